@@ -0,0 +1,187 @@
+// Command all-in-one runs the echo-api HTTP gateway and the upload and download
+// gRPC services in one process, talking over in-memory connections. It reads the
+// same configuration as the separate services, which remain the way to deploy
+// them apart in production, but defaults to a local SQLite database.
+package main
+
+import (
+	"context"
+	"errors"
+	"log"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/test/bufconn"
+
+	"echo-api/app"
+	"echo-api/clients"
+	"echo-api/db"
+	"file-service/config"
+	"file-service/download-service/download"
+	downloadstore "file-service/download-service/store"
+	"file-service/healthcheck"
+	"file-service/logging"
+	"file-service/metrics"
+	downloadpb "file-service/proto/download"
+	uploadpb "file-service/proto/upload"
+	"file-service/ratelimit"
+	"file-service/tracing"
+	uploadstore "file-service/upload-service/store"
+	"file-service/upload-service/upload"
+)
+
+// bufferSize is the in-memory buffer of each gRPC connection
+const bufferSize = 1 << 20
+
+func main() {
+	// Load and validate the configuration; without a database configured, keep
+	// everything in a local SQLite file
+	defaults := config.Defaults()
+	defaults.Database.Driver = config.SQLite
+	cfg, args, err := config.LoadWith("all-in-one", defaults, os.Args[1:])
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// Probe a running server, for container health checks
+	if len(args) > 0 && args[0] == "healthcheck" {
+		if err := healthcheck.ProbeHTTP(cfg.HTTP.Addr, "/readyz"); err != nil {
+			log.Fatalf("Unhealthy: %v", err)
+		}
+		return
+	}
+
+	// Log structured records from here on
+	if err := logging.Setup("all-in-one", cfg.Log); err != nil {
+		log.Fatal(err)
+	}
+
+	// Export traces; the gateway and the services report as one service
+	shutdownTracing, err := tracing.Setup(context.Background(), "all-in-one", cfg.Tracing)
+	if err != nil {
+		logging.Fatal("Failed to set up tracing", err)
+	}
+	defer shutdownTracing(context.Background())
+
+	// Initialize database, shared by the gateway and both services
+	db.Init(cfg.Database)
+	defer db.Close()
+
+	if err := app.Migrate(context.Background()); err != nil {
+		logging.Fatal("Failed to migrate database", err)
+	}
+
+	// Create upload directory
+	if err := os.MkdirAll(cfg.Storage.Dir, 0755); err != nil {
+		logging.Fatal("Failed to create upload directory", err)
+	}
+	if err := upload.PrepareStaging(cfg.Storage.Dir); err != nil {
+		logging.Fatal("Failed to prepare staging directory", err)
+	}
+
+	// On SIGINT or SIGTERM stop accepting requests and let in-flight ones finish
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	// Serve both gRPC services on in-memory listeners, sharing one health status
+	// and the buckets of the grpc rate limit policy
+	limiter := ratelimit.New(ratelimit.NewStore(cfg.RateLimit, db.DB, cfg.Database.QueryTimeout), func() []string {
+		return cfg.RateLimit.Policies
+	})
+	opts := append(append(metrics.ServerOptions(), logging.ServerOptions()...), tracing.ServerOption())
+	opts = append(opts, ratelimit.ServerOptions(limiter, "grpc", ratelimit.TokenSubject([]byte(cfg.Auth.JWTSecret)))...)
+	uploadListener := bufconn.Listen(bufferSize)
+	uploadServer := grpc.NewServer(opts...)
+	uploadpb.RegisterFileUploadServer(uploadServer,
+		upload.NewServer(cfg, uploadstore.NewSQL(db.DB, cfg.Database.QueryTimeout)))
+
+	downloadListener := bufconn.Listen(bufferSize)
+	downloadServer := grpc.NewServer(opts...)
+	downloadpb.RegisterFileDownloadServer(downloadServer,
+		download.NewServer(cfg, downloadstore.NewSQL(db.DB, cfg.Database.QueryTimeout)))
+
+	healthServer := health.NewServer()
+	healthpb.RegisterHealthServer(uploadServer, healthServer)
+	healthpb.RegisterHealthServer(downloadServer, healthServer)
+	go healthcheck.Watch(ctx, healthServer, map[string]healthcheck.Check{
+		"database": healthcheck.Database(db.DB),
+		"storage":  healthcheck.Writable(cfg.Storage.Dir),
+	}, uploadpb.FileUpload_ServiceDesc.ServiceName, downloadpb.FileDownload_ServiceDesc.ServiceName)
+
+	// Metrics for all three are served on the gateway's metrics port
+	metrics.RegisterStorage(cfg.Storage.Dir)
+	if cfg.HTTP.MetricsAddr != "" {
+		defer metrics.Serve(cfg.HTTP.MetricsAddr).Close()
+	}
+
+	go serveGRPC("Upload", uploadServer, uploadListener)
+	go serveGRPC("Download", downloadServer, downloadListener)
+
+	// Point the gateway's file client at the listeners, named by the target's address
+	listeners := map[string]*bufconn.Listener{"upload": uploadListener, "download": downloadListener}
+	dialer := grpc.WithContextDialer(func(ctx context.Context, addr string) (net.Conn, error) {
+		return listeners[addr].DialContext(ctx)
+	})
+	if err := clients.Connect("passthrough:///upload", "passthrough:///download", dialer); err != nil {
+		logging.Fatal("Failed to connect to file services", err)
+	}
+	defer clients.Close()
+
+	// Start the HTTP gateway; SIGHUP reloads the configuration
+	e := app.New(config.Watch(ctx, "all-in-one", cfg))
+	go func() {
+		slog.Info("HTTP server listening", "addr", cfg.HTTP.Addr)
+		if err := e.Start(cfg.HTTP.Addr); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			logging.Fatal("Failed to serve", err)
+		}
+	}()
+
+	// Drain the gateway first, then the RPCs it still has open, all within one deadline
+	<-ctx.Done()
+	deadline := time.Now().Add(cfg.Shutdown.DrainDelay + cfg.Shutdown.Timeout)
+	app.Shutdown(e, cfg.Shutdown)
+	healthServer.Shutdown()
+
+	done := make(chan struct{})
+	go func() {
+		stopGRPC(uploadServer, time.Until(deadline))
+		close(done)
+	}()
+	stopGRPC(downloadServer, time.Until(deadline))
+	<-done
+	upload.RemoveStaged()
+}
+
+// serveGRPC serves a gRPC service until it is stopped
+func serveGRPC(name string, s *grpc.Server, lis net.Listener) {
+	slog.Info("gRPC service listening in-process", "name", name)
+	if err := s.Serve(lis); err != nil {
+		slog.Error("gRPC service failed", "name", name, "error", err)
+		os.Exit(1)
+	}
+}
+
+// stopGRPC stops accepting RPCs and lets active ones finish for up to timeout,
+// then cancels the rest
+func stopGRPC(s *grpc.Server, timeout time.Duration) {
+	stopped := make(chan struct{})
+	go func() {
+		s.GracefulStop()
+		close(stopped)
+	}()
+
+	select {
+	case <-stopped:
+	case <-time.After(timeout):
+		s.Stop()
+		<-stopped
+	}
+}
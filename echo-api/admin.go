@@ -0,0 +1,205 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"echo-api/models"
+	"echo-api/store"
+	"echo-api/utils"
+)
+
+const adminUsage = `usage: echo-api admin users [-q search] [-role role] [-disabled | -enabled] [-limit n] [-offset n]
+       echo-api admin show <user>
+       echo-api admin disable <user>
+       echo-api admin enable <user>
+       echo-api admin role <user> <role>
+       echo-api admin reset-password <user>
+       echo-api admin usage [-limit n] [user]
+<user> is a username or user ID`
+
+// runAdmin handles the admin subcommand, which manages users directly in the
+// database. Changes are recorded as audit events without an actor.
+func runAdmin(repo *store.SQL, args []string) {
+	ctx := context.Background()
+	if len(args) == 0 {
+		adminUsageExit()
+	}
+	command, args := args[0], args[1:]
+
+	switch command {
+	case "users":
+		fs := flag.NewFlagSet("admin users", flag.ExitOnError)
+		f := models.UserFilter{}
+		fs.StringVar(&f.Query, "q", "", "part of the username, display name or email")
+		fs.StringVar(&f.Role, "role", "", "only users with this role")
+		disabled := fs.Bool("disabled", false, "only disabled users")
+		enabled := fs.Bool("enabled", false, "only users who are not disabled")
+		fs.IntVar(&f.Limit, "limit", 50, "users to list")
+		fs.IntVar(&f.Offset, "offset", 0, "users to skip")
+		fs.Parse(args)
+		if *disabled && *enabled {
+			adminUsageExit()
+		}
+		if *disabled || *enabled {
+			f.Disabled = disabled
+		}
+		users, err := repo.ListUsers(ctx, f)
+		if err != nil {
+			commandFailed("admin users", err)
+		}
+		for _, u := range users {
+			printUser(u)
+		}
+
+	case "show":
+		u := lookupUser(ctx, repo, command, args, 1)
+		printUser(*u)
+		usage, err := repo.StorageUsage(ctx, u.ID)
+		if err != nil {
+			commandFailed("admin show", err)
+		}
+		fmt.Printf("        %d files, %d bytes\n", usage.Files, usage.Bytes)
+
+	case "disable", "enable":
+		u := lookupUser(ctx, repo, command, args, 1)
+		disable := command == "disable"
+		changed, err := repo.SetDisabled(ctx, u.ID, disable, time.Now())
+		if err != nil {
+			commandFailed("admin "+command, err)
+		}
+		if !changed {
+			fmt.Printf("%s is already %sd\n", u.Username, command)
+			return
+		}
+		event, details := models.EventAccountEnabled, map[string]interface{}{"username": u.Username}
+		if disable {
+			event = models.EventAccountDisabled
+			n, err := repo.DeleteSessions(ctx, u.ID, 0)
+			if err != nil {
+				commandFailed("admin disable", err)
+			}
+			details["revoked_sessions"] = n
+		}
+		auditCommand(ctx, repo, event, u.ID, details)
+		fmt.Printf("%sd %s\n", command, u.Username)
+
+	case "role":
+		u := lookupUser(ctx, repo, command, args, 2)
+		role := args[1]
+		if !slices.Contains(models.Roles, role) {
+			commandFailed("admin role", fmt.Errorf("unknown role %q; roles are %s", role, strings.Join(models.Roles, ", ")))
+		}
+		if u.Role == role {
+			fmt.Printf("%s already has role %s\n", u.Username, role)
+			return
+		}
+		if err := repo.SetRole(ctx, u.ID, role); err != nil {
+			commandFailed("admin role", err)
+		}
+		if _, err := repo.DeleteSessions(ctx, u.ID, 0); err != nil {
+			commandFailed("admin role", err)
+		}
+		auditCommand(ctx, repo, models.EventRoleChanged, u.ID,
+			map[string]interface{}{"username": u.Username, "old_role": u.Role, "role": role})
+		fmt.Printf("%s now has role %s\n", u.Username, role)
+
+	case "reset-password":
+		u := lookupUser(ctx, repo, command, args, 1)
+		password, err := utils.NewToken()
+		var hash string
+		if err == nil {
+			hash, err = utils.HashPassword(password)
+		}
+		if err == nil {
+			err = repo.SetPassword(ctx, u.ID, hash)
+		}
+		if err == nil {
+			err = repo.DeleteTokens(ctx, u.ID, models.TokenResetPassword)
+		}
+		if err == nil {
+			_, err = repo.DeleteSessions(ctx, u.ID, 0)
+		}
+		if err != nil {
+			commandFailed("admin reset-password", err)
+		}
+		auditCommand(ctx, repo, models.EventAdminPasswordReset, u.ID,
+			map[string]interface{}{"username": u.Username, "generated": true})
+		fmt.Printf("new password of %s: %s\n", u.Username, password)
+
+	case "usage":
+		fs := flag.NewFlagSet("admin usage", flag.ExitOnError)
+		limit := fs.Int("limit", 50, "users to list")
+		fs.Parse(args)
+		var usage []models.StorageUsage
+		if fs.NArg() > 0 {
+			u := lookupUser(ctx, repo, command, fs.Args(), 1)
+			s, err := repo.StorageUsage(ctx, u.ID)
+			if err != nil {
+				commandFailed("admin usage", err)
+			}
+			usage = append(usage, *s)
+		} else {
+			var err error
+			if usage, err = repo.ListStorageUsage(ctx, *limit); err != nil {
+				commandFailed("admin usage", err)
+			}
+		}
+		for _, s := range usage {
+			fmt.Printf("%6d  %-32s %8d files %14d bytes\n", s.UserID, s.Username, s.Files, s.Bytes)
+		}
+
+	default:
+		adminUsageExit()
+	}
+}
+
+// lookupUser returns the user named by the first of exactly n arguments,
+// a username or a user ID, exiting if there is none
+func lookupUser(ctx context.Context, repo *store.SQL, command string, args []string, n int) *models.User {
+	if len(args) != n {
+		adminUsageExit()
+	}
+	u, err := repo.GetUserByUsername(ctx, args[0])
+	if id, convErr := strconv.Atoi(args[0]); errors.Is(err, store.ErrNotFound) && convErr == nil {
+		u, err = repo.GetUser(ctx, id)
+	}
+	if errors.Is(err, store.ErrNotFound) {
+		err = fmt.Errorf("no user %q", args[0])
+	}
+	if err != nil {
+		commandFailed("admin "+command, err)
+	}
+	return u
+}
+
+// printUser prints one line about a user
+func printUser(u models.User) {
+	status := "active"
+	if u.Disabled {
+		status = "disabled"
+	}
+	fmt.Printf("%6d  %-32s %-6s %-8s %s\n", u.ID, u.Username, u.Role, status, u.Email)
+}
+
+// auditCommand records a change made with the admin subcommand
+func auditCommand(ctx context.Context, repo *store.SQL, event string, userID int, details map[string]interface{}) {
+	details["via"] = "cli"
+	e := &models.AuditEvent{Event: event, UserID: &userID, Details: details}
+	if err := repo.RecordEvent(ctx, e); err != nil {
+		fmt.Fprintf(os.Stderr, "audit event %s not recorded: %v\n", event, err)
+	}
+}
+
+// adminUsageExit prints the usage of the admin subcommand and exits
+func adminUsageExit() {
+	fmt.Fprintln(os.Stderr, adminUsage)
+	os.Exit(2)
+}
@@ -0,0 +1,166 @@
+// Package app assembles the echo-api HTTP gateway, so that it can run on its
+// own or in one process with the file services.
+package app
+
+import (
+	"context"
+	"log/slog"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/echo/v4/middleware"
+	"go.opentelemetry.io/contrib/instrumentation/github.com/labstack/echo/otelecho"
+	"echo-api/clients"
+	"echo-api/db"
+	"echo-api/handlers"
+	"echo-api/mailer"
+	auth "echo-api/middleware"
+	"echo-api/migrations"
+	"echo-api/oidc"
+	"echo-api/problem"
+	"echo-api/routes"
+	"echo-api/store"
+	"echo-api/utils"
+	"file-service/config"
+	"file-service/healthcheck"
+	"file-service/metrics"
+	"file-service/ratelimit"
+)
+
+// Migrate brings the schema up to date; the migration lock makes concurrent starts safe
+func Migrate(ctx context.Context) error {
+	ran, err := migrations.Up(ctx, db.DB, db.Driver)
+	if err != nil {
+		return err
+	}
+	for _, m := range ran {
+		slog.Info("Applied migration", "version", m.Version, "name", m.Name)
+	}
+	return nil
+}
+
+// New wires the handlers to the stores on db.DB and the file services connected
+// by clients.Connect, and returns the Echo server with
+// its middleware and routes. CORS origins follow reloads of the configuration.
+func New(live *config.Live) *echo.Echo {
+	cfg := live.Get()
+	repo := store.NewSQL(db.DB, cfg.Database.QueryTimeout)
+	handlers.Users = repo
+	handlers.Orgs = repo
+	handlers.Logins = repo
+	handlers.Audit = repo
+	handlers.MFA = repo
+	handlers.Lockout = cfg.Lockout
+	handlers.MFASettings = func() config.MFA { return live.Get().MFA }
+	handlers.Tokens = repo
+	handlers.Mail = cfg.Mail
+	handlers.Mailer = mailer.New(cfg.Mail)
+	handlers.PublicURL = cfg.HTTP.PublicURL
+	handlers.Identities = repo
+	handlers.OIDC = cfg.OIDC
+	handlers.OIDCProviders = oidcProviders(cfg.OIDC)
+	handlers.Keys = repo
+	handlers.APIKeys = cfg.APIKeys
+	handlers.Sessions = repo
+	handlers.TempDir = cfg.HTTP.TempDir
+	handlers.ReadinessChecks = clients.Checks()
+	handlers.ReadinessChecks["database"] = healthcheck.Database(db.DB)
+	metrics.RegisterDB(db.DB, "echo_api")
+	utils.JWTSecret = []byte(cfg.Auth.JWTSecret)
+	utils.URLSigningSecret = []byte(cfg.Auth.URLSigningSecret)
+
+	// Rate limits follow reloads of their policies
+	limiter := ratelimit.New(ratelimit.NewStore(cfg.RateLimit, db.DB, cfg.Database.QueryTimeout), func() []string {
+		return live.Get().RateLimit.Policies
+	})
+
+	// Failures older than the lockout window no longer count, and expired
+	// sessions no longer have valid tokens
+	go func() {
+		for range time.Tick(time.Hour) {
+			handlers.PruneLoginFailures(context.Background())
+			handlers.PruneSessions(context.Background())
+		}
+	}()
+
+	// Echo setup. Client IPs are taken from X-Forwarded-For only when it was
+	// set by a proxy on a private network, so clients cannot pick their own
+	// rate limit bucket.
+	e := echo.New()
+	e.HideBanner, e.HidePort = true, true
+	e.HTTPErrorHandler = problem.Handler
+	e.IPExtractor = echo.ExtractIPFromXFFHeader()
+	e.Use(otelecho.Middleware("echo-api", otelecho.WithSkipper(probe)))
+	e.Use(auth.RequestID)
+	e.Use(auth.Log)
+	e.Use(auth.Metrics)
+	e.Use(auth.Recover)
+
+	// Configure CORS
+	e.Use(middleware.CORSWithConfig(middleware.CORSConfig{
+		AllowOriginFunc: func(origin string) (bool, error) {
+			return slices.Contains(live.Get().HTTP.CORSOrigins, origin) ||
+				slices.Contains(live.Get().HTTP.CORSOrigins, "*"), nil
+		},
+		AllowMethods:  []string{echo.GET, echo.PUT, echo.PATCH, echo.POST, echo.DELETE, echo.OPTIONS},
+		AllowHeaders:  []string{echo.HeaderOrigin, echo.HeaderContentType, echo.HeaderAccept, echo.HeaderAuthorization},
+		ExposeHeaders: []string{"RateLimit-Limit", "RateLimit-Remaining", "RateLimit-Reset", "RateLimit-Policy", echo.HeaderRetryAfter},
+	}))
+
+	// Every client IP has a bucket on top of those of the routes
+	ipLimit := auth.RateLimit(limiter, "ip", auth.ByIP)
+	e.Use(func(next echo.HandlerFunc) echo.HandlerFunc {
+		limited := ipLimit(next)
+		return func(c echo.Context) error {
+			if probe(c) {
+				return next(c)
+			}
+			return limited(c)
+		}
+	})
+
+	// Setup routes
+	routes.Setup(e, cfg.HTTP.MaxUploadSize, limiter)
+	return e
+}
+
+// oidcProviders returns the configured single sign-on providers, which send
+// users back to their callback route under the redirect URL
+func oidcProviders(cfg config.OIDC) map[string]*oidc.Provider {
+	configured, _ := cfg.ParseProviders() // Validated when loaded
+	providers := make(map[string]*oidc.Provider, len(configured))
+	for name, p := range configured {
+		callback := strings.TrimSuffix(cfg.RedirectURL, "/") + "/auth/oidc/" + name + "/callback"
+		providers[name] = oidc.New(p, callback, cfg.Scopes)
+	}
+	return providers
+}
+
+// probe reports whether a request is a health probe. They are not traced,
+// since they would swamp real requests, nor rate limited.
+func probe(c echo.Context) bool {
+	switch c.Request().URL.Path {
+	case "/healthz", "/readyz":
+		return true
+	}
+	return false
+}
+
+// Shutdown drains e: readiness reports draining for the drain delay, then new
+// requests are refused and in-flight ones get until the timeout to finish. Temp
+// files of requests cut off at the timeout are removed.
+func Shutdown(e *echo.Echo, cfg config.Shutdown) {
+	handlers.SetDraining()
+	slog.Info("Draining HTTP server")
+	time.Sleep(cfg.DrainDelay)
+
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.Timeout)
+	defer cancel()
+	if err := e.Shutdown(ctx); err != nil {
+		slog.Warn("HTTP shutdown incomplete; closing remaining connections", "error", err)
+		e.Close()
+	}
+	handlers.RemoveTempFiles()
+}
@@ -2,16 +2,19 @@ package clients
 
 import (
 	"context"
+	"errors"
 	"io"
-	"log"
 	"os"
 
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/credentials/insecure"
 	"google.golang.org/grpc/metadata"
 
-	uploadpb "echo-api/proto/upload"
-    downloadpb "echo-api/proto/download"
+	"file-service/healthcheck"
+	"file-service/logging"
+	"file-service/tracing"
+	uploadpb "file-service/proto/upload"
+	downloadpb "file-service/proto/download"
 )
 
 type FileClient struct {
@@ -19,17 +22,55 @@ type FileClient struct {
 	downloadClient downloadpb.FileDownloadClient
 }
 
-func NewFileClient() (*FileClient, error) {
-	// Connect to upload service
-	uploadConn, err := grpc.Dial("localhost:50051", grpc.WithTransportCredentials(insecure.NewCredentials()))
-	if err != nil {
-		return nil, err
+// logger logs the progress of transfers for the clients component
+var logger = logging.For("clients")
+
+// Connections to the file services, shared by every FileClient
+var uploadConn, downloadConn *grpc.ClientConn
+
+// Connect opens the connections to the upload and download services that
+// NewFileClient uses. Extra options, such as a custom dialer, let the services
+// run in the same process. RPCs carry the trace context and request ID of
+// their caller.
+func Connect(uploadTarget, downloadTarget string, opts ...grpc.DialOption) error {
+	opts = append(append([]grpc.DialOption{
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		tracing.DialOption(),
+	}, logging.DialOptions()...), opts...)
+
+	var err error
+	if uploadConn, err = grpc.NewClient(uploadTarget, opts...); err != nil {
+		return err
 	}
+	if downloadConn, err = grpc.NewClient(downloadTarget, opts...); err != nil {
+		uploadConn.Close()
+		return err
+	}
+	return nil
+}
 
-	// Connect to download service
-	downloadConn, err := grpc.Dial("localhost:50052", grpc.WithTransportCredentials(insecure.NewCredentials()))
-	if err != nil {
-		return nil, err
+// Close closes the connections opened by Connect
+func Close() {
+	if uploadConn != nil {
+		uploadConn.Close()
+	}
+	if downloadConn != nil {
+		downloadConn.Close()
+	}
+}
+
+// Checks returns readiness checks of the file services, reached over the
+// connections opened by Connect
+func Checks() map[string]healthcheck.Check {
+	return map[string]healthcheck.Check{
+		"upload_service":   healthcheck.GRPC(uploadConn, ""),
+		"download_service": healthcheck.GRPC(downloadConn, ""),
+	}
+}
+
+func NewFileClient() (*FileClient, error) {
+	if uploadConn == nil || downloadConn == nil {
+		return nil, errors.New("file services are not connected")
 	}
 
 	return &FileClient{
@@ -38,8 +79,8 @@ func NewFileClient() (*FileClient, error) {
 	}, nil
 }
 
-// UploadFile uploads a file to the upload service
-func (c *FileClient) UploadFile(ctx context.Context, filePath string, token string) (*uploadpb.UploadFileResponse, error) {
+// UploadFile uploads a file to the upload service, into folderID if it is not empty
+func (c *FileClient) UploadFile(ctx context.Context, filePath string, folderID string, token string) (*uploadpb.UploadFileResponse, error) {
 	// Add token to context
 	ctx = metadata.AppendToOutgoingContext(ctx, "authorization", token)
 
@@ -69,6 +110,7 @@ func (c *FileClient) UploadFile(ctx context.Context, filePath string, token stri
 				Filename:    fileInfo.Name(),
 				ContentType: "application/octet-stream", // TODO: Implement proper content type detection
 				Size:       fileInfo.Size(),
+				FolderId:    folderID,
 			},
 		},
 	})
@@ -136,7 +178,7 @@ func (c *FileClient) DownloadFile(ctx context.Context, fileID string, token stri
 
 		// Handle metadata
 		if metadata := resp.GetMetadata(); metadata != nil {
-			log.Printf("Downloading file: %s (%d bytes)", metadata.Filename, metadata.Size)
+			logger.DebugContext(ctx, "Downloading file", "file_id", metadata.FileId, "size", metadata.Size)
 			continue
 		}
 
@@ -152,14 +194,161 @@ func (c *FileClient) DownloadFile(ctx context.Context, fileID string, token stri
 	return nil
 }
 
-// ListFiles lists all files for a user
-func (c *FileClient) ListFiles(ctx context.Context, token string) (*downloadpb.ListFilesResponse, error) {
+// ListFiles lists all files owned by a user, or shared with them if sharedWithMe is set
+func (c *FileClient) ListFiles(ctx context.Context, token string, sharedWithMe bool) (*downloadpb.ListFilesResponse, error) {
 	// Add token to context
 	ctx = metadata.AppendToOutgoingContext(ctx, "authorization", token)
 
 	// Create list request
-	req := &downloadpb.ListFilesRequest{}
+	req := &downloadpb.ListFilesRequest{
+		SharedWithMe: sharedWithMe,
+	}
 
 	// Get file list
 	return c.downloadClient.ListFiles(ctx, req)
-} 
\ No newline at end of file
+}
+
+// ListOwnedFiles lists the files the user uploaded, in every organization
+func (c *FileClient) ListOwnedFiles(ctx context.Context, token string) (*downloadpb.ListFilesResponse, error) {
+	// Add token to context
+	ctx = metadata.AppendToOutgoingContext(ctx, "authorization", token)
+
+	return c.downloadClient.ListFiles(ctx, &downloadpb.ListFilesRequest{Owned: true})
+}
+
+// GetStorageUsage returns the user's used and remaining storage
+func (c *FileClient) GetStorageUsage(ctx context.Context, token string) (*uploadpb.StorageUsage, error) {
+	// Add token to context
+	ctx = metadata.AppendToOutgoingContext(ctx, "authorization", token)
+
+	return c.uploadClient.GetStorageUsage(ctx, &uploadpb.GetStorageUsageRequest{})
+}
+
+// CreateShareLink creates a public link to one of the user's files
+func (c *FileClient) CreateShareLink(ctx context.Context, token string, req *downloadpb.CreateShareLinkRequest) (*downloadpb.ShareLink, error) {
+	// Add token to context
+	ctx = metadata.AppendToOutgoingContext(ctx, "authorization", token)
+
+	return c.downloadClient.CreateShareLink(ctx, req)
+}
+
+// ListShareLinks lists the user's active share links
+func (c *FileClient) ListShareLinks(ctx context.Context, token string) (*downloadpb.ListShareLinksResponse, error) {
+	// Add token to context
+	ctx = metadata.AppendToOutgoingContext(ctx, "authorization", token)
+
+	return c.downloadClient.ListShareLinks(ctx, &downloadpb.ListShareLinksRequest{})
+}
+
+// RevokeShareLink revokes one of the user's share links
+func (c *FileClient) RevokeShareLink(ctx context.Context, token string, shareID string) error {
+	// Add token to context
+	ctx = metadata.AppendToOutgoingContext(ctx, "authorization", token)
+
+	_, err := c.downloadClient.RevokeShareLink(ctx, &downloadpb.RevokeShareLinkRequest{Id: shareID})
+	return err
+}
+
+// DownloadSharedFile streams a shared file to w. onMetadata is called before any data is written.
+func (c *FileClient) DownloadSharedFile(ctx context.Context, shareToken string, password string, w io.Writer, onMetadata func(*downloadpb.FileMetadata)) error {
+	// Start download stream
+	stream, err := c.downloadClient.DownloadSharedFile(ctx, &downloadpb.DownloadSharedFileRequest{
+		Token:    shareToken,
+		Password: password,
+	})
+	if err != nil {
+		return err
+	}
+
+	return receiveFile(stream, w, onMetadata)
+}
+
+// DownloadSignedFile streams a file authorized by a signed URL instead of a JWT
+func (c *FileClient) DownloadSignedFile(ctx context.Context, fileID string, signed *downloadpb.SignedAccess, w io.Writer, onMetadata func(*downloadpb.FileMetadata)) error {
+	// Start download stream
+	stream, err := c.downloadClient.DownloadFile(ctx, &downloadpb.DownloadFileRequest{
+		FileId: fileID,
+		Signed: signed,
+	})
+	if err != nil {
+		return err
+	}
+
+	return receiveFile(stream, w, onMetadata)
+}
+
+// fileReceiver is implemented by the client streams of the download RPCs
+type fileReceiver interface {
+	Recv() (*downloadpb.DownloadFileResponse, error)
+}
+
+// receiveFile writes a download stream to w, passing the leading metadata to onMetadata
+func receiveFile(stream fileReceiver, w io.Writer, onMetadata func(*downloadpb.FileMetadata)) error {
+	// Receive file chunks
+	for {
+		resp, err := stream.Recv()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		// Handle metadata
+		if metadata := resp.GetMetadata(); metadata != nil {
+			onMetadata(metadata)
+			continue
+		}
+
+		// Write chunk to output
+		if chunk := resp.GetChunk(); chunk != nil {
+			if _, err := w.Write(chunk); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// CreateFolder creates a folder, inside parentID if it is not empty
+func (c *FileClient) CreateFolder(ctx context.Context, token string, name string, parentID string) (*uploadpb.Folder, error) {
+	// Add token to context
+	ctx = metadata.AppendToOutgoingContext(ctx, "authorization", token)
+
+	return c.uploadClient.CreateFolder(ctx, &uploadpb.CreateFolderRequest{
+		Name:     name,
+		ParentId: parentID,
+	})
+}
+
+// GrantAccess shares a file or folder with another user
+func (c *FileClient) GrantAccess(ctx context.Context, token string, req *downloadpb.GrantAccessRequest) (*downloadpb.Grant, error) {
+	// Add token to context
+	ctx = metadata.AppendToOutgoingContext(ctx, "authorization", token)
+
+	return c.downloadClient.GrantAccess(ctx, req)
+}
+
+// RevokeAccess removes another user's access to a file or folder
+func (c *FileClient) RevokeAccess(ctx context.Context, token string, req *downloadpb.RevokeAccessRequest) error {
+	// Add token to context
+	ctx = metadata.AppendToOutgoingContext(ctx, "authorization", token)
+
+	_, err := c.downloadClient.RevokeAccess(ctx, req)
+	return err
+}
+
+// ListGrants lists the users a file or folder is shared with
+func (c *FileClient) ListGrants(ctx context.Context, token string, req *downloadpb.ListGrantsRequest) (*downloadpb.ListGrantsResponse, error) {
+	// Add token to context
+	ctx = metadata.AppendToOutgoingContext(ctx, "authorization", token)
+
+	return c.downloadClient.ListGrants(ctx, req)
+}
+
+// ReleaseUserFiles transfers or deletes the user's files before their account is deleted
+func (c *FileClient) ReleaseUserFiles(ctx context.Context, token string, req *uploadpb.ReleaseUserFilesRequest) (*uploadpb.ReleaseUserFilesResponse, error) {
+	// Add token to context
+	ctx = metadata.AppendToOutgoingContext(ctx, "authorization", token)
+
+	return c.uploadClient.ReleaseUserFiles(ctx, req)
+}
@@ -1,25 +1,58 @@
 package db
 
 import (
-	"context"
-	"log"
-	"os"
+	"database/sql"
+	"strings"
 
-	"github.com/jackc/pgx/v5/pgxpool"
+	_ "github.com/jackc/pgx/v5/stdlib"
+	_ "modernc.org/sqlite"
+	"file-service/config"
+	"file-service/logging"
+	"file-service/tracing"
 )
 
-var DB *pgxpool.Pool
+// Drivers accepted in database.driver
+const (
+	Postgres = config.Postgres
+	SQLite   = config.SQLite
+)
+
+var (
+	DB     *sql.DB
+	Driver string
+)
+
+// Init opens the configured database: Postgres at its URL, or an embedded
+// SQLite file. The configuration has already been validated.
+func Init(cfg config.Database) {
+	driverName, dsn, system := "pgx", cfg.URL, "postgresql"
+	if cfg.Driver == SQLite {
+		driverName, dsn, system = "sqlite", SQLiteDSN(cfg.URL), "sqlite"
+	}
 
-func Init() {
 	var err error
-	DB, err = pgxpool.New(context.Background(), os.Getenv("DB_URL"))
+	DB, err = tracing.OpenDB(driverName, dsn, system)
 	if err != nil {
-		log.Fatal(err)
+		logging.Fatal("Failed to open database", err)
 	}
+	Driver = cfg.Driver
+}
+
+// SQLiteDSN adds the connection settings the stores rely on to a SQLite path:
+// foreign keys, waiting on a busy database instead of failing, WAL so readers
+// do not block the writer, write locks taken when a transaction begins rather
+// than on its first write, and timestamps stored in a sortable text format
+func SQLiteDSN(path string) string {
+	sep := "?"
+	if strings.Contains(path, "?") {
+		sep = "&"
+	}
+	return path + sep + "_pragma=foreign_keys(1)&_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)" +
+		"&_txlock=immediate&_time_format=sqlite"
 }
 
 func Close() {
 	if DB != nil {
 		DB.Close()
 	}
-} 
\ No newline at end of file
+}
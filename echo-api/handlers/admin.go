@@ -0,0 +1,361 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"google.golang.org/grpc/codes"
+	"echo-api/mailer"
+	"echo-api/models"
+	"echo-api/store"
+	"echo-api/utils"
+	"file-service/apperr"
+)
+
+// impersonationTTL is how long an admin can act as a user with one token
+const impersonationTTL = time.Hour
+
+// Page sizes of the admin listings
+const (
+	defaultPageSize = 50
+	maxPageSize     = 500
+)
+
+// intParam reads a non-negative integer query parameter, def if it is missing
+func intParam(c echo.Context, name string, def, max int) (int, error) {
+	v := c.QueryParam(name)
+	if v == "" {
+		return def, nil
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil || n < 0 || n > max {
+		return 0, badRequest(fmt.Sprintf("%s must be a number from 0 to %d", name, max))
+	}
+	return n, nil
+}
+
+// targetUser loads the user of the :id parameter of an admin route
+func targetUser(c echo.Context) (*models.User, error) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return nil, badRequest("invalid user id")
+	}
+
+	ctx := c.Request().Context()
+	user, err := Users.GetUser(ctx, id)
+	if errors.Is(err, store.ErrNotFound) {
+		return nil, apperr.New(codes.NotFound, apperr.UserNotFound, "user not found")
+	}
+	if err != nil {
+		logger.ErrorContext(ctx, "User query failed", "error", err)
+		return nil, apperr.New(codes.Internal, apperr.Internal, "could not load user")
+	}
+	return user, nil
+}
+
+// notOwnAccount refuses admins changing their own account through the admin
+// routes, so that there is always an admin left to undo a change
+func notOwnAccount(c echo.Context, user *models.User) error {
+	if user.ID == utils.UserID(c) {
+		return apperr.New(codes.FailedPrecondition, apperr.OwnAccount, "admins cannot do this to their own account")
+	}
+	return nil
+}
+
+// ListUsers lists the users matching ?q= in their username, display name or
+// email, filtered by ?role= and ?disabled=true or false, a page of ?limit=
+// users at a time from ?offset=
+func ListUsers(c echo.Context) error {
+	f := models.UserFilter{Query: strings.TrimSpace(c.QueryParam("q")), Role: c.QueryParam("role")}
+	if f.Role != "" && !slices.Contains(models.Roles, f.Role) {
+		return badRequest(fmt.Sprintf("unknown role %q; roles are %s", f.Role, strings.Join(models.Roles, ", ")))
+	}
+	switch c.QueryParam("disabled") {
+	case "":
+	case "true", "false":
+		disabled := c.QueryParam("disabled") == "true"
+		f.Disabled = &disabled
+	default:
+		return badRequest("disabled must be true or false")
+	}
+	var err error
+	if f.Limit, err = intParam(c, "limit", defaultPageSize, maxPageSize); err != nil {
+		return err
+	}
+	if f.Offset, err = intParam(c, "offset", 0, 1<<31-1); err != nil {
+		return err
+	}
+
+	ctx := c.Request().Context()
+	users, err := Users.ListUsers(ctx, f)
+	if err != nil {
+		logger.ErrorContext(ctx, "User query failed", "error", err)
+		return apperr.New(codes.Internal, apperr.Internal, "could not list users")
+	}
+	return c.JSON(http.StatusOK, users)
+}
+
+// GetUser returns a user with the organizations they belong to
+func GetUser(c echo.Context) error {
+	user, err := targetUser(c)
+	if err != nil {
+		return err
+	}
+	ctx := c.Request().Context()
+	orgs, err := Orgs.ListOrganizations(ctx, user.ID)
+	if err != nil {
+		logger.ErrorContext(ctx, "Organization query failed", "error", err)
+		return apperr.New(codes.Internal, apperr.Internal, "could not list organizations")
+	}
+	return c.JSON(http.StatusOK, struct {
+		*models.User
+		Organizations []models.Organization `json:"organizations"`
+	}{user, orgs})
+}
+
+// setDisabled disables or enables the user of the request, auditing it if
+// anything changed. Disabling logs them out everywhere.
+func setDisabled(c echo.Context, disabled bool) error {
+	user, err := targetUser(c)
+	if err != nil {
+		return err
+	}
+	if err := notOwnAccount(c, user); err != nil {
+		return err
+	}
+
+	ctx := c.Request().Context()
+	changed, err := Users.SetDisabled(ctx, user.ID, disabled, time.Now())
+	if err != nil {
+		logger.ErrorContext(ctx, "Updating user failed", "error", err)
+		return apperr.New(codes.Internal, apperr.Internal, "could not update user")
+	}
+	if !changed {
+		return c.NoContent(http.StatusNoContent)
+	}
+
+	event := models.EventAccountEnabled
+	details := map[string]interface{}{"username": user.Username}
+	if disabled {
+		event = models.EventAccountDisabled
+		n, err := Sessions.DeleteSessions(ctx, user.ID, 0)
+		if err != nil {
+			logger.WarnContext(ctx, "Revoking sessions failed", "error", err)
+		}
+		details["revoked_sessions"] = n
+	}
+	audit(c, models.AuditEvent{Event: event, UserID: &user.ID, Details: details})
+	return c.NoContent(http.StatusNoContent)
+}
+
+// DisableUser stops a user from logging in or using their API keys, and logs
+// them out everywhere
+func DisableUser(c echo.Context) error {
+	return setDisabled(c, true)
+}
+
+// EnableUser lets a disabled user log in again
+func EnableUser(c echo.Context) error {
+	return setDisabled(c, false)
+}
+
+// SetUserRole gives a user another role. Their sessions are logged out, since
+// their tokens carry the old one, which CheckSession refuses in any case.
+func SetUserRole(c echo.Context) error {
+	var req struct {
+		Role string `json:"role"`
+	}
+	if err := c.Bind(&req); err != nil {
+		return err
+	}
+	if !slices.Contains(models.Roles, req.Role) {
+		return badRequest(fmt.Sprintf("unknown role %q; roles are %s", req.Role, strings.Join(models.Roles, ", ")))
+	}
+	user, err := targetUser(c)
+	if err != nil {
+		return err
+	}
+	if err := notOwnAccount(c, user); err != nil {
+		return err
+	}
+	if user.Role == req.Role {
+		return c.JSON(http.StatusOK, user)
+	}
+
+	ctx := c.Request().Context()
+	if err := Users.SetRole(ctx, user.ID, req.Role); err != nil {
+		logger.ErrorContext(ctx, "Updating user failed", "error", err)
+		return apperr.New(codes.Internal, apperr.Internal, "could not update user")
+	}
+	if _, err := Sessions.DeleteSessions(ctx, user.ID, 0); err != nil {
+		logger.WarnContext(ctx, "Revoking sessions failed", "error", err)
+	}
+	audit(c, models.AuditEvent{
+		Event:   models.EventRoleChanged,
+		UserID:  &user.ID,
+		Details: map[string]interface{}{"username": user.Username, "old_role": user.Role, "role": req.Role},
+	})
+	user.Role = req.Role
+	return c.JSON(http.StatusOK, user)
+}
+
+// ResetUserPassword sets a user's password to the one given, or to a random
+// one returned once. The user is logged out everywhere, any lockout is lifted,
+// and they are told by email.
+func ResetUserPassword(c echo.Context) error {
+	var req struct {
+		Password string `json:"password"`
+	}
+	if err := c.Bind(&req); err != nil {
+		return err
+	}
+	generated := req.Password == ""
+	if generated {
+		password, err := utils.NewToken()
+		if err != nil {
+			return err
+		}
+		req.Password = password
+	} else if err := validatePassword(req.Password); err != nil {
+		return err
+	}
+	user, err := targetUser(c)
+	if err != nil {
+		return err
+	}
+	if err := notOwnAccount(c, user); err != nil {
+		return err
+	}
+
+	ctx := c.Request().Context()
+	hash, err := utils.HashPassword(req.Password)
+	if err == nil {
+		err = Users.SetPassword(ctx, user.ID, hash)
+	}
+	if err != nil {
+		logger.ErrorContext(ctx, "Password reset failed", "error", err)
+		return apperr.New(codes.Internal, apperr.Internal, "could not reset password")
+	}
+
+	if err := Tokens.DeleteTokens(ctx, user.ID, models.TokenResetPassword); err != nil {
+		logger.WarnContext(ctx, "Deleting tokens failed", "error", err)
+	}
+	if _, err := Logins.ClearLoginFailures(ctx, accountKey(user.Username)); err != nil {
+		logger.WarnContext(ctx, "Clearing login failures failed", "error", err)
+	}
+	if _, err := Sessions.DeleteSessions(ctx, user.ID, 0); err != nil {
+		logger.WarnContext(ctx, "Revoking sessions failed", "error", err)
+	}
+	audit(c, models.AuditEvent{
+		Event:   models.EventAdminPasswordReset,
+		UserID:  &user.ID,
+		Details: map[string]interface{}{"username": user.Username, "generated": generated},
+	})
+
+	if user.Email != "" {
+		sendMail(ctx, mailer.Message{
+			To:      user.Email,
+			Subject: "Your password was changed",
+			Body: fmt.Sprintf("Hi %s,\n\nan administrator just reset the password of your account. "+
+				"Ask them for the new one, or reset it yourself.\n", user.Username),
+		})
+	}
+	if generated {
+		return c.JSON(http.StatusOK, map[string]string{"password": req.Password})
+	}
+	return c.NoContent(http.StatusNoContent)
+}
+
+// ImpersonateUser returns a token that acts as the user, in their default
+// organization, for an hour, so that support can see what they see. The
+// reason is audited, and so is everything done with the token, as the admin's.
+// It starts a session the user can see, and cannot change how they log in.
+// Admins and disabled users cannot be impersonated.
+func ImpersonateUser(c echo.Context) error {
+	var req struct {
+		Reason string `json:"reason"`
+	}
+	if err := c.Bind(&req); err != nil {
+		return err
+	}
+	req.Reason = strings.TrimSpace(req.Reason)
+	if req.Reason == "" || len(req.Reason) > 200 {
+		return badRequest("reason is required and must be at most 200 characters")
+	}
+	user, err := targetUser(c)
+	if err != nil {
+		return err
+	}
+	if err := notOwnAccount(c, user); err != nil {
+		return err
+	}
+	if user.Role == models.RoleAdmin || user.Disabled || user.Deleting {
+		return apperr.New(codes.PermissionDenied, apperr.ImpersonationDenied, "admins and disabled users cannot be impersonated")
+	}
+
+	ctx := c.Request().Context()
+	orgID, err := Orgs.DefaultOrganization(ctx, user.ID, user.Username)
+	if err != nil {
+		logger.ErrorContext(ctx, "Impersonation failed", "error", err)
+		return apperr.New(codes.Internal, apperr.Internal, "could not load organization")
+	}
+	sessionID, err := startSession(c, user.ID, impersonationTTL)
+	if err != nil {
+		logger.ErrorContext(ctx, "Impersonation failed", "error", err)
+		return apperr.New(codes.Internal, apperr.Internal, "could not start session")
+	}
+	t, err := utils.GenerateImpersonationToken(user.ID, user.Role, orgID, sessionID, utils.MFA(c), utils.UserID(c), impersonationTTL)
+	if err != nil {
+		return err
+	}
+
+	audit(c, models.AuditEvent{
+		Event:   models.EventImpersonationStarted,
+		UserID:  &user.ID,
+		Details: map[string]interface{}{"username": user.Username, "reason": req.Reason, "session_id": sessionID},
+	})
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"token":      t,
+		"expires_in": int(impersonationTTL.Seconds()),
+	})
+}
+
+// GetUserStorageUsage returns how many files a user uploaded and their total size
+func GetUserStorageUsage(c echo.Context) error {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return badRequest("invalid user id")
+	}
+	ctx := c.Request().Context()
+	usage, err := Users.StorageUsage(ctx, id)
+	if errors.Is(err, store.ErrNotFound) {
+		return apperr.New(codes.NotFound, apperr.UserNotFound, "user not found")
+	}
+	if err != nil {
+		logger.ErrorContext(ctx, "Storage usage query failed", "error", err)
+		return apperr.New(codes.Internal, apperr.Internal, "could not load storage usage")
+	}
+	return c.JSON(http.StatusOK, usage)
+}
+
+// ListStorageUsage returns the storage usage of the ?limit= users who
+// uploaded the most
+func ListStorageUsage(c echo.Context) error {
+	limit, err := intParam(c, "limit", defaultPageSize, maxPageSize)
+	if err != nil {
+		return err
+	}
+	ctx := c.Request().Context()
+	usage, err := Users.ListStorageUsage(ctx, limit)
+	if err != nil {
+		logger.ErrorContext(ctx, "Storage usage query failed", "error", err)
+		return apperr.New(codes.Internal, apperr.Internal, "could not load storage usage")
+	}
+	return c.JSON(http.StatusOK, usage)
+}
@@ -0,0 +1,128 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/labstack/echo/v4"
+	"echo-api/models"
+	"echo-api/store"
+	"file-service/apperr"
+)
+
+// brokenLogout is a session store that cannot log users out
+type brokenLogout struct {
+	store.SessionStore
+}
+
+func (brokenLogout) DeleteSessions(ctx context.Context, userID, exceptID int) (int, error) {
+	return 0, errors.New("database is down")
+}
+
+// adminContext returns the context of a request by an admin about a user
+func adminContext(admin *models.User, userID int, body string) echo.Context {
+	c, _ := newContext(body, "192.0.2.1", jwt.MapClaims{"user_id": float64(admin.ID), "role": models.RoleAdmin})
+	c.SetParamNames("id")
+	c.SetParamValues(strconv.Itoa(userID))
+	return c
+}
+
+func TestAdminRevokesTokens(t *testing.T) {
+	m := useMemory(t)
+	useMailbox(t)
+	ctx := context.Background()
+	admin := addUser(t, m, "admin", "password1")
+	if err := m.SetRole(ctx, admin.ID, models.RoleAdmin); err != nil {
+		t.Fatal(err)
+	}
+
+	// Tokens stop working even when logging the user out fails
+	tests := []struct {
+		name   string
+		change func(c echo.Context) error
+		body   string
+		code   apperr.Code
+	}{
+		{name: "disabled", change: DisableUser, code: apperr.AccountDisabled},
+		{name: "role changed", change: SetUserRole, body: `{"role": "admin"}`, code: apperr.SessionRevoked},
+	}
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			user := addUser(t, m, "user"+strconv.Itoa(i), "password1")
+			s := &models.Session{UserID: user.ID, ExpiresAt: time.Now().Add(time.Hour)}
+			if err := m.CreateSession(ctx, s); err != nil {
+				t.Fatal(err)
+			}
+
+			Sessions = brokenLogout{m}
+			err := tt.change(adminContext(admin, user.ID, tt.body))
+			Sessions = m
+			if err != nil {
+				t.Fatal(err)
+			}
+			c, _ := newContext("", "192.0.2.2", jwt.MapClaims{"user_id": float64(user.ID), "sid": float64(s.ID), "role": models.RoleUser})
+			if err := CheckSession(c, s.ID); codeOf(err) != tt.code {
+				t.Errorf("CheckSession() = %v, want code %q", err, tt.code)
+			}
+		})
+	}
+}
+
+func TestAdminUserChanges(t *testing.T) {
+	m := useMemory(t)
+	useMailbox(t)
+	ctx := context.Background()
+	admin := addUser(t, m, "admin", "password1")
+	other := addUser(t, m, "other", "password1")
+	alice := addUser(t, m, "alice", "password1")
+	for _, u := range []*models.User{admin, other} {
+		if err := m.SetRole(ctx, u.ID, models.RoleAdmin); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	steps := []struct {
+		name   string
+		do     func(c echo.Context) error
+		userID int
+		body   string
+		code   apperr.Code
+	}{
+		{name: "disable themselves", do: DisableUser, userID: admin.ID, code: apperr.OwnAccount},
+		{name: "unknown role", do: SetUserRole, userID: alice.ID, body: `{"role": "root"}`, code: apperr.InvalidRequest},
+		{name: "impersonate an admin", do: ImpersonateUser, userID: other.ID, body: `{"reason": "support"}`, code: apperr.ImpersonationDenied},
+		{name: "impersonate without a reason", do: ImpersonateUser, userID: alice.ID, body: `{}`, code: apperr.InvalidRequest},
+		{name: "impersonate", do: ImpersonateUser, userID: alice.ID, body: `{"reason": "ticket 42"}`},
+		{name: "disable", do: DisableUser, userID: alice.ID},
+		{name: "impersonate a disabled user", do: ImpersonateUser, userID: alice.ID, body: `{"reason": "ticket 42"}`, code: apperr.ImpersonationDenied},
+		{name: "enable", do: EnableUser, userID: alice.ID},
+		{name: "reset the password", do: ResetUserPassword, userID: alice.ID, body: `{"password": "new password"}`},
+		{name: "unknown user", do: DisableUser, userID: 1000, code: apperr.UserNotFound},
+	}
+	for _, step := range steps {
+		if err := step.do(adminContext(admin, step.userID, step.body)); codeOf(err) != step.code {
+			t.Fatalf("%s: %v, want code %q", step.name, err, step.code)
+		}
+	}
+
+	c, _ := newContext(`{"username": "alice", "password": "new password"}`, "192.0.2.3", nil)
+	if err := Login(c); err != nil {
+		t.Errorf("Login() with the reset password = %v", err)
+	}
+	events, err := m.ListUserEvents(ctx, alice.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]bool{models.EventImpersonationStarted: true, models.EventAccountDisabled: true,
+		models.EventAccountEnabled: true, models.EventAdminPasswordReset: true}
+	for _, e := range events {
+		delete(want, e.Event)
+	}
+	if len(want) > 0 {
+		t.Errorf("missing audit events %v", want)
+	}
+}
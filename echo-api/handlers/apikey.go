@@ -0,0 +1,214 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"google.golang.org/grpc/codes"
+	"echo-api/models"
+	"echo-api/store"
+	"echo-api/utils"
+	"file-service/apperr"
+	"file-service/config"
+	"file-service/metrics"
+)
+
+// APIKeys limits the keys users create, set from the configuration at startup
+var APIKeys = config.Defaults().APIKeys
+
+// keyUseInterval is how often a key's last use is recorded from one client IP
+const keyUseInterval = time.Minute
+
+// ExchangeAPIKey returns the JWT a request made with an API key acts with: the
+// key's user, with their current role, in the key's organization and limited
+// to its scopes
+func ExchangeAPIKey(c echo.Context, key string) (string, error) {
+	ctx, now := c.Request().Context(), time.Now()
+	k, err := Keys.GetAPIKeyByHash(ctx, utils.HashToken(key))
+	if err != nil && !errors.Is(err, store.ErrNotFound) {
+		logger.ErrorContext(ctx, "API key lookup failed", "error", err)
+		return "", apperr.New(codes.Internal, apperr.Internal, "could not check API key")
+	}
+	user, err := keyUser(ctx, k, now)
+	if err != nil {
+		return "", err
+	}
+
+	if err := Keys.TouchAPIKey(ctx, k.ID, c.RealIP(), now, now.Add(-keyUseInterval)); err != nil {
+		logger.WarnContext(ctx, "Recording API key use failed", "error", err)
+	}
+	return utils.GenerateAPIKeyToken(user.ID, user.Role, k.OrgID, k.MFA, k.ID, k.Scopes)
+}
+
+// keyUser returns the user of a key that is neither revoked nor expired, and
+// refuses it if the user is disabled. k is nil if there is no such key.
+func keyUser(ctx context.Context, k *models.APIKey, now time.Time) (*models.User, error) {
+	if k == nil || !k.Active(now) {
+		metrics.AuthFailures.WithLabelValues("gateway", string(apperr.InvalidAPIKey)).Inc()
+		return nil, apperr.New(codes.Unauthenticated, apperr.InvalidAPIKey, "invalid, expired or revoked API key")
+	}
+	user, err := Users.GetUser(ctx, k.UserID)
+	if err != nil {
+		logger.ErrorContext(ctx, "API key lookup failed", "error", err)
+		return nil, apperr.New(codes.Internal, apperr.Internal, "could not check API key")
+	}
+	if user.Disabled || user.Deleting {
+		return nil, accountDisabled()
+	}
+	return user, nil
+}
+
+// CheckAPIKey refuses the token a key was exchanged for once the key is
+// revoked or expires or its user is disabled, as CheckSession does for the
+// tokens of a login
+func CheckAPIKey(c echo.Context, id int) error {
+	ctx := c.Request().Context()
+	k, err := Keys.GetAPIKey(ctx, id)
+	if err != nil && !errors.Is(err, store.ErrNotFound) {
+		logger.ErrorContext(ctx, "API key lookup failed", "error", err)
+		return apperr.New(codes.Internal, apperr.Internal, "could not check API key")
+	}
+	if k != nil && k.UserID != utils.UserID(c) {
+		k = nil
+	}
+	_, err = keyUser(ctx, k, time.Now())
+	return err
+}
+
+// CreateAPIKey creates a named API key with scopes, acting in the current or a
+// given organization of the user, and returns it. The key itself is only
+// shown in this response; it is stored hashed.
+func CreateAPIKey(c echo.Context) error {
+	var req struct {
+		Name      string     `json:"name"`
+		Scopes    []string   `json:"scopes"`
+		OrgID     int        `json:"org_id"`
+		ExpiresAt *time.Time `json:"expires_at"`
+	}
+	if err := c.Bind(&req); err != nil {
+		return err
+	}
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" || len(req.Name) > 100 {
+		return badRequest("name is required and must be at most 100 characters")
+	}
+	if len(req.Scopes) == 0 {
+		return badRequest("at least one scope is required")
+	}
+	for _, s := range req.Scopes {
+		if !slices.Contains(models.Scopes, s) {
+			return badRequest(fmt.Sprintf("unknown scope %q; scopes are %s", s, strings.Join(models.Scopes, ", ")))
+		}
+	}
+	slices.Sort(req.Scopes)
+	req.Scopes = slices.Compact(req.Scopes)
+
+	ctx, userID, now := c.Request().Context(), utils.UserID(c), time.Now()
+	orgID := utils.OrgID(c)
+	if req.OrgID != 0 {
+		role, err := Orgs.MemberRole(ctx, req.OrgID, userID)
+		if err != nil {
+			logger.ErrorContext(ctx, "Creating API key failed", "error", err)
+			return apperr.New(codes.Internal, apperr.Internal, "could not create API key")
+		}
+		if role == "" {
+			return apperr.New(codes.PermissionDenied, apperr.NotOrgMember, "not a member of this organization")
+		}
+		orgID = req.OrgID
+	}
+	if orgID == 0 {
+		return badRequest("org_id is required")
+	}
+
+	expiresAt := req.ExpiresAt
+	switch {
+	case expiresAt != nil && !expiresAt.After(now):
+		return badRequest("expires_at must be in the future")
+	case expiresAt != nil && APIKeys.MaxTTL > 0 && expiresAt.Sub(now) > APIKeys.MaxTTL:
+		return badRequest("keys must expire within " + forHumans(APIKeys.MaxTTL))
+	case expiresAt == nil && APIKeys.DefaultTTL > 0:
+		t := now.Add(APIKeys.DefaultTTL)
+		expiresAt = &t
+	}
+
+	if APIKeys.MaxPerUser > 0 {
+		n, err := Keys.CountActiveAPIKeys(ctx, userID, now)
+		if err != nil {
+			logger.ErrorContext(ctx, "Creating API key failed", "error", err)
+			return apperr.New(codes.Internal, apperr.Internal, "could not create API key")
+		}
+		if n >= APIKeys.MaxPerUser {
+			return apperr.New(codes.FailedPrecondition, apperr.APIKeyLimitReached, "revoke a key before creating another").
+				With("limit", APIKeys.MaxPerUser)
+		}
+	}
+
+	key, err := utils.NewAPIKey()
+	if err != nil {
+		return err
+	}
+	k := &models.APIKey{
+		UserID:    userID,
+		OrgID:     orgID,
+		Name:      req.Name,
+		Prefix:    key[:len(utils.APIKeyPrefix)+8],
+		KeyHash:   utils.HashToken(key),
+		Scopes:    req.Scopes,
+		MFA:       utils.MFA(c),
+		ExpiresAt: expiresAt,
+	}
+	if err := Keys.CreateAPIKey(ctx, k); err != nil {
+		logger.ErrorContext(ctx, "Creating API key failed", "error", err)
+		return apperr.New(codes.Internal, apperr.Internal, "could not create API key")
+	}
+	audit(c, models.AuditEvent{
+		Event:   models.EventAPIKeyCreated,
+		UserID:  &userID,
+		Details: map[string]interface{}{"key_id": k.ID, "name": k.Name, "scopes": strings.Join(k.Scopes, ",")},
+	})
+
+	return c.JSON(http.StatusCreated, struct {
+		*models.APIKey
+		Key string `json:"key"`
+	}{k, key})
+}
+
+// ListAPIKeys returns the current user's API keys, revoked ones included
+func ListAPIKeys(c echo.Context) error {
+	keys, err := Keys.ListAPIKeys(c.Request().Context(), utils.UserID(c))
+	if err != nil {
+		logger.ErrorContext(c.Request().Context(), "Listing API keys failed", "error", err)
+		return apperr.New(codes.Internal, apperr.Internal, "could not list API keys")
+	}
+	return c.JSON(http.StatusOK, keys)
+}
+
+// RevokeAPIKey revokes one of the current user's API keys for good
+func RevokeAPIKey(c echo.Context) error {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return badRequest("invalid API key id")
+	}
+	ctx, userID := c.Request().Context(), utils.UserID(c)
+	ok, err := Keys.RevokeAPIKey(ctx, userID, id, time.Now())
+	if err != nil {
+		logger.ErrorContext(ctx, "Revoking API key failed", "error", err)
+		return apperr.New(codes.Internal, apperr.Internal, "could not revoke API key")
+	}
+	if !ok {
+		return apperr.New(codes.NotFound, apperr.APIKeyNotFound, "API key not found or already revoked")
+	}
+	audit(c, models.AuditEvent{
+		Event:   models.EventAPIKeyRevoked,
+		UserID:  &userID,
+		Details: map[string]interface{}{"key_id": id},
+	})
+	return c.NoContent(http.StatusNoContent)
+}
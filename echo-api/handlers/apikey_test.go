@@ -0,0 +1,68 @@
+package handlers
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"echo-api/models"
+	"file-service/apperr"
+)
+
+func TestCheckAPIKey(t *testing.T) {
+	m := useMemory(t)
+	ctx := context.Background()
+	alice := addUser(t, m, "alice", "password1")
+	bob := addUser(t, m, "bob", "password1")
+	carol := addUser(t, m, "carol", "password1")
+	dave := addUser(t, m, "dave", "password1")
+	if _, err := m.SetDisabled(ctx, carol.ID, true, time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.MarkDeleting(ctx, dave.ID, time.Now()); err != nil {
+		t.Fatal(err)
+	}
+
+	key := func(userID int, expiresAt *time.Time) int {
+		k := &models.APIKey{UserID: userID, Name: "test", ExpiresAt: expiresAt}
+		if err := m.CreateAPIKey(ctx, k); err != nil {
+			t.Fatal(err)
+		}
+		return k.ID
+	}
+	past, future := time.Now().Add(-time.Minute), time.Now().Add(time.Hour)
+	active := key(alice.ID, nil)
+	unexpired := key(alice.ID, &future)
+	expired := key(alice.ID, &past)
+	revoked := key(alice.ID, nil)
+	if _, err := m.RevokeAPIKey(ctx, alice.ID, revoked, time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	disabled := key(carol.ID, nil)
+	deleting := key(dave.ID, nil)
+
+	tests := []struct {
+		name   string
+		userID int
+		keyID  int
+		code   apperr.Code
+	}{
+		{name: "active", userID: alice.ID, keyID: active},
+		{name: "not expired yet", userID: alice.ID, keyID: unexpired},
+		{name: "expired", userID: alice.ID, keyID: expired, code: apperr.InvalidAPIKey},
+		{name: "revoked", userID: alice.ID, keyID: revoked, code: apperr.InvalidAPIKey},
+		{name: "unknown", userID: alice.ID, keyID: 1000, code: apperr.InvalidAPIKey},
+		{name: "another user's", userID: bob.ID, keyID: active, code: apperr.InvalidAPIKey},
+		{name: "disabled user", userID: carol.ID, keyID: disabled, code: apperr.AccountDisabled},
+		{name: "user deleting their account", userID: dave.ID, keyID: deleting, code: apperr.AccountDisabled},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, _ := newContext("", "192.0.2.1", jwt.MapClaims{"user_id": float64(tt.userID), "api_key_id": float64(tt.keyID)})
+			if err := CheckAPIKey(c, tt.keyID); codeOf(err) != tt.code {
+				t.Errorf("CheckAPIKey() = %v, want code %q", err, tt.code)
+			}
+		})
+	}
+}
@@ -0,0 +1,44 @@
+package handlers
+
+import (
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/labstack/echo/v4"
+	"echo-api/models"
+	"echo-api/utils"
+	"file-service/logging"
+)
+
+// auditLogger logs audit events as they are recorded, so that they are not
+// lost when the database is unavailable
+var auditLogger = logging.For("audit")
+
+// audit records a security event caused by the request, taking the client IP
+// and, on authenticated routes, the actor from it: the admin, if one is
+// impersonating the user
+func audit(c echo.Context, e models.AuditEvent) {
+	ctx := c.Request().Context()
+	e.IP = c.RealIP()
+	if _, ok := c.Get("user").(*jwt.Token); ok && e.ActorID == nil {
+		actorID := utils.UserID(c)
+		if adminID := utils.ImpersonatorID(c); adminID != 0 {
+			actorID = adminID
+		}
+		e.ActorID = &actorID
+	}
+
+	args := []interface{}{"event", e.Event, "ip", e.IP}
+	if e.UserID != nil {
+		args = append(args, "user_id", *e.UserID)
+	}
+	if e.ActorID != nil {
+		args = append(args, "actor_id", *e.ActorID)
+	}
+	for k, v := range e.Details {
+		args = append(args, k, v)
+	}
+	auditLogger.InfoContext(ctx, "Audit event", args...)
+
+	if err := Audit.RecordEvent(ctx, &e); err != nil {
+		logger.ErrorContext(ctx, "Audit event not recorded", "event", e.Event, "error", err)
+	}
+}
@@ -1,75 +1,252 @@
 package handlers
 
 import (
-	"context"
-	"log"
+	"errors"
 	"net/http"
-	"os"
 	"time"
 
-	"github.com/golang-jwt/jwt/v5"
 	"github.com/labstack/echo/v4"
-	"echo-api/db"
+	"google.golang.org/grpc/codes"
 	"echo-api/models"
+	"echo-api/store"
+	"echo-api/utils"
+	"file-service/apperr"
+	"file-service/metrics"
 )
 
-// Register user
+// Register user. An email address is optional; if given, a link to verify it
+// is mailed.
 func Register(c echo.Context) error {
-	u := new(models.User)
-	if err := c.Bind(u); err != nil {
+	var req struct {
+		Username    string `json:"username"`
+		Password    string `json:"password"`
+		Email       string `json:"email"`
+		DisplayName string `json:"display_name"`
+	}
+	if err := c.Bind(&req); err != nil {
 		return err
 	}
-
-	_, err := db.DB.Exec(context.Background(),
-		"INSERT INTO users (username, password) VALUES ($1, $2)", u.Username, u.Password)
+	if err := validateUsername(req.Username); err != nil {
+		return err
+	}
+	if err := validatePassword(req.Password); err != nil {
+		return err
+	}
+	displayName, err := validateDisplayName(req.DisplayName)
 	if err != nil {
-		log.Printf("register error: %v", err)
-		return c.JSON(http.StatusInternalServerError, map[string]string{"message": "could not create user"})
+		return err
+	}
+	u := &models.User{Username: req.Username, DisplayName: displayName}
+	if req.Email != "" {
+		if u.Email, err = normalizeEmail(req.Email); err != nil {
+			return err
+		}
+	}
+
+	ctx := c.Request().Context()
+	if err := checkAvailable(ctx, 0, u.Username, u.Email); err != nil {
+		return err
+	}
+	if u.PasswordHash, err = utils.HashPassword(req.Password); err != nil {
+		logger.ErrorContext(ctx, "Registration failed", "error", err)
+		return apperr.New(codes.Internal, apperr.Internal, "could not create user")
+	}
+
+	// Every user starts with a personal organization that owns their files
+	if err := Users.CreateUser(ctx, u); err != nil {
+		logger.ErrorContext(ctx, "Registration failed", "error", err)
+		return apperr.New(codes.Internal, apperr.Internal, "could not create user")
+	}
+	if u.Email != "" {
+		if err := sendVerification(c, u); err != nil {
+			logger.ErrorContext(ctx, "Sending verification failed", "error", err)
+		}
 	}
 	return c.JSON(http.StatusCreated, u)
 }
 
-// Login and return JWT
+// Login and return JWT, or an MFA challenge for users with TOTP enabled.
+// Failed logins delay, then lock out, further ones to the account and from the
+// client IP; see Lockout.
 func Login(c echo.Context) error {
-	u := new(models.User)
-	if err := c.Bind(u); err != nil {
+	var req struct {
+		Username string `json:"username"`
+		Password string `json:"password"`
+	}
+	if err := c.Bind(&req); err != nil {
 		return err
 	}
 
-	row := db.DB.QueryRow(context.Background(),
-		"SELECT id, password FROM users WHERE username=$1", u.Username)
+	ctx, now := c.Request().Context(), time.Now()
+	wait, err := loginBlocked(ctx, req.Username, c.RealIP(), now)
+	if err != nil {
+		logger.ErrorContext(ctx, "Login failed", "error", err)
+		return apperr.New(codes.Internal, apperr.Internal, "could not log in")
+	}
+	if wait > 0 {
+		metrics.AuthFailures.WithLabelValues("gateway", "locked_out").Inc()
+		return loginThrottled(wait)
+	}
 
-	var dbID int
-	var dbPass string
-	err := row.Scan(&dbID, &dbPass)
-	if err != nil || dbPass != u.Password {
-		return c.JSON(http.StatusUnauthorized, map[string]string{"message": "invalid credentials"})
+	// Unknown usernames go through the same comparison and failure counting
+	// as wrong passwords, so that they cannot be told apart by timing
+	dbUser, err := Users.GetUserByUsername(ctx, req.Username)
+	if err != nil && !errors.Is(err, store.ErrNotFound) {
+		logger.ErrorContext(ctx, "Login failed", "error", err)
+		return apperr.New(codes.Internal, apperr.Internal, "could not log in")
+	}
+	stored := dummyPassword
+	if dbUser != nil {
+		stored = dbUser.PasswordHash
+	}
+	if !utils.CheckPassword(stored, req.Password) || dbUser == nil {
+		metrics.AuthFailures.WithLabelValues("gateway", "bad_credentials").Inc()
+		if err := loginFailed(c, req.Username, dbUser, now); err != nil {
+			logger.ErrorContext(ctx, "Counting login failure failed", "error", err)
+		}
+		return apperr.New(codes.Unauthenticated, apperr.InvalidCredentials, "invalid credentials")
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
-		"user_id": dbID,
-		"exp":     time.Now().Add(time.Hour * 72).Unix(),
-	})
+	// Passwords stored before they were hashed are hashed on the first login
+	if !utils.IsPasswordHash(dbUser.PasswordHash) {
+		hash, err := utils.HashPassword(req.Password)
+		if err == nil {
+			err = Users.SetPassword(ctx, dbUser.ID, hash)
+		}
+		if err != nil {
+			logger.WarnContext(ctx, "Hashing legacy password failed", "error", err)
+		}
+	}
 
-	t, err := token.SignedString([]byte(os.Getenv("JWT_SECRET")))
-	if err != nil {
+	return completeLogin(c, dbUser)
+}
+
+// accountDisabled refuses a user an admin disabled. It is only returned once
+// the user proved who they are, so that it does not tell others which
+// accounts are disabled.
+func accountDisabled() error {
+	metrics.AuthFailures.WithLabelValues("gateway", string(apperr.AccountDisabled)).Inc()
+	return apperr.New(codes.PermissionDenied, apperr.AccountDisabled, "the account is disabled; contact an administrator")
+}
+
+// completeLogin logs in a user who passed the first factor, a password or a
+// provider's login, or returns a challenge for LoginMFA if they enabled TOTP
+func completeLogin(c echo.Context, user *models.User) error {
+	if user.Disabled || user.Deleting {
+		return accountDisabled()
+	}
+	ctx := c.Request().Context()
+	t, err := MFA.GetTOTP(ctx, user.ID)
+	if err != nil && !errors.Is(err, store.ErrNotFound) {
+		logger.ErrorContext(ctx, "Login failed", "error", err)
+		return apperr.New(codes.Internal, apperr.Internal, "could not log in")
+	}
+	if t != nil && t.Enabled {
+		ttl := MFASettings().ChallengeTTL
+		challenge, err := utils.GenerateMFAChallenge(user.ID, ttl)
+		if err != nil {
+			return err
+		}
+		return c.JSON(http.StatusOK, map[string]interface{}{
+			"mfa_required": true,
+			"mfa_token":    challenge,
+			"expires_in":   int(ttl.Seconds()),
+		})
+	}
+	return loggedIn(c, user, false)
+}
+
+// LoginMFA completes a login with the challenge token returned by Login and a
+// TOTP or recovery code. Wrong codes count as failed logins.
+func LoginMFA(c echo.Context) error {
+	var req struct {
+		MFAToken string `json:"mfa_token"`
+		Code     string `json:"code"`
+	}
+	if err := c.Bind(&req); err != nil {
 		return err
 	}
 
-	return c.JSON(http.StatusOK, map[string]string{"token": t})
+	invalidToken := apperr.New(codes.Unauthenticated, apperr.InvalidMFAToken, "invalid or expired MFA token")
+	userID, err := utils.ParseMFAChallenge(req.MFAToken)
+	if err != nil {
+		metrics.AuthFailures.WithLabelValues("gateway", string(apperr.InvalidMFAToken)).Inc()
+		return invalidToken
+	}
+	ctx, now := c.Request().Context(), time.Now()
+	user, err := Users.GetUser(ctx, userID)
+	if errors.Is(err, store.ErrNotFound) {
+		return invalidToken
+	}
+	if err != nil {
+		logger.ErrorContext(ctx, "Login failed", "error", err)
+		return apperr.New(codes.Internal, apperr.Internal, "could not log in")
+	}
+
+	wait, err := loginBlocked(ctx, user.Username, c.RealIP(), now)
+	if err != nil {
+		logger.ErrorContext(ctx, "Login failed", "error", err)
+		return apperr.New(codes.Internal, apperr.Internal, "could not log in")
+	}
+	if wait > 0 {
+		metrics.AuthFailures.WithLabelValues("gateway", "locked_out").Inc()
+		return loginThrottled(wait)
+	}
+
+	t, err := MFA.GetTOTP(ctx, user.ID)
+	if errors.Is(err, store.ErrNotFound) || (err == nil && !t.Enabled) {
+		return invalidToken
+	}
+	var ok bool
+	if err == nil {
+		ok, err = verifySecondFactor(c, t, req.Code)
+	}
+	if err != nil {
+		logger.ErrorContext(ctx, "Login failed", "error", err)
+		return apperr.New(codes.Internal, apperr.Internal, "could not log in")
+	}
+	if !ok {
+		metrics.AuthFailures.WithLabelValues("gateway", "bad_mfa_code").Inc()
+		if err := loginFailed(c, user.Username, user, now); err != nil {
+			logger.ErrorContext(ctx, "Counting login failure failed", "error", err)
+		}
+		return invalidMFACode(codes.Unauthenticated)
+	}
+	if user.Disabled || user.Deleting {
+		return accountDisabled()
+	}
+	return loggedIn(c, user, true)
 }
 
-// Protected profile route
-func Profile(c echo.Context) error {
-	user := c.Get("user").(*jwt.Token)
-	claims := user.Claims.(jwt.MapClaims)
-	id := claims["user_id"].(float64)
+// loggedIn clears the failed logins of a user who passed every factor, starts
+// a session and returns its token, acting in their default organization. Users whose role
+// requires two-factor authentication but who have not enrolled are told to.
+func loggedIn(c echo.Context, user *models.User, mfa bool) error {
+	ctx := c.Request().Context()
+	if _, err := Logins.ClearLoginFailures(ctx, accountKey(user.Username)); err != nil {
+		logger.WarnContext(ctx, "Clearing login failures failed", "error", err)
+	}
+
+	orgID, err := Orgs.DefaultOrganization(ctx, user.ID, user.Username)
+	if err != nil {
+		logger.ErrorContext(ctx, "Login failed", "error", err)
+		return apperr.New(codes.Internal, apperr.Internal, "could not load organization")
+	}
+
+	sessionID, err := startSession(c, user.ID, utils.TokenTTL)
+	if err != nil {
+		logger.ErrorContext(ctx, "Login failed", "error", err)
+		return apperr.New(codes.Internal, apperr.Internal, "could not start session")
+	}
 
-	var username string
-	err := db.DB.QueryRow(context.Background(), "SELECT username FROM users WHERE id=$1", int(id)).Scan(&username)
+	t, err := utils.GenerateToken(user.ID, user.Role, orgID, sessionID, mfa)
 	if err != nil {
-		return c.JSON(http.StatusNotFound, map[string]string{"message": "user not found"})
+		return err
 	}
 
-	return c.JSON(http.StatusOK, map[string]string{"user": username})
-} 
\ No newline at end of file
+	res := map[string]interface{}{"token": t}
+	if !mfa && mfaRequired(user.Role) {
+		res["mfa_enrollment_required"] = true
+	}
+	return c.JSON(http.StatusOK, res)
+}
@@ -0,0 +1,272 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/mail"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"google.golang.org/grpc/codes"
+	"echo-api/mailer"
+	"echo-api/models"
+	"echo-api/store"
+	"echo-api/utils"
+	"file-service/apperr"
+	"file-service/config"
+)
+
+// Mail delivery, set from the configuration at startup. Links in emails,
+// share links and signed download URLs point at PublicURL.
+var (
+	Mailer    mailer.Mailer = mailer.NewWriter(io.Discard, config.Defaults().Mail.From)
+	Mail                    = config.Defaults().Mail
+	PublicURL               = config.Defaults().HTTP.PublicURL
+)
+
+// normalizeEmail validates a bare address like alice@example.com and lower-cases it
+func normalizeEmail(email string) (string, error) {
+	email = strings.TrimSpace(email)
+	addr, err := mail.ParseAddress(email)
+	if err != nil || addr.Address != email {
+		return "", badRequest("invalid email address")
+	}
+	return strings.ToLower(email), nil
+}
+
+// forHumans spells out a link lifetime like 48h as 2 days
+func forHumans(d time.Duration) string {
+	n, unit := int(d.Round(time.Minute)/time.Minute), "minute"
+	switch {
+	case d >= 24*time.Hour && d%(24*time.Hour) == 0:
+		n, unit = int(d/(24*time.Hour)), "day"
+	case d >= time.Hour && d%time.Hour == 0:
+		n, unit = int(d/time.Hour), "hour"
+	}
+	if n != 1 {
+		unit += "s"
+	}
+	return fmt.Sprintf("%d %s", n, unit)
+}
+
+// sendMail delivers a message in the background, so that responses take as
+// long whether or not one is sent
+func sendMail(ctx context.Context, m mailer.Message) {
+	ctx = context.WithoutCancel(ctx)
+	go func() {
+		ctx, cancel := context.WithTimeout(ctx, Mail.Timeout)
+		defer cancel()
+		if err := Mailer.Send(ctx, m); err != nil {
+			logger.ErrorContext(ctx, "Sending mail failed", "subject", m.Subject, "error", err)
+		}
+	}()
+}
+
+// mailToken stores a new single-use token for the user and returns the link
+// to path that carries it
+func mailToken(ctx context.Context, user *models.User, purpose, email string, ttl time.Duration, path string) (string, error) {
+	token, err := utils.NewToken()
+	if err != nil {
+		return "", err
+	}
+	err = Tokens.CreateToken(ctx, &models.UserToken{
+		TokenHash: utils.HashToken(token),
+		UserID:    user.ID,
+		Purpose:   purpose,
+		Email:     email,
+		ExpiresAt: time.Now().Add(ttl),
+	})
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSuffix(PublicURL, "/") + path + "?token=" + url.QueryEscape(token), nil
+}
+
+// sendVerification mails the user a link confirming their address
+func sendVerification(c echo.Context, user *models.User) error {
+	link, err := mailToken(c.Request().Context(), user, models.TokenVerifyEmail, user.Email, Mail.VerifyTTL, "/email/verify")
+	if err != nil {
+		return err
+	}
+	sendMail(c.Request().Context(), mailer.Message{
+		To:      user.Email,
+		Subject: "Confirm your email address",
+		Body: fmt.Sprintf("Hi %s,\n\nconfirm that this is your email address by opening\n\n%s\n\n"+
+			"The link works for %s. If you did not sign up, ignore this email.\n",
+			user.Username, link, forHumans(Mail.VerifyTTL)),
+	})
+	return nil
+}
+
+// tokenParam returns the token of a mailed link, from the query or a JSON body
+func tokenParam(c echo.Context) string {
+	if token := c.QueryParam("token"); token != "" {
+		return token
+	}
+	var req struct {
+		Token string `json:"token"`
+	}
+	c.Bind(&req)
+	return req.Token
+}
+
+// VerifyEmail confirms the address a verification link was sent to. It
+// accepts GET, so that the link in the email works when opened.
+func VerifyEmail(c echo.Context) error {
+	ctx := c.Request().Context()
+	invalid := apperr.New(codes.InvalidArgument, apperr.InvalidVerifyToken, "invalid or expired verification link")
+	t, err := Tokens.UseToken(ctx, utils.HashToken(tokenParam(c)), models.TokenVerifyEmail)
+	if errors.Is(err, store.ErrNotFound) {
+		return invalid
+	}
+	if err != nil {
+		logger.ErrorContext(ctx, "Token query failed", "error", err)
+		return apperr.New(codes.Internal, apperr.Internal, "could not verify email")
+	}
+
+	// The address may have changed or been verified through another link since
+	verified, err := Users.VerifyEmail(ctx, t.UserID, t.Email)
+	if err != nil {
+		logger.ErrorContext(ctx, "User query failed", "error", err)
+		return apperr.New(codes.Internal, apperr.Internal, "could not verify email")
+	}
+	if !verified {
+		return invalid
+	}
+	if err := Tokens.DeleteTokens(ctx, t.UserID, models.TokenVerifyEmail); err != nil {
+		logger.WarnContext(ctx, "Deleting tokens failed", "error", err)
+	}
+	audit(c, models.AuditEvent{Event: models.EventEmailVerified, UserID: &t.UserID})
+
+	return c.JSON(http.StatusOK, map[string]interface{}{"email": t.Email, "email_verified": true})
+}
+
+// ResendVerification mails the caller a new verification link
+func ResendVerification(c echo.Context) error {
+	ctx := c.Request().Context()
+	user, err := Users.GetUser(ctx, utils.UserID(c))
+	if err != nil {
+		return apperr.New(codes.NotFound, apperr.UserNotFound, "user not found")
+	}
+	if user.Email == "" {
+		return apperr.New(codes.FailedPrecondition, apperr.EmailMissing, "no email address on the account")
+	}
+	if user.EmailVerified {
+		return apperr.New(codes.FailedPrecondition, apperr.EmailAlreadyVerified, "email address already verified")
+	}
+
+	if err := sendVerification(c, user); err != nil {
+		logger.ErrorContext(ctx, "Token query failed", "error", err)
+		return apperr.New(codes.Internal, apperr.Internal, "could not send verification email")
+	}
+	return c.NoContent(http.StatusAccepted)
+}
+
+// ForgotPassword mails a password reset link if an account has the address
+// and it is verified, so that a token cannot add an address to take over the
+// account with. The answer is the same either way and the lookup happens
+// after it, so that neither reveals which addresses have accounts.
+func ForgotPassword(c echo.Context) error {
+	var req struct {
+		Email string `json:"email"`
+	}
+	if err := c.Bind(&req); err != nil {
+		return err
+	}
+	email, err := normalizeEmail(req.Email)
+	if err != nil {
+		return err
+	}
+
+	ctx := context.WithoutCancel(c.Request().Context())
+	go func() {
+		user, err := Users.GetUserByEmail(ctx, email)
+		if errors.Is(err, store.ErrNotFound) || (err == nil && !user.EmailVerified) {
+			return
+		}
+		if err == nil {
+			err = Tokens.DeleteTokens(ctx, user.ID, models.TokenResetPassword)
+		}
+		var link string
+		if err == nil {
+			link, err = mailToken(ctx, user, models.TokenResetPassword, email, Mail.ResetTTL, "/password/reset")
+		}
+		if err != nil {
+			logger.ErrorContext(ctx, "Password reset failed", "error", err)
+			return
+		}
+		sendMail(ctx, mailer.Message{
+			To:      email,
+			Subject: "Reset your password",
+			Body: fmt.Sprintf("Hi %s,\n\nsomeone asked to reset your password. To choose a new one, open\n\n%s\n\n"+
+				"The link works once, for %s. If you did not ask for it, ignore this email.\n",
+				user.Username, link, forHumans(Mail.ResetTTL)),
+		})
+	}()
+
+	return c.NoContent(http.StatusAccepted)
+}
+
+// ResetPassword sets a new password with the token of a reset link. The link
+// also proves the address, and lifts any lockout of the account. Every session
+// is logged out, in case the old password was stolen.
+func ResetPassword(c echo.Context) error {
+	var req struct {
+		Token    string `json:"token"`
+		Password string `json:"password"`
+	}
+	if err := c.Bind(&req); err != nil {
+		return err
+	}
+	if err := validatePassword(req.Password); err != nil {
+		return err
+	}
+
+	ctx := c.Request().Context()
+	t, err := Tokens.UseToken(ctx, utils.HashToken(req.Token), models.TokenResetPassword)
+	if errors.Is(err, store.ErrNotFound) {
+		return apperr.New(codes.InvalidArgument, apperr.InvalidResetToken, "invalid or expired reset link")
+	}
+	var user *models.User
+	if err == nil {
+		user, err = Users.GetUser(ctx, t.UserID)
+	}
+	var hash string
+	if err == nil {
+		hash, err = utils.HashPassword(req.Password)
+	}
+	if err == nil {
+		err = Users.SetPassword(ctx, t.UserID, hash)
+	}
+	if err != nil {
+		logger.ErrorContext(ctx, "Password reset failed", "error", err)
+		return apperr.New(codes.Internal, apperr.Internal, "could not reset password")
+	}
+
+	if err := Tokens.DeleteTokens(ctx, t.UserID, models.TokenResetPassword); err != nil {
+		logger.WarnContext(ctx, "Deleting tokens failed", "error", err)
+	}
+	if _, err := Users.VerifyEmail(ctx, t.UserID, t.Email); err != nil {
+		logger.WarnContext(ctx, "Verifying email failed", "error", err)
+	}
+	if _, err := Logins.ClearLoginFailures(ctx, accountKey(user.Username)); err != nil {
+		logger.WarnContext(ctx, "Clearing login failures failed", "error", err)
+	}
+	if _, err := Sessions.DeleteSessions(ctx, t.UserID, 0); err != nil {
+		logger.WarnContext(ctx, "Revoking sessions failed", "error", err)
+	}
+	audit(c, models.AuditEvent{Event: models.EventPasswordReset, UserID: &t.UserID})
+
+	sendMail(ctx, mailer.Message{
+		To:      t.Email,
+		Subject: "Your password was changed",
+		Body: fmt.Sprintf("Hi %s,\n\nthe password of your account was just reset. If this was not you, "+
+			"contact an administrator.\n", user.Username),
+	})
+	return c.NoContent(http.StatusNoContent)
+}
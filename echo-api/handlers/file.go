@@ -6,56 +6,78 @@ import (
 	"net/http"
 	"os"
 	"path/filepath"
-	
+	"sync"
 
 	"github.com/labstack/echo/v4"
 	"echo-api/clients"
 )
 
+// tempFiles holds the temp files of requests in progress, so that shutdown can
+// remove the ones it cuts off
+var tempFiles sync.Map
+
+// trackTemp records a request's temp file and returns the func that removes it
+func trackTemp(path string) func() {
+	tempFiles.Store(path, struct{}{})
+	return func() {
+		os.Remove(path)
+		tempFiles.Delete(path)
+	}
+}
+
+// RemoveTempFiles removes the temp files of requests still in progress
+func RemoveTempFiles() {
+	tempFiles.Range(func(path, _ interface{}) bool {
+		os.Remove(path.(string))
+		tempFiles.Delete(path)
+		return true
+	})
+}
+
 // UploadFile handles file upload requests
 func UploadFile(c echo.Context) error {
 	// Get file from form
 	file, err := c.FormFile("file")
 	if err != nil {
-		return c.JSON(http.StatusBadRequest, map[string]string{"error": "No file uploaded"})
+		return badRequest("No file uploaded")
 	}
 
 	// Create temp file
 	src, err := file.Open()
 	if err != nil {
-		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to open uploaded file"})
+		return fmt.Errorf("open uploaded file: %w", err)
 	}
 	defer src.Close()
 
 	// Create temp directory if it doesn't exist
-	if err := os.MkdirAll("temp", 0755); err != nil {
-		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to create temp directory"})
+	if err := os.MkdirAll(TempDir, 0755); err != nil {
+		return fmt.Errorf("create temp directory: %w", err)
 	}
 
 	// Save to temp file
-	tempPath := filepath.Join("temp", file.Filename)
+	tempPath := filepath.Join(TempDir, file.Filename)
+	defer trackTemp(tempPath)() // Clean up temp file
 	dst, err := os.Create(tempPath)
 	if err != nil {
-		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to create temp file"})
+		return fmt.Errorf("create temp file: %w", err)
 	}
 	defer dst.Close()
-	defer os.Remove(tempPath) // Clean up temp file
 
 	if _, err = io.Copy(dst, src); err != nil {
-		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to save uploaded file"})
+		return fmt.Errorf("save uploaded file: %w", err)
 	}
 
 	// Initialize file client
 	fileClient, err := clients.NewFileClient()
 	if err != nil {
-		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to connect to file service"})
+		return err
 	}
 
 	// Upload file
 	token := c.Request().Header.Get("Authorization")
-	resp, err := fileClient.UploadFile(c.Request().Context(), tempPath, token)
+	resp, err := fileClient.UploadFile(c.Request().Context(), tempPath, c.FormValue("folder_id"), token)
 	if err != nil {
-		return c.JSON(http.StatusInternalServerError, map[string]string{"error": fmt.Sprintf("Failed to upload file: %v", err)})
+		return err
 	}
 
 	return c.JSON(http.StatusOK, resp)
@@ -66,27 +88,27 @@ func DownloadFile(c echo.Context) error {
 	// Get file ID from URL
 	fileID := c.Param("id")
 	if fileID == "" {
-		return c.JSON(http.StatusBadRequest, map[string]string{"error": "File ID is required"})
+		return badRequest("File ID is required")
 	}
 
 	// Initialize file client
 	fileClient, err := clients.NewFileClient()
 	if err != nil {
-		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to connect to file service"})
+		return err
 	}
 
 	// Create temp directory if it doesn't exist
-	if err := os.MkdirAll("temp", 0755); err != nil {
-		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to create temp directory"})
+	if err := os.MkdirAll(TempDir, 0755); err != nil {
+		return fmt.Errorf("create temp directory: %w", err)
 	}
 
 	// Download file
-	tempPath := filepath.Join("temp", fileID)
+	tempPath := filepath.Join(TempDir, fileID)
+	defer trackTemp(tempPath)() // Clean up temp file, complete or not
 	token := c.Request().Header.Get("Authorization")
 	if err := fileClient.DownloadFile(c.Request().Context(), fileID, token, tempPath); err != nil {
-		return c.JSON(http.StatusInternalServerError, map[string]string{"error": fmt.Sprintf("Failed to download file: %v", err)})
+		return err
 	}
-	defer os.Remove(tempPath) // Clean up temp file
 
 	// Send file to client
 	return c.File(tempPath)
@@ -97,15 +119,67 @@ func ListFiles(c echo.Context) error {
 	// Initialize file client
 	fileClient, err := clients.NewFileClient()
 	if err != nil {
-		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to connect to file service"})
+		return err
 	}
 
 	// List files
 	token := c.Request().Header.Get("Authorization")
-	resp, err := fileClient.ListFiles(c.Request().Context(), token)
+	resp, err := fileClient.ListFiles(c.Request().Context(), token, false)
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, resp)
+}
+
+// ListSharedFiles lists files other users have shared with the user
+func ListSharedFiles(c echo.Context) error {
+	// Initialize file client
+	fileClient, err := clients.NewFileClient()
+	if err != nil {
+		return err
+	}
+
+	// List shared files
+	token := c.Request().Header.Get("Authorization")
+	resp, err := fileClient.ListFiles(c.Request().Context(), token, true)
 	if err != nil {
-		return c.JSON(http.StatusInternalServerError, map[string]string{"error": fmt.Sprintf("Failed to list files: %v", err)})
+		return err
 	}
 
 	return c.JSON(http.StatusOK, resp)
-} 
\ No newline at end of file
+}
+
+// GetStorageUsage reports the user's used and remaining storage; limits are null when unlimited
+func GetStorageUsage(c echo.Context) error {
+	// Initialize file client
+	fileClient, err := clients.NewFileClient()
+	if err != nil {
+		return err
+	}
+
+	// Get usage
+	token := c.Request().Header.Get("Authorization")
+	usage, err := fileClient.GetStorageUsage(c.Request().Context(), token)
+	if err != nil {
+		return err
+	}
+
+	limit := func(v int64) *int64 {
+		if v < 0 {
+			return nil
+		}
+		return &v
+	}
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"used_bytes":          usage.UsedBytes,
+		"quota_bytes":         limit(usage.QuotaBytes),
+		"remaining_bytes":     limit(usage.RemainingBytes),
+		"max_file_size":       limit(usage.MaxFileSize),
+		"file_count":          usage.FileCount,
+		"org_used_bytes":      usage.OrgUsedBytes,
+		"org_quota_bytes":     limit(usage.OrgQuotaBytes),
+		"org_remaining_bytes": limit(usage.OrgRemainingBytes),
+	})
+}
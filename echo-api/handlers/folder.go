@@ -0,0 +1,37 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+	"echo-api/clients"
+)
+
+// folderRequest is the body accepted when creating a folder
+type folderRequest struct {
+	Name     string `json:"name"`
+	ParentID string `json:"parent_id"`
+}
+
+// CreateFolder creates a folder, optionally inside a folder the user can write to
+func CreateFolder(c echo.Context) error {
+	req := new(folderRequest)
+	if err := c.Bind(req); err != nil {
+		return badRequest("Invalid request body")
+	}
+
+	// Initialize file client
+	fileClient, err := clients.NewFileClient()
+	if err != nil {
+		return err
+	}
+
+	// Create folder
+	token := c.Request().Header.Get("Authorization")
+	folder, err := fileClient.CreateFolder(c.Request().Context(), token, req.Name, req.ParentID)
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusCreated, folder)
+}
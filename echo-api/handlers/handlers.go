@@ -0,0 +1,33 @@
+package handlers
+
+import (
+	"google.golang.org/grpc/codes"
+	"echo-api/store"
+	"file-service/apperr"
+	"file-service/logging"
+)
+
+// Repositories behind the handlers. main wires in the SQL store;
+// store.NewMemory returns an in-memory one for tests.
+var (
+	Users      store.UserStore
+	Orgs       store.OrgStore
+	Logins     store.LoginFailureStore
+	Audit      store.AuditStore
+	MFA        store.MFAStore
+	Tokens     store.TokenStore
+	Identities store.IdentityStore
+	Keys       store.APIKeyStore
+	Sessions   store.SessionStore
+)
+
+// TempDir holds files in transit between the client and the file services
+var TempDir = "temp"
+
+// logger logs the failures behind 500 responses, whose details clients do not see
+var logger = logging.For("api")
+
+// badRequest returns the error for a request that fails validation
+func badRequest(message string) error {
+	return apperr.New(codes.InvalidArgument, apperr.InvalidRequest, message)
+}
@@ -0,0 +1,65 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/labstack/echo/v4"
+	"echo-api/models"
+	"echo-api/store"
+	"echo-api/utils"
+	"file-service/apperr"
+	"file-service/config"
+)
+
+// useMemory points the handlers at a fresh in-memory store for the test
+func useMemory(t *testing.T) *store.Memory {
+	t.Helper()
+	m := store.NewMemory()
+	Users, Orgs, Logins, Audit, MFA, Tokens, Identities, Keys, Sessions = m, m, m, m, m, m, m, m, m
+	utils.JWTSecret = []byte("test secret")
+	t.Cleanup(func() { Lockout = config.Lockout{} })
+	return m
+}
+
+// addUser creates a user with a password
+func addUser(t *testing.T, m *store.Memory, username, password string) *models.User {
+	t.Helper()
+	hash, err := utils.HashPassword(password)
+	if err != nil {
+		t.Fatal(err)
+	}
+	u := &models.User{Username: username, PasswordHash: hash, Role: models.RoleUser}
+	if err := m.CreateUser(context.Background(), u); err != nil {
+		t.Fatal(err)
+	}
+	return u
+}
+
+// newContext returns the context of a request with a JSON body from ip, made
+// with a validated JWT of claims unless they are nil
+func newContext(body, ip string, claims jwt.MapClaims) (echo.Context, *httptest.ResponseRecorder) {
+	req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(body))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	req.RemoteAddr = ip + ":1234"
+	rec := httptest.NewRecorder()
+	c := echo.New().NewContext(req, rec)
+	if claims != nil {
+		c.Set("user", &jwt.Token{Claims: claims, Valid: true})
+	}
+	return c, rec
+}
+
+// codeOf returns the code of an *apperr.Error, or "" for nil
+func codeOf(err error) apperr.Code {
+	var e *apperr.Error
+	if errors.As(err, &e) {
+		return e.Code
+	}
+	return ""
+}
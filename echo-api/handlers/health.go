@@ -0,0 +1,43 @@
+package handlers
+
+import (
+	"net/http"
+	"sync/atomic"
+
+	"github.com/labstack/echo/v4"
+	"file-service/healthcheck"
+)
+
+// ReadinessChecks are the dependencies the server needs to accept work, by name
+var ReadinessChecks map[string]healthcheck.Check
+
+// draining is set once shutdown begins, so readiness probes take the server out of rotation
+var draining atomic.Bool
+
+// SetDraining marks the server as shutting down
+func SetDraining() {
+	draining.Store(true)
+}
+
+// Healthz reports that the process is alive, whatever the state of its dependencies
+func Healthz(c echo.Context) error {
+	return c.JSON(http.StatusOK, map[string]string{"status": "ok"})
+}
+
+// Ready reports whether the server is accepting new work and each readiness check passes
+func Ready(c echo.Context) error {
+	if draining.Load() {
+		return c.JSON(http.StatusServiceUnavailable, map[string]string{"status": "draining"})
+	}
+
+	code, status := http.StatusOK, "ready"
+	checks := map[string]string{}
+	for name, err := range healthcheck.Run(c.Request().Context(), ReadinessChecks) {
+		checks[name] = "ok"
+		if err != nil {
+			checks[name] = err.Error()
+			code, status = http.StatusServiceUnavailable, "unavailable"
+		}
+	}
+	return c.JSON(code, map[string]interface{}{"status": status, "checks": checks})
+}
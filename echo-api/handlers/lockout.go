@@ -0,0 +1,137 @@
+package handlers
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"google.golang.org/grpc/codes"
+	"echo-api/models"
+	"file-service/apperr"
+	"file-service/config"
+	"file-service/ratelimit"
+)
+
+// Lockout slows down password guessing against accounts and from client IPs;
+// the zero value only counts failures
+var Lockout config.Lockout
+
+// Failures are counted under the username rather than the user ID, so that
+// usernames that do not exist are delayed and locked out like those that do
+// and responses do not reveal which ones exist
+func accountKey(username string) string { return "user:" + username }
+func ipKey(ip string) string            { return "ip:" + ip }
+
+// loginBlocked returns how much longer logins to the account or from the
+// client IP are refused, or zero
+func loginBlocked(ctx context.Context, username, ip string, now time.Time) (time.Duration, error) {
+	var wait time.Duration
+	for _, k := range []struct {
+		key     string
+		backoff func(int) time.Duration
+	}{
+		{accountKey(username), Lockout.AccountBackoff},
+		{ipKey(ip), Lockout.IPBackoff},
+	} {
+		f, err := Logins.LoginFailures(ctx, k.key)
+		if err != nil {
+			return 0, err
+		}
+		if f.Failures > 0 && !f.LastFailure.Before(now.Add(-Lockout.Window)) {
+			wait = max(wait, f.LastFailure.Add(k.backoff(f.Failures)).Sub(now))
+		}
+	}
+	return wait, nil
+}
+
+// loginFailed counts a failed login against the account and the client IP,
+// auditing each lockout it starts. user is nil if the username does not exist.
+func loginFailed(c echo.Context, username string, user *models.User, now time.Time) error {
+	ctx := c.Request().Context()
+	failures, err := Logins.AddLoginFailure(ctx, accountKey(username), now, now.Add(-Lockout.Window))
+	if err != nil {
+		return err
+	}
+	if Lockout.Attempts > 0 && failures >= Lockout.Attempts {
+		e := models.AuditEvent{Event: models.EventAccountLocked, Details: map[string]interface{}{
+			"username":     username,
+			"failures":     failures,
+			"locked_until": now.Add(Lockout.AccountBackoff(failures)).UTC().Format(time.RFC3339),
+		}}
+		if user != nil {
+			e.UserID = &user.ID
+		}
+		audit(c, e)
+	}
+
+	failures, err = Logins.AddLoginFailure(ctx, ipKey(c.RealIP()), now, now.Add(-Lockout.Window))
+	if err != nil {
+		return err
+	}
+	if Lockout.IPAttempts > 0 && failures >= Lockout.IPAttempts {
+		audit(c, models.AuditEvent{Event: models.EventIPLocked, Details: map[string]interface{}{
+			"failures":     failures,
+			"locked_until": now.Add(Lockout.IPBackoff(failures)).UTC().Format(time.RFC3339),
+		}})
+	}
+	return nil
+}
+
+// loginThrottled returns the error refusing a login for wait
+func loginThrottled(wait time.Duration) error {
+	return apperr.New(codes.ResourceExhausted, apperr.LoginThrottled, "too many failed logins, try again later").
+		With("retry_after_seconds", ratelimit.RetryAfterSeconds(wait))
+}
+
+// dummyPassword is the hash compared with the password given for a username
+// that does not exist, so that it takes as long to reject as a wrong password
+const dummyPassword = "$2a$10$hH3v4z97rwhfLTWXInAoQ.BkDVbUkKBlsRHZQzfV87DyrrPO/7Zmu"
+
+// PruneLoginFailures forgets failures too old to count towards a lockout
+func PruneLoginFailures(ctx context.Context) {
+	if err := Logins.PruneLoginFailures(ctx, time.Now().Add(-Lockout.Window)); err != nil {
+		logger.WarnContext(ctx, "Pruning login failures failed", "error", err)
+	}
+}
+
+// UnlockUser lifts the delays and lockout of an account by forgetting its failed logins
+func UnlockUser(c echo.Context) error {
+	user, err := targetUser(c)
+	if err != nil {
+		return err
+	}
+
+	ctx := c.Request().Context()
+	cleared, err := Logins.ClearLoginFailures(ctx, accountKey(user.Username))
+	if err != nil {
+		logger.ErrorContext(ctx, "Unlock failed", "error", err)
+		return apperr.New(codes.Internal, apperr.Internal, "could not unlock user")
+	}
+	if cleared {
+		audit(c, models.AuditEvent{Event: models.EventAccountUnlocked, UserID: &user.ID,
+			Details: map[string]interface{}{"username": user.Username}})
+	}
+	return c.NoContent(http.StatusNoContent)
+}
+
+// UnlockIP lifts the lockout of a client IP by forgetting its failed logins
+func UnlockIP(c echo.Context) error {
+	ip := net.ParseIP(c.Param("ip"))
+	if ip == nil {
+		return badRequest("invalid IP address")
+	}
+
+	ctx := c.Request().Context()
+	cleared, err := Logins.ClearLoginFailures(ctx, ipKey(ip.String()))
+	if err != nil {
+		logger.ErrorContext(ctx, "Unlock failed", "error", err)
+		return apperr.New(codes.Internal, apperr.Internal, "could not unlock IP address")
+	}
+	if cleared {
+		audit(c, models.AuditEvent{Event: models.EventIPUnlocked,
+			Details: map[string]interface{}{"unlocked_ip": ip.String()}})
+	}
+	return c.NoContent(http.StatusNoContent)
+}
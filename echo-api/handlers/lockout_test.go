@@ -0,0 +1,90 @@
+package handlers
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"file-service/apperr"
+	"file-service/config"
+)
+
+func TestLoginLockout(t *testing.T) {
+	type attempt struct {
+		username, password, ip string
+		code                   apperr.Code
+	}
+	tests := []struct {
+		name     string
+		lockout  config.Lockout
+		attempts []attempt
+	}{
+		{
+			name:    "account locked after attempts",
+			lockout: config.Lockout{Attempts: 3, Duration: time.Minute, Window: time.Hour},
+			attempts: []attempt{
+				{"alice", "wrong", "192.0.2.1", apperr.InvalidCredentials},
+				{"alice", "wrong", "192.0.2.2", apperr.InvalidCredentials},
+				{"alice", "wrong", "192.0.2.3", apperr.InvalidCredentials},
+				{"alice", "password1", "192.0.2.4", apperr.LoginThrottled},
+				{"bob", "password1", "192.0.2.4", ""},
+			},
+		},
+		{
+			name:    "success clears failures",
+			lockout: config.Lockout{Attempts: 3, Duration: time.Minute, Window: time.Hour},
+			attempts: []attempt{
+				{"alice", "wrong", "192.0.2.1", apperr.InvalidCredentials},
+				{"alice", "wrong", "192.0.2.1", apperr.InvalidCredentials},
+				{"alice", "password1", "192.0.2.1", ""},
+				{"alice", "wrong", "192.0.2.1", apperr.InvalidCredentials},
+				{"alice", "wrong", "192.0.2.1", apperr.InvalidCredentials},
+				{"alice", "password1", "192.0.2.1", ""},
+			},
+		},
+		{
+			name:    "unknown usernames locked alike",
+			lockout: config.Lockout{Attempts: 2, Duration: time.Minute, Window: time.Hour},
+			attempts: []attempt{
+				{"nobody", "wrong", "192.0.2.1", apperr.InvalidCredentials},
+				{"nobody", "wrong", "192.0.2.2", apperr.InvalidCredentials},
+				{"nobody", "wrong", "192.0.2.3", apperr.LoginThrottled},
+			},
+		},
+		{
+			name:    "client IP locked across accounts",
+			lockout: config.Lockout{IPAttempts: 2, Duration: time.Minute, Window: time.Hour},
+			attempts: []attempt{
+				{"alice", "wrong", "192.0.2.1", apperr.InvalidCredentials},
+				{"bob", "wrong", "192.0.2.1", apperr.InvalidCredentials},
+				{"bob", "password1", "192.0.2.1", apperr.LoginThrottled},
+				{"bob", "password1", "192.0.2.2", ""},
+			},
+		},
+		{
+			name: "no lockout",
+			attempts: []attempt{
+				{"alice", "wrong", "192.0.2.1", apperr.InvalidCredentials},
+				{"alice", "wrong", "192.0.2.1", apperr.InvalidCredentials},
+				{"alice", "wrong", "192.0.2.1", apperr.InvalidCredentials},
+				{"alice", "password1", "192.0.2.1", ""},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := useMemory(t)
+			addUser(t, m, "alice", "password1")
+			addUser(t, m, "bob", "password1")
+			Lockout = tt.lockout
+
+			for i, a := range tt.attempts {
+				body := fmt.Sprintf(`{"username": %q, "password": %q}`, a.username, a.password)
+				c, _ := newContext(body, a.ip, nil)
+				if err := Login(c); codeOf(err) != a.code {
+					t.Fatalf("attempt %d: Login(%s) = %v, want code %q", i+1, a.username, err, a.code)
+				}
+			}
+		})
+	}
+}
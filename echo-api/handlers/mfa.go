@@ -0,0 +1,268 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"google.golang.org/grpc/codes"
+	"echo-api/models"
+	"echo-api/store"
+	"echo-api/utils"
+	"file-service/apperr"
+	"file-service/config"
+	"file-service/metrics"
+)
+
+// MFASettings returns the two-factor settings; main wires in the live configuration
+var MFASettings = func() config.MFA { return config.Defaults().MFA }
+
+// recoveryCodeCount is how many recovery codes a user gets at a time
+const recoveryCodeCount = 10
+
+// codeRequest is the body of requests confirmed with a second factor
+type codeRequest struct {
+	Code string `json:"code"`
+}
+
+// mfaRequired reports whether users of role must use two-factor authentication
+func mfaRequired(role string) bool {
+	return slices.Contains(MFASettings().RequiredRoles, role)
+}
+
+// invalidMFACode returns the error for a wrong or reused code, with status
+// Unauthenticated while logging in and InvalidArgument otherwise
+func invalidMFACode(status codes.Code) error {
+	return apperr.New(status, apperr.InvalidMFACode, "invalid or already used code")
+}
+
+// newRecoveryCodes returns fresh recovery codes and the hashes to store
+func newRecoveryCodes() ([]string, []string, error) {
+	codes, err := utils.NewRecoveryCodes(recoveryCodeCount)
+	if err != nil {
+		return nil, nil, err
+	}
+	hashes := make([]string, len(codes))
+	for i, code := range codes {
+		hashes[i] = utils.HashRecoveryCode(code)
+	}
+	return codes, hashes, nil
+}
+
+// verifySecondFactor accepts a TOTP code, or else a recovery code, of an
+// enabled enrollment and uses it up, so that neither works a second time
+func verifySecondFactor(c echo.Context, t *models.TOTP, code string) (bool, error) {
+	ctx := c.Request().Context()
+	if step, ok := utils.VerifyTOTP(t.Secret, code, time.Now()); ok {
+		return MFA.UseTOTPStep(ctx, t.UserID, step)
+	}
+
+	used, err := MFA.UseRecoveryCode(ctx, t.UserID, utils.HashRecoveryCode(code))
+	if used {
+		audit(c, models.AuditEvent{Event: models.EventRecoveryCodeUsed, UserID: &t.UserID,
+			Details: map[string]interface{}{"recovery_codes_left": t.RecoveryCodesLeft - 1}})
+	}
+	return used, err
+}
+
+// confirmSecondFactor checks a code confirming a change to the caller's
+// enrollment. Wrong codes count as failed logins, so that a stolen token
+// cannot be used to guess codes past the lockout.
+func confirmSecondFactor(c echo.Context, t *models.TOTP, code string) error {
+	user, err := currentUser(c)
+	if err != nil {
+		return err
+	}
+	ctx, now := c.Request().Context(), time.Now()
+	wait, err := loginBlocked(ctx, user.Username, c.RealIP(), now)
+	if err != nil {
+		logger.ErrorContext(ctx, "Lockout query failed", "error", err)
+		return apperr.New(codes.Internal, apperr.Internal, "could not verify code")
+	}
+	if wait > 0 {
+		return loginThrottled(wait)
+	}
+
+	ok, err := verifySecondFactor(c, t, code)
+	if err != nil {
+		logger.ErrorContext(ctx, "MFA query failed", "error", err)
+		return apperr.New(codes.Internal, apperr.Internal, "could not verify code")
+	}
+	if !ok {
+		metrics.AuthFailures.WithLabelValues("gateway", "bad_mfa_code").Inc()
+		if err := loginFailed(c, user.Username, user, now); err != nil {
+			logger.ErrorContext(ctx, "Counting login failure failed", "error", err)
+		}
+		return invalidMFACode(codes.InvalidArgument)
+	}
+	return nil
+}
+
+// enabledTOTP returns the caller's enabled enrollment, or mfa_not_enrolled
+func enabledTOTP(c echo.Context) (*models.TOTP, error) {
+	t, err := MFA.GetTOTP(c.Request().Context(), utils.UserID(c))
+	if errors.Is(err, store.ErrNotFound) || (err == nil && !t.Enabled) {
+		return nil, apperr.New(codes.FailedPrecondition, apperr.MFANotEnrolled, "two-factor authentication is not enabled")
+	}
+	if err != nil {
+		logger.ErrorContext(c.Request().Context(), "MFA query failed", "error", err)
+		return nil, apperr.New(codes.Internal, apperr.Internal, "could not load two-factor authentication")
+	}
+	return t, nil
+}
+
+// GetMFAStatus reports whether the caller uses two-factor authentication and
+// whether their role requires it
+func GetMFAStatus(c echo.Context) error {
+	t, err := MFA.GetTOTP(c.Request().Context(), utils.UserID(c))
+	if errors.Is(err, store.ErrNotFound) {
+		t, err = &models.TOTP{}, nil
+	}
+	if err != nil {
+		logger.ErrorContext(c.Request().Context(), "MFA query failed", "error", err)
+		return apperr.New(codes.Internal, apperr.Internal, "could not load two-factor authentication")
+	}
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"enabled":             t.Enabled,
+		"recovery_codes_left": t.RecoveryCodesLeft,
+		"required":            mfaRequired(utils.Role(c)),
+	})
+}
+
+// EnrollTOTP starts TOTP enrollment with a new secret, returned with the
+// otpauth:// URI to show as a QR code. It takes effect once VerifyTOTP
+// confirms a code generated from it.
+func EnrollTOTP(c echo.Context) error {
+	ctx := c.Request().Context()
+	user, err := Users.GetUser(ctx, utils.UserID(c))
+	if err != nil {
+		return apperr.New(codes.NotFound, apperr.UserNotFound, "user not found")
+	}
+
+	secret, err := utils.NewTOTPSecret()
+	if err != nil {
+		return err
+	}
+	started, err := MFA.StartTOTP(ctx, user.ID, secret)
+	if err != nil {
+		logger.ErrorContext(ctx, "MFA query failed", "error", err)
+		return apperr.New(codes.Internal, apperr.Internal, "could not start enrollment")
+	}
+	if !started {
+		return apperr.New(codes.AlreadyExists, apperr.MFAAlreadyEnabled, "two-factor authentication is already enabled")
+	}
+
+	return c.JSON(http.StatusOK, map[string]string{
+		"secret":           secret,
+		"provisioning_uri": utils.TOTPURI(MFASettings().Issuer, user.Username, secret),
+	})
+}
+
+// VerifyTOTP completes enrollment with a code from the authenticator app. It
+// returns the recovery codes, shown only this once, and a token that passed
+// the second factor.
+func VerifyTOTP(c echo.Context) error {
+	req := new(codeRequest)
+	if err := c.Bind(req); err != nil {
+		return err
+	}
+
+	ctx := c.Request().Context()
+	t, err := MFA.GetTOTP(ctx, utils.UserID(c))
+	if errors.Is(err, store.ErrNotFound) {
+		return apperr.New(codes.FailedPrecondition, apperr.MFANotEnrolled, "start enrollment first")
+	}
+	if err != nil {
+		logger.ErrorContext(ctx, "MFA query failed", "error", err)
+		return apperr.New(codes.Internal, apperr.Internal, "could not load two-factor authentication")
+	}
+	if t.Enabled {
+		return apperr.New(codes.AlreadyExists, apperr.MFAAlreadyEnabled, "two-factor authentication is already enabled")
+	}
+	step, ok := utils.VerifyTOTP(t.Secret, req.Code, time.Now())
+	if !ok {
+		return invalidMFACode(codes.InvalidArgument)
+	}
+
+	recoveryCodes, hashes, err := newRecoveryCodes()
+	if err != nil {
+		return err
+	}
+	enabled, err := MFA.EnableTOTP(ctx, t.UserID, step, hashes)
+	if err != nil {
+		logger.ErrorContext(ctx, "MFA query failed", "error", err)
+		return apperr.New(codes.Internal, apperr.Internal, "could not enable two-factor authentication")
+	}
+	if !enabled {
+		return apperr.New(codes.AlreadyExists, apperr.MFAAlreadyEnabled, "two-factor authentication is already enabled")
+	}
+	audit(c, models.AuditEvent{Event: models.EventMFAEnabled, UserID: &t.UserID})
+
+	token, err := utils.GenerateToken(t.UserID, utils.Role(c), utils.OrgID(c), utils.SessionID(c), true)
+	if err != nil {
+		return err
+	}
+	extendSession(c)
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"recovery_codes": recoveryCodes,
+		"token":          token,
+	})
+}
+
+// DisableTOTP turns two-factor authentication off, confirmed with a current
+// code, unless the caller's role requires it
+func DisableTOTP(c echo.Context) error {
+	req := new(codeRequest)
+	if err := c.Bind(req); err != nil {
+		return err
+	}
+
+	t, err := enabledTOTP(c)
+	if err != nil {
+		return err
+	}
+	if mfaRequired(utils.Role(c)) {
+		return apperr.New(codes.PermissionDenied, apperr.MFARequired, "two-factor authentication is required for your role")
+	}
+	if err := confirmSecondFactor(c, t, req.Code); err != nil {
+		return err
+	}
+
+	if err := MFA.DisableTOTP(c.Request().Context(), t.UserID); err != nil {
+		logger.ErrorContext(c.Request().Context(), "MFA query failed", "error", err)
+		return apperr.New(codes.Internal, apperr.Internal, "could not disable two-factor authentication")
+	}
+	audit(c, models.AuditEvent{Event: models.EventMFADisabled, UserID: &t.UserID})
+	return c.NoContent(http.StatusNoContent)
+}
+
+// RegenerateRecoveryCodes replaces the caller's recovery codes, confirmed with
+// a current code
+func RegenerateRecoveryCodes(c echo.Context) error {
+	req := new(codeRequest)
+	if err := c.Bind(req); err != nil {
+		return err
+	}
+
+	t, err := enabledTOTP(c)
+	if err != nil {
+		return err
+	}
+	if err := confirmSecondFactor(c, t, req.Code); err != nil {
+		return err
+	}
+
+	recoveryCodes, hashes, err := newRecoveryCodes()
+	if err != nil {
+		return err
+	}
+	if err := MFA.ReplaceRecoveryCodes(c.Request().Context(), t.UserID, hashes); err != nil {
+		logger.ErrorContext(c.Request().Context(), "MFA query failed", "error", err)
+		return apperr.New(codes.Internal, apperr.Internal, "could not replace recovery codes")
+	}
+	audit(c, models.AuditEvent{Event: models.EventRecoveryCodesRegenerated, UserID: &t.UserID})
+	return c.JSON(http.StatusOK, map[string]interface{}{"recovery_codes": recoveryCodes})
+}
@@ -0,0 +1,65 @@
+package handlers
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"echo-api/utils"
+	"file-service/apperr"
+	"file-service/config"
+)
+
+func TestConfirmSecondFactor(t *testing.T) {
+	m := useMemory(t)
+	ctx := context.Background()
+	alice := addUser(t, m, "alice", "password1")
+	Lockout = config.Lockout{Attempts: 3, Duration: time.Minute, Window: time.Hour}
+
+	secret, err := utils.NewTOTPSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+	codes, hashes, err := newRecoveryCodes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.StartTOTP(ctx, alice.ID, secret); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.EnableTOTP(ctx, alice.ID, 0, hashes); err != nil {
+		t.Fatal(err)
+	}
+
+	// Wrong codes count towards the lockout of the account, which then
+	// refuses even a right code
+	steps := []struct {
+		name string
+		code string
+		want apperr.Code
+	}{
+		{name: "recovery code", code: codes[0]},
+		{name: "used recovery code", code: codes[0], want: apperr.InvalidMFACode},
+		{name: "wrong code", code: "000000", want: apperr.InvalidMFACode},
+		{name: "another wrong code", code: "not a code", want: apperr.InvalidMFACode},
+		{name: "locked out", code: codes[1], want: apperr.LoginThrottled},
+	}
+	claims := jwt.MapClaims{"user_id": float64(alice.ID)}
+	for _, step := range steps {
+		c, _ := newContext("", "192.0.2.1", claims)
+		totp, err := m.GetTOTP(ctx, alice.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := confirmSecondFactor(c, totp, step.code); codeOf(err) != step.want {
+			t.Fatalf("%s: confirmSecondFactor() = %v, want code %q", step.name, err, step.want)
+		}
+	}
+
+	// The lockout also stops logging in with a password
+	c, _ := newContext(`{"username": "alice", "password": "password1"}`, "192.0.2.2", nil)
+	if err := Login(c); codeOf(err) != apperr.LoginThrottled {
+		t.Errorf("Login() = %v, want code %q", err, apperr.LoginThrottled)
+	}
+}
@@ -0,0 +1,347 @@
+package handlers
+
+import (
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"google.golang.org/grpc/codes"
+	"echo-api/models"
+	"echo-api/oidc"
+	"echo-api/store"
+	"echo-api/utils"
+	"file-service/apperr"
+	"file-service/config"
+	"file-service/metrics"
+)
+
+// Single sign-on providers by name and how their logins map to accounts, set
+// from the configuration at startup
+var (
+	OIDCProviders = map[string]*oidc.Provider{}
+	OIDC          = config.Defaults().OIDC
+)
+
+// oidcFlowCookie holds the flow of a login in progress at a provider
+const oidcFlowCookie = "oidc_flow"
+
+// oidcProvider returns the provider named in the path
+func oidcProvider(c echo.Context) (*oidc.Provider, error) {
+	p, ok := OIDCProviders[c.Param("provider")]
+	if !ok {
+		return nil, apperr.New(codes.NotFound, apperr.OIDCProviderNotFound, "identity provider not found").
+			With("provider", c.Param("provider"))
+	}
+	return p, nil
+}
+
+// flowCookie returns the cookie keeping a flow for the provider's callback;
+// a negative maxAge deletes it
+func flowCookie(provider, value string, maxAge int) *http.Cookie {
+	return &http.Cookie{
+		Name:     oidcFlowCookie,
+		Value:    value,
+		Path:     "/auth/oidc/" + provider + "/",
+		MaxAge:   maxAge,
+		HttpOnly: true,
+		Secure:   strings.HasPrefix(OIDC.RedirectURL, "https://"),
+		SameSite: http.SameSiteLaxMode,
+	}
+}
+
+// ListOIDCProviders returns the providers users can log in with
+func ListOIDCProviders(c echo.Context) error {
+	providers := make([]map[string]string, 0, len(OIDCProviders))
+	for name := range OIDCProviders {
+		providers = append(providers, map[string]string{
+			"name":      name,
+			"login_url": "/auth/oidc/" + name + "/login",
+		})
+	}
+	sort.Slice(providers, func(i, j int) bool { return providers[i]["name"] < providers[j]["name"] })
+	return c.JSON(http.StatusOK, providers)
+}
+
+// StartOIDCLogin sends the browser to the provider's login page. The state,
+// nonce and PKCE verifier of the flow stay in a signed cookie until the
+// provider sends the user back to OIDCCallback.
+func StartOIDCLogin(c echo.Context) error {
+	p, err := oidcProvider(c)
+	if err != nil {
+		return err
+	}
+	ctx := c.Request().Context()
+
+	flow := utils.OIDCFlow{Provider: p.Name()}
+	if flow.State, err = utils.NewToken(); err != nil {
+		return err
+	}
+	if flow.Nonce, err = utils.NewToken(); err != nil {
+		return err
+	}
+	if flow.Verifier, err = oidc.NewVerifier(); err != nil {
+		return err
+	}
+	authURL, err := p.AuthCodeURL(ctx, flow.State, flow.Nonce, flow.Verifier)
+	if err != nil {
+		logger.ErrorContext(ctx, "Identity provider unavailable", "provider", p.Name(), "error", err)
+		return apperr.New(codes.Unavailable, apperr.Unavailable, "identity provider unavailable, try again later")
+	}
+	signed, err := utils.GenerateOIDCFlow(flow, OIDC.FlowTTL)
+	if err != nil {
+		return err
+	}
+
+	c.SetCookie(flowCookie(p.Name(), signed, int(OIDC.FlowTTL.Seconds())))
+	return c.Redirect(http.StatusFound, authURL)
+}
+
+// OIDCCallback finishes a login at a provider: it checks the state against
+// the flow cookie, redeems the code and logs in the user the identity is
+// linked to, linking or creating one first if it is new. Users with TOTP
+// enabled still get an MFA challenge.
+func OIDCCallback(c echo.Context) error {
+	p, err := oidcProvider(c)
+	if err != nil {
+		return err
+	}
+	ctx := c.Request().Context()
+
+	invalidState := apperr.New(codes.Unauthenticated, apperr.InvalidOIDCState,
+		"the login expired or was started in another browser; start it again")
+	cookie, err := c.Cookie(oidcFlowCookie)
+	c.SetCookie(flowCookie(p.Name(), "", -1))
+	if err != nil {
+		return invalidState
+	}
+	flow, err := utils.ParseOIDCFlow(cookie.Value)
+	if err != nil || flow.Provider != p.Name() ||
+		subtle.ConstantTimeCompare([]byte(flow.State), []byte(c.QueryParam("state"))) != 1 {
+		metrics.AuthFailures.WithLabelValues("gateway", string(apperr.InvalidOIDCState)).Inc()
+		return invalidState
+	}
+
+	if reason := c.QueryParam("error"); reason != "" {
+		metrics.AuthFailures.WithLabelValues("gateway", "oidc_denied").Inc()
+		return apperr.New(codes.Unauthenticated, apperr.OIDCLoginFailed, "the identity provider did not log you in").
+			With("provider", p.Name()).With("reason", reason)
+	}
+	id, err := p.Exchange(ctx, c.QueryParam("code"), flow.Verifier, flow.Nonce)
+	if err != nil {
+		logger.WarnContext(ctx, "Single sign-on failed", "provider", p.Name(), "error", err)
+		metrics.AuthFailures.WithLabelValues("gateway", "oidc_failed").Inc()
+		return apperr.New(codes.Unauthenticated, apperr.OIDCLoginFailed, "could not verify the login at the identity provider").
+			With("provider", p.Name())
+	}
+
+	user, err := identityUser(c, p.Name(), id)
+	if err != nil {
+		return err
+	}
+	return completeLogin(c, user)
+}
+
+// identityUser returns the user an identity is linked to. A new identity is
+// linked to the account with its email if both the provider and the account
+// verified it, and otherwise gets an account of its own.
+func identityUser(c echo.Context, provider string, id *oidc.Identity) (*models.User, error) {
+	ctx, now := c.Request().Context(), time.Now()
+	identity, err := Identities.GetIdentity(ctx, provider, id.Subject)
+	if err == nil {
+		if err := Identities.TouchIdentity(ctx, identity.ID, id.Email, now); err != nil {
+			logger.WarnContext(ctx, "Recording identity login failed", "error", err)
+		}
+		user, err := Users.GetUser(ctx, identity.UserID)
+		if err != nil {
+			logger.ErrorContext(ctx, "Login failed", "error", err)
+			return nil, apperr.New(codes.Internal, apperr.Internal, "could not log in")
+		}
+		return user, nil
+	}
+	if !errors.Is(err, store.ErrNotFound) {
+		logger.ErrorContext(ctx, "Login failed", "error", err)
+		return nil, apperr.New(codes.Internal, apperr.Internal, "could not log in")
+	}
+
+	// Addresses the provider did not verify are neither linked nor copied
+	email := ""
+	if id.EmailVerified {
+		email, _ = normalizeEmail(id.Email)
+	}
+	var user *models.User
+	if OIDC.LinkByEmail && email != "" {
+		user, err = Users.GetUserByEmail(ctx, email)
+		if err != nil && !errors.Is(err, store.ErrNotFound) {
+			logger.ErrorContext(ctx, "Login failed", "error", err)
+			return nil, apperr.New(codes.Internal, apperr.Internal, "could not log in")
+		}
+		if user != nil && !user.EmailVerified {
+			user = nil
+		}
+	}
+	if user == nil {
+		if !OIDC.AutoCreate {
+			return nil, apperr.New(codes.PermissionDenied, apperr.IdentityNotLinked, "no account is linked to this identity").
+				With("provider", provider)
+		}
+		if user, err = provisionUser(c, provider, id, email); err != nil {
+			return nil, err
+		}
+	}
+
+	identity = &models.Identity{UserID: user.ID, Provider: provider, Subject: id.Subject, Email: id.Email}
+	if err := Identities.CreateIdentity(ctx, identity); err != nil {
+		logger.ErrorContext(ctx, "Linking identity failed", "error", err)
+		return nil, apperr.New(codes.Internal, apperr.Internal, "could not link identity")
+	}
+	if err := Identities.TouchIdentity(ctx, identity.ID, id.Email, now); err != nil {
+		logger.WarnContext(ctx, "Recording identity login failed", "error", err)
+	}
+	audit(c, models.AuditEvent{
+		Event:   models.EventIdentityLinked,
+		UserID:  &user.ID,
+		Details: map[string]interface{}{"provider": provider, "subject": id.Subject},
+	})
+	return user, nil
+}
+
+// provisionUser creates the account of a new identity, named after the
+// username or email the provider gave. It has no password, so it logs in
+// through the provider until one is set with a password reset.
+func provisionUser(c echo.Context, provider string, id *oidc.Identity, email string) (*models.User, error) {
+	ctx := c.Request().Context()
+	failed := func(err error) (*models.User, error) {
+		logger.ErrorContext(ctx, "Provisioning user failed", "error", err)
+		return nil, apperr.New(codes.Internal, apperr.Internal, "could not create user")
+	}
+
+	// The email may belong to an account it was not linked to
+	if email != "" {
+		if _, err := Users.GetUserByEmail(ctx, email); err == nil {
+			email = ""
+		} else if !errors.Is(err, store.ErrNotFound) {
+			return failed(err)
+		}
+	}
+
+	base := usernameFor(provider, id)
+	for n := 1; n <= 100; n++ {
+		username := base
+		if n > 1 {
+			username += strconv.Itoa(n)
+		}
+		if _, err := Users.GetUserByUsername(ctx, username); err == nil {
+			continue
+		} else if !errors.Is(err, store.ErrNotFound) {
+			return failed(err)
+		}
+
+		u := &models.User{Username: username, Email: email}
+		if err := Users.CreateUser(ctx, u); err != nil {
+			return failed(err)
+		}
+		if email != "" {
+			var err error
+			if u.EmailVerified, err = Users.VerifyEmail(ctx, u.ID, email); err != nil {
+				logger.WarnContext(ctx, "Verifying provisioned email failed", "error", err)
+			}
+		}
+		audit(c, models.AuditEvent{
+			Event:   models.EventUserProvisioned,
+			UserID:  &u.ID,
+			Details: map[string]interface{}{"provider": provider, "username": username},
+		})
+		return u, nil
+	}
+	return failed(fmt.Errorf("no free username like %q", base))
+}
+
+// usernameFor derives a username from the preferred username or email of an
+// identity, keeping letters, digits, dots, dashes and underscores
+func usernameFor(provider string, id *oidc.Identity) string {
+	name := id.PreferredUsername
+	if name == "" {
+		name, _, _ = strings.Cut(id.Email, "@")
+	}
+	name = strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= '0' && r <= '9', r == '.', r == '-', r == '_':
+			return r
+		case r >= 'A' && r <= 'Z':
+			return r + 'a' - 'A'
+		}
+		return -1
+	}, name)
+	if len(name) > 40 {
+		name = name[:40]
+	}
+	if name == "" {
+		name = provider + "-user"
+	}
+	return name
+}
+
+// ListIdentities returns the provider identities linked to the current user
+func ListIdentities(c echo.Context) error {
+	identities, err := Identities.ListIdentities(c.Request().Context(), utils.UserID(c))
+	if err != nil {
+		logger.ErrorContext(c.Request().Context(), "Listing identities failed", "error", err)
+		return apperr.New(codes.Internal, apperr.Internal, "could not list identities")
+	}
+	return c.JSON(http.StatusOK, identities)
+}
+
+// UnlinkIdentity unlinks one of the current user's identities. Users without
+// a password must keep one, since it is their only way to log in.
+func UnlinkIdentity(c echo.Context) error {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return badRequest("invalid identity id")
+	}
+	ctx, userID := c.Request().Context(), utils.UserID(c)
+	notFound := apperr.New(codes.NotFound, apperr.IdentityNotFound, "identity not found")
+
+	user, err := Users.GetUser(ctx, userID)
+	if err != nil {
+		return apperr.New(codes.NotFound, apperr.UserNotFound, "user not found")
+	}
+	identities, err := Identities.ListIdentities(ctx, userID)
+	if err != nil {
+		logger.ErrorContext(ctx, "Unlinking identity failed", "error", err)
+		return apperr.New(codes.Internal, apperr.Internal, "could not unlink identity")
+	}
+	var identity *models.Identity
+	for i := range identities {
+		if identities[i].ID == id {
+			identity = &identities[i]
+		}
+	}
+	if identity == nil {
+		return notFound
+	}
+	if user.PasswordHash == "" && len(identities) == 1 {
+		return apperr.New(codes.FailedPrecondition, apperr.LastLoginMethod,
+			"set a password before unlinking the only identity you log in with")
+	}
+
+	ok, err := Identities.DeleteIdentity(ctx, userID, id)
+	if err != nil {
+		logger.ErrorContext(ctx, "Unlinking identity failed", "error", err)
+		return apperr.New(codes.Internal, apperr.Internal, "could not unlink identity")
+	}
+	if !ok {
+		return notFound
+	}
+	audit(c, models.AuditEvent{
+		Event:   models.EventIdentityUnlinked,
+		UserID:  &userID,
+		Details: map[string]interface{}{"provider": identity.Provider, "subject": identity.Subject},
+	})
+	return c.NoContent(http.StatusNoContent)
+}
@@ -0,0 +1,221 @@
+package handlers
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/labstack/echo/v4"
+	"echo-api/oidc"
+	"echo-api/utils"
+	"file-service/apperr"
+	"file-service/config"
+)
+
+// mockProvider is an OpenID Connect provider that logs in whoever is set as
+// its user, signing ID tokens with an RSA key
+type mockProvider struct {
+	*httptest.Server
+
+	mu    sync.Mutex
+	user  jwt.MapClaims
+	codes map[string]url.Values // Authorization requests by the code issued
+}
+
+func newMockProvider(t *testing.T) *mockProvider {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := &mockProvider{codes: map[string]url.Values{}}
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"issuer":                                p.URL,
+			"authorization_endpoint":                p.URL + "/authorize",
+			"token_endpoint":                        p.URL + "/token",
+			"jwks_uri":                              p.URL + "/jwks",
+			"token_endpoint_auth_methods_supported": []string{"client_secret_basic"},
+		})
+	})
+	mux.HandleFunc("GET /jwks", func(w http.ResponseWriter, r *http.Request) {
+		b64 := base64.RawURLEncoding.EncodeToString
+		json.NewEncoder(w).Encode(map[string]interface{}{"keys": []map[string]string{{
+			"kty": "RSA", "kid": "key", "use": "sig", "alg": "RS256",
+			"n": b64(key.N.Bytes()), "e": b64(big.NewInt(int64(key.E)).Bytes()),
+		}}})
+	})
+	// The login page logs the user in at once and sends them back with a code
+	mux.HandleFunc("GET /authorize", func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		code, _ := utils.NewToken()
+		p.mu.Lock()
+		p.codes[code] = q
+		p.mu.Unlock()
+		http.Redirect(w, r, q.Get("redirect_uri")+"?"+url.Values{"code": {code}, "state": {q.Get("state")}}.Encode(), http.StatusFound)
+	})
+	mux.HandleFunc("POST /token", func(w http.ResponseWriter, r *http.Request) {
+		p.mu.Lock()
+		auth, ok := p.codes[r.FormValue("code")]
+		delete(p.codes, r.FormValue("code"))
+		user := p.user
+		p.mu.Unlock()
+		sum := sha256.Sum256([]byte(r.FormValue("code_verifier")))
+		id, secret, _ := r.BasicAuth()
+		if !ok || id != "echo-api" || secret != "secret" || r.FormValue("redirect_uri") != auth.Get("redirect_uri") ||
+			base64.RawURLEncoding.EncodeToString(sum[:]) != auth.Get("code_challenge") {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{"error": "invalid_grant"})
+			return
+		}
+
+		claims := jwt.MapClaims{"iss": p.URL, "aud": "echo-api", "nonce": auth.Get("nonce"),
+			"iat": time.Now().Unix(), "exp": time.Now().Add(time.Minute).Unix()}
+		for k, v := range user {
+			claims[k] = v
+		}
+		token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+		token.Header["kid"] = "key"
+		signed, err := token.SignedString(key)
+		if err != nil {
+			t.Error(err)
+		}
+		json.NewEncoder(w).Encode(map[string]string{"access_token": "access", "id_token": signed, "token_type": "Bearer"})
+	})
+	p.Server = httptest.NewServer(mux)
+	t.Cleanup(p.Close)
+	return p
+}
+
+// useMockProvider configures the mock provider under the name mock
+func useMockProvider(t *testing.T, cfg config.OIDC) *mockProvider {
+	p := newMockProvider(t)
+	previous, previousCfg := OIDCProviders, OIDC
+	cfg.RedirectURL, cfg.FlowTTL = "http://gateway.test", 10*time.Minute
+	OIDC = cfg
+	OIDCProviders = map[string]*oidc.Provider{"mock": oidc.New(
+		config.OIDCProvider{Name: "mock", Issuer: p.URL, ClientID: "echo-api", ClientSecret: "secret"},
+		"http://gateway.test/auth/oidc/mock/callback", []string{"openid", "email"})}
+	t.Cleanup(func() { OIDCProviders, OIDC = previous, previousCfg })
+	return p
+}
+
+// oidcLogin goes through a login at the mock provider as user, with the
+// browser handing the flow cookie and the provider's redirect back to the
+// gateway, and returns the callback's response
+func oidcLogin(t *testing.T, p *mockProvider, user jwt.MapClaims) (*httptest.ResponseRecorder, error) {
+	t.Helper()
+	p.mu.Lock()
+	p.user = user
+	p.mu.Unlock()
+
+	e := echo.New()
+	rec := httptest.NewRecorder()
+	c := e.NewContext(httptest.NewRequest(http.MethodGet, "/auth/oidc/mock/login", nil), rec)
+	c.SetParamNames("provider")
+	c.SetParamValues("mock")
+	if err := StartOIDCLogin(c); err != nil {
+		t.Fatal(err)
+	}
+	cookies := rec.Result().Cookies()
+
+	browser := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }}
+	res, err := browser.Get(rec.Header().Get(echo.HeaderLocation))
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	callback, err := url.Parse(res.Header.Get(echo.HeaderLocation))
+	if err != nil || callback.Host != "gateway.test" {
+		t.Fatalf("provider sent the browser to %q, %v", res.Header.Get(echo.HeaderLocation), err)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, callback.RequestURI(), nil)
+	for _, cookie := range cookies {
+		req.AddCookie(cookie)
+	}
+	rec = httptest.NewRecorder()
+	c = e.NewContext(req, rec)
+	c.SetParamNames("provider")
+	c.SetParamValues("mock")
+	return rec, OIDCCallback(c)
+}
+
+func TestOIDCLogin(t *testing.T) {
+	m := useMemory(t)
+	ctx := context.Background()
+	p := useMockProvider(t, config.OIDC{AutoCreate: true, LinkByEmail: true})
+
+	// A verified address links the identity to the account that verified it
+	alice := addUser(t, m, "alice", "password1")
+	if err := m.SetEmail(ctx, alice.ID, "alice@example.com"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.VerifyEmail(ctx, alice.ID, "alice@example.com"); err != nil {
+		t.Fatal(err)
+	}
+	rec, err := oidcLogin(t, p, jwt.MapClaims{"sub": "a1", "email": "Alice@example.com", "email_verified": true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var res struct{ Token string }
+	if err := json.Unmarshal(rec.Body.Bytes(), &res); err != nil || res.Token == "" {
+		t.Fatalf("callback answered %s, want a token", rec.Body)
+	}
+	claims := jwt.MapClaims{}
+	if _, err := jwt.ParseWithClaims(res.Token, claims, func(*jwt.Token) (interface{}, error) { return utils.JWTSecret, nil }); err != nil {
+		t.Fatal(err)
+	}
+	if id, _ := claims["user_id"].(float64); int(id) != alice.ID {
+		t.Errorf("logged in as user %v, want alice (%d)", claims["user_id"], alice.ID)
+	}
+
+	// Unverified addresses are not linked; the identity gets its own account
+	if _, err := oidcLogin(t, p, jwt.MapClaims{"sub": "b1", "email": "alice@example.com", "preferred_username": "Bob"}); err != nil {
+		t.Fatal(err)
+	}
+	bob, err := m.GetUserByUsername(ctx, "bob")
+	if err != nil || bob.Email != "" {
+		t.Fatalf("GetUserByUsername(bob) = %+v, %v, want an account without email", bob, err)
+	}
+	if _, err := oidcLogin(t, p, jwt.MapClaims{"sub": "b1", "preferred_username": "renamed"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.GetUserByUsername(ctx, "renamed"); err == nil {
+		t.Error("a second login of the identity created another account")
+	}
+}
+
+func TestOIDCLoginRejected(t *testing.T) {
+	useMemory(t)
+	p := useMockProvider(t, config.OIDC{})
+
+	if _, err := oidcLogin(t, p, jwt.MapClaims{"sub": "c1"}); codeOf(err) != apperr.IdentityNotLinked {
+		t.Errorf("login of an unknown identity without auto_create = %v, want code %q", err, apperr.IdentityNotLinked)
+	}
+	// ID tokens for another client are refused
+	if _, err := oidcLogin(t, p, jwt.MapClaims{"sub": "c1", "aud": "other"}); codeOf(err) != apperr.OIDCLoginFailed {
+		t.Errorf("login with a token for another client = %v, want code %q", err, apperr.OIDCLoginFailed)
+	}
+
+	// The callback only works in the browser that started the login
+	c, _ := newContext("", "192.0.2.1", nil)
+	c.Request().URL.RawQuery = "code=code&state=state"
+	c.SetParamNames("provider")
+	c.SetParamValues("mock")
+	if err := OIDCCallback(c); codeOf(err) != apperr.InvalidOIDCState {
+		t.Errorf("callback without the flow cookie = %v, want code %q", err, apperr.InvalidOIDCState)
+	}
+}
@@ -0,0 +1,275 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/labstack/echo/v4"
+	"google.golang.org/grpc/codes"
+	"echo-api/models"
+	"echo-api/store"
+	"echo-api/utils"
+	"file-service/apperr"
+)
+
+// orgParam parses the :id route parameter and returns the caller's role in that organization
+func orgParam(c echo.Context) (int, string, error) {
+	orgID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return 0, "", badRequest("invalid organization id")
+	}
+
+	role, err := Orgs.MemberRole(c.Request().Context(), orgID, utils.UserID(c))
+	if err != nil {
+		logger.ErrorContext(c.Request().Context(), "Organization query failed", "error", err)
+		return 0, "", apperr.New(codes.Internal, apperr.Internal, "could not load organization")
+	}
+	if role == "" {
+		return 0, "", apperr.New(codes.NotFound, apperr.OrgNotFound, "organization not found")
+	}
+	return orgID, role, nil
+}
+
+// CreateOrganization creates a shared organization owned by the caller
+func CreateOrganization(c echo.Context) error {
+	org := new(models.Organization)
+	if err := c.Bind(org); err != nil || org.Name == "" {
+		return badRequest("name is required")
+	}
+
+	org.Personal = false
+	org.MaxStorageBytes = nil
+	if err := Orgs.CreateOrganization(c.Request().Context(), utils.UserID(c), org); err != nil {
+		logger.ErrorContext(c.Request().Context(), "Organization query failed", "error", err)
+		return apperr.New(codes.Internal, apperr.Internal, "could not create organization")
+	}
+
+	org.Role = models.OrgRoleOwner
+	return c.JSON(http.StatusCreated, org)
+}
+
+// ListOrganizations lists the organizations the caller belongs to
+func ListOrganizations(c echo.Context) error {
+	orgs, err := Orgs.ListOrganizations(c.Request().Context(), utils.UserID(c))
+	if err != nil {
+		logger.ErrorContext(c.Request().Context(), "Organization query failed", "error", err)
+		return apperr.New(codes.Internal, apperr.Internal, "could not list organizations")
+	}
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"organizations": orgs,
+		"current":       utils.OrgID(c),
+	})
+}
+
+// SwitchOrganization issues a new token of the caller's session acting in
+// another organization they belong to
+func SwitchOrganization(c echo.Context) error {
+	orgID, _, err := orgParam(c)
+	if err != nil {
+		return err
+	}
+
+	t, err := utils.GenerateToken(utils.UserID(c), utils.Role(c), orgID, utils.SessionID(c), utils.MFA(c))
+	if err != nil {
+		return err
+	}
+	extendSession(c)
+
+	return c.JSON(http.StatusOK, map[string]string{"token": t})
+}
+
+// ListMembers lists the members of an organization the caller belongs to
+func ListMembers(c echo.Context) error {
+	orgID, _, err := orgParam(c)
+	if err != nil {
+		return err
+	}
+
+	members, err := Orgs.ListMembers(c.Request().Context(), orgID)
+	if err != nil {
+		logger.ErrorContext(c.Request().Context(), "Organization query failed", "error", err)
+		return apperr.New(codes.Internal, apperr.Internal, "could not list members")
+	}
+
+	return c.JSON(http.StatusOK, members)
+}
+
+// AddMember adds a user to an organization. Owners and admins may add
+// members; only owners may grant the owner role. Members already in it keep
+// their role, which only SetMemberRole changes.
+func AddMember(c echo.Context) error {
+	orgID, callerRole, err := orgParam(c)
+	if err != nil {
+		return err
+	}
+
+	m := new(models.Member)
+	if err := c.Bind(m); err != nil || m.Username == "" {
+		return badRequest("username is required")
+	}
+	if m.Role == "" {
+		m.Role = models.OrgRoleMember
+	}
+	if err := validateOrgRole(m.Role); err != nil {
+		return err
+	}
+	if callerRole != models.OrgRoleOwner && (callerRole != models.OrgRoleAdmin || m.Role == models.OrgRoleOwner) {
+		return apperr.New(codes.PermissionDenied, apperr.InsufficientRole, "insufficient organization role")
+	}
+
+	ctx := c.Request().Context()
+	org, err := Orgs.GetOrganization(ctx, orgID)
+	if err != nil {
+		logger.ErrorContext(c.Request().Context(), "Organization query failed", "error", err)
+		return apperr.New(codes.Internal, apperr.Internal, "could not add member")
+	}
+	if org.Personal {
+		return badRequest("personal organizations cannot have members")
+	}
+
+	user, err := Users.GetUserByUsername(ctx, m.Username)
+	if errors.Is(err, store.ErrNotFound) {
+		return apperr.New(codes.NotFound, apperr.UserNotFound, "user not found")
+	}
+	if err != nil {
+		logger.ErrorContext(c.Request().Context(), "Organization query failed", "error", err)
+		return apperr.New(codes.Internal, apperr.Internal, "could not add member")
+	}
+	m.UserID = user.ID
+
+	added, err := Orgs.AddMember(ctx, orgID, m.UserID, m.Role)
+	if err != nil {
+		logger.ErrorContext(c.Request().Context(), "Organization query failed", "error", err)
+		return apperr.New(codes.Internal, apperr.Internal, "could not add member")
+	}
+	if !added {
+		return apperr.New(codes.AlreadyExists, apperr.AlreadyMember, "user is already a member")
+	}
+
+	return c.JSON(http.StatusOK, m)
+}
+
+// SetMemberRole changes the role of a member of an organization. Only owners
+// may, and the last owner cannot be demoted.
+func SetMemberRole(c echo.Context) error {
+	orgID, callerRole, err := orgParam(c)
+	if err != nil {
+		return err
+	}
+
+	userID, err := strconv.Atoi(c.Param("user_id"))
+	if err != nil {
+		return badRequest("invalid user id")
+	}
+	var req struct {
+		Role string `json:"role"`
+	}
+	if err := c.Bind(&req); err != nil {
+		return badRequest("invalid request body")
+	}
+	if err := validateOrgRole(req.Role); err != nil {
+		return err
+	}
+	if callerRole != models.OrgRoleOwner {
+		return apperr.New(codes.PermissionDenied, apperr.OwnerOnly, "only owners can change roles")
+	}
+
+	ctx := c.Request().Context()
+	role, err := Orgs.MemberRole(ctx, orgID, userID)
+	if err != nil {
+		logger.ErrorContext(ctx, "Organization query failed", "error", err)
+		return apperr.New(codes.Internal, apperr.Internal, "could not change role")
+	}
+	if role == "" {
+		return apperr.New(codes.NotFound, apperr.NotMember, "user is not a member")
+	}
+	changed, err := Orgs.SetMemberRole(ctx, orgID, userID, req.Role)
+	if err != nil {
+		logger.ErrorContext(ctx, "Organization query failed", "error", err)
+		return apperr.New(codes.Internal, apperr.Internal, "could not change role")
+	}
+	if !changed {
+		return apperr.New(codes.FailedPrecondition, apperr.LastOwner, "the last owner cannot be demoted")
+	}
+
+	return c.JSON(http.StatusOK, models.Member{UserID: userID, Role: req.Role})
+}
+
+// validateOrgRole accepts the roles of organization members
+func validateOrgRole(role string) error {
+	if role != models.OrgRoleOwner && role != models.OrgRoleAdmin && role != models.OrgRoleMember {
+		return badRequest("role must be owner, admin or member")
+	}
+	return nil
+}
+
+// RemoveMember removes a user from an organization. Owners may remove others,
+// admins may remove anyone but owners, anyone may leave, and the last owner
+// cannot be removed.
+func RemoveMember(c echo.Context) error {
+	orgID, callerRole, err := orgParam(c)
+	if err != nil {
+		return err
+	}
+
+	userID, err := strconv.Atoi(c.Param("user_id"))
+	if err != nil {
+		return badRequest("invalid user id")
+	}
+	if userID != utils.UserID(c) && callerRole != models.OrgRoleOwner && callerRole != models.OrgRoleAdmin {
+		return apperr.New(codes.PermissionDenied, apperr.InsufficientRole, "insufficient organization role")
+	}
+
+	ctx := c.Request().Context()
+	role, err := Orgs.MemberRole(ctx, orgID, userID)
+	if err != nil {
+		logger.ErrorContext(ctx, "Organization query failed", "error", err)
+		return apperr.New(codes.Internal, apperr.Internal, "could not remove member")
+	}
+	if role == "" {
+		return apperr.New(codes.NotFound, apperr.NotMember, "user is not a member")
+	}
+	if role == models.OrgRoleOwner && userID != utils.UserID(c) && callerRole != models.OrgRoleOwner {
+		return apperr.New(codes.PermissionDenied, apperr.OwnerOnly, "only owners can remove owners")
+	}
+
+	removed, err := Orgs.RemoveMember(ctx, orgID, userID)
+	if err != nil {
+		logger.ErrorContext(ctx, "Organization query failed", "error", err)
+		return apperr.New(codes.Internal, apperr.Internal, "could not remove member")
+	}
+	if !removed {
+		return apperr.New(codes.FailedPrecondition, apperr.LastOwner, "the last owner cannot be removed")
+	}
+
+	return c.NoContent(http.StatusNoContent)
+}
+
+// SetOrganizationQuota sets an organization's storage limit; null removes it. Admin only.
+func SetOrganizationQuota(c echo.Context) error {
+	orgID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return badRequest("invalid organization id")
+	}
+
+	body := new(models.Organization)
+	if err := c.Bind(body); err != nil {
+		return badRequest("invalid request body")
+	}
+	if body.MaxStorageBytes != nil && *body.MaxStorageBytes < 0 {
+		return badRequest("max_storage_bytes must not be negative")
+	}
+
+	err = Orgs.SetQuota(c.Request().Context(), orgID, body.MaxStorageBytes)
+	if errors.Is(err, store.ErrNotFound) {
+		return apperr.New(codes.NotFound, apperr.OrgNotFound, "organization not found")
+	}
+	if err != nil {
+		logger.ErrorContext(c.Request().Context(), "Organization query failed", "error", err)
+		return apperr.New(codes.Internal, apperr.Internal, "could not update quota")
+	}
+
+	return c.JSON(http.StatusOK, map[string]interface{}{"id": orgID, "max_storage_bytes": body.MaxStorageBytes})
+}
@@ -0,0 +1,87 @@
+package handlers
+
+import (
+	"context"
+	"strconv"
+	"testing"
+
+	"github.com/golang-jwt/jwt/v5"
+	"echo-api/models"
+	"file-service/apperr"
+)
+
+func TestOrganizationMembers(t *testing.T) {
+	m := useMemory(t)
+	ctx := context.Background()
+	owner := addUser(t, m, "owner", "password1")
+	admin := addUser(t, m, "admin", "password1")
+	member := addUser(t, m, "member", "password1")
+	addUser(t, m, "newcomer", "password1")
+	org := &models.Organization{Name: "team"}
+	if err := m.CreateOrganization(ctx, owner.ID, org); err != nil {
+		t.Fatal(err)
+	}
+	for userID, role := range map[int]string{admin.ID: models.OrgRoleAdmin, member.ID: models.OrgRoleMember} {
+		if _, err := m.AddMember(ctx, org.ID, userID, role); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	add := func(body string) func(callerID int) error {
+		return func(callerID int) error {
+			c, _ := newContext(body, "192.0.2.1", jwt.MapClaims{"user_id": float64(callerID)})
+			c.SetParamNames("id")
+			c.SetParamValues(strconv.Itoa(org.ID))
+			return AddMember(c)
+		}
+	}
+	setRole := func(userID int, role string) func(callerID int) error {
+		return func(callerID int) error {
+			c, _ := newContext(`{"role": "`+role+`"}`, "192.0.2.1", jwt.MapClaims{"user_id": float64(callerID)})
+			c.SetParamNames("id", "user_id")
+			c.SetParamValues(strconv.Itoa(org.ID), strconv.Itoa(userID))
+			return SetMemberRole(c)
+		}
+	}
+	remove := func(userID int) func(callerID int) error {
+		return func(callerID int) error {
+			c, _ := newContext("", "192.0.2.1", jwt.MapClaims{"user_id": float64(callerID)})
+			c.SetParamNames("id", "user_id")
+			c.SetParamValues(strconv.Itoa(org.ID), strconv.Itoa(userID))
+			return RemoveMember(c)
+		}
+	}
+
+	// Steps run in order, each on the memberships the previous ones left
+	steps := []struct {
+		name   string
+		caller int
+		do     func(callerID int) error
+		code   apperr.Code
+	}{
+		{name: "admin re-adds the owner as a member", caller: admin.ID, do: add(`{"username": "owner", "role": "member"}`), code: apperr.AlreadyMember},
+		{name: "admin adds an owner", caller: admin.ID, do: add(`{"username": "newcomer", "role": "owner"}`), code: apperr.InsufficientRole},
+		{name: "member adds a member", caller: member.ID, do: add(`{"username": "newcomer"}`), code: apperr.InsufficientRole},
+		{name: "admin adds a member", caller: admin.ID, do: add(`{"username": "newcomer"}`)},
+		{name: "admin demotes the owner", caller: admin.ID, do: setRole(owner.ID, models.OrgRoleMember), code: apperr.OwnerOnly},
+		{name: "admin removes the owner", caller: admin.ID, do: remove(owner.ID), code: apperr.OwnerOnly},
+		{name: "owner demotes themselves", caller: owner.ID, do: setRole(owner.ID, models.OrgRoleAdmin), code: apperr.LastOwner},
+		{name: "owner changes the role of a non-member", caller: owner.ID, do: setRole(owner.ID+1000, models.OrgRoleAdmin), code: apperr.NotMember},
+		{name: "owner gives an invalid role", caller: owner.ID, do: setRole(member.ID, "boss"), code: apperr.InvalidRequest},
+		{name: "owner promotes a member", caller: owner.ID, do: setRole(member.ID, models.OrgRoleOwner)},
+		{name: "owner leaves", caller: owner.ID, do: remove(owner.ID)},
+		{name: "last owner leaves", caller: member.ID, do: remove(member.ID), code: apperr.LastOwner},
+	}
+	for _, step := range steps {
+		if err := step.do(step.caller); codeOf(err) != step.code {
+			t.Fatalf("%s: %v, want code %q", step.name, err, step.code)
+		}
+	}
+
+	want := map[int]string{admin.ID: models.OrgRoleAdmin, member.ID: models.OrgRoleOwner}
+	for userID, role := range want {
+		if got, _ := m.MemberRole(ctx, org.ID, userID); got != role {
+			t.Errorf("role of user %d = %q, want %q", userID, got, role)
+		}
+	}
+}
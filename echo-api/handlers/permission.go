@@ -0,0 +1,109 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+	"echo-api/clients"
+	downloadpb "file-service/proto/download"
+)
+
+// Kinds of resources that can be shared with other users
+const (
+	ResourceFile   = "file"
+	ResourceFolder = "folder"
+)
+
+// grantRequest is the body accepted when sharing a file or folder
+type grantRequest struct {
+	Username string `json:"username"`
+	Access   string `json:"access"` // "read" or "read_write"
+}
+
+// resourceIDs maps the :id route parameter to a file or folder ID
+func resourceIDs(c echo.Context, kind string) (fileID string, folderID string) {
+	if kind == ResourceFolder {
+		return "", c.Param("id")
+	}
+	return c.Param("id"), ""
+}
+
+// GrantAccess returns a handler that shares a file or folder with another user
+func GrantAccess(kind string) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		req := new(grantRequest)
+		if err := c.Bind(req); err != nil || req.Username == "" {
+			return badRequest("username and access are required")
+		}
+
+		// Initialize file client
+		fileClient, err := clients.NewFileClient()
+		if err != nil {
+			return err
+		}
+
+		// Grant access
+		fileID, folderID := resourceIDs(c, kind)
+		token := c.Request().Header.Get("Authorization")
+		grant, err := fileClient.GrantAccess(c.Request().Context(), token, &downloadpb.GrantAccessRequest{
+			FileId:   fileID,
+			FolderId: folderID,
+			Username: req.Username,
+			Access:   req.Access,
+		})
+		if err != nil {
+			return err
+		}
+
+		return c.JSON(http.StatusOK, grant)
+	}
+}
+
+// RevokeAccess returns a handler that removes a user's access to a file or folder
+func RevokeAccess(kind string) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		// Initialize file client
+		fileClient, err := clients.NewFileClient()
+		if err != nil {
+			return err
+		}
+
+		// Revoke access
+		fileID, folderID := resourceIDs(c, kind)
+		token := c.Request().Header.Get("Authorization")
+		err = fileClient.RevokeAccess(c.Request().Context(), token, &downloadpb.RevokeAccessRequest{
+			FileId:   fileID,
+			FolderId: folderID,
+			UserId:   c.Param("user_id"),
+		})
+		if err != nil {
+			return err
+		}
+
+		return c.NoContent(http.StatusNoContent)
+	}
+}
+
+// ListGrants returns a handler that lists the users a file or folder is shared with
+func ListGrants(kind string) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		// Initialize file client
+		fileClient, err := clients.NewFileClient()
+		if err != nil {
+			return err
+		}
+
+		// List grants
+		fileID, folderID := resourceIDs(c, kind)
+		token := c.Request().Header.Get("Authorization")
+		resp, err := fileClient.ListGrants(c.Request().Context(), token, &downloadpb.ListGrantsRequest{
+			FileId:   fileID,
+			FolderId: folderID,
+		})
+		if err != nil {
+			return err
+		}
+
+		return c.JSON(http.StatusOK, resp)
+	}
+}
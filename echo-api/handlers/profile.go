@@ -0,0 +1,507 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/labstack/echo/v4"
+	"google.golang.org/grpc/codes"
+	"echo-api/clients"
+	"echo-api/mailer"
+	"echo-api/models"
+	"echo-api/store"
+	"echo-api/utils"
+	"file-service/apperr"
+	uploadpb "file-service/proto/upload"
+)
+
+// maxDisplayName is the longest display name, in characters
+const maxDisplayName = 100
+
+// profile is the current user as returned to them
+type profile struct {
+	*models.User
+	HasPassword bool `json:"has_password"` // False for users who only log in with a provider
+}
+
+// validateUsername accepts 1 to 40 letters, digits, dots, dashes and underscores
+func validateUsername(username string) error {
+	if username == "" || len(username) > 40 {
+		return badRequest("username must be 1 to 40 characters")
+	}
+	for _, r := range username {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '.', r == '-', r == '_':
+		default:
+			return badRequest("username may only contain letters, digits, dots, dashes and underscores")
+		}
+	}
+	return nil
+}
+
+// validatePassword checks the length of a new password
+func validatePassword(password string) error {
+	if len(password) < utils.MinPasswordLength || len(password) > utils.MaxPasswordLength {
+		return badRequest(fmt.Sprintf("password must be %d to %d bytes", utils.MinPasswordLength, utils.MaxPasswordLength))
+	}
+	return nil
+}
+
+// validateDisplayName trims a display name and checks its length
+func validateDisplayName(name string) (string, error) {
+	name = strings.TrimSpace(name)
+	if utf8.RuneCountInString(name) > maxDisplayName {
+		return "", badRequest(fmt.Sprintf("display name must be at most %d characters", maxDisplayName))
+	}
+	return name, nil
+}
+
+// checkAvailable fails if a user other than userID has the username or email
+// address; empty values are not checked
+func checkAvailable(ctx context.Context, userID int, username, email string) error {
+	if username != "" {
+		u, err := Users.GetUserByUsername(ctx, username)
+		if err != nil && !errors.Is(err, store.ErrNotFound) {
+			logger.ErrorContext(ctx, "User lookup failed", "error", err)
+			return apperr.New(codes.Internal, apperr.Internal, "could not check username")
+		}
+		if u != nil && u.ID != userID {
+			return apperr.New(codes.AlreadyExists, apperr.UsernameTaken, "username is taken")
+		}
+	}
+	if email != "" {
+		u, err := Users.GetUserByEmail(ctx, email)
+		if err != nil && !errors.Is(err, store.ErrNotFound) {
+			logger.ErrorContext(ctx, "User lookup failed", "error", err)
+			return apperr.New(codes.Internal, apperr.Internal, "could not check email address")
+		}
+		if u != nil && u.ID != userID {
+			return apperr.New(codes.AlreadyExists, apperr.EmailTaken, "email address is used by another account")
+		}
+	}
+	return nil
+}
+
+// confirmPassword checks the current password of a user making a sensitive
+// change. Wrong passwords count as failed logins, so that a stolen token
+// cannot be used to guess it.
+func confirmPassword(c echo.Context, user *models.User, password string) error {
+	ctx, now := c.Request().Context(), time.Now()
+	wait, err := loginBlocked(ctx, user.Username, c.RealIP(), now)
+	if err != nil {
+		logger.ErrorContext(ctx, "Lockout query failed", "error", err)
+		return apperr.New(codes.Internal, apperr.Internal, "could not check password")
+	}
+	if wait > 0 {
+		return loginThrottled(wait)
+	}
+	if password == "" {
+		return apperr.New(codes.InvalidArgument, apperr.PasswordRequired, "current password is required")
+	}
+	if !utils.CheckPassword(user.PasswordHash, password) {
+		if err := loginFailed(c, user.Username, user, now); err != nil {
+			logger.ErrorContext(ctx, "Counting login failure failed", "error", err)
+		}
+		return apperr.New(codes.PermissionDenied, apperr.InvalidPassword, "wrong password")
+	}
+	return nil
+}
+
+// currentUser loads the user the request is made by
+func currentUser(c echo.Context) (*models.User, error) {
+	ctx := c.Request().Context()
+	user, err := Users.GetUser(ctx, utils.UserID(c))
+	if errors.Is(err, store.ErrNotFound) {
+		return nil, apperr.New(codes.NotFound, apperr.UserNotFound, "user not found")
+	}
+	if err != nil {
+		logger.ErrorContext(ctx, "User lookup failed", "error", err)
+		return nil, apperr.New(codes.Internal, apperr.Internal, "could not load user")
+	}
+	return user, nil
+}
+
+// Profile returns the current user
+func Profile(c echo.Context) error {
+	user, err := currentUser(c)
+	if err != nil {
+		return err
+	}
+	return c.JSON(http.StatusOK, profile{User: user, HasPassword: user.PasswordHash != ""})
+}
+
+// UpdateProfile changes the username, display name or email address of the
+// current user; fields left out are kept. Changing the username or email
+// address is confirmed like a password change. A new email address is
+// unverified until the link mailed to it is opened, and an empty one removes it.
+func UpdateProfile(c echo.Context) error {
+	var req struct {
+		Username        *string `json:"username"`
+		DisplayName     *string `json:"display_name"`
+		Email           *string `json:"email"`
+		CurrentPassword string  `json:"current_password"`
+	}
+	if err := c.Bind(&req); err != nil {
+		return err
+	}
+	user, err := currentUser(c)
+	if err != nil {
+		return err
+	}
+	ctx := c.Request().Context()
+	current := *user // As stored, for confirming the change
+
+	details := map[string]interface{}{}
+	if req.Username != nil && *req.Username != user.Username {
+		if err := validateUsername(*req.Username); err != nil {
+			return err
+		}
+		if err := checkAvailable(ctx, user.ID, *req.Username, ""); err != nil {
+			return err
+		}
+		details["old_username"] = user.Username
+		details["username"] = *req.Username
+		user.Username = *req.Username
+	}
+	if req.DisplayName != nil {
+		name, err := validateDisplayName(*req.DisplayName)
+		if err != nil {
+			return err
+		}
+		if name != user.DisplayName {
+			details["display_name"] = name
+			user.DisplayName = name
+		}
+	}
+	oldEmail := user.Email
+	if req.Email != nil {
+		email := ""
+		if *req.Email != "" {
+			if email, err = normalizeEmail(*req.Email); err != nil {
+				return err
+			}
+		}
+		if email != user.Email {
+			if err := checkAvailable(ctx, user.ID, "", email); err != nil {
+				return err
+			}
+			details["email"] = email
+			user.Email = email
+		}
+	}
+	if len(details) == 0 {
+		return c.JSON(http.StatusOK, profile{User: user, HasPassword: user.PasswordHash != ""})
+	}
+	_, renamed := details["username"]
+	if renamed || user.Email != oldEmail {
+		if err := confirmUser(c, &current, req.CurrentPassword); err != nil {
+			return err
+		}
+	}
+
+	if _, ok := details["email"]; ok {
+		err = Users.SetEmail(ctx, user.ID, user.Email)
+		user.EmailVerified = false
+	}
+	if err == nil {
+		err = Users.UpdateProfile(ctx, user)
+	}
+	if err != nil {
+		logger.ErrorContext(ctx, "Updating profile failed", "error", err)
+		return apperr.New(codes.Internal, apperr.Internal, "could not update profile")
+	}
+	audit(c, models.AuditEvent{Event: models.EventProfileUpdated, UserID: &user.ID, Details: details})
+
+	// Links mailed to the old address stop working, and its owner is told
+	if user.Email != oldEmail {
+		for _, purpose := range []string{models.TokenVerifyEmail, models.TokenResetPassword} {
+			if err := Tokens.DeleteTokens(ctx, user.ID, purpose); err != nil {
+				logger.WarnContext(ctx, "Deleting tokens failed", "error", err)
+			}
+		}
+		if oldEmail != "" {
+			sendMail(ctx, mailer.Message{
+				To:      oldEmail,
+				Subject: "Your email address was changed",
+				Body: fmt.Sprintf("Hi %s,\n\nthe email address of your account was just changed. If this was not you, "+
+					"contact an administrator.\n", user.Username),
+			})
+		}
+		if user.Email != "" {
+			if err := sendVerification(c, user); err != nil {
+				logger.ErrorContext(ctx, "Sending verification failed", "error", err)
+			}
+		}
+	}
+	return c.JSON(http.StatusOK, profile{User: user, HasPassword: user.PasswordHash != ""})
+}
+
+// recentLogin is how recently users who only log in with a provider must have
+// done so to change how they log in or are reached
+const recentLogin = 5 * time.Minute
+
+// confirmUser checks that a sensitive change is made by the user rather than
+// with a stolen token: with their current password, or for users who only
+// log in with a provider, by the session having just logged in with it
+func confirmUser(c echo.Context, user *models.User, password string) error {
+	if user.PasswordHash != "" {
+		return confirmPassword(c, user, password)
+	}
+	ctx := c.Request().Context()
+	s, err := Sessions.GetSession(ctx, utils.SessionID(c))
+	if err != nil && !errors.Is(err, store.ErrNotFound) {
+		logger.ErrorContext(ctx, "Session lookup failed", "error", err)
+		return apperr.New(codes.Internal, apperr.Internal, "could not check session")
+	}
+	if s == nil || time.Since(s.CreatedAt) > recentLogin {
+		return apperr.New(codes.PermissionDenied, apperr.RecentLoginRequired,
+			"log in with your provider again to make this change")
+	}
+	return nil
+}
+
+// ChangePassword sets a new password for the current user after checking the
+// current one; users who only log in with a provider set their first password
+// right after logging in with it. Every other session of the user is logged out.
+func ChangePassword(c echo.Context) error {
+	var req struct {
+		CurrentPassword string `json:"current_password"`
+		NewPassword     string `json:"new_password"`
+	}
+	if err := c.Bind(&req); err != nil {
+		return err
+	}
+	user, err := currentUser(c)
+	if err != nil {
+		return err
+	}
+	if err := validatePassword(req.NewPassword); err != nil {
+		return err
+	}
+	if err := confirmUser(c, user, req.CurrentPassword); err != nil {
+		return err
+	}
+
+	ctx := c.Request().Context()
+
+	hash, err := utils.HashPassword(req.NewPassword)
+	if err == nil {
+		err = Users.SetPassword(ctx, user.ID, hash)
+	}
+	if err != nil {
+		logger.ErrorContext(ctx, "Changing password failed", "error", err)
+		return apperr.New(codes.Internal, apperr.Internal, "could not change password")
+	}
+
+	if err := Tokens.DeleteTokens(ctx, user.ID, models.TokenResetPassword); err != nil {
+		logger.WarnContext(ctx, "Deleting tokens failed", "error", err)
+	}
+	if _, err := Sessions.DeleteSessions(ctx, user.ID, utils.SessionID(c)); err != nil {
+		logger.WarnContext(ctx, "Revoking sessions failed", "error", err)
+	}
+	audit(c, models.AuditEvent{Event: models.EventPasswordChanged, UserID: &user.ID})
+
+	if user.Email != "" {
+		sendMail(ctx, mailer.Message{
+			To:      user.Email,
+			Subject: "Your password was changed",
+			Body: fmt.Sprintf("Hi %s,\n\nthe password of your account was just changed. If this was not you, "+
+				"contact an administrator.\n", user.Username),
+		})
+	}
+	return c.NoContent(http.StatusNoContent)
+}
+
+// DeleteAccount deletes the current user, confirmed with their password, or
+// with their username if they have none. Their personal organization and the
+// organizations nobody else belongs to are deleted with all their files. Their
+// files in other organizations go to another owner of each, or are deleted
+// with "files": "delete". Sole owners of organizations with other members
+// must hand over ownership first.
+func DeleteAccount(c echo.Context) error {
+	var req struct {
+		Password        string `json:"password"`
+		ConfirmUsername string `json:"confirm_username"`
+		Files           string `json:"files"` // transfer or delete
+	}
+	if err := c.Bind(&req); err != nil {
+		return err
+	}
+	switch req.Files {
+	case "":
+		req.Files = "transfer"
+	case "transfer", "delete":
+	default:
+		return badRequest(`files must be "transfer" or "delete"`)
+	}
+	user, err := currentUser(c)
+	if err != nil {
+		return err
+	}
+	if user.PasswordHash != "" {
+		if err := confirmPassword(c, user, req.Password); err != nil {
+			return err
+		}
+	} else if req.ConfirmUsername != user.Username {
+		return badRequest("confirm_username must be your username")
+	}
+
+	ctx := c.Request().Context()
+	orgs, err := Orgs.ListOrganizations(ctx, user.ID)
+	if err != nil {
+		logger.ErrorContext(ctx, "Organization query failed", "error", err)
+		return apperr.New(codes.Internal, apperr.Internal, "could not list organizations")
+	}
+	release := &uploadpb.ReleaseUserFilesRequest{TransferTo: map[string]string{}}
+	var deleteOrgs []int
+	for _, org := range orgs {
+		members, err := Orgs.ListMembers(ctx, org.ID)
+		if err != nil {
+			logger.ErrorContext(ctx, "Member query failed", "error", err)
+			return apperr.New(codes.Internal, apperr.Internal, "could not list members")
+		}
+		var owner *models.Member
+		others := 0
+		for i, m := range members {
+			if m.UserID == user.ID {
+				continue
+			}
+			others++
+			if owner == nil && m.Role == models.OrgRoleOwner {
+				owner = &members[i]
+			}
+		}
+
+		switch {
+		case org.Personal || others == 0:
+			deleteOrgs = append(deleteOrgs, org.ID)
+			release.DeleteOrgIds = append(release.DeleteOrgIds, strconv.Itoa(org.ID))
+		case owner == nil:
+			return apperr.New(codes.FailedPrecondition, apperr.SoleOrgOwner,
+				"make another member an owner of the organization before deleting your account").
+				With("org_id", org.ID)
+		case req.Files == "transfer":
+			release.TransferTo[strconv.Itoa(org.ID)] = strconv.Itoa(owner.UserID)
+		}
+	}
+
+	// The account is closed to logins, API keys and its other sessions before
+	// its files are released, so nothing else adds to them meanwhile. The
+	// current session is kept for releasing them; if that or deleting the
+	// user fails, deleting the account again finishes the job.
+	if err := Users.MarkDeleting(ctx, user.ID, time.Now()); err != nil {
+		logger.ErrorContext(ctx, "Deleting user failed", "error", err)
+		return apperr.New(codes.Internal, apperr.Internal, "could not delete account")
+	}
+	if _, err := Sessions.DeleteSessions(ctx, user.ID, utils.SessionID(c)); err != nil {
+		logger.ErrorContext(ctx, "Revoking sessions failed", "error", err)
+		return apperr.New(codes.Internal, apperr.Internal, "could not delete account")
+	}
+
+	fileClient, err := clients.NewFileClient()
+	if err != nil {
+		return err
+	}
+	token := c.Request().Header.Get("Authorization")
+	released, err := fileClient.ReleaseUserFiles(ctx, token, release)
+	if err != nil {
+		return err
+	}
+
+	if err := Users.DeleteUser(ctx, user.ID, deleteOrgs); err != nil {
+		logger.ErrorContext(ctx, "Deleting user failed", "error", err)
+		return apperr.New(codes.Internal, apperr.Internal, "could not delete account")
+	}
+	audit(c, models.AuditEvent{
+		Event:  models.EventAccountDeleted,
+		UserID: &user.ID,
+		Details: map[string]interface{}{
+			"username":          user.Username,
+			"deleted_orgs":      len(deleteOrgs),
+			"deleted_files":     released.DeletedFiles,
+			"transferred_files": released.TransferredFiles,
+		},
+	})
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"deleted_organizations": len(deleteOrgs),
+		"deleted_files":         released.DeletedFiles,
+		"deleted_bytes":         released.DeletedBytes,
+		"transferred_files":     released.TransferredFiles,
+	})
+}
+
+// accountExport is everything stored about a user, as returned by ExportAccount
+type accountExport struct {
+	ExportedAt    time.Time              `json:"exported_at"`
+	Profile       profile                `json:"profile"`
+	Organizations []models.Organization  `json:"organizations"`
+	Identities    []models.Identity      `json:"identities"`
+	APIKeys       []models.APIKey        `json:"api_keys"`
+	Sessions      []models.Session       `json:"sessions"`
+	MFA           map[string]interface{} `json:"mfa"`
+	Files         interface{}            `json:"files"` // Metadata of the files the user uploaded
+	AuditEvents   []models.AuditEvent    `json:"audit_events"`
+}
+
+// ExportAccount returns the metadata of the current user's account, their
+// files and the audit events about them as a JSON download
+func ExportAccount(c echo.Context) error {
+	user, err := currentUser(c)
+	if err != nil {
+		return err
+	}
+	ctx, now := c.Request().Context(), time.Now()
+	export := accountExport{
+		ExportedAt: now.UTC(),
+		Profile:    profile{User: user, HasPassword: user.PasswordHash != ""},
+	}
+
+	t, err := MFA.GetTOTP(ctx, user.ID)
+	if errors.Is(err, store.ErrNotFound) {
+		t, err = &models.TOTP{}, nil
+	}
+	if err == nil {
+		export.Organizations, err = Orgs.ListOrganizations(ctx, user.ID)
+	}
+	if err == nil {
+		export.Identities, err = Identities.ListIdentities(ctx, user.ID)
+	}
+	if err == nil {
+		export.APIKeys, err = Keys.ListAPIKeys(ctx, user.ID)
+	}
+	if err == nil {
+		export.Sessions, err = Sessions.ListSessions(ctx, user.ID, now)
+	}
+	if err == nil {
+		export.AuditEvents, err = Audit.ListUserEvents(ctx, user.ID)
+	}
+	if err != nil {
+		logger.ErrorContext(ctx, "Account export failed", "error", err)
+		return apperr.New(codes.Internal, apperr.Internal, "could not export account")
+	}
+	export.MFA = map[string]interface{}{"enabled": t.Enabled, "recovery_codes_left": t.RecoveryCodesLeft}
+	for i := range export.Sessions {
+		export.Sessions[i].Current = export.Sessions[i].ID == utils.SessionID(c)
+	}
+
+	fileClient, err := clients.NewFileClient()
+	if err != nil {
+		return err
+	}
+	files, err := fileClient.ListOwnedFiles(ctx, c.Request().Header.Get("Authorization"))
+	if err != nil {
+		return err
+	}
+	export.Files = files.Files
+
+	c.Response().Header().Set(echo.HeaderContentDisposition,
+		fmt.Sprintf(`attachment; filename="account-%s.json"`, now.UTC().Format("20060102")))
+	return c.JSON(http.StatusOK, export)
+}
@@ -0,0 +1,150 @@
+package handlers
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"echo-api/mailer"
+	"echo-api/models"
+	"echo-api/utils"
+	"file-service/apperr"
+)
+
+// mailbox is a Mailer that hands every message to a channel
+type mailbox chan mailer.Message
+
+func (m mailbox) Send(ctx context.Context, msg mailer.Message) error {
+	m <- msg
+	return nil
+}
+
+// useMailbox points the handlers at a mailbox for the test
+func useMailbox(t *testing.T) mailbox {
+	m, previous := make(mailbox, 10), Mailer
+	Mailer = m
+	t.Cleanup(func() { Mailer = previous })
+	return m
+}
+
+// wait returns the next n messages, which are sent in the background
+func (m mailbox) wait(t *testing.T, n int) []mailer.Message {
+	t.Helper()
+	var msgs []mailer.Message
+	for range n {
+		select {
+		case msg := <-m:
+			msgs = append(msgs, msg)
+		case <-time.After(5 * time.Second):
+			t.Fatalf("got %d messages, want %d", len(msgs), n)
+		}
+	}
+	return msgs
+}
+
+func TestUpdateProfileConfirmation(t *testing.T) {
+	m := useMemory(t)
+	mail := useMailbox(t)
+	ctx := context.Background()
+	alice := addUser(t, m, "alice", "password1")
+	sso := &models.User{Username: "sso", Role: models.RoleUser}
+	if err := m.CreateUser(ctx, sso); err != nil {
+		t.Fatal(err)
+	}
+	fresh := &models.Session{UserID: sso.ID, ExpiresAt: time.Now().Add(time.Hour)}
+	if err := m.CreateSession(ctx, fresh); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		userID int
+		sid    int
+		body   string
+		code   apperr.Code
+	}{
+		{name: "display name", userID: alice.ID, body: `{"display_name": "Alice"}`},
+		{name: "username without password", userID: alice.ID, body: `{"username": "alice2"}`, code: apperr.PasswordRequired},
+		{name: "username with wrong password", userID: alice.ID, body: `{"username": "alice2", "current_password": "wrong"}`, code: apperr.InvalidPassword},
+		{name: "email without password", userID: alice.ID, body: `{"email": "alice@example.com"}`, code: apperr.PasswordRequired},
+		{name: "username and email", userID: alice.ID, body: `{"username": "alice2", "email": "alice@example.com", "current_password": "password1"}`},
+		{name: "provider user without session", userID: sso.ID, body: `{"email": "sso@example.com"}`, code: apperr.RecentLoginRequired},
+		{name: "provider user who just logged in", userID: sso.ID, sid: fresh.ID, body: `{"email": "sso@example.com"}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, _ := newContext(tt.body, "192.0.2.1", jwt.MapClaims{"user_id": float64(tt.userID), "sid": float64(tt.sid)})
+			if err := UpdateProfile(c); codeOf(err) != tt.code {
+				t.Errorf("UpdateProfile() = %v, want code %q", err, tt.code)
+			}
+		})
+	}
+	mail.wait(t, 2) // Verification of both new addresses
+
+	got, err := m.GetUser(ctx, alice.ID)
+	if err != nil || got.Username != "alice2" || got.Email != "alice@example.com" {
+		t.Errorf("GetUser() = %+v, %v, want alice2 at alice@example.com", got, err)
+	}
+}
+
+func TestUpdateProfileEmailVoidsTokens(t *testing.T) {
+	m := useMemory(t)
+	mail := useMailbox(t)
+	ctx := context.Background()
+	alice := addUser(t, m, "alice", "password1")
+	if err := m.SetEmail(ctx, alice.ID, "alice@example.com"); err != nil {
+		t.Fatal(err)
+	}
+	for _, purpose := range []string{models.TokenVerifyEmail, models.TokenResetPassword} {
+		err := m.CreateToken(ctx, &models.UserToken{TokenHash: utils.HashToken(purpose), UserID: alice.ID,
+			Purpose: purpose, Email: "alice@example.com", ExpiresAt: time.Now().Add(time.Hour)})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	c, _ := newContext(`{"email": "new@example.com", "current_password": "password1"}`, "192.0.2.1",
+		jwt.MapClaims{"user_id": float64(alice.ID)})
+	if err := UpdateProfile(c); err != nil {
+		t.Fatal(err)
+	}
+	mail.wait(t, 2) // Notice to the old address, verification of the new one
+	for _, purpose := range []string{models.TokenVerifyEmail, models.TokenResetPassword} {
+		if _, err := m.UseToken(ctx, utils.HashToken(purpose), purpose); err == nil {
+			t.Errorf("%s token mailed to the old address still works", purpose)
+		}
+	}
+}
+
+func TestForgotPasswordVerifiedOnly(t *testing.T) {
+	m := useMemory(t)
+	mail := useMailbox(t)
+	ctx := context.Background()
+	alice := addUser(t, m, "alice", "password1")
+	bob := addUser(t, m, "bob", "password1")
+	for _, u := range []*models.User{alice, bob} {
+		if err := m.SetEmail(ctx, u.ID, u.Username+"@example.com"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := m.VerifyEmail(ctx, alice.ID, "alice@example.com"); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, email := range []string{"bob@example.com", "alice@example.com"} {
+		c, _ := newContext(`{"email": "`+email+`"}`, "192.0.2.1", nil)
+		if err := ForgotPassword(c); err != nil {
+			t.Fatalf("ForgotPassword(%s) = %v", email, err)
+		}
+	}
+	// The lookups happen in the background, in any order; only alice is mailed
+	if msg := mail.wait(t, 1)[0]; msg.To != "alice@example.com" {
+		t.Errorf("reset link mailed to %s, want alice@example.com", msg.To)
+	}
+	select {
+	case msg := <-mail:
+		t.Errorf("unexpected mail to %s", msg.To)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
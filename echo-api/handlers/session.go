@@ -0,0 +1,158 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"google.golang.org/grpc/codes"
+	"echo-api/models"
+	"echo-api/store"
+	"echo-api/utils"
+	"file-service/apperr"
+	"file-service/metrics"
+)
+
+// sessionSeenInterval is how often a session's last request is recorded from one client IP
+const sessionSeenInterval = time.Minute
+
+// maxUserAgent is the length user agents are cut to
+const maxUserAgent = 255
+
+// startSession records a login of the user from the client of the request,
+// lasting as long as its token, and returns the session the token belongs to
+func startSession(c echo.Context, userID int, ttl time.Duration) (int, error) {
+	now := time.Now()
+	userAgent := c.Request().UserAgent()
+	if len(userAgent) > maxUserAgent {
+		userAgent = strings.ToValidUTF8(userAgent[:maxUserAgent], "")
+	}
+	s := &models.Session{
+		UserID:     userID,
+		UserAgent:  userAgent,
+		IP:         c.RealIP(),
+		LastSeenAt: now,
+		ExpiresAt:  now.Add(ttl),
+	}
+	if err := Sessions.CreateSession(c.Request().Context(), s); err != nil {
+		return 0, err
+	}
+	return s.ID, nil
+}
+
+// extendSession keeps the session of the caller alive as long as a token
+// newly issued for it
+func extendSession(c echo.Context) {
+	ctx := c.Request().Context()
+	if err := Sessions.ExtendSession(ctx, utils.SessionID(c), time.Now().Add(utils.TokenTTL)); err != nil {
+		logger.WarnContext(ctx, "Extending session failed", "error", err)
+	}
+}
+
+// CheckSession rejects the token of a validated JWT if its session was logged
+// out or expired, its user was disabled, deleted or given another role than
+// the token carries, and records the request as the session's latest. This
+// holds even if logging out the user's sessions failed. The session of a user
+// deleting their account is only accepted for deleting it again, which
+// finishes a deletion that failed halfway.
+func CheckSession(c echo.Context, id int) error {
+	ctx, now := c.Request().Context(), time.Now()
+	s, err := Sessions.GetSession(ctx, id)
+	if err != nil && !errors.Is(err, store.ErrNotFound) {
+		logger.ErrorContext(ctx, "Session lookup failed", "error", err)
+		return apperr.New(codes.Internal, apperr.Internal, "could not check session")
+	}
+	var user *models.User
+	if s != nil && s.UserID == utils.UserID(c) && now.Before(s.ExpiresAt) {
+		user, err = Users.GetUser(ctx, s.UserID)
+		if err != nil && !errors.Is(err, store.ErrNotFound) {
+			logger.ErrorContext(ctx, "User lookup failed", "error", err)
+			return apperr.New(codes.Internal, apperr.Internal, "could not check session")
+		}
+	}
+	if user == nil || user.Role != utils.Role(c) {
+		metrics.AuthFailures.WithLabelValues("gateway", string(apperr.SessionRevoked)).Inc()
+		return apperr.New(codes.Unauthenticated, apperr.SessionRevoked, "the session was logged out, log in again")
+	}
+	deletingAgain := user.Deleting && c.Request().Method == http.MethodDelete && c.Path() == "/profile"
+	if user.Disabled || (user.Deleting && !deletingAgain) {
+		return accountDisabled()
+	}
+
+	if err := Sessions.TouchSession(ctx, s.ID, c.RealIP(), now, now.Add(-sessionSeenInterval)); err != nil {
+		logger.WarnContext(ctx, "Recording session use failed", "error", err)
+	}
+	return nil
+}
+
+// ListSessions returns the current user's sessions that have not expired,
+// marking the one the request was made with
+func ListSessions(c echo.Context) error {
+	ctx := c.Request().Context()
+	sessions, err := Sessions.ListSessions(ctx, utils.UserID(c), time.Now())
+	if err != nil {
+		logger.ErrorContext(ctx, "Listing sessions failed", "error", err)
+		return apperr.New(codes.Internal, apperr.Internal, "could not list sessions")
+	}
+	current := utils.SessionID(c)
+	for i := range sessions {
+		sessions[i].Current = sessions[i].ID == current
+	}
+	return c.JSON(http.StatusOK, sessions)
+}
+
+// RevokeSession logs out one of the current user's sessions, which may be the
+// current one; its tokens stop working at once
+func RevokeSession(c echo.Context) error {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return badRequest("invalid session id")
+	}
+	ctx, userID := c.Request().Context(), utils.UserID(c)
+	ok, err := Sessions.DeleteSession(ctx, userID, id)
+	if err != nil {
+		logger.ErrorContext(ctx, "Revoking session failed", "error", err)
+		return apperr.New(codes.Internal, apperr.Internal, "could not revoke session")
+	}
+	if !ok {
+		return apperr.New(codes.NotFound, apperr.SessionNotFound, "session not found")
+	}
+	audit(c, models.AuditEvent{
+		Event:   models.EventSessionRevoked,
+		UserID:  &userID,
+		Details: map[string]interface{}{"session_id": id},
+	})
+	return c.NoContent(http.StatusNoContent)
+}
+
+// RevokeSessions logs the current user out everywhere, or everywhere else
+// with ?keep_current=true, and returns how many sessions were logged out
+func RevokeSessions(c echo.Context) error {
+	ctx, userID := c.Request().Context(), utils.UserID(c)
+	keep := 0
+	if c.QueryParam("keep_current") == "true" {
+		keep = utils.SessionID(c)
+	}
+	n, err := Sessions.DeleteSessions(ctx, userID, keep)
+	if err != nil {
+		logger.ErrorContext(ctx, "Revoking sessions failed", "error", err)
+		return apperr.New(codes.Internal, apperr.Internal, "could not revoke sessions")
+	}
+	audit(c, models.AuditEvent{
+		Event:   models.EventSessionsRevoked,
+		UserID:  &userID,
+		Details: map[string]interface{}{"count": n, "kept_current": keep != 0},
+	})
+	return c.JSON(http.StatusOK, map[string]int{"revoked": n})
+}
+
+// PruneSessions deletes the sessions whose tokens have all expired
+func PruneSessions(ctx context.Context) {
+	if err := Sessions.PruneSessions(ctx, time.Now()); err != nil {
+		logger.WarnContext(ctx, "Pruning sessions failed", "error", err)
+	}
+}
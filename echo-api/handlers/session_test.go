@@ -0,0 +1,78 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"echo-api/models"
+	"file-service/apperr"
+)
+
+func TestCheckSession(t *testing.T) {
+	m := useMemory(t)
+	ctx := context.Background()
+	alice := addUser(t, m, "alice", "password1")
+	bob := addUser(t, m, "bob", "password1")
+	carol := addUser(t, m, "carol", "password1")
+	dave := addUser(t, m, "dave", "password1")
+
+	session := func(userID int, expiresAt time.Time) int {
+		s := &models.Session{UserID: userID, LastSeenAt: time.Now(), ExpiresAt: expiresAt}
+		if err := m.CreateSession(ctx, s); err != nil {
+			t.Fatal(err)
+		}
+		return s.ID
+	}
+	active := session(alice.ID, time.Now().Add(time.Hour))
+	expired := session(alice.ID, time.Now().Add(-time.Minute))
+	loggedOut := session(alice.ID, time.Now().Add(time.Hour))
+	if _, err := m.DeleteSession(ctx, alice.ID, loggedOut); err != nil {
+		t.Fatal(err)
+	}
+	disabled := session(carol.ID, time.Now().Add(time.Hour))
+	if _, err := m.SetDisabled(ctx, carol.ID, true, time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	deleting := session(dave.ID, time.Now().Add(time.Hour))
+	if err := m.MarkDeleting(ctx, dave.ID, time.Now()); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name      string
+		userID    int
+		sessionID int
+		role      string // Claimed by the token; the user's by default
+		method    string // Of the request; POST by default
+		path      string // Route of the request
+		code      apperr.Code
+	}{
+		{name: "active", userID: alice.ID, sessionID: active},
+		{name: "expired", userID: alice.ID, sessionID: expired, code: apperr.SessionRevoked},
+		{name: "logged out", userID: alice.ID, sessionID: loggedOut, code: apperr.SessionRevoked},
+		{name: "unknown", userID: alice.ID, sessionID: 1000, code: apperr.SessionRevoked},
+		{name: "another user's", userID: bob.ID, sessionID: active, code: apperr.SessionRevoked},
+		{name: "role changed since", userID: alice.ID, sessionID: active, role: models.RoleAdmin, code: apperr.SessionRevoked},
+		{name: "disabled user", userID: carol.ID, sessionID: disabled, code: apperr.AccountDisabled},
+		{name: "user deleting their account", userID: dave.ID, sessionID: deleting, code: apperr.AccountDisabled},
+		{name: "deleting the account again", userID: dave.ID, sessionID: deleting, method: http.MethodDelete, path: "/profile"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.role == "" {
+				tt.role = models.RoleUser
+			}
+			c, _ := newContext("", "192.0.2.1", jwt.MapClaims{"user_id": float64(tt.userID), "sid": float64(tt.sessionID), "role": tt.role})
+			if tt.method != "" {
+				c.Request().Method = tt.method
+			}
+			c.SetPath(tt.path)
+			if err := CheckSession(c, tt.sessionID); codeOf(err) != tt.code {
+				t.Errorf("CheckSession() = %v, want code %q", err, tt.code)
+			}
+		})
+	}
+}
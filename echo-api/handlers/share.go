@@ -0,0 +1,185 @@
+package handlers
+
+import (
+	"fmt"
+	"mime"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+	"echo-api/clients"
+	downloadpb "file-service/proto/download"
+)
+
+// shareRequest is the body accepted when creating a share link
+type shareRequest struct {
+	Password     string `json:"password"`
+	ExpiresIn    int64  `json:"expires_in"` // Seconds until the link expires, 0 for never
+	MaxDownloads int32  `json:"max_downloads"`
+}
+
+// CreateShareLink creates a public link to one of the user's files
+func CreateShareLink(c echo.Context) error {
+	req := new(shareRequest)
+	if err := c.Bind(req); err != nil {
+		return badRequest("Invalid request body")
+	}
+
+	// Initialize file client
+	fileClient, err := clients.NewFileClient()
+	if err != nil {
+		return err
+	}
+
+	// Create share link
+	token := c.Request().Header.Get("Authorization")
+	link, err := fileClient.CreateShareLink(c.Request().Context(), token, &downloadpb.CreateShareLinkRequest{
+		FileId:           c.Param("id"),
+		Password:         req.Password,
+		ExpiresInSeconds: req.ExpiresIn,
+		MaxDownloads:     req.MaxDownloads,
+	})
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusCreated, map[string]interface{}{
+		"share": link,
+		"url":   strings.TrimSuffix(PublicURL, "/") + "/s/" + url.PathEscape(link.Token),
+	})
+}
+
+// ListShareLinks lists the user's active share links
+func ListShareLinks(c echo.Context) error {
+	// Initialize file client
+	fileClient, err := clients.NewFileClient()
+	if err != nil {
+		return err
+	}
+
+	// List share links
+	token := c.Request().Header.Get("Authorization")
+	resp, err := fileClient.ListShareLinks(c.Request().Context(), token)
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, resp)
+}
+
+// RevokeShareLink revokes one of the user's share links
+func RevokeShareLink(c echo.Context) error {
+	// Initialize file client
+	fileClient, err := clients.NewFileClient()
+	if err != nil {
+		return err
+	}
+
+	// Revoke share link
+	token := c.Request().Header.Get("Authorization")
+	if err := fileClient.RevokeShareLink(c.Request().Context(), token, c.Param("id")); err != nil {
+		return err
+	}
+
+	return c.NoContent(http.StatusNoContent)
+}
+
+// DownloadSharedFile streams a file through a share link without authentication.
+// The password, if any, is read from the X-Share-Password header, or from the
+// body of a POST such as a password form, but never from the URL, which ends
+// up in logs and browser history.
+func DownloadSharedFile(c echo.Context) error {
+	password := c.Request().Header.Get("X-Share-Password")
+	if password == "" && c.Request().Method == http.MethodPost {
+		var req struct {
+			Password string `json:"password" form:"password"`
+		}
+		if err := c.Bind(&req); err != nil {
+			return badRequest("Invalid request body")
+		}
+		password = req.Password
+	}
+
+	// Initialize file client
+	fileClient, err := clients.NewFileClient()
+	if err != nil {
+		return err
+	}
+
+	// Stream the file straight to the response once its metadata arrives. Errors
+	// after the headers are sent leave the client with a truncated body.
+	res := c.Response()
+	return fileClient.DownloadSharedFile(c.Request().Context(), c.Param("token"), password, res, func(m *downloadpb.FileMetadata) {
+		writeFileHeaders(res, m, "attachment")
+	})
+}
+
+// inlineTypes are the content types served inline when asked to; browsers
+// render them as media rather than as pages that could run scripts
+var inlineTypes = map[string]bool{
+	"image/png":       true,
+	"image/jpeg":      true,
+	"image/gif":       true,
+	"image/webp":      true,
+	"image/avif":      true,
+	"video/mp4":       true,
+	"video/webm":      true,
+	"video/ogg":       true,
+	"audio/mpeg":      true,
+	"audio/ogg":       true,
+	"audio/wav":       true,
+	"audio/webm":      true,
+	"application/pdf": true,
+}
+
+// writeFileHeaders starts a streamed file response described by the download
+// metadata. Uploaded files are untrusted, so types other than inlineTypes are
+// always attachments, browsers must not guess another type, and a page that
+// is rendered anyway runs sandboxed rather than in the gateway's origin.
+func writeFileHeaders(res *echo.Response, m *downloadpb.FileMetadata, disposition string) {
+	contentType := m.ContentType
+	if contentType == "" {
+		contentType = echo.MIMEOctetStream
+	}
+	if mediaType, _, err := mime.ParseMediaType(contentType); err != nil || !inlineTypes[mediaType] {
+		disposition = "attachment"
+	}
+	res.Header().Set(echo.HeaderContentType, contentType)
+	res.Header().Set(echo.HeaderContentDisposition, contentDisposition(disposition, m.Filename))
+	res.Header().Set(echo.HeaderXContentTypeOptions, "nosniff")
+	res.Header().Set(echo.HeaderContentSecurityPolicy, "sandbox")
+	res.Header().Set(echo.HeaderContentLength, strconv.FormatInt(m.Size, 10))
+	res.WriteHeader(http.StatusOK)
+}
+
+// contentDisposition formats a Content-Disposition header as in RFC 6266: an
+// ASCII filename for old clients and the exact one as UTF-8 in filename*
+func contentDisposition(disposition, filename string) string {
+	var fallback, encoded strings.Builder
+	for _, r := range filename {
+		if r < 0x20 || r > 0x7e || r == '"' || r == '\\' {
+			fallback.WriteByte('_')
+		} else {
+			fallback.WriteRune(r)
+		}
+	}
+	for _, b := range []byte(filename) {
+		if isAttrChar(b) {
+			encoded.WriteByte(b)
+		} else {
+			fmt.Fprintf(&encoded, "%%%02X", b)
+		}
+	}
+	return fmt.Sprintf(`%s; filename="%s"; filename*=UTF-8''%s`, disposition, fallback.String(), encoded.String())
+}
+
+// isAttrChar reports whether b may appear unencoded in an RFC 8187 value
+func isAttrChar(b byte) bool {
+	switch {
+	case b >= 'a' && b <= 'z', b >= 'A' && b <= 'Z', b >= '0' && b <= '9':
+		return true
+	}
+	return strings.IndexByte("!#$&+-.^_`|~", b) >= 0
+}
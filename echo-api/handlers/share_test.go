@@ -0,0 +1,68 @@
+package handlers
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	downloadpb "file-service/proto/download"
+)
+
+func TestWriteFileHeaders(t *testing.T) {
+	tests := []struct {
+		name        string
+		file        *downloadpb.FileMetadata
+		disposition string
+		want        string
+	}{
+		{
+			name:        "image inline",
+			file:        &downloadpb.FileMetadata{Filename: "cat.png", ContentType: "image/png"},
+			disposition: "inline",
+			want:        `inline; filename="cat.png"; filename*=UTF-8''cat.png`,
+		},
+		{
+			name:        "HTML as an attachment",
+			file:        &downloadpb.FileMetadata{Filename: "page.html", ContentType: "text/html; charset=utf-8"},
+			disposition: "inline",
+			want:        `attachment; filename="page.html"; filename*=UTF-8''page.html`,
+		},
+		{
+			name:        "SVG as an attachment",
+			file:        &downloadpb.FileMetadata{Filename: "logo.svg", ContentType: "image/svg+xml"},
+			disposition: "inline",
+			want:        `attachment; filename="logo.svg"; filename*=UTF-8''logo.svg`,
+		},
+		{
+			name:        "no type",
+			file:        &downloadpb.FileMetadata{Filename: "data"},
+			disposition: "inline",
+			want:        `attachment; filename="data"; filename*=UTF-8''data`,
+		},
+		{
+			name:        "quotes and spaces",
+			file:        &downloadpb.FileMetadata{Filename: `say "hi" \ now.txt`, ContentType: "text/plain"},
+			disposition: "attachment",
+			want:        `attachment; filename="say _hi_ _ now.txt"; filename*=UTF-8''say%20%22hi%22%20%5C%20now.txt`,
+		},
+		{
+			name:        "non-ASCII",
+			file:        &downloadpb.FileMetadata{Filename: "résumé;.pdf", ContentType: "application/pdf"},
+			disposition: "inline",
+			want:        `inline; filename="r_sum_;.pdf"; filename*=UTF-8''r%C3%A9sum%C3%A9%3B.pdf`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			writeFileHeaders(echo.NewResponse(rec, echo.New()), tt.file, tt.disposition)
+			h := rec.Header()
+			if got := h.Get(echo.HeaderContentDisposition); got != tt.want {
+				t.Errorf("Content-Disposition = %s, want %s", got, tt.want)
+			}
+			if h.Get(echo.HeaderXContentTypeOptions) != "nosniff" || h.Get(echo.HeaderContentSecurityPolicy) != "sandbox" {
+				t.Errorf("headers = %v, want nosniff and a sandbox policy", h)
+			}
+		})
+	}
+}
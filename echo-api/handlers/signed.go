@@ -0,0 +1,127 @@
+package handlers
+
+import (
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"google.golang.org/grpc/codes"
+	"echo-api/clients"
+	"file-service/apperr"
+	"file-service/auth"
+	downloadpb "file-service/proto/download"
+	"echo-api/utils"
+)
+
+// maxSignedURLLifetime caps how long a signed download URL stays valid
+const maxSignedURLLifetime = 7 * 24 * time.Hour
+
+// CreateSignedURL returns a time-limited URL for downloading a file without an Authorization header.
+// Query parameters: expires_in (seconds, default 300) and bind_ip=true to restrict it to the caller's IP.
+func CreateSignedURL(c echo.Context) error {
+	fileID := c.Param("id")
+
+	lifetime := 5 * time.Minute
+	if v := c.QueryParam("expires_in"); v != "" {
+		seconds, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || seconds <= 0 {
+			return badRequest("expires_in must be a positive number of seconds")
+		}
+		lifetime = time.Duration(seconds) * time.Second
+	}
+	if lifetime > maxSignedURLLifetime {
+		lifetime = maxSignedURLLifetime
+	}
+
+	var boundIP string
+	if c.QueryParam("bind_ip") == "true" {
+		boundIP = c.RealIP()
+	}
+
+	// The URL stops working when the session or the API key it is created
+	// with is logged out or revoked
+	d := auth.SignedDownload{
+		FileID:  fileID,
+		UserID:  strconv.Itoa(utils.UserID(c)),
+		OrgID:   strconv.Itoa(utils.OrgID(c)),
+		Expires: time.Now().Add(lifetime).Unix(),
+		BoundIP: boundIP,
+	}
+	if keyID := utils.APIKeyID(c); keyID != 0 {
+		d.APIKeyID = strconv.Itoa(keyID)
+	} else {
+		d.SessionID = strconv.Itoa(utils.SessionID(c))
+	}
+
+	q := url.Values{}
+	q.Set("uid", d.UserID)
+	q.Set("org", d.OrgID)
+	q.Set("exp", strconv.FormatInt(d.Expires, 10))
+	if boundIP != "" {
+		q.Set("ip", boundIP)
+	}
+	if d.SessionID != "" {
+		q.Set("sid", d.SessionID)
+	}
+	if d.APIKeyID != "" {
+		q.Set("key", d.APIKeyID)
+	}
+	q.Set("sig", auth.SignDownload(utils.URLSigningSecret, d))
+
+	// The URL points at the configured public address rather than the Host
+	// header, which the client controls
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"url":        strings.TrimSuffix(PublicURL, "/") + "/files/signed/" + url.PathEscape(fileID) + "?" + q.Encode(),
+		"expires_at": time.Unix(d.Expires, 0).UTC().Format(time.RFC3339),
+	})
+}
+
+// DownloadSignedFile streams a file authorized by a signed URL rather than a JWT
+func DownloadSignedFile(c echo.Context) error {
+	fileID := c.Param("id")
+	expires, err := strconv.ParseInt(c.QueryParam("exp"), 10, 64)
+	if err != nil {
+		return apperr.New(codes.InvalidArgument, apperr.InvalidSignedURL, "Invalid signed URL")
+	}
+
+	signed := &downloadpb.SignedAccess{
+		UserId:    c.QueryParam("uid"),
+		OrgId:     c.QueryParam("org"),
+		Expires:   expires,
+		BoundIp:   c.QueryParam("ip"),
+		Signature: c.QueryParam("sig"),
+		ClientIp:  c.RealIP(),
+		SessionId: c.QueryParam("sid"),
+		ApiKeyId:  c.QueryParam("key"),
+	}
+
+	// Reject bad signatures here; the download service verifies them again before serving
+	d := auth.SignedDownload{
+		FileID:    fileID,
+		UserID:    signed.UserId,
+		OrgID:     signed.OrgId,
+		Expires:   signed.Expires,
+		BoundIP:   signed.BoundIp,
+		SessionID: signed.SessionId,
+		APIKeyID:  signed.ApiKeyId,
+	}
+	if auth.CheckDownload(utils.URLSigningSecret, d, signed.Signature, signed.ClientIp, time.Now()) != nil {
+		return apperr.New(codes.PermissionDenied, apperr.InvalidSignedURL, "Invalid or expired signed URL")
+	}
+
+	// Initialize file client
+	fileClient, err := clients.NewFileClient()
+	if err != nil {
+		return err
+	}
+
+	// Stream media inline so it can back <img> and <video> tags. Errors after
+	// the headers are sent leave the client with a truncated body.
+	res := c.Response()
+	return fileClient.DownloadSignedFile(c.Request().Context(), fileID, signed, res, func(m *downloadpb.FileMetadata) {
+		writeFileHeaders(res, m, "inline")
+	})
+}
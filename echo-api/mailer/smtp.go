@@ -0,0 +1,80 @@
+package mailer
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"time"
+)
+
+// SMTP sends messages through an SMTP server, upgrading to TLS when the server
+// offers STARTTLS and logging in when a username is set
+type SMTP struct {
+	addr, from         string
+	username, password string
+}
+
+var _ Mailer = (*SMTP)(nil)
+
+// NewSMTP returns a mailer sending through the server at addr
+func NewSMTP(addr, username, password, from string) *SMTP {
+	return &SMTP{addr: addr, from: from, username: username, password: password}
+}
+
+func (s *SMTP) Send(ctx context.Context, m Message) error {
+	msg, err := format(s.from, m)
+	if err != nil {
+		return err
+	}
+	sender, _ := mail.ParseAddress(s.from)
+	recipient, _ := mail.ParseAddress(m.To)
+
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "tcp", s.addr)
+	if err != nil {
+		return err
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	} else {
+		conn.SetDeadline(time.Now().Add(time.Minute))
+	}
+	host, _, _ := net.SplitHostPort(s.addr)
+	c, err := smtp.NewClient(conn, host)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer c.Close()
+
+	if ok, _ := c.Extension("STARTTLS"); ok {
+		if err := c.StartTLS(&tls.Config{ServerName: host}); err != nil {
+			return err
+		}
+	}
+	// PlainAuth refuses to send the password unencrypted, except to localhost
+	if s.username != "" {
+		if err := c.Auth(smtp.PlainAuth("", s.username, s.password, host)); err != nil {
+			return err
+		}
+	}
+	if err := c.Mail(sender.Address); err != nil {
+		return err
+	}
+	if err := c.Rcpt(recipient.Address); err != nil {
+		return err
+	}
+	w, err := c.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(msg); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return c.Quit()
+}
@@ -0,0 +1,116 @@
+package mailer
+
+import (
+	"context"
+	"encoding/base64"
+	"io"
+	"net"
+	"net/textproto"
+	"strings"
+	"testing"
+)
+
+// smtpSession is what a stand-in SMTP server was told in one session
+type smtpSession struct {
+	auth string
+	from string
+	to   string
+	data string
+}
+
+// serveSMTP accepts one session on a local port, answering RCPT TO with
+// rcptReply, and returns the address and the session once it is over
+func serveSMTP(t *testing.T, rcptReply string) (string, <-chan smtpSession) {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { l.Close() })
+
+	done := make(chan smtpSession, 1)
+	go func() {
+		var s smtpSession
+		defer func() { done <- s }()
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		c := textproto.NewConn(conn)
+		defer c.Close()
+
+		c.PrintfLine("220 localhost ESMTP")
+		for {
+			line, err := c.ReadLine()
+			if err != nil {
+				return
+			}
+			verb, arg, _ := strings.Cut(line, " ")
+			switch strings.ToUpper(verb) {
+			case "EHLO":
+				c.PrintfLine("250-localhost")
+				c.PrintfLine("250 AUTH PLAIN")
+			case "AUTH":
+				_, encoded, _ := strings.Cut(arg, " ")
+				decoded, _ := base64.StdEncoding.DecodeString(encoded)
+				s.auth = string(decoded)
+				c.PrintfLine("235 authenticated")
+			case "MAIL":
+				s.from = arg
+				c.PrintfLine("250 ok")
+			case "RCPT":
+				s.to = arg
+				c.PrintfLine(rcptReply)
+			case "DATA":
+				c.PrintfLine("354 go ahead")
+				data, _ := io.ReadAll(c.DotReader())
+				s.data = string(data)
+				c.PrintfLine("250 queued")
+			case "QUIT":
+				c.PrintfLine("221 bye")
+				return
+			default:
+				c.PrintfLine("502 unknown command")
+			}
+		}
+	}()
+	return l.Addr().String(), done
+}
+
+func TestSMTP(t *testing.T) {
+	addr, done := serveSMTP(t, "250 ok")
+	m := NewSMTP(addr, "user", "secret", "Echo API <noreply@example.com>")
+	err := m.Send(context.Background(), Message{To: "alice@example.com", Subject: "Vérifiez", Body: "Hello\n.signature\n"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := <-done
+	if s.auth != "\x00user\x00secret" {
+		t.Errorf("AUTH PLAIN %q, want user and secret", s.auth)
+	}
+	if s.from != "FROM:<noreply@example.com>" || s.to != "TO:<alice@example.com>" {
+		t.Errorf("envelope %s %s, want noreply@example.com to alice@example.com", s.from, s.to)
+	}
+	for _, want := range []string{
+		"From: \"Echo API\" <noreply@example.com>\n",
+		"To: alice@example.com\n",
+		"Subject: =?utf-8?q?V=C3=A9rifiez?=\n",
+		"\nHello\n.signature\n",
+	} {
+		if !strings.Contains(s.data, want) {
+			t.Errorf("message %q does not contain %q", s.data, want)
+		}
+	}
+}
+
+func TestSMTPRejected(t *testing.T) {
+	addr, done := serveSMTP(t, "550 no such user")
+	err := NewSMTP(addr, "", "", "noreply@example.com").Send(context.Background(), Message{To: "nobody@example.com", Subject: "Hi"})
+	if err == nil || !strings.Contains(err.Error(), "no such user") {
+		t.Errorf("Send() = %v, want the server's refusal", err)
+	}
+	if s := <-done; s.auth != "" || s.data != "" {
+		t.Errorf("session %+v, want no login and no message", s)
+	}
+}
@@ -0,0 +1,63 @@
+package mailer
+
+import (
+	"context"
+	"io"
+	"os"
+	"sync"
+)
+
+// Writer writes messages, each followed by a blank line, to stdout or another
+// writer instead of delivering them
+type Writer struct {
+	mu   sync.Mutex
+	w    io.Writer
+	from string
+}
+
+var _ Mailer = (*Writer)(nil)
+
+// NewWriter returns a mailer writing messages from the sender to w
+func NewWriter(w io.Writer, from string) *Writer {
+	return &Writer{w: w, from: from}
+}
+
+func (w *Writer) Send(_ context.Context, m Message) error {
+	msg, err := format(w.from, m)
+	if err != nil {
+		return err
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	_, err = w.w.Write(append(msg, "\r\n\r\n"...))
+	return err
+}
+
+// File appends messages to a file like Writer, opening it for each one so
+// that it can be rotated or removed while running
+type File struct {
+	mu   sync.Mutex
+	path string
+	from string
+}
+
+var _ Mailer = (*File)(nil)
+
+// NewFile returns a mailer appending messages from the sender to the file at path
+func NewFile(path, from string) *File {
+	return &File{path: path, from: from}
+}
+
+func (f *File) Send(ctx context.Context, m Message) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	file, err := os.OpenFile(f.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o600)
+	if err != nil {
+		return err
+	}
+	if err := NewWriter(file, f.from).Send(ctx, m); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
@@ -1,40 +1,97 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"log"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
 
-	"github.com/joho/godotenv"
-	"github.com/labstack/echo/v4"
-	"github.com/labstack/echo/v4/middleware"
+	"echo-api/app"
+	"echo-api/clients"
 	"echo-api/db"
-	"echo-api/routes"
+	"echo-api/store"
+	"file-service/config"
+	"file-service/healthcheck"
+	"file-service/logging"
+	"file-service/metrics"
+	"file-service/tracing"
 )
 
 func main() {
-	// Load environment variables
-	if err := godotenv.Load(); err != nil {
-		log.Printf("Warning: .env file not found")
+	// Load and validate the configuration
+	cfg, args, err := config.Load("echo-api", os.Args[1:])
+	if err != nil {
+		log.Fatal(err)
 	}
 
+	// Probe a running server, for container health checks
+	if len(args) > 0 && args[0] == "healthcheck" {
+		if err := healthcheck.ProbeHTTP(cfg.HTTP.Addr, "/readyz"); err != nil {
+			log.Fatalf("Unhealthy: %v", err)
+		}
+		return
+	}
+
+	// Log structured records from here on
+	if err := logging.Setup("echo-api", cfg.Log); err != nil {
+		log.Fatal(err)
+	}
+
+	// Export traces; buffered spans are flushed on exit
+	shutdownTracing, err := tracing.Setup(context.Background(), "echo-api", cfg.Tracing)
+	if err != nil {
+		logging.Fatal("Failed to set up tracing", err)
+	}
+	defer shutdownTracing(context.Background())
+
 	// Initialize database
-	db.Init()
+	db.Init(cfg.Database)
 	defer db.Close()
 
-	// Echo setup
-	e := echo.New()
-	e.Use(middleware.Logger())
-	e.Use(middleware.Recover())
-	
-	// Configure CORS
-	e.Use(middleware.CORSWithConfig(middleware.CORSConfig{
-		AllowOrigins: []string{"http://localhost:3000"},
-		AllowMethods: []string{echo.GET, echo.PUT, echo.POST, echo.DELETE, echo.OPTIONS},
-		AllowHeaders: []string{echo.HeaderOrigin, echo.HeaderContentType, echo.HeaderAccept, echo.HeaderAuthorization},
-	}))
-
-	// Setup routes
-	routes.Setup(e)
-
-	// Start server
-	e.Logger.Fatal(e.Start(":8080"))
+	// Run the migrate subcommand instead of the server
+	if len(args) > 0 && args[0] == "migrate" {
+		runMigrate(args[1:])
+		return
+	}
+
+	// Bring the schema up to date
+	if err := app.Migrate(context.Background()); err != nil {
+		logging.Fatal("Failed to migrate database", err)
+	}
+
+	// Run the admin subcommand instead of the server
+	if len(args) > 0 && args[0] == "admin" {
+		runAdmin(store.NewSQL(db.DB, cfg.Database.QueryTimeout), args[1:])
+		return
+	}
+
+	// Connect to the file services
+	if err := clients.Connect(cfg.Services.UploadTarget, cfg.Services.DownloadTarget); err != nil {
+		logging.Fatal("Failed to connect to file services", err)
+	}
+	defer clients.Close()
+
+	// Run until SIGINT or SIGTERM
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	// Start server; SIGHUP reloads the configuration. Metrics are exported on
+	// their own port, out of reach of the public one.
+	e := app.New(config.Watch(ctx, "echo-api", cfg))
+	if cfg.HTTP.MetricsAddr != "" {
+		defer metrics.Serve(cfg.HTTP.MetricsAddr).Close()
+	}
+	go func() {
+		slog.Info("HTTP server listening", "addr", cfg.HTTP.Addr)
+		if err := e.Start(cfg.HTTP.Addr); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			logging.Fatal("Failed to serve", err)
+		}
+	}()
+
+	<-ctx.Done()
+	app.Shutdown(e, cfg.Shutdown)
 }
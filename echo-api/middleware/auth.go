@@ -1,12 +1,156 @@
+package middleware
+
+import (
+	"errors"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/golang-jwt/jwt/v5"
+	echojwt "github.com/labstack/echo-jwt/v4"
+	"github.com/labstack/echo/v4"
+	"google.golang.org/grpc/codes"
+	"echo-api/utils"
+	"file-service/apperr"
+	"file-service/metrics"
+)
+
+// exchangedKey marks a request whose API key APIKey has just checked and
+// exchanged for a token
+const exchangedKey = "api_key_exchanged"
+
+// JWT validates the bearer token like echojwt.JWT, counting rejected tokens and
+// answering them with missing_token or invalid_token. Tokens without a user,
+// such as MFA challenges signed with the same key, are invalid. The session of
+// a login's token must pass the session check, and the key of a token an API
+// key was exchanged for the key check, unless APIKey exchanged it just now.
+func JWT(key []byte, session, apiKey func(c echo.Context, id int) error) echo.MiddlewareFunc {
+	validate := echojwt.JWT(key)
+	invalid := apperr.New(codes.Unauthenticated, apperr.InvalidToken, "invalid or expired token")
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		h := validate(func(c echo.Context) error {
+			claims := c.Get("user").(*jwt.Token).Claims.(jwt.MapClaims)
+			if _, ok := claims["user_id"].(float64); !ok {
+				metrics.AuthFailures.WithLabelValues("gateway", string(invalid.Code)).Inc()
+				return invalid
+			}
+			if keyID, ok := claims["api_key_id"].(float64); ok {
+				if c.Get(exchangedKey) == nil {
+					if err := apiKey(c, int(keyID)); err != nil {
+						return err
+					}
+				}
+				return next(c)
+			}
+			sessionID, ok := claims["sid"].(float64)
+			if !ok {
+				metrics.AuthFailures.WithLabelValues("gateway", string(invalid.Code)).Inc()
+				return invalid
+			}
+			if err := session(c, int(sessionID)); err != nil {
+				return err
+			}
+			return next(c)
+		})
+		return func(c echo.Context) error {
+			err := h(c)
+			if err != nil && c.Get("user") == nil {
+				rejected := invalid
+				var missing *echojwt.TokenExtractionError
+				if errors.As(err, &missing) {
+					rejected = apperr.New(codes.Unauthenticated, apperr.MissingToken, "missing or malformed token")
+				}
+				metrics.AuthFailures.WithLabelValues("gateway", string(rejected.Code)).Inc()
+				return rejected
+			}
+			return err
+		}
+	}
+}
+
+// APIKey exchanges a personal API key sent as the bearer token for a JWT of
+// its user, so that JWT, the handlers and the file services see the key's user
+// like any other. Other tokens pass untouched; it must come before JWT.
+func APIKey(exchange func(c echo.Context, key string) (string, error)) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			key, ok := strings.CutPrefix(c.Request().Header.Get(echo.HeaderAuthorization), "Bearer ")
+			if !ok || !strings.HasPrefix(key, utils.APIKeyPrefix) {
+				return next(c)
+			}
+			token, err := exchange(c, key)
+			if err != nil {
+				return err
+			}
+			c.Request().Header.Set(echo.HeaderAuthorization, "Bearer "+token)
+			c.Set(exchangedKey, true)
+			return next(c)
+		}
+	}
+}
+
+// RequireScope lets requests made with an API key through only if it has the
+// scope for the resource: resource:read for GET and HEAD requests and
+// resource:write for the others. Logins have every scope; it must follow JWT.
+func RequireScope(resource string) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			if utils.APIKeyID(c) == 0 {
+				return next(c)
+			}
+			scope := resource + ":write"
+			if m := c.Request().Method; m == http.MethodGet || m == http.MethodHead {
+				scope = resource + ":read"
+			}
+			if !slices.Contains(utils.Scopes(c), scope) {
+				return apperr.New(codes.PermissionDenied, apperr.InsufficientScope, "the API key lacks the "+scope+" scope").
+					With("scope", scope)
+			}
+			return next(c)
+		}
+	}
+}
+
+// RequireLogin rejects requests made with an API key or by an admin
+// impersonating the user, for routes that change how the user logs in or hand
+// out new tokens; it must follow JWT
+func RequireLogin(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		if utils.APIKeyID(c) != 0 {
+			return apperr.New(codes.PermissionDenied, apperr.LoginRequired, "API keys cannot be used here; log in instead")
+		}
+		if utils.ImpersonatorID(c) != 0 {
+			return apperr.New(codes.PermissionDenied, apperr.LoginRequired, "not available while impersonating a user")
+		}
+		return next(c)
+	}
+}
+
+// RequireMFA rejects requests of the roles returned by roles whose JWT was
+// issued without a second factor; it must follow JWT
+func RequireMFA(roles func() []string) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			if !utils.MFA(c) && slices.Contains(roles(), utils.Role(c)) {
+				metrics.AuthFailures.WithLabelValues("gateway", string(apperr.MFARequired)).Inc()
+				return apperr.New(codes.PermissionDenied, apperr.MFARequired,
+					"two-factor authentication is required for your role; enroll at /profile/mfa")
+			}
+			return next(c)
+		}
+	}
+}
+
+// RequireAdmin rejects requests whose JWT does not carry the admin role
 func RequireAdmin(next echo.HandlerFunc) echo.HandlerFunc {
-    return func(c echo.Context) error {
-        user := c.Get("user").(*jwt.Token)
-        claims := user.Claims.(jwt.MapClaims)
+	return func(c echo.Context) error {
+		user := c.Get("user").(*jwt.Token)
+		claims := user.Claims.(jwt.MapClaims)
 
-        if claims["role"] != "admin" {
-            return echo.ErrUnauthorized
-        }
+		if claims["role"] != "admin" {
+			return apperr.New(codes.PermissionDenied, apperr.InsufficientRole, "admin role required")
+		}
 
-        return next(c)
-    }
+		return next(c)
+	}
 }
@@ -0,0 +1,68 @@
+package middleware
+
+import (
+	"log/slog"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	echomw "github.com/labstack/echo/v4/middleware"
+	"file-service/logging"
+)
+
+// accessLog logs one record per request for the http component
+var accessLog = logging.For("http")
+
+// quietPaths are probed often, so their requests are logged at debug level
+var quietPaths = map[string]bool{"/healthz": true, "/readyz": true}
+
+// RequestID gives each request an ID, adopting the caller's X-Request-ID if it
+// is well formed. The ID is returned in the response, added to the request's
+// logs and forwarded to the file services.
+func RequestID(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		id := c.Request().Header.Get(logging.RequestIDHeader)
+		if !logging.ValidRequestID(id) {
+			id = logging.NewRequestID()
+		}
+		c.Response().Header().Set(logging.RequestIDHeader, id)
+		c.SetRequest(c.Request().WithContext(logging.WithRequestID(c.Request().Context(), id)))
+		return next(c)
+	}
+}
+
+// Log logs each request once it completes. Requests are identified by their
+// route template rather than their path, which can hold share tokens and IDs,
+// and query strings, which can hold URL signatures, are left out.
+func Log(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		start := time.Now()
+		err := next(c)
+		if err != nil {
+			c.Error(err)
+		}
+
+		status := c.Response().Status
+		level := slog.LevelInfo
+		switch {
+		case quietPaths[c.Request().URL.Path]:
+			level = slog.LevelDebug
+		case status >= 500:
+			level = slog.LevelError
+		}
+		accessLog.Log(c.Request().Context(), level, "HTTP request",
+			"method", c.Request().Method,
+			"route", route(c),
+			"status", status,
+			"duration_ms", time.Since(start).Milliseconds(),
+			"bytes", c.Response().Size)
+		return nil
+	}
+}
+
+// Recover turns panics into 500 responses, logging them with their stack
+var Recover = echomw.RecoverWithConfig(echomw.RecoverConfig{
+	LogErrorFunc: func(c echo.Context, err error, stack []byte) error {
+		accessLog.ErrorContext(c.Request().Context(), "Panic recovered", "error", err, "stack", string(stack))
+		return err
+	},
+})
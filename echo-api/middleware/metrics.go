@@ -0,0 +1,58 @@
+package middleware
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	httpRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "http_requests_total",
+		Help: "HTTP requests completed, by method, route and status code.",
+	}, []string{"method", "route", "code"})
+
+	httpDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "http_request_duration_seconds",
+		Help:    "Time taken to complete HTTP requests, by method and route.",
+		Buckets: []float64{.005, .025, .1, .5, 1, 5, 30, 120, 600},
+	}, []string{"method", "route"})
+)
+
+// knownMethods bounds the method label; anything else is counted as OTHER
+var knownMethods = map[string]bool{
+	http.MethodGet: true, http.MethodHead: true, http.MethodPost: true, http.MethodPut: true,
+	http.MethodPatch: true, http.MethodDelete: true, http.MethodOptions: true,
+}
+
+// Metrics records each request under its route template, such as /files/:id,
+// rather than its path, so that IDs do not each become a series
+func Metrics(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		start := time.Now()
+		err := next(c)
+		if err != nil {
+			c.Error(err)
+		}
+
+		method := c.Request().Method
+		if !knownMethods[method] {
+			method = "OTHER"
+		}
+		httpRequests.WithLabelValues(method, route(c), strconv.Itoa(c.Response().Status)).Inc()
+		httpDuration.WithLabelValues(method, route(c)).Observe(time.Since(start).Seconds())
+		return nil
+	}
+}
+
+// route returns the route template of the request, or "unmatched"
+func route(c echo.Context) string {
+	if r := c.Path(); r != "" && r != "/*" {
+		return r
+	}
+	return "unmatched"
+}
@@ -0,0 +1,45 @@
+package middleware
+
+import (
+	"strconv"
+
+	"github.com/labstack/echo/v4"
+	"echo-api/utils"
+	"file-service/ratelimit"
+)
+
+// Keys of the buckets requests take their tokens from
+var (
+	// ByIP keys requests by client IP, for routes anyone can call
+	ByIP = func(c echo.Context) string { return "ip:" + c.RealIP() }
+	// ByUser keys requests by the user of their JWT; it must follow JWT
+	ByUser = func(c echo.Context) string { return "user:" + strconv.Itoa(utils.UserID(c)) }
+)
+
+// RateLimit takes a token for each request from the bucket of the named
+// policy and key, answering 429 once it is empty. Responses carry the
+// RateLimit headers of the bucket with the fewest tokens left, and 429s a
+// Retry-After header.
+func RateLimit(l *ratelimit.Limiter, policy string, key func(echo.Context) string) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			r, ok := l.Allow(c.Request().Context(), policy, key(c))
+			if !ok {
+				return next(c)
+			}
+
+			h := c.Response().Header()
+			if remaining, err := strconv.Atoi(h.Get("RateLimit-Remaining")); err != nil || r.Remaining <= remaining {
+				h.Set("RateLimit-Limit", strconv.Itoa(r.Policy.Burst))
+				h.Set("RateLimit-Remaining", strconv.Itoa(r.Remaining))
+				h.Set("RateLimit-Reset", strconv.FormatInt(ratelimit.RetryAfterSeconds(r.Reset), 10))
+				h.Set("RateLimit-Policy", ratelimit.PolicyHeader(r.Policy))
+			}
+			if err := r.Err(); err != nil {
+				h.Set(echo.HeaderRetryAfter, strconv.FormatInt(ratelimit.RetryAfterSeconds(r.RetryAfter), 10))
+				return err
+			}
+			return next(c)
+		}
+	}
+}
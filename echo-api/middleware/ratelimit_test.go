@@ -0,0 +1,37 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"file-service/apperr"
+	"file-service/ratelimit"
+)
+
+func TestRateLimit(t *testing.T) {
+	l := ratelimit.New(ratelimit.NewMemory(), func() []string { return []string{"login=2/1m"} })
+	h := RateLimit(l, "login", ByIP)(func(c echo.Context) error { return c.NoContent(http.StatusNoContent) })
+	e := echo.New()
+
+	request := func() (*httptest.ResponseRecorder, error) {
+		req := httptest.NewRequest(http.MethodPost, "/login", nil)
+		req.Header.Set(echo.HeaderXRealIP, "192.0.2.1")
+		rec := httptest.NewRecorder()
+		return rec, h(e.NewContext(req, rec))
+	}
+	for i, remaining := range []string{"1", "0"} {
+		rec, err := request()
+		if err != nil || rec.Header().Get("RateLimit-Remaining") != remaining || rec.Header().Get("RateLimit-Policy") != "2;w=60" {
+			t.Fatalf("request %d: %v with headers %v, want %s left", i+1, err, rec.Header(), remaining)
+		}
+	}
+	rec, err := request()
+	if e, ok := err.(*apperr.Error); !ok || e.Code != apperr.RateLimited {
+		t.Fatalf("third request = %v, want code %q", err, apperr.RateLimited)
+	}
+	if rec.Header().Get(echo.HeaderRetryAfter) == "" {
+		t.Errorf("no Retry-After header on a limited request")
+	}
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+
+	"echo-api/db"
+	"echo-api/migrations"
+)
+
+const migrateUsage = "usage: echo-api migrate [status | up | down [steps] | redo]"
+
+// runMigrate handles the migrate subcommand
+func runMigrate(args []string) {
+	ctx := context.Background()
+	command := "up"
+	if len(args) > 0 {
+		command = args[0]
+	}
+
+	switch command {
+	case "status":
+		statuses, err := migrations.GetStatus(ctx, db.DB, db.Driver)
+		if err != nil {
+			commandFailed("migrate status", err)
+		}
+		for _, s := range statuses {
+			applied := "pending"
+			if s.AppliedAt != nil {
+				applied = "applied " + s.AppliedAt.Format("2006-01-02 15:04:05")
+			}
+			fmt.Printf("%04d  %-32s %s\n", s.Version, s.Name, applied)
+		}
+
+	case "up":
+		ran, err := migrations.Up(ctx, db.DB, db.Driver)
+		for _, m := range ran {
+			fmt.Printf("applied %04d_%s\n", m.Version, m.Name)
+		}
+		if err != nil {
+			commandFailed("migrate up", err)
+		}
+		if len(ran) == 0 {
+			fmt.Println("no pending migrations")
+		}
+
+	case "down":
+		steps := 1
+		if len(args) > 1 {
+			n, err := strconv.Atoi(args[1])
+			if err != nil || n < 1 {
+				fmt.Fprintln(os.Stderr, migrateUsage)
+				os.Exit(2)
+			}
+			steps = n
+		}
+		ran, err := migrations.Down(ctx, db.DB, db.Driver, steps)
+		for _, m := range ran {
+			fmt.Printf("reverted %04d_%s\n", m.Version, m.Name)
+		}
+		if err != nil {
+			commandFailed("migrate down", err)
+		}
+		if len(ran) == 0 {
+			fmt.Println("no applied migrations")
+		}
+
+	case "redo":
+		m, err := migrations.Redo(ctx, db.DB, db.Driver)
+		if err != nil {
+			commandFailed("migrate redo", err)
+		}
+		if m == nil {
+			fmt.Println("no applied migrations")
+			return
+		}
+		fmt.Printf("redid %04d_%s\n", m.Version, m.Name)
+
+	default:
+		fmt.Fprintln(os.Stderr, migrateUsage)
+		os.Exit(2)
+	}
+}
+
+// commandFailed reports a failed command on stderr, plain like the rest of the
+// command's output rather than in the structured log, and exits
+func commandFailed(command string, err error) {
+	fmt.Fprintf(os.Stderr, "%s: %v\n", command, err)
+	os.Exit(1)
+}
@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS user_quotas;
+DROP TABLE IF EXISTS role_quotas;
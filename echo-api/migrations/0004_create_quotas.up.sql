@@ -0,0 +1,19 @@
+-- Storage limits per role; NULL means unlimited
+CREATE TABLE IF NOT EXISTS role_quotas (
+    role VARCHAR(50) PRIMARY KEY,
+    max_storage_bytes BIGINT,
+    max_file_size BIGINT
+);
+
+INSERT INTO role_quotas (role, max_storage_bytes, max_file_size) VALUES
+    ('user', 1073741824, 104857600),
+    ('admin', NULL, NULL)
+ON CONFLICT (role) DO NOTHING;
+
+-- Per-user overrides of the role limits; NULL falls back to the role
+CREATE TABLE IF NOT EXISTS user_quotas (
+    user_id INTEGER PRIMARY KEY,
+    max_storage_bytes BIGINT,
+    max_file_size BIGINT,
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
@@ -0,0 +1,20 @@
+-- Access granted to other users on a file or a folder; folder grants
+-- cover everything inside the folder and its subfolders
+CREATE TABLE IF NOT EXISTS file_permissions (
+    id SERIAL PRIMARY KEY,
+    file_id VARCHAR(36),
+    folder_id VARCHAR(36),
+    user_id INTEGER NOT NULL,
+    access VARCHAR(20) NOT NULL CHECK (access IN ('read', 'read_write')),
+    granted_by INTEGER NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    CHECK ((file_id IS NULL) <> (folder_id IS NULL)),
+    UNIQUE (file_id, user_id),
+    UNIQUE (folder_id, user_id),
+    FOREIGN KEY (file_id) REFERENCES files(id) ON DELETE CASCADE,
+    FOREIGN KEY (folder_id) REFERENCES folders(id) ON DELETE CASCADE,
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+    FOREIGN KEY (granted_by) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_file_permissions_user_id ON file_permissions(user_id);
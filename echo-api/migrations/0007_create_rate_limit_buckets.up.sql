@@ -0,0 +1,10 @@
+-- Token buckets of the rate limiter when rate_limit.store is database.
+-- Keys are policy:ip:address or policy:user:id; updated_at is in microseconds
+-- since the epoch. Buckets idle long enough to be full again are deleted.
+CREATE TABLE IF NOT EXISTS rate_limit_buckets (
+    key VARCHAR(255) PRIMARY KEY,
+    tokens DOUBLE PRECISION NOT NULL,
+    updated_at BIGINT NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_rate_limit_buckets_updated_at ON rate_limit_buckets(updated_at);
@@ -0,0 +1,9 @@
+-- Failed logins counted per account (user:username) and per client IP
+-- (ip:address); last_failure_at is in microseconds since the epoch. Counts
+-- start over after lockout.window without a failure and are deleted on a
+-- successful login or an admin unlock.
+CREATE TABLE IF NOT EXISTS login_failures (
+    key VARCHAR(300) PRIMARY KEY,
+    failures INTEGER NOT NULL,
+    last_failure_at BIGINT NOT NULL
+);
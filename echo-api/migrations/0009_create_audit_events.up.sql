@@ -0,0 +1,15 @@
+-- Security-relevant events such as lockouts. user_id is the account the
+-- event concerns and actor_id the user who caused it, if any; neither is a
+-- foreign key so that events outlive the users. details is a JSON object.
+CREATE TABLE IF NOT EXISTS audit_events (
+    id SERIAL PRIMARY KEY,
+    event VARCHAR(64) NOT NULL,
+    user_id INTEGER,
+    actor_id INTEGER,
+    ip VARCHAR(64) NOT NULL DEFAULT '',
+    details TEXT NOT NULL DEFAULT '{}',
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_audit_events_user_id ON audit_events(user_id);
+CREATE INDEX IF NOT EXISTS idx_audit_events_created_at ON audit_events(created_at);
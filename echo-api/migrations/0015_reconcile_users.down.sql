@@ -0,0 +1,2 @@
+ALTER TABLE users DROP COLUMN display_name;
+ALTER TABLE users RENAME COLUMN password_hash TO password;
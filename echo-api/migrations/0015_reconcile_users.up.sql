@@ -0,0 +1,6 @@
+-- Reconciles the users table with the shape the file services were first
+-- written against: passwords are kept as bcrypt hashes in password_hash, empty
+-- for accounts without one. Passwords stored in plain text before are hashed
+-- at their owner's next login. Users can also set a display name.
+ALTER TABLE users RENAME COLUMN password TO password_hash;
+ALTER TABLE users ADD COLUMN display_name VARCHAR(100);
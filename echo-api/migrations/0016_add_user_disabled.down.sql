@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS idx_files_user_id;
+ALTER TABLE users DROP COLUMN disabled_at;
@@ -0,0 +1,5 @@
+-- When an admin disabled the account; disabled accounts cannot log in. The
+-- index on files(user_id) serves the per-user storage usage admins look at.
+ALTER TABLE users ADD COLUMN disabled_at TIMESTAMP WITH TIME ZONE;
+
+CREATE INDEX IF NOT EXISTS idx_files_user_id ON files(user_id);
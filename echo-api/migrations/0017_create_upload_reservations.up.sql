@@ -0,0 +1,16 @@
+-- Storage held by uploads in progress, counted as used so that parallel
+-- uploads cannot together exceed a quota. The upload service replaces a
+-- reservation with the file's row when the upload completes and deletes it
+-- when the upload fails; expires_at bounds those left by a crashed service.
+CREATE TABLE IF NOT EXISTS upload_reservations (
+    id VARCHAR(36) PRIMARY KEY,
+    user_id INTEGER NOT NULL,
+    org_id INTEGER NOT NULL,
+    bytes BIGINT NOT NULL,
+    expires_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+    FOREIGN KEY (org_id) REFERENCES organizations(id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_upload_reservations_user_id ON upload_reservations(user_id);
+CREATE INDEX IF NOT EXISTS idx_upload_reservations_org_id ON upload_reservations(org_id);
@@ -0,0 +1,3 @@
+-- When the user started deleting the account. It can no longer log in or use
+-- its API keys while its files are released, and deleting it again finishes.
+ALTER TABLE users ADD COLUMN deleted_at TIMESTAMP WITH TIME ZONE;
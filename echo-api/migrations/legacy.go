@@ -0,0 +1,70 @@
+package migrations
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"echo-api/db"
+)
+
+// Before migrations, the file services shipped an init.sql that Postgres ran
+// on its first start. It created the tables of migrations 0002 to 0006 as they
+// are, but a users table of its own: passwords in password_hash, and a
+// required, unique email. Only the users table needs reshaping for the
+// migrations to apply; SQLite support came after init.sql was gone.
+
+// adoptLegacyUsers reshapes the users table created by init.sql into the one
+// of migration 0001, so that the pending migrations apply to it, and reports
+// whether it did. The addresses are put aside until restoreLegacyEmails. It
+// does nothing once a migration has been recorded.
+func adoptLegacyUsers(ctx context.Context, tx *sql.Tx, driver string) (bool, error) {
+	if driver != db.Postgres {
+		return false, nil
+	}
+
+	var legacy bool
+	err := tx.QueryRowContext(ctx, `
+		SELECT EXISTS (
+			SELECT 1 FROM information_schema.columns
+			WHERE table_schema = current_schema() AND table_name = 'users' AND column_name = 'password_hash'
+		) AND NOT EXISTS (SELECT 1 FROM schema_migrations)
+	`).Scan(&legacy)
+	if err != nil || !legacy {
+		return false, err
+	}
+
+	_, err = tx.ExecContext(ctx, `
+		CREATE TABLE legacy_user_emails (
+			user_id INTEGER PRIMARY KEY,
+			email VARCHAR(255) NOT NULL
+		);
+		INSERT INTO legacy_user_emails (user_id, email) SELECT id, email FROM users;
+		ALTER TABLE users DROP COLUMN email;
+		ALTER TABLE users RENAME COLUMN password_hash TO password;
+	`)
+	if err != nil {
+		return false, fmt.Errorf("adopt the users table of init.sql: %w", err)
+	}
+	return true, nil
+}
+
+// restoreLegacyEmails gives adopted users back their addresses once migration
+// 0011 has added the column. They were never verified and are stored
+// lower-cased like new ones; addresses that only differed in case are dropped,
+// since no one can tell which user they belong to.
+func restoreLegacyEmails(ctx context.Context, tx *sql.Tx) error {
+	_, err := tx.ExecContext(ctx, `
+		UPDATE users SET email = LOWER(l.email)
+		FROM legacy_user_emails l
+		WHERE l.user_id = users.id AND NOT EXISTS (
+			SELECT 1 FROM legacy_user_emails other
+			WHERE other.user_id <> l.user_id AND LOWER(other.email) = LOWER(l.email)
+		);
+		DROP TABLE legacy_user_emails;
+	`)
+	if err != nil {
+		return fmt.Errorf("restore the emails of init.sql users: %w", err)
+	}
+	return nil
+}
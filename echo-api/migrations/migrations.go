@@ -0,0 +1,295 @@
+// Package migrations holds the canonical database schema as versioned SQL
+// migrations embedded in the binary. The files are written for Postgres and
+// adapted to SQLite when applied. echo-api owns the schema; the file services
+// only read and write the tables it creates.
+package migrations
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"fmt"
+	"io/fs"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"echo-api/db"
+)
+
+//go:embed *.sql
+var files embed.FS
+
+// lockKey identifies the advisory lock held while migrating, so that
+// services starting at the same time apply each migration only once
+const lockKey int64 = 0x6563686f617069 // "echoapi"
+
+// Migration is one versioned schema change, read from NNNN_name.up.sql
+// and NNNN_name.down.sql
+type Migration struct {
+	Version int64
+	Name    string
+	Up      string
+	Down    string
+}
+
+// Status describes a migration and whether it has been applied
+type Status struct {
+	Migration
+	AppliedAt *time.Time
+}
+
+// Load returns the embedded migrations ordered by version
+func Load() ([]Migration, error) {
+	entries, err := fs.ReadDir(files, ".")
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := map[int64]*Migration{}
+	for _, entry := range entries {
+		name := entry.Name()
+		base, direction, ok := strings.Cut(strings.TrimSuffix(name, ".sql"), ".")
+		if !ok || (direction != "up" && direction != "down") {
+			return nil, fmt.Errorf("migration %s: expected NNNN_name.up.sql or NNNN_name.down.sql", name)
+		}
+		prefix, label, _ := strings.Cut(base, "_")
+		version, err := strconv.ParseInt(prefix, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("migration %s: invalid version", name)
+		}
+
+		contents, err := files.ReadFile(name)
+		if err != nil {
+			return nil, err
+		}
+
+		m, ok := byVersion[version]
+		if !ok {
+			m = &Migration{Version: version, Name: label}
+			byVersion[version] = m
+		} else if m.Name != label {
+			return nil, fmt.Errorf("migration %d: conflicting names %q and %q", version, m.Name, label)
+		}
+		if direction == "up" {
+			m.Up = string(contents)
+		} else {
+			m.Down = string(contents)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if m.Up == "" || m.Down == "" {
+			return nil, fmt.Errorf("migration %d_%s: missing up or down file", m.Version, m.Name)
+		}
+		migrations = append(migrations, *m)
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+	return migrations, nil
+}
+
+// sqliteTypes rewrites the Postgres-only column types used by the migrations
+// into their SQLite equivalents, so both drivers share one set of files
+var sqliteTypes = strings.NewReplacer(
+	"SERIAL PRIMARY KEY", "INTEGER PRIMARY KEY AUTOINCREMENT",
+	"TIMESTAMP WITH TIME ZONE", "TIMESTAMP",
+)
+
+// forDriver returns the migration SQL for the database driver
+func forDriver(sql, driver string) string {
+	if driver == db.SQLite {
+		return sqliteTypes.Replace(sql)
+	}
+	return sql
+}
+
+// withLock runs fn in one transaction that holds the migration lock. Postgres
+// takes a transaction-scoped advisory lock; SQLite transactions are opened with
+// BEGIN IMMEDIATE (see db.SQLiteDSN), which already excludes other writers.
+// DDL is transactional in both, so a failed run leaves the schema untouched.
+func withLock(ctx context.Context, conn *sql.DB, driver string, fn func(tx *sql.Tx, migrations []Migration) error) error {
+	migrations, err := Load()
+	if err != nil {
+		return err
+	}
+
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if driver == db.Postgres {
+		if _, err := tx.ExecContext(ctx, "SELECT pg_advisory_xact_lock($1)", lockKey); err != nil {
+			return fmt.Errorf("acquire migration lock: %w", err)
+		}
+	}
+
+	_, err = tx.ExecContext(ctx, forDriver(`
+		CREATE TABLE IF NOT EXISTS schema_migrations (
+			version BIGINT PRIMARY KEY,
+			name VARCHAR(255) NOT NULL,
+			applied_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP
+		)
+	`, driver))
+	if err != nil {
+		return fmt.Errorf("create schema_migrations: %w", err)
+	}
+
+	if err := fn(tx, migrations); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// applied returns the applied versions and when they were applied
+func applied(ctx context.Context, tx *sql.Tx) (map[int64]time.Time, error) {
+	rows, err := tx.QueryContext(ctx, "SELECT version, applied_at FROM schema_migrations")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	versions := map[int64]time.Time{}
+	for rows.Next() {
+		var version int64
+		var at time.Time
+		if err := rows.Scan(&version, &at); err != nil {
+			return nil, err
+		}
+		versions[version] = at
+	}
+	return versions, rows.Err()
+}
+
+// run executes one direction of a migration and records it
+func run(ctx context.Context, tx *sql.Tx, driver string, m Migration, up bool) error {
+	query, record := m.Down, "DELETE FROM schema_migrations WHERE version = $1"
+	args := []interface{}{m.Version}
+	if up {
+		query, record = m.Up, "INSERT INTO schema_migrations (version, name) VALUES ($1, $2)"
+		args = append(args, m.Name)
+	}
+
+	// Exec without arguments allows several statements per file
+	if _, err := tx.ExecContext(ctx, forDriver(query, driver)); err != nil {
+		return fmt.Errorf("migration %d_%s: %w", m.Version, m.Name, err)
+	}
+	_, err := tx.ExecContext(ctx, record, args...)
+	return err
+}
+
+// up applies all pending migrations in order
+func up(ctx context.Context, tx *sql.Tx, driver string, migrations []Migration) ([]Migration, error) {
+	done, err := applied(ctx, tx)
+	if err != nil {
+		return nil, err
+	}
+
+	var ran []Migration
+	for _, m := range migrations {
+		if _, ok := done[m.Version]; ok {
+			continue
+		}
+		if err := run(ctx, tx, driver, m, true); err != nil {
+			return nil, err
+		}
+		ran = append(ran, m)
+	}
+	return ran, nil
+}
+
+// down reverts up to steps of the most recently applied migrations
+func down(ctx context.Context, tx *sql.Tx, driver string, migrations []Migration, steps int) ([]Migration, error) {
+	done, err := applied(ctx, tx)
+	if err != nil {
+		return nil, err
+	}
+
+	var ran []Migration
+	for i := len(migrations) - 1; i >= 0 && len(ran) < steps; i-- {
+		m := migrations[i]
+		if _, ok := done[m.Version]; !ok {
+			continue
+		}
+		if err := run(ctx, tx, driver, m, false); err != nil {
+			return nil, err
+		}
+		ran = append(ran, m)
+	}
+	return ran, nil
+}
+
+// Up applies all pending migrations and returns the ones it ran. A database
+// created by the init.sql of the file services is adopted on the first run.
+func Up(ctx context.Context, conn *sql.DB, driver string) ([]Migration, error) {
+	var ran []Migration
+	err := withLock(ctx, conn, driver, func(tx *sql.Tx, migrations []Migration) error {
+		legacy, err := adoptLegacyUsers(ctx, tx, driver)
+		if err != nil {
+			return err
+		}
+		ran, err = up(ctx, tx, driver, migrations)
+		if err != nil || !legacy {
+			return err
+		}
+		return restoreLegacyEmails(ctx, tx)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return ran, nil
+}
+
+// Down reverts the last steps applied migrations and returns the ones it reverted
+func Down(ctx context.Context, conn *sql.DB, driver string, steps int) ([]Migration, error) {
+	var ran []Migration
+	err := withLock(ctx, conn, driver, func(tx *sql.Tx, migrations []Migration) error {
+		var err error
+		ran, err = down(ctx, tx, driver, migrations, steps)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return ran, nil
+}
+
+// Redo reverts the last applied migration and applies it again
+func Redo(ctx context.Context, conn *sql.DB, driver string) (*Migration, error) {
+	var redone *Migration
+	err := withLock(ctx, conn, driver, func(tx *sql.Tx, migrations []Migration) error {
+		reverted, err := down(ctx, tx, driver, migrations, 1)
+		if err != nil || len(reverted) == 0 {
+			return err
+		}
+		redone = &reverted[0]
+		return run(ctx, tx, driver, *redone, true)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return redone, nil
+}
+
+// GetStatus lists every known migration with the time it was applied, if it was
+func GetStatus(ctx context.Context, conn *sql.DB, driver string) ([]Status, error) {
+	var statuses []Status
+	err := withLock(ctx, conn, driver, func(tx *sql.Tx, migrations []Migration) error {
+		done, err := applied(ctx, tx)
+		if err != nil {
+			return err
+		}
+		for _, m := range migrations {
+			s := Status{Migration: m}
+			if at, ok := done[m.Version]; ok {
+				s.AppliedAt = &at
+			}
+			statuses = append(statuses, s)
+		}
+		return nil
+	})
+	return statuses, err
+}
@@ -0,0 +1,117 @@
+package migrations
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"echo-api/db"
+)
+
+func TestUp(t *testing.T) {
+	ctx := context.Background()
+	conn, err := sql.Open("sqlite", db.SQLiteDSN(filepath.Join(t.TempDir(), "test.db")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	all, err := Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ran, err := Up(ctx, conn, db.SQLite); err != nil || len(ran) != len(all) {
+		t.Fatalf("Up() ran %d migrations, %v, want all %d", len(ran), err, len(all))
+	}
+	if ran, err := Up(ctx, conn, db.SQLite); err != nil || len(ran) != 0 {
+		t.Errorf("Up() again ran %d migrations, %v, want none", len(ran), err)
+	}
+}
+
+// TestAdoptLegacySchema needs a Postgres database to create its schema in,
+// given as TEST_POSTGRES_URL
+func TestAdoptLegacySchema(t *testing.T) {
+	dsn := os.Getenv("TEST_POSTGRES_URL")
+	if dsn == "" {
+		t.Skip("TEST_POSTGRES_URL is not set")
+	}
+	ctx := context.Background()
+	admin, err := sql.Open("pgx", dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer admin.Close()
+	schema := fmt.Sprintf("legacy_%d", time.Now().UnixNano())
+	if _, err := admin.ExecContext(ctx, "CREATE SCHEMA "+schema); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { admin.ExecContext(ctx, "DROP SCHEMA "+schema+" CASCADE") })
+
+	u, err := url.Parse(dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	q := u.Query()
+	q.Set("search_path", schema)
+	u.RawQuery = q.Encode()
+	conn, err := sql.Open("pgx", u.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	// A database as init.sql left it, with a user and a file
+	legacy, err := os.ReadFile("testdata/legacy_init.sql")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = conn.ExecContext(ctx, string(legacy)+`;
+		INSERT INTO users (username, email, password_hash) VALUES
+			('alice', 'Alice@Example.com', 'alice hash'),
+			('bob', 'bob@example.com', 'bob hash'),
+			('bob2', 'BOB@example.com', 'bob2 hash');
+		INSERT INTO organizations (name, personal) VALUES ('alice', TRUE);
+		INSERT INTO files (id, filename, content_type, size, user_id, org_id)
+			SELECT 'file', 'a.txt', 'text/plain', 1, id, 1 FROM users WHERE username = 'alice';
+	`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	all, err := Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ran, err := Up(ctx, conn, db.Postgres); err != nil || len(ran) != len(all) {
+		t.Fatalf("Up() ran %d migrations, %v, want all %d", len(ran), err, len(all))
+	}
+
+	// Users keep their password hashes and unambiguous addresses, unverified
+	want := map[string]struct{ hash, email string }{
+		"alice": {"alice hash", "alice@example.com"},
+		"bob":   {"bob hash", ""},
+		"bob2":  {"bob2 hash", ""},
+	}
+	for username, w := range want {
+		var hash string
+		var email sql.NullString
+		var verified sql.NullTime
+		err := conn.QueryRowContext(ctx, "SELECT password_hash, email, email_verified_at FROM users WHERE username = $1", username).
+			Scan(&hash, &email, &verified)
+		if err != nil || hash != w.hash || email.String != w.email || verified.Valid {
+			t.Errorf("%s: %q, %v, verified %v, %v; want %q, %q, unverified", username, hash, email, verified, err, w.hash, w.email)
+		}
+	}
+	var files int
+	if err := conn.QueryRowContext(ctx, "SELECT COUNT(*) FROM files").Scan(&files); err != nil || files != 1 {
+		t.Errorf("%d files, %v, want the one stored before", files, err)
+	}
+	if _, err := conn.ExecContext(ctx, "INSERT INTO users (username, password_hash) VALUES ('carol', '')"); err != nil {
+		t.Errorf("creating a user without an email: %v", err)
+	}
+}
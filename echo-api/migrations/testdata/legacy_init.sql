@@ -0,0 +1,121 @@
+-- The schema the file services created with init.sql before migrations, kept
+-- to test that databases created with it are adopted
+
+-- Create users table first
+CREATE TABLE IF NOT EXISTS users (
+    id SERIAL PRIMARY KEY,
+    username VARCHAR(255) NOT NULL UNIQUE,
+    email VARCHAR(255) NOT NULL UNIQUE,
+    password_hash VARCHAR(255) NOT NULL,
+    role VARCHAR(50) NOT NULL DEFAULT 'user',
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Organizations own files; every user gets a personal organization on registration
+CREATE TABLE IF NOT EXISTS organizations (
+    id SERIAL PRIMARY KEY,
+    name VARCHAR(255) NOT NULL,
+    personal BOOLEAN NOT NULL DEFAULT FALSE,
+    max_storage_bytes BIGINT, -- NULL means unlimited
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS organization_members (
+    org_id INTEGER NOT NULL,
+    user_id INTEGER NOT NULL,
+    role VARCHAR(20) NOT NULL DEFAULT 'member' CHECK (role IN ('owner', 'admin', 'member')),
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (org_id, user_id),
+    FOREIGN KEY (org_id) REFERENCES organizations(id) ON DELETE CASCADE,
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_organization_members_user_id ON organization_members(user_id);
+
+-- Folders group files; parent_id is NULL for top-level folders
+CREATE TABLE IF NOT EXISTS folders (
+    id VARCHAR(36) PRIMARY KEY,
+    name VARCHAR(255) NOT NULL,
+    parent_id VARCHAR(36),
+    user_id INTEGER NOT NULL,
+    org_id INTEGER NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (parent_id) REFERENCES folders(id) ON DELETE CASCADE,
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+    FOREIGN KEY (org_id) REFERENCES organizations(id) ON DELETE CASCADE
+);
+
+-- Then create files table with foreign key reference
+CREATE TABLE IF NOT EXISTS files (
+    id VARCHAR(36) PRIMARY KEY,
+    filename VARCHAR(255) NOT NULL,
+    content_type VARCHAR(100) NOT NULL,
+    size BIGINT NOT NULL,
+    user_id INTEGER NOT NULL,
+    org_id INTEGER NOT NULL,
+    folder_id VARCHAR(36),
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (user_id) REFERENCES users(id),
+    FOREIGN KEY (org_id) REFERENCES organizations(id) ON DELETE CASCADE,
+    FOREIGN KEY (folder_id) REFERENCES folders(id) ON DELETE SET NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_files_org_id ON files(org_id);
+
+-- Storage limits per role; NULL means unlimited
+CREATE TABLE IF NOT EXISTS role_quotas (
+    role VARCHAR(50) PRIMARY KEY,
+    max_storage_bytes BIGINT,
+    max_file_size BIGINT
+);
+
+INSERT INTO role_quotas (role, max_storage_bytes, max_file_size) VALUES
+    ('user', 1073741824, 104857600),
+    ('admin', NULL, NULL)
+ON CONFLICT (role) DO NOTHING;
+
+-- Per-user overrides of the role limits; NULL falls back to the role
+CREATE TABLE IF NOT EXISTS user_quotas (
+    user_id INTEGER PRIMARY KEY,
+    max_storage_bytes BIGINT,
+    max_file_size BIGINT,
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+-- Public links to files; only a hash of the token is stored.
+-- NULL password_hash, expires_at or max_downloads mean no such restriction.
+CREATE TABLE IF NOT EXISTS share_links (
+    id VARCHAR(36) PRIMARY KEY,
+    token_hash VARCHAR(64) NOT NULL UNIQUE,
+    file_id VARCHAR(36) NOT NULL,
+    user_id INTEGER NOT NULL,
+    password_hash VARCHAR(255),
+    expires_at TIMESTAMP WITH TIME ZONE,
+    max_downloads INTEGER,
+    download_count INTEGER NOT NULL DEFAULT 0,
+    revoked_at TIMESTAMP WITH TIME ZONE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (file_id) REFERENCES files(id) ON DELETE CASCADE,
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+-- Access granted to other users on a file or a folder; folder grants
+-- cover everything inside the folder and its subfolders
+CREATE TABLE IF NOT EXISTS file_permissions (
+    id SERIAL PRIMARY KEY,
+    file_id VARCHAR(36),
+    folder_id VARCHAR(36),
+    user_id INTEGER NOT NULL,
+    access VARCHAR(20) NOT NULL CHECK (access IN ('read', 'read_write')),
+    granted_by INTEGER NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    CHECK ((file_id IS NULL) <> (folder_id IS NULL)),
+    UNIQUE (file_id, user_id),
+    UNIQUE (folder_id, user_id),
+    FOREIGN KEY (file_id) REFERENCES files(id) ON DELETE CASCADE,
+    FOREIGN KEY (folder_id) REFERENCES folders(id) ON DELETE CASCADE,
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+    FOREIGN KEY (granted_by) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_file_permissions_user_id ON file_permissions(user_id);
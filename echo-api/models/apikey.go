@@ -0,0 +1,38 @@
+package models
+
+import "time"
+
+// Scopes of API keys. A key needs the read scope of a resource for GET requests
+// and the write scope for the others.
+const (
+	ScopeFilesRead   = "files:read"
+	ScopeFilesWrite  = "files:write"
+	ScopeOrgsRead    = "orgs:read"
+	ScopeOrgsWrite   = "orgs:write"
+	ScopeProfileRead = "profile:read"
+)
+
+// Scopes lists every API key scope
+var Scopes = []string{ScopeFilesRead, ScopeFilesWrite, ScopeOrgsRead, ScopeOrgsWrite, ScopeProfileRead}
+
+// APIKey is a personal API key, stored as a hash
+type APIKey struct {
+	ID         int        `json:"id"`
+	UserID     int        `json:"-"`
+	OrgID      int        `json:"org_id"`
+	Name       string     `json:"name"`
+	Prefix     string     `json:"prefix"` // First characters of the key
+	KeyHash    string     `json:"-"`
+	Scopes     []string   `json:"scopes"`
+	MFA        bool       `json:"-"` // The login that created the key passed a second factor
+	ExpiresAt  *time.Time `json:"expires_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	LastUsedIP string     `json:"last_used_ip,omitempty"`
+	RevokedAt  *time.Time `json:"revoked_at,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+// Active reports whether the key is neither revoked nor expired at now
+func (k *APIKey) Active(now time.Time) bool {
+	return k.RevokedAt == nil && (k.ExpiresAt == nil || now.Before(*k.ExpiresAt))
+}
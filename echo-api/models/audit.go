@@ -0,0 +1,49 @@
+package models
+
+import "time"
+
+// Audit events
+const (
+	EventAccountLocked   = "account_locked"
+	EventIPLocked        = "ip_locked"
+	EventAccountUnlocked = "account_unlocked"
+	EventIPUnlocked      = "ip_unlocked"
+
+	EventMFAEnabled               = "mfa_enabled"
+	EventMFADisabled              = "mfa_disabled"
+	EventRecoveryCodeUsed         = "mfa_recovery_code_used"
+	EventRecoveryCodesRegenerated = "mfa_recovery_codes_regenerated"
+
+	EventEmailVerified = "email_verified"
+	EventPasswordReset = "password_reset"
+
+	EventUserProvisioned  = "user_provisioned"
+	EventIdentityLinked   = "identity_linked"
+	EventIdentityUnlinked = "identity_unlinked"
+
+	EventAPIKeyCreated = "api_key_created"
+	EventAPIKeyRevoked = "api_key_revoked"
+
+	EventSessionRevoked  = "session_revoked"
+	EventSessionsRevoked = "sessions_revoked"
+
+	EventProfileUpdated  = "profile_updated"
+	EventPasswordChanged = "password_changed"
+	EventAccountDeleted  = "account_deleted"
+
+	EventAccountDisabled      = "account_disabled"
+	EventAccountEnabled       = "account_enabled"
+	EventRoleChanged          = "role_changed"
+	EventAdminPasswordReset   = "admin_password_reset"
+	EventImpersonationStarted = "impersonation_started"
+)
+
+type AuditEvent struct {
+	ID        int                    `json:"id"`
+	Event     string                 `json:"event"`
+	UserID    *int                   `json:"user_id"`  // Account the event concerns
+	ActorID   *int                   `json:"actor_id"` // User who caused it
+	IP        string                 `json:"ip"`
+	Details   map[string]interface{} `json:"details"`
+	CreatedAt time.Time              `json:"created_at"`
+}
@@ -0,0 +1,10 @@
+package models
+
+// TOTP is a user's TOTP enrollment
+type TOTP struct {
+	UserID            int
+	Secret            string
+	Enabled           bool  // The first code has been verified
+	LastUsedStep      int64 // Time step of the last code accepted
+	RecoveryCodesLeft int
+}
@@ -0,0 +1,22 @@
+package models
+
+// Roles a user can hold within an organization
+const (
+	OrgRoleOwner  = "owner"
+	OrgRoleAdmin  = "admin"
+	OrgRoleMember = "member"
+)
+
+type Organization struct {
+	ID              int    `json:"id"`
+	Name            string `json:"name"`
+	Personal        bool   `json:"personal"`
+	Role            string `json:"role,omitempty"` // Role of the requesting user
+	MaxStorageBytes *int64 `json:"max_storage_bytes"`
+}
+
+type Member struct {
+	UserID   int    `json:"user_id"`
+	Username string `json:"username"`
+	Role     string `json:"role"` // owner, admin or member
+}
@@ -0,0 +1,17 @@
+package models
+
+import "time"
+
+// Session is a login of a user on a device. The tokens issued for the login
+// and for switching its organization all belong to it.
+type Session struct {
+	ID         int       `json:"id"`
+	UserID     int       `json:"-"`
+	UserAgent  string    `json:"user_agent"`
+	IP         string    `json:"ip"` // Address the login came from
+	LastSeenIP string    `json:"last_seen_ip"`
+	CreatedAt  time.Time `json:"created_at"`
+	LastSeenAt time.Time `json:"last_seen_at"`
+	ExpiresAt  time.Time `json:"expires_at"`
+	Current    bool      `json:"current"` // The session of the token listing it
+}
@@ -1,7 +1,65 @@
 package models
 
+import "time"
+
+// Roles a user can hold across the whole service
+const (
+	RoleUser  = "user"
+	RoleAdmin = "admin"
+)
+
+// Roles lists the roles a user can be given
+var Roles = []string{RoleUser, RoleAdmin}
+
+// User is an account. PasswordHash is empty for accounts created through
+// single sign-on that never set a password.
 type User struct {
-	ID       int    `json:"id"`
+	ID            int       `json:"id"`
+	Username      string    `json:"username"`
+	DisplayName   string    `json:"display_name"`
+	PasswordHash  string    `json:"-"`
+	Email         string    `json:"email,omitempty"`
+	EmailVerified bool      `json:"email_verified"`
+	Role          string    `json:"role"`
+	Disabled      bool      `json:"disabled"` // Disabled by an admin; cannot log in
+	Deleting      bool      `json:"-"`        // Deleting their account; cannot log in
+	CreatedAt     time.Time `json:"created_at"`
+}
+
+// UserFilter selects the users an admin lists
+type UserFilter struct {
+	Query    string // Part of the username, display name or email, in any case
+	Role     string
+	Disabled *bool
+	Limit    int
+	Offset   int
+}
+
+// StorageUsage is how many files a user uploaded, in any organization, and their total size
+type StorageUsage struct {
+	UserID   int    `json:"user_id"`
 	Username string `json:"username"`
-	Password string `json:"password"` // plaintext for demo only — hash in prod
+	Files    int64  `json:"files"`
+	Bytes    int64  `json:"bytes"`
+}
+
+// Purposes of the tokens mailed to users
+const (
+	TokenVerifyEmail   = "verify_email"
+	TokenResetPassword = "reset_password"
+)
+
+// UserToken is a single-use token mailed to a user, stored as a hash
+type UserToken struct {
+	TokenHash string
+	UserID    int
+	Purpose   string
+	Email     string // Address the token was sent to
+	ExpiresAt time.Time
+}
+
+// LoginFailures counts the failed logins of an account or client IP
+type LoginFailures struct {
+	Failures    int
+	LastFailure time.Time
 }
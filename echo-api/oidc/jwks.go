@@ -0,0 +1,98 @@
+package oidc
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"math/big"
+	"strings"
+)
+
+// jsonKey is a JSON Web Key; only the members of RSA and EC public keys are read
+type jsonKey struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+// jsonKeySet is a provider's JWKS document
+type jsonKeySet struct {
+	Keys []jsonKey `json:"keys"`
+}
+
+// key is a parsed signing key
+type key struct {
+	id     string
+	alg    string // Algorithm the key is restricted to, if any
+	public interface{}
+}
+
+// keySet holds the signing keys of a provider
+type keySet []key
+
+// parse returns the RSA and EC signing keys of the set, skipping those it cannot use
+func (s jsonKeySet) parse() keySet {
+	var keys keySet
+	for _, k := range s.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		var public interface{}
+		switch k.Kty {
+		case "RSA":
+			n, e := decodeInt(k.N), decodeInt(k.E)
+			if n == nil || e == nil || !e.IsInt64() || n.BitLen() < 2048 {
+				continue
+			}
+			public = &rsa.PublicKey{N: n, E: int(e.Int64())}
+		case "EC":
+			curve := map[string]elliptic.Curve{"P-256": elliptic.P256(), "P-384": elliptic.P384(), "P-521": elliptic.P521()}[k.Crv]
+			x, y := decodeInt(k.X), decodeInt(k.Y)
+			if curve == nil || x == nil || y == nil || !curve.IsOnCurve(x, y) {
+				continue
+			}
+			public = &ecdsa.PublicKey{Curve: curve, X: x, Y: y}
+		default:
+			continue
+		}
+		keys = append(keys, key{id: k.Kid, alg: k.Alg, public: public})
+	}
+	return keys
+}
+
+// find returns the key with the ID for a token signed with alg. Tokens without
+// a key ID match any key of the right type.
+func (s keySet) find(kid, alg string) interface{} {
+	for _, k := range s {
+		if (kid != "" && k.id != kid) || (k.alg != "" && k.alg != alg) {
+			continue
+		}
+		switch k.public.(type) {
+		case *rsa.PublicKey:
+			if strings.HasPrefix(alg, "RS") || strings.HasPrefix(alg, "PS") {
+				return k.public
+			}
+		case *ecdsa.PublicKey:
+			if strings.HasPrefix(alg, "ES") {
+				return k.public
+			}
+		}
+	}
+	return nil
+}
+
+// decodeInt decodes a base64url big-endian integer, or returns nil
+func decodeInt(s string) *big.Int {
+	b, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(s, "="))
+	if err != nil || len(b) == 0 {
+		return nil
+	}
+	return new(big.Int).SetBytes(b)
+}
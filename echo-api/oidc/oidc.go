@@ -0,0 +1,356 @@
+// Package oidc logs users in through OpenID Connect providers with the
+// authorization code flow and PKCE. It discovers each provider's endpoints and
+// signing keys from its issuer URL, exchanges the code the provider sends back
+// and verifies the ID token it returns.
+package oidc
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"file-service/config"
+)
+
+// signingMethods are the ID token algorithms accepted; tokens signed with the
+// client secret (HS256) or not at all are not
+var signingMethods = []string{"RS256", "RS384", "RS512", "PS256", "PS384", "PS512", "ES256", "ES384", "ES512"}
+
+// maxResponse bounds the provider responses read
+const maxResponse = 1 << 20
+
+// Identity is the user a provider vouches for. Subject is stable per provider
+// and user; the other claims may change between logins.
+type Identity struct {
+	Subject           string
+	Email             string
+	EmailVerified     bool
+	Name              string
+	PreferredUsername string
+}
+
+// metadata is the part of a provider's discovery document used here
+type metadata struct {
+	Issuer                string   `json:"issuer"`
+	AuthorizationEndpoint string   `json:"authorization_endpoint"`
+	TokenEndpoint         string   `json:"token_endpoint"`
+	UserinfoEndpoint      string   `json:"userinfo_endpoint"`
+	JWKSURI               string   `json:"jwks_uri"`
+	TokenAuthMethods      []string `json:"token_endpoint_auth_methods_supported"`
+}
+
+// Provider is an OpenID Connect provider and the client registered with it.
+// Its metadata is discovered on first use, so that the gateway starts while a
+// provider is down, and its keys are fetched again when a token is signed
+// with one they do not include.
+type Provider struct {
+	cfg         config.OIDCProvider
+	redirectURL string
+	scopes      []string
+	client      *http.Client
+
+	mu       sync.Mutex
+	meta     *metadata
+	keys     keySet
+	keysTime time.Time
+}
+
+// New returns the provider of cfg that sends users back to redirectURL
+func New(cfg config.OIDCProvider, redirectURL string, scopes []string) *Provider {
+	return &Provider{
+		cfg:         cfg,
+		redirectURL: redirectURL,
+		scopes:      scopes,
+		client:      &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// Name returns the name the provider is configured under
+func (p *Provider) Name() string {
+	return p.cfg.Name
+}
+
+// NewVerifier returns a random PKCE code verifier
+func NewVerifier() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// challenge returns the S256 PKCE challenge of a verifier
+func challenge(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// AuthCodeURL returns the URL of the provider's login page. The provider sends
+// the user back to the redirect URL with state and a code that Exchange
+// redeems with verifier; the ID token it returns carries nonce.
+func (p *Provider) AuthCodeURL(ctx context.Context, state, nonce, verifier string) (string, error) {
+	meta, err := p.metadata(ctx)
+	if err != nil {
+		return "", err
+	}
+	u, err := url.Parse(meta.AuthorizationEndpoint)
+	if err != nil {
+		return "", fmt.Errorf("authorization endpoint: %w", err)
+	}
+	q := u.Query()
+	q.Set("response_type", "code")
+	q.Set("client_id", p.cfg.ClientID)
+	q.Set("redirect_uri", p.redirectURL)
+	q.Set("scope", strings.Join(p.scopes, " "))
+	q.Set("state", state)
+	q.Set("nonce", nonce)
+	q.Set("code_challenge", challenge(verifier))
+	q.Set("code_challenge_method", "S256")
+	u.RawQuery = q.Encode()
+	return u.String(), nil
+}
+
+// Exchange redeems an authorization code and returns the identity in the
+// verified ID token, filling in the email from the userinfo endpoint if the
+// token leaves it out
+func (p *Provider) Exchange(ctx context.Context, code, verifier, nonce string) (*Identity, error) {
+	meta, err := p.metadata(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {p.redirectURL},
+		"code_verifier": {verifier},
+	}
+	// Secrets go in the Authorization header unless the provider only takes
+	// them in the form; public clients only identify themselves
+	basic := p.cfg.ClientSecret != "" && (len(meta.TokenAuthMethods) == 0 || slices.Contains(meta.TokenAuthMethods, "client_secret_basic"))
+	if !basic {
+		form.Set("client_id", p.cfg.ClientID)
+		if p.cfg.ClientSecret != "" {
+			form.Set("client_secret", p.cfg.ClientSecret)
+		}
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, meta.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if basic {
+		req.SetBasicAuth(url.QueryEscape(p.cfg.ClientID), url.QueryEscape(p.cfg.ClientSecret))
+	}
+
+	var tokens struct {
+		AccessToken string `json:"access_token"`
+		IDToken     string `json:"id_token"`
+		Error       string `json:"error"`
+		Description string `json:"error_description"`
+	}
+	status, err := p.do(req, &tokens)
+	if err != nil {
+		return nil, fmt.Errorf("token endpoint: %w", err)
+	}
+	if status != http.StatusOK || tokens.IDToken == "" {
+		if tokens.Error != "" {
+			return nil, fmt.Errorf("token endpoint: %s: %s", tokens.Error, tokens.Description)
+		}
+		return nil, fmt.Errorf("token endpoint: status %d without an ID token", status)
+	}
+
+	id, err := p.verify(ctx, meta, tokens.IDToken, nonce)
+	if err != nil {
+		return nil, fmt.Errorf("ID token: %w", err)
+	}
+	if id.Email == "" && meta.UserinfoEndpoint != "" && tokens.AccessToken != "" {
+		if err := p.userinfo(ctx, meta, tokens.AccessToken, id); err != nil {
+			return nil, fmt.Errorf("userinfo endpoint: %w", err)
+		}
+	}
+	return id, nil
+}
+
+// idClaims are the ID token claims read here
+type idClaims struct {
+	jwt.RegisteredClaims
+	AuthorizedParty   string `json:"azp"`
+	Nonce             string `json:"nonce"`
+	Email             string `json:"email"`
+	EmailVerified     flag   `json:"email_verified"`
+	Name              string `json:"name"`
+	PreferredUsername string `json:"preferred_username"`
+}
+
+// flag is a boolean claim, which some providers send as a string
+type flag bool
+
+func (f *flag) UnmarshalJSON(b []byte) error {
+	var s string
+	if json.Unmarshal(b, &s) == nil {
+		*f = s == "true"
+		return nil
+	}
+	return json.Unmarshal(b, (*bool)(f))
+}
+
+// verify checks the signature, issuer, audience, lifetime and nonce of an ID token
+func (p *Provider) verify(ctx context.Context, meta *metadata, raw, nonce string) (*Identity, error) {
+	var claims idClaims
+	_, err := jwt.ParseWithClaims(raw, &claims, func(t *jwt.Token) (interface{}, error) {
+		kid, _ := t.Header["kid"].(string)
+		return p.key(ctx, meta, kid, t.Method.Alg())
+	},
+		jwt.WithValidMethods(signingMethods),
+		jwt.WithIssuer(meta.Issuer),
+		jwt.WithAudience(p.cfg.ClientID),
+		jwt.WithExpirationRequired(),
+		jwt.WithIssuedAt(),
+		jwt.WithLeeway(time.Minute),
+	)
+	if err != nil {
+		return nil, err
+	}
+	if len(claims.Audience) > 1 && claims.AuthorizedParty != p.cfg.ClientID {
+		return nil, errors.New("token is authorized for another party")
+	}
+	if claims.Nonce != nonce {
+		return nil, errors.New("nonce does not match")
+	}
+	if claims.Subject == "" {
+		return nil, errors.New("token has no subject")
+	}
+	return &Identity{
+		Subject:           claims.Subject,
+		Email:             claims.Email,
+		EmailVerified:     bool(claims.EmailVerified),
+		Name:              claims.Name,
+		PreferredUsername: claims.PreferredUsername,
+	}, nil
+}
+
+// userinfo fills in the email of id from the userinfo endpoint, as long as it
+// answers for the same subject
+func (p *Provider) userinfo(ctx context.Context, meta *metadata, accessToken string, id *Identity) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, meta.UserinfoEndpoint, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+accessToken)
+	req.Header.Set("Accept", "application/json")
+
+	var info struct {
+		Subject       string `json:"sub"`
+		Email         string `json:"email"`
+		EmailVerified flag   `json:"email_verified"`
+	}
+	status, err := p.do(req, &info)
+	if err != nil {
+		return err
+	}
+	if status != http.StatusOK {
+		return fmt.Errorf("status %d", status)
+	}
+	if info.Subject != id.Subject {
+		return errors.New("subject does not match the ID token")
+	}
+	id.Email, id.EmailVerified = info.Email, bool(info.EmailVerified)
+	return nil
+}
+
+// metadata returns the provider's discovery document, fetching it on first use
+func (p *Provider) metadata(ctx context.Context) (*metadata, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.meta != nil {
+		return p.meta, nil
+	}
+
+	wellKnown := strings.TrimSuffix(p.cfg.Issuer, "/") + "/.well-known/openid-configuration"
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, wellKnown, nil)
+	if err != nil {
+		return nil, err
+	}
+	var meta metadata
+	status, err := p.do(req, &meta)
+	if err != nil {
+		return nil, fmt.Errorf("discovery: %w", err)
+	}
+	if status != http.StatusOK {
+		return nil, fmt.Errorf("discovery: %s answered %d", wellKnown, status)
+	}
+	if meta.Issuer != p.cfg.Issuer {
+		return nil, fmt.Errorf("discovery: issuer %q is not the configured %q", meta.Issuer, p.cfg.Issuer)
+	}
+	if meta.AuthorizationEndpoint == "" || meta.TokenEndpoint == "" || meta.JWKSURI == "" {
+		return nil, errors.New("discovery: authorization, token or JWKS endpoint missing")
+	}
+	p.meta = &meta
+	return p.meta, nil
+}
+
+// keyRefresh is how often the keys may be fetched again for a token signed
+// with an unknown key, so that forged tokens cannot hammer the provider
+const keyRefresh = time.Minute
+
+// key returns the provider's public key with the ID, fetching the key set
+// when it is not known
+func (p *Provider) key(ctx context.Context, meta *metadata, kid, alg string) (interface{}, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if k := p.keys.find(kid, alg); k != nil {
+		return k, nil
+	}
+	if time.Since(p.keysTime) < keyRefresh {
+		return nil, fmt.Errorf("no key %q for %s", kid, alg)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, meta.JWKSURI, nil)
+	if err != nil {
+		return nil, err
+	}
+	var set jsonKeySet
+	status, err := p.do(req, &set)
+	if err != nil {
+		return nil, fmt.Errorf("JWKS: %w", err)
+	}
+	if status != http.StatusOK {
+		return nil, fmt.Errorf("JWKS: status %d", status)
+	}
+	p.keys, p.keysTime = set.parse(), time.Now()
+	if k := p.keys.find(kid, alg); k != nil {
+		return k, nil
+	}
+	return nil, fmt.Errorf("no key %q for %s", kid, alg)
+}
+
+// do sends a request and decodes its JSON response into v, returning the status
+func (p *Provider) do(req *http.Request, v interface{}) (int, error) {
+	res, err := p.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer res.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(res.Body, maxResponse))
+	if err != nil {
+		return 0, err
+	}
+	if err := json.Unmarshal(body, v); err != nil && res.StatusCode == http.StatusOK {
+		return 0, fmt.Errorf("invalid response: %w", err)
+	}
+	return res.StatusCode, nil
+}
@@ -0,0 +1,133 @@
+// Package problem writes the errors of echo-api as RFC 9457 problem details.
+// Every error response is an application/problem+json document with the
+// standard members and three extensions: code, the machine-readable code of
+// the error, request_id, and the details of the error, if any.
+package problem
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+	"file-service/apperr"
+	"file-service/logging"
+)
+
+// ContentType is the media type of problem documents
+const ContentType = "application/problem+json"
+
+// logger logs the failures behind 5xx responses
+var logger = logging.For("api")
+
+// Problem is a problem details document
+type Problem struct {
+	Type      string
+	Title     string
+	Status    int
+	Detail    string
+	Code      apperr.Code
+	RequestID string
+	// Details are written as extension members next to the standard ones
+	Details map[string]interface{}
+}
+
+// MarshalJSON writes the details as top-level members; ones that clash with
+// the standard members are dropped
+func (p Problem) MarshalJSON() ([]byte, error) {
+	m := make(map[string]interface{}, len(p.Details)+6)
+	for k, v := range p.Details {
+		m[k] = v
+	}
+	m["type"] = p.Type
+	m["title"] = p.Title
+	m["status"] = p.Status
+	m["code"] = p.Code
+	if p.Detail != "" {
+		m["detail"] = p.Detail
+	}
+	if p.RequestID != "" {
+		m["request_id"] = p.RequestID
+	}
+	return json.Marshal(m)
+}
+
+// From converts an error into the problem it is answered with. Errors that are
+// neither apperr, Echo nor gRPC errors are internal.
+func From(err error) Problem {
+	var he *echo.HTTPError
+	if errors.As(err, &he) {
+		return fromHTTP(he)
+	}
+
+	// Errors that are not gRPC statuses come out as Unknown, hence internal
+	e := apperr.FromGRPC(err)
+	return Problem{
+		Type:    "about:blank",
+		Title:   http.StatusText(e.HTTPStatus()),
+		Status:  e.HTTPStatus(),
+		Detail:  e.Message,
+		Code:    e.Code,
+		Details: e.Details,
+	}
+}
+
+// fromHTTP converts the HTTP errors Echo and its middleware return, such as
+// bind failures, unknown routes and oversized bodies
+func fromHTTP(he *echo.HTTPError) Problem {
+	p := Problem{Type: "about:blank", Title: http.StatusText(he.Code), Status: he.Code, Code: httpErrorCodes[he.Code]}
+	if p.Code == "" {
+		p.Code = apperr.InvalidRequest
+		if he.Code >= http.StatusInternalServerError {
+			p.Code = apperr.Internal
+		}
+	}
+	if msg, ok := he.Message.(string); ok && he.Code < http.StatusInternalServerError {
+		p.Detail = msg
+	}
+	return p
+}
+
+// httpErrorCodes are the codes of the HTTP errors Echo and its middleware return
+var httpErrorCodes = map[int]apperr.Code{
+	http.StatusUnauthorized:          apperr.Unauthenticated,
+	http.StatusForbidden:             apperr.PermissionDenied,
+	http.StatusNotFound:              apperr.NotFound,
+	http.StatusMethodNotAllowed:      apperr.MethodNotAllowed,
+	http.StatusRequestEntityTooLarge: apperr.RequestTooLarge,
+	http.StatusTooManyRequests:       apperr.ResourceExhausted,
+	http.StatusServiceUnavailable:    apperr.Unavailable,
+}
+
+// Handler is the HTTP error handler of the Echo server. It answers with the
+// problem of the error, unless the response has already started, and logs
+// the unexpected errors behind 5xx responses.
+func Handler(err error, c echo.Context) {
+	if c.Response().Committed {
+		return
+	}
+
+	p := From(err)
+	p.RequestID = logging.RequestID(c.Request().Context())
+	// Handlers log the failures behind the apperr errors they return themselves
+	var e *apperr.Error
+	if p.Status >= http.StatusInternalServerError && !errors.As(err, &e) {
+		logger.ErrorContext(c.Request().Context(), "Request failed", "code", p.Code, "error", err)
+	}
+
+	// Rate limits hit by the file services have no RateLimit headers, but their wait is known
+	if wait, ok := p.Details["retry_after_seconds"]; ok && c.Response().Header().Get(echo.HeaderRetryAfter) == "" {
+		c.Response().Header().Set(echo.HeaderRetryAfter, fmt.Sprint(wait))
+	}
+
+	if c.Request().Method == http.MethodHead {
+		err = c.NoContent(p.Status)
+	} else {
+		body, _ := json.Marshal(p)
+		err = c.Blob(p.Status, ContentType, body)
+	}
+	if err != nil {
+		logger.ErrorContext(c.Request().Context(), "Writing error response failed", "error", err)
+	}
+}
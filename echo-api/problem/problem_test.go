@@ -0,0 +1,103 @@
+package problem
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"file-service/apperr"
+)
+
+func TestHandler(t *testing.T) {
+	tests := []struct {
+		name       string
+		method     string
+		err        error
+		status     int
+		body       map[string]interface{}
+		retryAfter string
+	}{
+		{
+			name:   "apperr",
+			err:    apperr.New(codes.NotFound, apperr.FileNotFound, "file not found").With("file_id", "f1").With("status", 200),
+			status: http.StatusNotFound,
+			body: map[string]interface{}{"type": "about:blank", "title": "Not Found", "status": float64(404),
+				"code": "file_not_found", "detail": "file not found", "file_id": "f1"},
+		},
+		{
+			name:   "file service failure",
+			err:    status.Error(codes.Internal, "pq: connection refused"),
+			status: http.StatusInternalServerError,
+			body: map[string]interface{}{"type": "about:blank", "title": "Internal Server Error", "status": float64(500),
+				"code": "internal", "detail": "internal error"},
+		},
+		{
+			name:   "rate limited by a file service",
+			err:    apperr.New(codes.ResourceExhausted, apperr.RateLimited, "too many requests").With("retry_after_seconds", 7).GRPCStatus().Err(),
+			status: http.StatusTooManyRequests,
+			body: map[string]interface{}{"type": "about:blank", "title": "Too Many Requests", "status": float64(429),
+				"code": "rate_limited", "detail": "too many requests", "retry_after_seconds": float64(7)},
+			retryAfter: "7",
+		},
+		{
+			name:   "echo",
+			err:    echo.NewHTTPError(http.StatusRequestEntityTooLarge, "Request Entity Too Large"),
+			status: http.StatusRequestEntityTooLarge,
+			body: map[string]interface{}{"type": "about:blank", "title": "Request Entity Too Large", "status": float64(413),
+				"code": "request_too_large", "detail": "Request Entity Too Large"},
+		},
+		{
+			name:   "other",
+			err:    errors.New("disk full"),
+			status: http.StatusInternalServerError,
+			body: map[string]interface{}{"type": "about:blank", "title": "Internal Server Error", "status": float64(500),
+				"code": "internal", "detail": "internal error"},
+		},
+		{
+			name:   "HEAD",
+			method: http.MethodHead,
+			err:    apperr.New(codes.NotFound, apperr.FileNotFound, "file not found"),
+			status: http.StatusNotFound,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			method := tt.method
+			if method == "" {
+				method = http.MethodGet
+			}
+			rec := httptest.NewRecorder()
+			Handler(tt.err, echo.New().NewContext(httptest.NewRequest(method, "/", nil), rec))
+
+			if rec.Code != tt.status || rec.Header().Get(echo.HeaderRetryAfter) != tt.retryAfter {
+				t.Errorf("status %d, Retry-After %q, want %d, %q", rec.Code, rec.Header().Get(echo.HeaderRetryAfter), tt.status, tt.retryAfter)
+			}
+			if tt.body == nil {
+				if rec.Body.Len() != 0 {
+					t.Errorf("body %q, want none", rec.Body)
+				}
+				return
+			}
+			if ct := rec.Header().Get(echo.HeaderContentType); ct != ContentType {
+				t.Errorf("Content-Type %q, want %q", ct, ContentType)
+			}
+			var body map[string]interface{}
+			if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+				t.Fatal(err)
+			}
+			if len(body) != len(tt.body) {
+				t.Errorf("body %v, want %v", body, tt.body)
+			}
+			for k, v := range tt.body {
+				if body[k] != v {
+					t.Errorf("%s = %v, want %v", k, body[k], v)
+				}
+			}
+		})
+	}
+}
@@ -1,27 +1,120 @@
 package routes
 
 import (
-	"os"
+	"strconv"
 
 	"github.com/labstack/echo/v4"
-	echojwt "github.com/labstack/echo-jwt/v4"
+	"github.com/labstack/echo/v4/middleware"
 	"echo-api/handlers"
+	auth "echo-api/middleware"
+	"echo-api/utils"
+	"file-service/config"
+	"file-service/ratelimit"
 )
 
-func Setup(e *echo.Echo) {
+// Setup registers the routes; maxUploadSize limits upload request bodies and
+// limiter throttles clients by the policies named here
+func Setup(e *echo.Echo, maxUploadSize config.ByteSize, limiter *ratelimit.Limiter) {
 	// Public routes
-	e.POST("/register", handlers.Register)
-	e.POST("/login", handlers.Login)
+	e.POST("/register", handlers.Register, auth.RateLimit(limiter, "register", auth.ByIP))
+	e.POST("/login", handlers.Login, auth.RateLimit(limiter, "login", auth.ByIP))
+	e.POST("/login/mfa", handlers.LoginMFA, auth.RateLimit(limiter, "login", auth.ByIP))
+	e.GET("/email/verify", handlers.VerifyEmail, auth.RateLimit(limiter, "login", auth.ByIP))
+	e.POST("/email/verify", handlers.VerifyEmail, auth.RateLimit(limiter, "login", auth.ByIP))
+	e.POST("/password/forgot", handlers.ForgotPassword, auth.RateLimit(limiter, "mail", auth.ByIP))
+	e.POST("/password/reset", handlers.ResetPassword, auth.RateLimit(limiter, "login", auth.ByIP))
+	e.GET("/auth/oidc", handlers.ListOIDCProviders)
+	e.GET("/auth/oidc/:provider/login", handlers.StartOIDCLogin, auth.RateLimit(limiter, "login", auth.ByIP))
+	e.GET("/auth/oidc/:provider/callback", handlers.OIDCCallback, auth.RateLimit(limiter, "login", auth.ByIP))
+	e.GET("/s/:token", handlers.DownloadSharedFile, auth.RateLimit(limiter, "share", auth.ByIP))
+	e.POST("/s/:token", handlers.DownloadSharedFile, auth.RateLimit(limiter, "share", auth.ByIP))
+	e.GET("/files/signed/:id", handlers.DownloadSignedFile, auth.RateLimit(limiter, "share", auth.ByIP))
+	e.GET("/healthz", handlers.Healthz)
+	e.GET("/readyz", handlers.Ready)
+
+	jwt := auth.JWT(utils.JWTSecret, handlers.CheckSession, handlers.CheckAPIKey)
+
+	// Users whose role requires two-factor authentication can only enroll until they do
+	mfa := e.Group("/profile/mfa")
+	mfa.Use(jwt, auth.RateLimit(limiter, "user", auth.ByUser), auth.RequireLogin)
+	mfa.GET("", handlers.GetMFAStatus)
+	mfa.POST("/totp", handlers.EnrollTOTP)
+	mfa.POST("/totp/verify", handlers.VerifyTOTP)
+	mfa.DELETE("/totp", handlers.DisableTOTP)
+	mfa.POST("/recovery-codes", handlers.RegenerateRecoveryCodes)
+	requireMFA := auth.RequireMFA(func() []string { return handlers.MFASettings().RequiredRoles })
+
+	// API keys stand in for a login on the routes of their scopes; they never
+	// manage the account or get other tokens
+	apiKey := auth.APIKey(handlers.ExchangeAPIKey)
 
 	// Protected group
 	r := e.Group("/profile")
-	r.Use(echojwt.JWT([]byte(os.Getenv("JWT_SECRET"))))
+	r.Use(apiKey, jwt, auth.RateLimit(limiter, "user", auth.ByUser), requireMFA, auth.RequireScope("profile"))
 	r.GET("", handlers.Profile)
+	r.PATCH("", handlers.UpdateProfile, auth.RequireLogin)
+	r.DELETE("", handlers.DeleteAccount, auth.RequireLogin)
+	r.PUT("/password", handlers.ChangePassword, auth.RequireLogin)
+	r.GET("/export", handlers.ExportAccount, auth.RequireLogin)
+	r.GET("/usage", handlers.GetStorageUsage)
+	r.POST("/email/verification", handlers.ResendVerification, auth.RequireLogin, auth.RateLimit(limiter, "mail", auth.ByUser))
+	r.GET("/identities", handlers.ListIdentities, auth.RequireLogin)
+	r.DELETE("/identities/:id", handlers.UnlinkIdentity, auth.RequireLogin)
+	r.GET("/api-keys", handlers.ListAPIKeys, auth.RequireLogin)
+	r.POST("/api-keys", handlers.CreateAPIKey, auth.RequireLogin)
+	r.DELETE("/api-keys/:id", handlers.RevokeAPIKey, auth.RequireLogin)
+	r.GET("/sessions", handlers.ListSessions, auth.RequireLogin)
+	r.DELETE("/sessions", handlers.RevokeSessions, auth.RequireLogin)
+	r.DELETE("/sessions/:id", handlers.RevokeSession, auth.RequireLogin)
 
 	// File handling routes
 	files := e.Group("/files")
-	files.Use(echojwt.JWT([]byte(os.Getenv("JWT_SECRET"))))
-	files.POST("/upload", handlers.UploadFile)
+	files.Use(apiKey, jwt, auth.RateLimit(limiter, "user", auth.ByUser), requireMFA, auth.RequireScope("files"))
+	files.POST("/upload", handlers.UploadFile, auth.RateLimit(limiter, "upload", auth.ByUser),
+		middleware.BodyLimit(strconv.FormatInt(int64(maxUploadSize), 10)))
 	files.GET("/download/:id", handlers.DownloadFile)
+	files.GET("/:id/signed-url", handlers.CreateSignedURL)
 	files.GET("/list", handlers.ListFiles)
+	files.POST("/:id/shares", handlers.CreateShareLink)
+	files.GET("/shares", handlers.ListShareLinks)
+	files.DELETE("/shares/:id", handlers.RevokeShareLink)
+	files.GET("/shared", handlers.ListSharedFiles)
+	files.POST("/:id/permissions", handlers.GrantAccess(handlers.ResourceFile))
+	files.GET("/:id/permissions", handlers.ListGrants(handlers.ResourceFile))
+	files.DELETE("/:id/permissions/:user_id", handlers.RevokeAccess(handlers.ResourceFile))
+
+	// Folder routes
+	folders := e.Group("/folders")
+	folders.Use(apiKey, jwt, auth.RateLimit(limiter, "user", auth.ByUser), requireMFA, auth.RequireScope("files"))
+	folders.POST("", handlers.CreateFolder)
+	folders.POST("/:id/permissions", handlers.GrantAccess(handlers.ResourceFolder))
+	folders.GET("/:id/permissions", handlers.ListGrants(handlers.ResourceFolder))
+	folders.DELETE("/:id/permissions/:user_id", handlers.RevokeAccess(handlers.ResourceFolder))
+
+	// Organization routes
+	orgs := e.Group("/orgs")
+	orgs.Use(apiKey, jwt, auth.RateLimit(limiter, "user", auth.ByUser), requireMFA, auth.RequireScope("orgs"))
+	orgs.POST("", handlers.CreateOrganization)
+	orgs.GET("", handlers.ListOrganizations)
+	orgs.POST("/:id/switch", handlers.SwitchOrganization, auth.RequireLogin)
+	orgs.GET("/:id/members", handlers.ListMembers)
+	orgs.POST("/:id/members", handlers.AddMember)
+	orgs.PUT("/:id/members/:user_id", handlers.SetMemberRole)
+	orgs.DELETE("/:id/members/:user_id", handlers.RemoveMember)
+	orgs.PUT("/:id/quota", handlers.SetOrganizationQuota, auth.RequireAdmin)
+
+	// Admin routes
+	admin := e.Group("/admin")
+	admin.Use(jwt, auth.RateLimit(limiter, "user", auth.ByUser), requireMFA, auth.RequireAdmin)
+	admin.DELETE("/lockouts/users/:id", handlers.UnlockUser)
+	admin.DELETE("/lockouts/ips/:ip", handlers.UnlockIP)
+	admin.GET("/users", handlers.ListUsers)
+	admin.GET("/users/:id", handlers.GetUser)
+	admin.GET("/users/:id/usage", handlers.GetUserStorageUsage)
+	admin.POST("/users/:id/disable", handlers.DisableUser)
+	admin.POST("/users/:id/enable", handlers.EnableUser)
+	admin.PUT("/users/:id/role", handlers.SetUserRole)
+	admin.POST("/users/:id/password", handlers.ResetUserPassword)
+	admin.POST("/users/:id/impersonate", handlers.ImpersonateUser)
+	admin.GET("/usage", handlers.ListStorageUsage)
 }
@@ -0,0 +1,849 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"echo-api/models"
+)
+
+// Memory implements the stores in maps, for tests and running without a database
+type Memory struct {
+	mu      sync.Mutex
+	users   map[int]models.User
+	orgs    map[int]models.Organization
+	members map[int]map[int]string // org ID to user ID to role
+	nextID  int
+
+	loginFailures map[string]models.LoginFailures
+	events        []models.AuditEvent
+	totp          map[int]models.TOTP
+	recoveryCodes map[int]map[string]bool // user ID to code hash to whether it is unused
+	tokens        map[string]models.UserToken
+	identities    map[int]models.Identity
+	apiKeys       map[int]models.APIKey
+	sessions      map[int]models.Session
+}
+
+var (
+	_ UserStore         = (*Memory)(nil)
+	_ OrgStore          = (*Memory)(nil)
+	_ LoginFailureStore = (*Memory)(nil)
+	_ AuditStore        = (*Memory)(nil)
+	_ MFAStore          = (*Memory)(nil)
+	_ TokenStore        = (*Memory)(nil)
+	_ IdentityStore     = (*Memory)(nil)
+	_ APIKeyStore       = (*Memory)(nil)
+	_ SessionStore      = (*Memory)(nil)
+)
+
+// NewMemory returns an empty in-memory store
+func NewMemory() *Memory {
+	return &Memory{
+		users:   map[int]models.User{},
+		orgs:    map[int]models.Organization{},
+		members: map[int]map[int]string{},
+
+		loginFailures: map[string]models.LoginFailures{},
+		totp:          map[int]models.TOTP{},
+		recoveryCodes: map[int]map[string]bool{},
+		tokens:        map[string]models.UserToken{},
+		identities:    map[int]models.Identity{},
+		apiKeys:       map[int]models.APIKey{},
+		sessions:      map[int]models.Session{},
+	}
+}
+
+// id returns a new ID; users and organizations share one sequence
+func (m *Memory) id() int {
+	m.nextID++
+	return m.nextID
+}
+
+func (m *Memory) createOrganization(ownerID int, org *models.Organization) {
+	org.ID = m.id()
+	stored := *org
+	stored.Role = ""
+	m.orgs[org.ID] = stored
+	m.members[org.ID] = map[int]string{ownerID: models.OrgRoleOwner}
+}
+
+func (m *Memory) CreateUser(ctx context.Context, u *models.User) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, existing := range m.users {
+		if existing.Username == u.Username {
+			return fmt.Errorf("username %q is taken", u.Username)
+		}
+		if u.Email != "" && existing.Email == u.Email {
+			return fmt.Errorf("email %q is taken", u.Email)
+		}
+	}
+
+	u.ID = m.id()
+	if u.Role == "" {
+		u.Role = "user"
+	}
+	u.CreatedAt = time.Now()
+	m.users[u.ID] = *u
+	m.createOrganization(u.ID, &models.Organization{Name: u.Username, Personal: true})
+	return nil
+}
+
+func (m *Memory) GetUser(ctx context.Context, id int) (*models.User, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	u, ok := m.users[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return &u, nil
+}
+
+func (m *Memory) GetUserByUsername(ctx context.Context, username string) (*models.User, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, u := range m.users {
+		if u.Username == username {
+			return &u, nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+func (m *Memory) GetUserByEmail(ctx context.Context, email string) (*models.User, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, u := range m.users {
+		if email != "" && u.Email == email {
+			return &u, nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+func (m *Memory) SetPassword(ctx context.Context, userID int, passwordHash string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	u, ok := m.users[userID]
+	if !ok {
+		return ErrNotFound
+	}
+	u.PasswordHash = passwordHash
+	m.users[userID] = u
+	return nil
+}
+
+func (m *Memory) VerifyEmail(ctx context.Context, userID int, email string) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	u, ok := m.users[userID]
+	if !ok || u.Email != email || u.EmailVerified {
+		return false, nil
+	}
+	u.EmailVerified = true
+	m.users[userID] = u
+	return true, nil
+}
+
+func (m *Memory) UpdateProfile(ctx context.Context, u *models.User) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	stored, ok := m.users[u.ID]
+	if !ok {
+		return ErrNotFound
+	}
+	for id, existing := range m.users {
+		if id != u.ID && existing.Username == u.Username {
+			return fmt.Errorf("username %q is taken", u.Username)
+		}
+	}
+	stored.Username, stored.DisplayName = u.Username, u.DisplayName
+	m.users[u.ID] = stored
+	return nil
+}
+
+func (m *Memory) SetEmail(ctx context.Context, userID int, email string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	u, ok := m.users[userID]
+	if !ok {
+		return ErrNotFound
+	}
+	for id, existing := range m.users {
+		if id != userID && email != "" && existing.Email == email {
+			return fmt.Errorf("email %q is taken", email)
+		}
+	}
+	u.Email, u.EmailVerified = email, false
+	m.users[userID] = u
+	return nil
+}
+
+func (m *Memory) DeleteUser(ctx context.Context, userID int, orgIDs []int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.users[userID]; !ok {
+		return ErrNotFound
+	}
+	for _, orgID := range orgIDs {
+		delete(m.orgs, orgID)
+		delete(m.members, orgID)
+	}
+	for _, members := range m.members {
+		delete(members, userID)
+	}
+	delete(m.users, userID)
+	delete(m.totp, userID)
+	delete(m.recoveryCodes, userID)
+	for hash, t := range m.tokens {
+		if t.UserID == userID {
+			delete(m.tokens, hash)
+		}
+	}
+	for id, i := range m.identities {
+		if i.UserID == userID {
+			delete(m.identities, id)
+		}
+	}
+	for id, k := range m.apiKeys {
+		if k.UserID == userID {
+			delete(m.apiKeys, id)
+		}
+	}
+	for id, s := range m.sessions {
+		if s.UserID == userID {
+			delete(m.sessions, id)
+		}
+	}
+	return nil
+}
+
+func (m *Memory) ListUsers(ctx context.Context, f models.UserFilter) ([]models.User, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	query := strings.ToLower(f.Query)
+	users := []models.User{}
+	for _, u := range m.users {
+		if query != "" && !strings.Contains(strings.ToLower(u.Username), query) &&
+			!strings.Contains(strings.ToLower(u.DisplayName), query) && !strings.Contains(u.Email, query) {
+			continue
+		}
+		if (f.Role != "" && u.Role != f.Role) || (f.Disabled != nil && u.Disabled != *f.Disabled) {
+			continue
+		}
+		users = append(users, u)
+	}
+	sort.Slice(users, func(i, j int) bool { return users[i].ID < users[j].ID })
+	users = users[min(f.Offset, len(users)):]
+	return users[:min(f.Limit, len(users))], nil
+}
+
+func (m *Memory) SetDisabled(ctx context.Context, userID int, disabled bool, now time.Time) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	u, ok := m.users[userID]
+	if !ok || u.Disabled == disabled {
+		return false, nil
+	}
+	u.Disabled = disabled
+	m.users[userID] = u
+	return true, nil
+}
+
+func (m *Memory) MarkDeleting(ctx context.Context, userID int, now time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if u, ok := m.users[userID]; ok {
+		u.Deleting = true
+		m.users[userID] = u
+	}
+	return nil
+}
+
+func (m *Memory) SetRole(ctx context.Context, userID int, role string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	u, ok := m.users[userID]
+	if !ok {
+		return ErrNotFound
+	}
+	u.Role = role
+	m.users[userID] = u
+	return nil
+}
+
+// StorageUsage reports no files; they are kept by the file services, which
+// the memory store does not share
+func (m *Memory) StorageUsage(ctx context.Context, userID int) (*models.StorageUsage, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	u, ok := m.users[userID]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return &models.StorageUsage{UserID: u.ID, Username: u.Username}, nil
+}
+
+func (m *Memory) ListStorageUsage(ctx context.Context, limit int) ([]models.StorageUsage, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	usage := []models.StorageUsage{}
+	for _, u := range m.users {
+		usage = append(usage, models.StorageUsage{UserID: u.ID, Username: u.Username})
+	}
+	sort.Slice(usage, func(i, j int) bool { return usage[i].UserID < usage[j].UserID })
+	return usage[:min(limit, len(usage))], nil
+}
+
+func (m *Memory) CreateOrganization(ctx context.Context, ownerID int, org *models.Organization) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.createOrganization(ownerID, org)
+	return nil
+}
+
+// userOrganizations returns the user's organizations ordered like the SQL store
+func (m *Memory) userOrganizations(userID int) []models.Organization {
+	var orgs []models.Organization
+	for id, members := range m.members {
+		if role, ok := members[userID]; ok {
+			org := m.orgs[id]
+			org.Role = role
+			orgs = append(orgs, org)
+		}
+	}
+	sort.Slice(orgs, func(i, j int) bool {
+		if orgs[i].Personal != orgs[j].Personal {
+			return orgs[i].Personal
+		}
+		return orgs[i].ID < orgs[j].ID
+	})
+	return orgs
+}
+
+func (m *Memory) DefaultOrganization(ctx context.Context, userID int, username string) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if orgs := m.userOrganizations(userID); len(orgs) > 0 {
+		return orgs[0].ID, nil
+	}
+	org := &models.Organization{Name: username, Personal: true}
+	m.createOrganization(userID, org)
+	return org.ID, nil
+}
+
+func (m *Memory) GetOrganization(ctx context.Context, orgID int) (*models.Organization, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	org, ok := m.orgs[orgID]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return &org, nil
+}
+
+func (m *Memory) ListOrganizations(ctx context.Context, userID int) ([]models.Organization, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	orgs := append([]models.Organization{}, m.userOrganizations(userID)...)
+	sort.SliceStable(orgs, func(i, j int) bool {
+		if orgs[i].Personal != orgs[j].Personal {
+			return orgs[i].Personal
+		}
+		return orgs[i].Name < orgs[j].Name
+	})
+	return orgs, nil
+}
+
+func (m *Memory) MemberRole(ctx context.Context, orgID, userID int) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.members[orgID][userID], nil
+}
+
+func (m *Memory) ListMembers(ctx context.Context, orgID int) ([]models.Member, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	members := []models.Member{}
+	for userID, role := range m.members[orgID] {
+		members = append(members, models.Member{UserID: userID, Username: m.users[userID].Username, Role: role})
+	}
+	sort.Slice(members, func(i, j int) bool { return members[i].Username < members[j].Username })
+	return members, nil
+}
+
+func (m *Memory) AddMember(ctx context.Context, orgID, userID int, role string) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.orgs[orgID]; !ok {
+		return false, ErrNotFound
+	}
+	if _, ok := m.members[orgID][userID]; ok {
+		return false, nil
+	}
+	m.members[orgID][userID] = role
+	return true, nil
+}
+
+func (m *Memory) SetMemberRole(ctx context.Context, orgID, userID int, role string) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	current, ok := m.members[orgID][userID]
+	if !ok || (current == models.OrgRoleOwner && role != models.OrgRoleOwner && m.owners(orgID) == 1) {
+		return false, nil
+	}
+	m.members[orgID][userID] = role
+	return true, nil
+}
+
+// owners counts the owners of an organization; the caller holds the lock
+func (m *Memory) owners(orgID int) int {
+	n := 0
+	for _, r := range m.members[orgID] {
+		if r == models.OrgRoleOwner {
+			n++
+		}
+	}
+	return n
+}
+
+func (m *Memory) RemoveMember(ctx context.Context, orgID, userID int) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	role, ok := m.members[orgID][userID]
+	if !ok {
+		return false, nil
+	}
+	if role == models.OrgRoleOwner && m.owners(orgID) == 1 {
+		return false, nil
+	}
+	delete(m.members[orgID], userID)
+	return true, nil
+}
+
+func (m *Memory) SetQuota(ctx context.Context, orgID int, maxStorageBytes *int64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	org, ok := m.orgs[orgID]
+	if !ok {
+		return ErrNotFound
+	}
+	org.MaxStorageBytes = maxStorageBytes
+	m.orgs[orgID] = org
+	return nil
+}
+
+func (m *Memory) AddLoginFailure(ctx context.Context, key string, now, since time.Time) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	f := m.loginFailures[key]
+	if f.LastFailure.Before(since) {
+		f.Failures = 0
+	}
+	f.Failures++
+	f.LastFailure = now
+	m.loginFailures[key] = f
+	return f.Failures, nil
+}
+
+func (m *Memory) LoginFailures(ctx context.Context, key string) (models.LoginFailures, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.loginFailures[key], nil
+}
+
+func (m *Memory) ClearLoginFailures(ctx context.Context, key string) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	_, ok := m.loginFailures[key]
+	delete(m.loginFailures, key)
+	return ok, nil
+}
+
+func (m *Memory) PruneLoginFailures(ctx context.Context, before time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for key, f := range m.loginFailures {
+		if f.LastFailure.Before(before) {
+			delete(m.loginFailures, key)
+		}
+	}
+	return nil
+}
+
+func (m *Memory) RecordEvent(ctx context.Context, e *models.AuditEvent) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	e.ID = len(m.events) + 1
+	e.CreatedAt = time.Now()
+	m.events = append(m.events, *e)
+	return nil
+}
+
+func (m *Memory) ListUserEvents(ctx context.Context, userID int) ([]models.AuditEvent, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	events := []models.AuditEvent{}
+	for _, e := range m.events {
+		if e.UserID != nil && *e.UserID == userID {
+			events = append(events, e)
+		}
+	}
+	return events, nil
+}
+
+func (m *Memory) GetTOTP(ctx context.Context, userID int) (*models.TOTP, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	t, ok := m.totp[userID]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	for _, unused := range m.recoveryCodes[userID] {
+		if unused {
+			t.RecoveryCodesLeft++
+		}
+	}
+	return &t, nil
+}
+
+func (m *Memory) StartTOTP(ctx context.Context, userID int, secret string) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.totp[userID].Enabled {
+		return false, nil
+	}
+	m.totp[userID] = models.TOTP{UserID: userID, Secret: secret}
+	return true, nil
+}
+
+func (m *Memory) replaceRecoveryCodes(userID int, codeHashes []string) {
+	m.recoveryCodes[userID] = map[string]bool{}
+	for _, hash := range codeHashes {
+		m.recoveryCodes[userID][hash] = true
+	}
+}
+
+func (m *Memory) EnableTOTP(ctx context.Context, userID int, step int64, codeHashes []string) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	t, ok := m.totp[userID]
+	if !ok || t.Enabled {
+		return false, nil
+	}
+	t.Enabled, t.LastUsedStep = true, step
+	m.totp[userID] = t
+	m.replaceRecoveryCodes(userID, codeHashes)
+	return true, nil
+}
+
+func (m *Memory) UseTOTPStep(ctx context.Context, userID int, step int64) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	t, ok := m.totp[userID]
+	if !ok || t.LastUsedStep >= step {
+		return false, nil
+	}
+	t.LastUsedStep = step
+	m.totp[userID] = t
+	return true, nil
+}
+
+func (m *Memory) UseRecoveryCode(ctx context.Context, userID int, codeHash string) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if !m.recoveryCodes[userID][codeHash] {
+		return false, nil
+	}
+	m.recoveryCodes[userID][codeHash] = false
+	return true, nil
+}
+
+func (m *Memory) ReplaceRecoveryCodes(ctx context.Context, userID int, codeHashes []string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.replaceRecoveryCodes(userID, codeHashes)
+	return nil
+}
+
+func (m *Memory) DisableTOTP(ctx context.Context, userID int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.totp, userID)
+	delete(m.recoveryCodes, userID)
+	return nil
+}
+
+func (m *Memory) CreateToken(ctx context.Context, t *models.UserToken) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.tokens[t.TokenHash] = *t
+	return nil
+}
+
+func (m *Memory) UseToken(ctx context.Context, tokenHash, purpose string) (*models.UserToken, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	t, ok := m.tokens[tokenHash]
+	if !ok || t.Purpose != purpose || !t.ExpiresAt.After(time.Now()) {
+		return nil, ErrNotFound
+	}
+	delete(m.tokens, tokenHash)
+	return &t, nil
+}
+
+func (m *Memory) DeleteTokens(ctx context.Context, userID int, purpose string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for hash, t := range m.tokens {
+		if t.UserID == userID && t.Purpose == purpose {
+			delete(m.tokens, hash)
+		}
+	}
+	return nil
+}
+
+func (m *Memory) CreateIdentity(ctx context.Context, i *models.Identity) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, existing := range m.identities {
+		if existing.Provider == i.Provider && existing.Subject == i.Subject {
+			return fmt.Errorf("identity %s/%s is linked", i.Provider, i.Subject)
+		}
+	}
+	i.ID = m.id()
+	i.CreatedAt = time.Now()
+	m.identities[i.ID] = *i
+	return nil
+}
+
+func (m *Memory) GetIdentity(ctx context.Context, provider, subject string) (*models.Identity, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, i := range m.identities {
+		if i.Provider == provider && i.Subject == subject {
+			return &i, nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+func (m *Memory) ListIdentities(ctx context.Context, userID int) ([]models.Identity, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	identities := []models.Identity{}
+	for _, i := range m.identities {
+		if i.UserID == userID {
+			identities = append(identities, i)
+		}
+	}
+	sort.Slice(identities, func(a, b int) bool { return identities[a].ID < identities[b].ID })
+	return identities, nil
+}
+
+func (m *Memory) TouchIdentity(ctx context.Context, id int, email string, at time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	i, ok := m.identities[id]
+	if !ok {
+		return ErrNotFound
+	}
+	i.Email, i.LastLoginAt = email, &at
+	m.identities[id] = i
+	return nil
+}
+
+func (m *Memory) DeleteIdentity(ctx context.Context, userID, id int) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if i, ok := m.identities[id]; !ok || i.UserID != userID {
+		return false, nil
+	}
+	delete(m.identities, id)
+	return true, nil
+}
+
+func (m *Memory) CreateAPIKey(ctx context.Context, k *models.APIKey) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	k.ID = m.id()
+	k.CreatedAt = time.Now()
+	m.apiKeys[k.ID] = *k
+	return nil
+}
+
+func (m *Memory) GetAPIKeyByHash(ctx context.Context, keyHash string) (*models.APIKey, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, k := range m.apiKeys {
+		if k.KeyHash == keyHash {
+			return &k, nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+func (m *Memory) GetAPIKey(ctx context.Context, id int) (*models.APIKey, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	k, ok := m.apiKeys[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return &k, nil
+}
+
+func (m *Memory) ListAPIKeys(ctx context.Context, userID int) ([]models.APIKey, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	keys := []models.APIKey{}
+	for _, k := range m.apiKeys {
+		if k.UserID == userID {
+			keys = append(keys, k)
+		}
+	}
+	sort.Slice(keys, func(a, b int) bool { return keys[a].ID < keys[b].ID })
+	return keys, nil
+}
+
+func (m *Memory) CountActiveAPIKeys(ctx context.Context, userID int, now time.Time) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	n := 0
+	for _, k := range m.apiKeys {
+		if k.UserID == userID && k.Active(now) {
+			n++
+		}
+	}
+	return n, nil
+}
+
+func (m *Memory) TouchAPIKey(ctx context.Context, id int, ip string, at, since time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	k, ok := m.apiKeys[id]
+	if !ok {
+		return ErrNotFound
+	}
+	if k.LastUsedAt == nil || k.LastUsedAt.Before(since) || k.LastUsedIP != ip {
+		k.LastUsedAt, k.LastUsedIP = &at, ip
+		m.apiKeys[id] = k
+	}
+	return nil
+}
+
+func (m *Memory) RevokeAPIKey(ctx context.Context, userID, id int, at time.Time) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	k, ok := m.apiKeys[id]
+	if !ok || k.UserID != userID || k.RevokedAt != nil {
+		return false, nil
+	}
+	k.RevokedAt = &at
+	m.apiKeys[id] = k
+	return true, nil
+}
+
+func (m *Memory) CreateSession(ctx context.Context, s *models.Session) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	s.ID = m.id()
+	s.CreatedAt = time.Now()
+	s.LastSeenIP = s.IP
+	m.sessions[s.ID] = *s
+	return nil
+}
+
+func (m *Memory) GetSession(ctx context.Context, id int) (*models.Session, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	s, ok := m.sessions[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return &s, nil
+}
+
+func (m *Memory) ListSessions(ctx context.Context, userID int, now time.Time) ([]models.Session, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	sessions := []models.Session{}
+	for _, s := range m.sessions {
+		if s.UserID == userID && s.ExpiresAt.After(now) {
+			sessions = append(sessions, s)
+		}
+	}
+	sort.Slice(sessions, func(a, b int) bool {
+		if !sessions[a].LastSeenAt.Equal(sessions[b].LastSeenAt) {
+			return sessions[a].LastSeenAt.After(sessions[b].LastSeenAt)
+		}
+		return sessions[a].ID > sessions[b].ID
+	})
+	return sessions, nil
+}
+
+func (m *Memory) TouchSession(ctx context.Context, id int, ip string, at, since time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	s, ok := m.sessions[id]
+	if !ok {
+		return ErrNotFound
+	}
+	if s.LastSeenAt.Before(since) || s.LastSeenIP != ip {
+		s.LastSeenAt, s.LastSeenIP = at, ip
+		m.sessions[id] = s
+	}
+	return nil
+}
+
+func (m *Memory) ExtendSession(ctx context.Context, id int, expiresAt time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	s, ok := m.sessions[id]
+	if !ok {
+		return ErrNotFound
+	}
+	s.ExpiresAt = expiresAt
+	m.sessions[id] = s
+	return nil
+}
+
+func (m *Memory) DeleteSession(ctx context.Context, userID, id int) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	s, ok := m.sessions[id]
+	if !ok || s.UserID != userID {
+		return false, nil
+	}
+	delete(m.sessions, id)
+	return true, nil
+}
+
+func (m *Memory) DeleteSessions(ctx context.Context, userID, exceptID int) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	n := 0
+	for id, s := range m.sessions {
+		if s.UserID == userID && id != exceptID {
+			delete(m.sessions, id)
+			n++
+		}
+	}
+	return n, nil
+}
+
+func (m *Memory) PruneSessions(ctx context.Context, before time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for id, s := range m.sessions {
+		if s.ExpiresAt.Before(before) {
+			delete(m.sessions, id)
+		}
+	}
+	return nil
+}
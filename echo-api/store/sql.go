@@ -0,0 +1,1090 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	"echo-api/models"
+)
+
+// SQL implements the stores on a Postgres or SQLite database. Queries stick to
+// the SQL both understand, so there is one implementation for either driver.
+type SQL struct {
+	db      *sql.DB
+	timeout time.Duration
+}
+
+var (
+	_ UserStore         = (*SQL)(nil)
+	_ OrgStore          = (*SQL)(nil)
+	_ LoginFailureStore = (*SQL)(nil)
+	_ AuditStore        = (*SQL)(nil)
+	_ MFAStore          = (*SQL)(nil)
+	_ TokenStore        = (*SQL)(nil)
+	_ IdentityStore     = (*SQL)(nil)
+	_ APIKeyStore       = (*SQL)(nil)
+	_ SessionStore      = (*SQL)(nil)
+)
+
+// NewSQL returns a store on the database that bounds every query by timeout
+func NewSQL(db *sql.DB, timeout time.Duration) *SQL {
+	return &SQL{db: db, timeout: timeout}
+}
+
+func (p *SQL) withTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	return context.WithTimeout(ctx, p.timeout)
+}
+
+// inTx runs fn in a transaction, committing if it succeeds
+func (p *SQL) inTx(ctx context.Context, fn func(tx *sql.Tx) error) error {
+	ctx, cancel := p.withTimeout(ctx)
+	defer cancel()
+
+	tx, err := p.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := fn(tx); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// createOrganization inserts an organization and its owner
+func createOrganization(ctx context.Context, tx *sql.Tx, ownerID int, name string, personal bool) (int, error) {
+	var orgID int
+	err := tx.QueryRowContext(ctx,
+		"INSERT INTO organizations (name, personal) VALUES ($1, $2) RETURNING id", name, personal).Scan(&orgID)
+	if err != nil {
+		return 0, err
+	}
+
+	_, err = tx.ExecContext(ctx,
+		"INSERT INTO organization_members (org_id, user_id, role) VALUES ($1, $2, $3)", orgID, ownerID, models.OrgRoleOwner)
+	return orgID, err
+}
+
+func (p *SQL) CreateUser(ctx context.Context, u *models.User) error {
+	return p.inTx(ctx, func(tx *sql.Tx) error {
+		err := tx.QueryRowContext(ctx,
+			"INSERT INTO users (username, password_hash, email, display_name) VALUES ($1, $2, $3, $4) RETURNING id, role, created_at",
+			u.Username, u.PasswordHash, nullable(u.Email), nullable(u.DisplayName)).Scan(&u.ID, &u.Role, &u.CreatedAt)
+		if err != nil {
+			return err
+		}
+
+		// Every user starts with a personal organization that owns their files
+		_, err = createOrganization(ctx, tx, u.ID, u.Username, true)
+		return err
+	})
+}
+
+// userColumns are the columns scanUser reads
+const userColumns = `id, username, COALESCE(display_name, ''), password_hash, COALESCE(email, ''),
+	email_verified_at IS NOT NULL, role, disabled_at IS NOT NULL, deleted_at IS NOT NULL, created_at`
+
+func scanUser(row interface{ Scan(...interface{}) error }) (*models.User, error) {
+	var u models.User
+	err := row.Scan(&u.ID, &u.Username, &u.DisplayName, &u.PasswordHash, &u.Email, &u.EmailVerified,
+		&u.Role, &u.Disabled, &u.Deleting, &u.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &u, nil
+}
+
+func (p *SQL) getUser(ctx context.Context, where string, arg interface{}) (*models.User, error) {
+	ctx, cancel := p.withTimeout(ctx)
+	defer cancel()
+
+	u, err := scanUser(p.db.QueryRowContext(ctx, "SELECT "+userColumns+" FROM users WHERE "+where, arg))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	return u, err
+}
+
+func (p *SQL) GetUser(ctx context.Context, id int) (*models.User, error) {
+	return p.getUser(ctx, "id=$1", id)
+}
+
+func (p *SQL) GetUserByUsername(ctx context.Context, username string) (*models.User, error) {
+	return p.getUser(ctx, "username=$1", username)
+}
+
+func (p *SQL) GetUserByEmail(ctx context.Context, email string) (*models.User, error) {
+	return p.getUser(ctx, "email=$1", email)
+}
+
+// nullable stores an empty string as NULL
+func nullable(s string) interface{} {
+	if s == "" {
+		return nil
+	}
+	return s
+}
+
+func (p *SQL) SetPassword(ctx context.Context, userID int, passwordHash string) error {
+	ctx, cancel := p.withTimeout(ctx)
+	defer cancel()
+
+	res, err := p.db.ExecContext(ctx, "UPDATE users SET password_hash=$1 WHERE id=$2", passwordHash, userID)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (p *SQL) VerifyEmail(ctx context.Context, userID int, email string) (bool, error) {
+	ctx, cancel := p.withTimeout(ctx)
+	defer cancel()
+
+	res, err := p.db.ExecContext(ctx, `
+		UPDATE users SET email_verified_at = CURRENT_TIMESTAMP
+		WHERE id = $1 AND email = $2 AND email_verified_at IS NULL
+	`, userID, email)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+func (p *SQL) UpdateProfile(ctx context.Context, u *models.User) error {
+	ctx, cancel := p.withTimeout(ctx)
+	defer cancel()
+
+	_, err := p.db.ExecContext(ctx, "UPDATE users SET username=$1, display_name=$2 WHERE id=$3",
+		u.Username, nullable(u.DisplayName), u.ID)
+	return err
+}
+
+func (p *SQL) SetEmail(ctx context.Context, userID int, email string) error {
+	ctx, cancel := p.withTimeout(ctx)
+	defer cancel()
+
+	_, err := p.db.ExecContext(ctx, "UPDATE users SET email=$1, email_verified_at=NULL WHERE id=$2", nullable(email), userID)
+	return err
+}
+
+func (p *SQL) DeleteUser(ctx context.Context, userID int, orgIDs []int) error {
+	return p.inTx(ctx, func(tx *sql.Tx) error {
+		for _, orgID := range orgIDs {
+			if _, err := tx.ExecContext(ctx, "DELETE FROM organizations WHERE id=$1", orgID); err != nil {
+				return err
+			}
+		}
+		res, err := tx.ExecContext(ctx, "DELETE FROM users WHERE id=$1", userID)
+		if err != nil {
+			return err
+		}
+		n, err := res.RowsAffected()
+		if err == nil && n == 0 {
+			err = ErrNotFound
+		}
+		return err
+	})
+}
+
+// likePattern escapes the wildcards of LIKE in s and matches it anywhere
+func likePattern(s string) string {
+	return "%" + strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(s) + "%"
+}
+
+func (p *SQL) ListUsers(ctx context.Context, f models.UserFilter) ([]models.User, error) {
+	ctx, cancel := p.withTimeout(ctx)
+	defer cancel()
+
+	var where []string
+	var args []interface{}
+	arg := func(v interface{}) string {
+		args = append(args, v)
+		return "$" + strconv.Itoa(len(args))
+	}
+	if f.Query != "" {
+		q := arg(likePattern(strings.ToLower(f.Query)))
+		where = append(where, "(LOWER(username) LIKE "+q+` ESCAPE '\' OR LOWER(COALESCE(display_name, '')) LIKE `+q+
+			` ESCAPE '\' OR COALESCE(email, '') LIKE `+q+` ESCAPE '\')`)
+	}
+	if f.Role != "" {
+		where = append(where, "role="+arg(f.Role))
+	}
+	if f.Disabled != nil && *f.Disabled {
+		where = append(where, "disabled_at IS NOT NULL")
+	} else if f.Disabled != nil {
+		where = append(where, "disabled_at IS NULL")
+	}
+	query := "SELECT " + userColumns + " FROM users"
+	if len(where) > 0 {
+		query += " WHERE " + strings.Join(where, " AND ")
+	}
+	query += " ORDER BY id LIMIT " + arg(f.Limit) + " OFFSET " + arg(f.Offset)
+
+	rows, err := p.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	users := []models.User{}
+	for rows.Next() {
+		u, err := scanUser(rows)
+		if err != nil {
+			return nil, err
+		}
+		users = append(users, *u)
+	}
+	return users, rows.Err()
+}
+
+func (p *SQL) SetDisabled(ctx context.Context, userID int, disabled bool, now time.Time) (bool, error) {
+	ctx, cancel := p.withTimeout(ctx)
+	defer cancel()
+
+	var res sql.Result
+	var err error
+	if disabled {
+		res, err = p.db.ExecContext(ctx, "UPDATE users SET disabled_at=$1 WHERE id=$2 AND disabled_at IS NULL",
+			now.UTC(), userID)
+	} else {
+		res, err = p.db.ExecContext(ctx, "UPDATE users SET disabled_at=NULL WHERE id=$1 AND disabled_at IS NOT NULL", userID)
+	}
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+func (p *SQL) MarkDeleting(ctx context.Context, userID int, now time.Time) error {
+	ctx, cancel := p.withTimeout(ctx)
+	defer cancel()
+
+	_, err := p.db.ExecContext(ctx, "UPDATE users SET deleted_at=COALESCE(deleted_at, $1) WHERE id=$2", now.UTC(), userID)
+	return err
+}
+
+func (p *SQL) SetRole(ctx context.Context, userID int, role string) error {
+	ctx, cancel := p.withTimeout(ctx)
+	defer cancel()
+
+	res, err := p.db.ExecContext(ctx, "UPDATE users SET role=$1 WHERE id=$2", role, userID)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// storageUsageQuery sums the files table by uploader
+const storageUsageQuery = `
+	SELECT u.id, u.username, COUNT(f.id), COALESCE(SUM(f.size), 0)
+	FROM users u
+	LEFT JOIN files f ON f.user_id = u.id`
+
+func (p *SQL) StorageUsage(ctx context.Context, userID int) (*models.StorageUsage, error) {
+	ctx, cancel := p.withTimeout(ctx)
+	defer cancel()
+
+	var s models.StorageUsage
+	err := p.db.QueryRowContext(ctx, storageUsageQuery+" WHERE u.id=$1 GROUP BY u.id, u.username", userID).
+		Scan(&s.UserID, &s.Username, &s.Files, &s.Bytes)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
+
+func (p *SQL) ListStorageUsage(ctx context.Context, limit int) ([]models.StorageUsage, error) {
+	ctx, cancel := p.withTimeout(ctx)
+	defer cancel()
+
+	rows, err := p.db.QueryContext(ctx,
+		storageUsageQuery+" GROUP BY u.id, u.username ORDER BY COALESCE(SUM(f.size), 0) DESC, u.id LIMIT $1", limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	usage := []models.StorageUsage{}
+	for rows.Next() {
+		var s models.StorageUsage
+		if err := rows.Scan(&s.UserID, &s.Username, &s.Files, &s.Bytes); err != nil {
+			return nil, err
+		}
+		usage = append(usage, s)
+	}
+	return usage, rows.Err()
+}
+
+func (p *SQL) CreateOrganization(ctx context.Context, ownerID int, org *models.Organization) error {
+	return p.inTx(ctx, func(tx *sql.Tx) error {
+		var err error
+		org.ID, err = createOrganization(ctx, tx, ownerID, org.Name, org.Personal)
+		return err
+	})
+}
+
+func (p *SQL) DefaultOrganization(ctx context.Context, userID int, username string) (int, error) {
+	qctx, cancel := p.withTimeout(ctx)
+	defer cancel()
+
+	var orgID int
+	err := p.db.QueryRowContext(qctx, `
+		SELECT m.org_id
+		FROM organization_members m
+		JOIN organizations o ON o.id = m.org_id
+		WHERE m.user_id = $1
+		ORDER BY o.personal DESC, m.org_id
+		LIMIT 1
+	`, userID).Scan(&orgID)
+	if !errors.Is(err, sql.ErrNoRows) {
+		return orgID, err
+	}
+
+	err = p.inTx(ctx, func(tx *sql.Tx) error {
+		orgID, err = createOrganization(ctx, tx, userID, username, true)
+		return err
+	})
+	return orgID, err
+}
+
+func (p *SQL) GetOrganization(ctx context.Context, orgID int) (*models.Organization, error) {
+	ctx, cancel := p.withTimeout(ctx)
+	defer cancel()
+
+	org := models.Organization{ID: orgID}
+	err := p.db.QueryRowContext(ctx,
+		"SELECT name, personal, max_storage_bytes FROM organizations WHERE id=$1", orgID).
+		Scan(&org.Name, &org.Personal, &org.MaxStorageBytes)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &org, nil
+}
+
+func (p *SQL) ListOrganizations(ctx context.Context, userID int) ([]models.Organization, error) {
+	ctx, cancel := p.withTimeout(ctx)
+	defer cancel()
+
+	rows, err := p.db.QueryContext(ctx, `
+		SELECT o.id, o.name, o.personal, m.role, o.max_storage_bytes
+		FROM organizations o
+		JOIN organization_members m ON m.org_id = o.id
+		WHERE m.user_id = $1
+		ORDER BY o.personal DESC, o.name
+	`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	orgs := []models.Organization{}
+	for rows.Next() {
+		var org models.Organization
+		if err := rows.Scan(&org.ID, &org.Name, &org.Personal, &org.Role, &org.MaxStorageBytes); err != nil {
+			return nil, err
+		}
+		orgs = append(orgs, org)
+	}
+	return orgs, rows.Err()
+}
+
+func (p *SQL) MemberRole(ctx context.Context, orgID, userID int) (string, error) {
+	ctx, cancel := p.withTimeout(ctx)
+	defer cancel()
+
+	var role string
+	err := p.db.QueryRowContext(ctx,
+		"SELECT role FROM organization_members WHERE org_id=$1 AND user_id=$2", orgID, userID).Scan(&role)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", nil
+	}
+	return role, err
+}
+
+func (p *SQL) ListMembers(ctx context.Context, orgID int) ([]models.Member, error) {
+	ctx, cancel := p.withTimeout(ctx)
+	defer cancel()
+
+	rows, err := p.db.QueryContext(ctx, `
+		SELECT u.id, u.username, m.role
+		FROM organization_members m
+		JOIN users u ON u.id = m.user_id
+		WHERE m.org_id = $1
+		ORDER BY u.username
+	`, orgID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	members := []models.Member{}
+	for rows.Next() {
+		var m models.Member
+		if err := rows.Scan(&m.UserID, &m.Username, &m.Role); err != nil {
+			return nil, err
+		}
+		members = append(members, m)
+	}
+	return members, rows.Err()
+}
+
+func (p *SQL) AddMember(ctx context.Context, orgID, userID int, role string) (bool, error) {
+	ctx, cancel := p.withTimeout(ctx)
+	defer cancel()
+
+	res, err := p.db.ExecContext(ctx, `
+		INSERT INTO organization_members (org_id, user_id, role) VALUES ($1, $2, $3)
+		ON CONFLICT (org_id, user_id) DO NOTHING
+	`, orgID, userID, role)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+func (p *SQL) SetMemberRole(ctx context.Context, orgID, userID int, role string) (bool, error) {
+	ctx, cancel := p.withTimeout(ctx)
+	defer cancel()
+
+	// Like RemoveMember, an owner is only demoted if another owner remains
+	res, err := p.db.ExecContext(ctx, `
+		UPDATE organization_members SET role = $3
+		WHERE org_id = $1 AND user_id = $2
+			AND (role <> 'owner' OR $4 OR EXISTS (
+				SELECT 1 FROM organization_members o
+				WHERE o.org_id = $1 AND o.role = 'owner' AND o.user_id <> $2
+			))
+	`, orgID, userID, role, role == models.OrgRoleOwner)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+func (p *SQL) RemoveMember(ctx context.Context, orgID, userID int) (bool, error) {
+	ctx, cancel := p.withTimeout(ctx)
+	defer cancel()
+
+	// Only delete the row if at least one other owner remains afterwards
+	res, err := p.db.ExecContext(ctx, `
+		DELETE FROM organization_members
+		WHERE org_id = $1 AND user_id = $2
+			AND (role <> 'owner' OR EXISTS (
+				SELECT 1 FROM organization_members o
+				WHERE o.org_id = $1 AND o.role = 'owner' AND o.user_id <> $2
+			))
+	`, orgID, userID)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+func (p *SQL) SetQuota(ctx context.Context, orgID int, maxStorageBytes *int64) error {
+	ctx, cancel := p.withTimeout(ctx)
+	defer cancel()
+
+	res, err := p.db.ExecContext(ctx,
+		"UPDATE organizations SET max_storage_bytes=$1 WHERE id=$2", maxStorageBytes, orgID)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (p *SQL) AddLoginFailure(ctx context.Context, key string, now, since time.Time) (int, error) {
+	ctx, cancel := p.withTimeout(ctx)
+	defer cancel()
+
+	var failures int
+	err := p.db.QueryRowContext(ctx, `
+		INSERT INTO login_failures (key, failures, last_failure_at) VALUES ($1, 1, $2)
+		ON CONFLICT (key) DO UPDATE SET
+			failures = CASE WHEN login_failures.last_failure_at < $3 THEN 1 ELSE login_failures.failures + 1 END,
+			last_failure_at = EXCLUDED.last_failure_at
+		RETURNING failures
+	`, key, now.UnixMicro(), since.UnixMicro()).Scan(&failures)
+	return failures, err
+}
+
+func (p *SQL) LoginFailures(ctx context.Context, key string) (models.LoginFailures, error) {
+	ctx, cancel := p.withTimeout(ctx)
+	defer cancel()
+
+	var f models.LoginFailures
+	var last int64
+	err := p.db.QueryRowContext(ctx,
+		"SELECT failures, last_failure_at FROM login_failures WHERE key=$1", key).Scan(&f.Failures, &last)
+	if errors.Is(err, sql.ErrNoRows) {
+		return models.LoginFailures{}, nil
+	}
+	if err != nil {
+		return models.LoginFailures{}, err
+	}
+	f.LastFailure = time.UnixMicro(last)
+	return f, nil
+}
+
+func (p *SQL) ClearLoginFailures(ctx context.Context, key string) (bool, error) {
+	ctx, cancel := p.withTimeout(ctx)
+	defer cancel()
+
+	res, err := p.db.ExecContext(ctx, "DELETE FROM login_failures WHERE key=$1", key)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+func (p *SQL) PruneLoginFailures(ctx context.Context, before time.Time) error {
+	ctx, cancel := p.withTimeout(ctx)
+	defer cancel()
+
+	_, err := p.db.ExecContext(ctx, "DELETE FROM login_failures WHERE last_failure_at < $1", before.UnixMicro())
+	return err
+}
+
+func (p *SQL) RecordEvent(ctx context.Context, e *models.AuditEvent) error {
+	ctx, cancel := p.withTimeout(ctx)
+	defer cancel()
+
+	details := []byte("{}")
+	if len(e.Details) > 0 {
+		var err error
+		if details, err = json.Marshal(e.Details); err != nil {
+			return err
+		}
+	}
+	return p.db.QueryRowContext(ctx, `
+		INSERT INTO audit_events (event, user_id, actor_id, ip, details) VALUES ($1, $2, $3, $4, $5)
+		RETURNING id, created_at
+	`, e.Event, e.UserID, e.ActorID, e.IP, string(details)).Scan(&e.ID, &e.CreatedAt)
+}
+
+func (p *SQL) ListUserEvents(ctx context.Context, userID int) ([]models.AuditEvent, error) {
+	ctx, cancel := p.withTimeout(ctx)
+	defer cancel()
+
+	rows, err := p.db.QueryContext(ctx, `
+		SELECT id, event, user_id, actor_id, ip, details, created_at
+		FROM audit_events WHERE user_id=$1 ORDER BY id
+	`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	events := []models.AuditEvent{}
+	for rows.Next() {
+		var e models.AuditEvent
+		var details string
+		if err := rows.Scan(&e.ID, &e.Event, &e.UserID, &e.ActorID, &e.IP, &details, &e.CreatedAt); err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal([]byte(details), &e.Details); err != nil {
+			return nil, err
+		}
+		events = append(events, e)
+	}
+	return events, rows.Err()
+}
+
+func (p *SQL) GetTOTP(ctx context.Context, userID int) (*models.TOTP, error) {
+	ctx, cancel := p.withTimeout(ctx)
+	defer cancel()
+
+	t := models.TOTP{UserID: userID}
+	err := p.db.QueryRowContext(ctx, `
+		SELECT secret, enabled_at IS NOT NULL, last_used_step,
+			(SELECT COUNT(*) FROM mfa_recovery_codes WHERE user_id = $1 AND used_at IS NULL)
+		FROM user_totp WHERE user_id = $1
+	`, userID).Scan(&t.Secret, &t.Enabled, &t.LastUsedStep, &t.RecoveryCodesLeft)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
+
+func (p *SQL) StartTOTP(ctx context.Context, userID int, secret string) (bool, error) {
+	ctx, cancel := p.withTimeout(ctx)
+	defer cancel()
+
+	res, err := p.db.ExecContext(ctx, `
+		INSERT INTO user_totp (user_id, secret) VALUES ($1, $2)
+		ON CONFLICT (user_id) DO UPDATE SET secret = EXCLUDED.secret, last_used_step = 0
+		WHERE user_totp.enabled_at IS NULL
+	`, userID, secret)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+// replaceRecoveryCodes deletes the user's recovery codes and inserts new ones
+func replaceRecoveryCodes(ctx context.Context, tx *sql.Tx, userID int, codeHashes []string) error {
+	if _, err := tx.ExecContext(ctx, "DELETE FROM mfa_recovery_codes WHERE user_id=$1", userID); err != nil {
+		return err
+	}
+	for _, hash := range codeHashes {
+		_, err := tx.ExecContext(ctx,
+			"INSERT INTO mfa_recovery_codes (user_id, code_hash) VALUES ($1, $2)", userID, hash)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (p *SQL) EnableTOTP(ctx context.Context, userID int, step int64, codeHashes []string) (bool, error) {
+	var enabled bool
+	err := p.inTx(ctx, func(tx *sql.Tx) error {
+		res, err := tx.ExecContext(ctx, `
+			UPDATE user_totp SET enabled_at = CURRENT_TIMESTAMP, last_used_step = $2
+			WHERE user_id = $1 AND enabled_at IS NULL
+		`, userID, step)
+		if err != nil {
+			return err
+		}
+		if n, err := res.RowsAffected(); err != nil || n == 0 {
+			return err
+		}
+		enabled = true
+		return replaceRecoveryCodes(ctx, tx, userID, codeHashes)
+	})
+	return enabled, err
+}
+
+func (p *SQL) UseTOTPStep(ctx context.Context, userID int, step int64) (bool, error) {
+	ctx, cancel := p.withTimeout(ctx)
+	defer cancel()
+
+	res, err := p.db.ExecContext(ctx,
+		"UPDATE user_totp SET last_used_step=$2 WHERE user_id=$1 AND last_used_step < $2", userID, step)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+func (p *SQL) UseRecoveryCode(ctx context.Context, userID int, codeHash string) (bool, error) {
+	ctx, cancel := p.withTimeout(ctx)
+	defer cancel()
+
+	res, err := p.db.ExecContext(ctx, `
+		UPDATE mfa_recovery_codes SET used_at = CURRENT_TIMESTAMP
+		WHERE user_id = $1 AND code_hash = $2 AND used_at IS NULL
+	`, userID, codeHash)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+func (p *SQL) ReplaceRecoveryCodes(ctx context.Context, userID int, codeHashes []string) error {
+	return p.inTx(ctx, func(tx *sql.Tx) error {
+		return replaceRecoveryCodes(ctx, tx, userID, codeHashes)
+	})
+}
+
+func (p *SQL) DisableTOTP(ctx context.Context, userID int) error {
+	return p.inTx(ctx, func(tx *sql.Tx) error {
+		if _, err := tx.ExecContext(ctx, "DELETE FROM mfa_recovery_codes WHERE user_id=$1", userID); err != nil {
+			return err
+		}
+		_, err := tx.ExecContext(ctx, "DELETE FROM user_totp WHERE user_id=$1", userID)
+		return err
+	})
+}
+
+func (p *SQL) CreateToken(ctx context.Context, t *models.UserToken) error {
+	ctx, cancel := p.withTimeout(ctx)
+	defer cancel()
+
+	// SQLite compares timestamps as text, which only orders correctly in one time zone
+	_, err := p.db.ExecContext(ctx, `
+		INSERT INTO user_tokens (token_hash, user_id, purpose, email, expires_at) VALUES ($1, $2, $3, $4, $5)
+	`, t.TokenHash, t.UserID, t.Purpose, t.Email, t.ExpiresAt.UTC())
+	return err
+}
+
+func (p *SQL) UseToken(ctx context.Context, tokenHash, purpose string) (*models.UserToken, error) {
+	ctx, cancel := p.withTimeout(ctx)
+	defer cancel()
+
+	t := models.UserToken{TokenHash: tokenHash, Purpose: purpose}
+	now := time.Now().UTC()
+	err := p.db.QueryRowContext(ctx, `
+		UPDATE user_tokens SET used_at = $3
+		WHERE token_hash = $1 AND purpose = $2 AND used_at IS NULL AND expires_at > $3
+		RETURNING user_id, email, expires_at
+	`, tokenHash, purpose, now).Scan(&t.UserID, &t.Email, &t.ExpiresAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
+
+func (p *SQL) DeleteTokens(ctx context.Context, userID int, purpose string) error {
+	ctx, cancel := p.withTimeout(ctx)
+	defer cancel()
+
+	_, err := p.db.ExecContext(ctx, "DELETE FROM user_tokens WHERE user_id=$1 AND purpose=$2", userID, purpose)
+	return err
+}
+
+func (p *SQL) CreateIdentity(ctx context.Context, i *models.Identity) error {
+	ctx, cancel := p.withTimeout(ctx)
+	defer cancel()
+
+	return p.db.QueryRowContext(ctx, `
+		INSERT INTO user_identities (user_id, provider, subject, email) VALUES ($1, $2, $3, $4)
+		RETURNING id, created_at
+	`, i.UserID, i.Provider, i.Subject, nullable(i.Email)).Scan(&i.ID, &i.CreatedAt)
+}
+
+// identityColumns are the columns scanned by scanIdentity
+const identityColumns = "id, user_id, provider, subject, COALESCE(email, ''), created_at, last_login_at"
+
+func scanIdentity(row interface{ Scan(...interface{}) error }) (*models.Identity, error) {
+	var i models.Identity
+	var lastLogin sql.NullTime
+	if err := row.Scan(&i.ID, &i.UserID, &i.Provider, &i.Subject, &i.Email, &i.CreatedAt, &lastLogin); err != nil {
+		return nil, err
+	}
+	if lastLogin.Valid {
+		i.LastLoginAt = &lastLogin.Time
+	}
+	return &i, nil
+}
+
+func (p *SQL) GetIdentity(ctx context.Context, provider, subject string) (*models.Identity, error) {
+	ctx, cancel := p.withTimeout(ctx)
+	defer cancel()
+
+	i, err := scanIdentity(p.db.QueryRowContext(ctx,
+		"SELECT "+identityColumns+" FROM user_identities WHERE provider=$1 AND subject=$2", provider, subject))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	return i, err
+}
+
+func (p *SQL) ListIdentities(ctx context.Context, userID int) ([]models.Identity, error) {
+	ctx, cancel := p.withTimeout(ctx)
+	defer cancel()
+
+	rows, err := p.db.QueryContext(ctx,
+		"SELECT "+identityColumns+" FROM user_identities WHERE user_id=$1 ORDER BY id", userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	identities := []models.Identity{}
+	for rows.Next() {
+		i, err := scanIdentity(rows)
+		if err != nil {
+			return nil, err
+		}
+		identities = append(identities, *i)
+	}
+	return identities, rows.Err()
+}
+
+func (p *SQL) TouchIdentity(ctx context.Context, id int, email string, at time.Time) error {
+	ctx, cancel := p.withTimeout(ctx)
+	defer cancel()
+
+	_, err := p.db.ExecContext(ctx,
+		"UPDATE user_identities SET email=$1, last_login_at=$2 WHERE id=$3", nullable(email), at.UTC(), id)
+	return err
+}
+
+func (p *SQL) DeleteIdentity(ctx context.Context, userID, id int) (bool, error) {
+	ctx, cancel := p.withTimeout(ctx)
+	defer cancel()
+
+	res, err := p.db.ExecContext(ctx, "DELETE FROM user_identities WHERE id=$1 AND user_id=$2", id, userID)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+func (p *SQL) CreateAPIKey(ctx context.Context, k *models.APIKey) error {
+	ctx, cancel := p.withTimeout(ctx)
+	defer cancel()
+
+	var expiresAt interface{}
+	if k.ExpiresAt != nil {
+		expiresAt = k.ExpiresAt.UTC()
+	}
+	return p.db.QueryRowContext(ctx, `
+		INSERT INTO api_keys (user_id, org_id, name, prefix, key_hash, scopes, mfa, expires_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		RETURNING id, created_at
+	`, k.UserID, k.OrgID, k.Name, k.Prefix, k.KeyHash, strings.Join(k.Scopes, ","), k.MFA, expiresAt).
+		Scan(&k.ID, &k.CreatedAt)
+}
+
+// apiKeyColumns are the columns scanned by scanAPIKey
+const apiKeyColumns = `id, user_id, org_id, name, prefix, key_hash, scopes, mfa,
+	expires_at, last_used_at, COALESCE(last_used_ip, ''), revoked_at, created_at`
+
+func scanAPIKey(row interface{ Scan(...interface{}) error }) (*models.APIKey, error) {
+	var k models.APIKey
+	var scopes string
+	var expiresAt, lastUsedAt, revokedAt sql.NullTime
+	err := row.Scan(&k.ID, &k.UserID, &k.OrgID, &k.Name, &k.Prefix, &k.KeyHash, &scopes, &k.MFA,
+		&expiresAt, &lastUsedAt, &k.LastUsedIP, &revokedAt, &k.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	k.Scopes = strings.Split(scopes, ",")
+	for _, t := range []struct {
+		src sql.NullTime
+		dst **time.Time
+	}{{expiresAt, &k.ExpiresAt}, {lastUsedAt, &k.LastUsedAt}, {revokedAt, &k.RevokedAt}} {
+		if t.src.Valid {
+			at := t.src.Time
+			*t.dst = &at
+		}
+	}
+	return &k, nil
+}
+
+func (p *SQL) GetAPIKeyByHash(ctx context.Context, keyHash string) (*models.APIKey, error) {
+	ctx, cancel := p.withTimeout(ctx)
+	defer cancel()
+
+	k, err := scanAPIKey(p.db.QueryRowContext(ctx, "SELECT "+apiKeyColumns+" FROM api_keys WHERE key_hash=$1", keyHash))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	return k, err
+}
+
+func (p *SQL) GetAPIKey(ctx context.Context, id int) (*models.APIKey, error) {
+	ctx, cancel := p.withTimeout(ctx)
+	defer cancel()
+
+	k, err := scanAPIKey(p.db.QueryRowContext(ctx, "SELECT "+apiKeyColumns+" FROM api_keys WHERE id=$1", id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	return k, err
+}
+
+func (p *SQL) ListAPIKeys(ctx context.Context, userID int) ([]models.APIKey, error) {
+	ctx, cancel := p.withTimeout(ctx)
+	defer cancel()
+
+	rows, err := p.db.QueryContext(ctx, "SELECT "+apiKeyColumns+" FROM api_keys WHERE user_id=$1 ORDER BY id", userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	keys := []models.APIKey{}
+	for rows.Next() {
+		k, err := scanAPIKey(rows)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, *k)
+	}
+	return keys, rows.Err()
+}
+
+func (p *SQL) CountActiveAPIKeys(ctx context.Context, userID int, now time.Time) (int, error) {
+	ctx, cancel := p.withTimeout(ctx)
+	defer cancel()
+
+	var n int
+	err := p.db.QueryRowContext(ctx, `
+		SELECT COUNT(*) FROM api_keys
+		WHERE user_id=$1 AND revoked_at IS NULL AND (expires_at IS NULL OR expires_at > $2)
+	`, userID, now.UTC()).Scan(&n)
+	return n, err
+}
+
+func (p *SQL) TouchAPIKey(ctx context.Context, id int, ip string, at, since time.Time) error {
+	ctx, cancel := p.withTimeout(ctx)
+	defer cancel()
+
+	_, err := p.db.ExecContext(ctx, `
+		UPDATE api_keys SET last_used_at=$1, last_used_ip=$2
+		WHERE id=$3 AND (last_used_at IS NULL OR last_used_at < $4 OR last_used_ip <> $2)
+	`, at.UTC(), ip, id, since.UTC())
+	return err
+}
+
+func (p *SQL) RevokeAPIKey(ctx context.Context, userID, id int, at time.Time) (bool, error) {
+	ctx, cancel := p.withTimeout(ctx)
+	defer cancel()
+
+	res, err := p.db.ExecContext(ctx,
+		"UPDATE api_keys SET revoked_at=$1 WHERE id=$2 AND user_id=$3 AND revoked_at IS NULL", at.UTC(), id, userID)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+func (p *SQL) CreateSession(ctx context.Context, s *models.Session) error {
+	ctx, cancel := p.withTimeout(ctx)
+	defer cancel()
+
+	return p.db.QueryRowContext(ctx, `
+		INSERT INTO sessions (user_id, user_agent, ip, last_seen_ip, last_seen_at, expires_at)
+		VALUES ($1, $2, $3, $3, $4, $5)
+		RETURNING id, created_at
+	`, s.UserID, s.UserAgent, s.IP, s.LastSeenAt.UTC(), s.ExpiresAt.UTC()).Scan(&s.ID, &s.CreatedAt)
+}
+
+// sessionColumns are the columns scanned by scanSession
+const sessionColumns = "id, user_id, user_agent, ip, last_seen_ip, created_at, last_seen_at, expires_at"
+
+func scanSession(row interface{ Scan(...interface{}) error }) (*models.Session, error) {
+	var s models.Session
+	err := row.Scan(&s.ID, &s.UserID, &s.UserAgent, &s.IP, &s.LastSeenIP, &s.CreatedAt, &s.LastSeenAt, &s.ExpiresAt)
+	if err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
+
+func (p *SQL) GetSession(ctx context.Context, id int) (*models.Session, error) {
+	ctx, cancel := p.withTimeout(ctx)
+	defer cancel()
+
+	s, err := scanSession(p.db.QueryRowContext(ctx, "SELECT "+sessionColumns+" FROM sessions WHERE id=$1", id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	return s, err
+}
+
+func (p *SQL) ListSessions(ctx context.Context, userID int, now time.Time) ([]models.Session, error) {
+	ctx, cancel := p.withTimeout(ctx)
+	defer cancel()
+
+	rows, err := p.db.QueryContext(ctx,
+		"SELECT "+sessionColumns+" FROM sessions WHERE user_id=$1 AND expires_at > $2 ORDER BY last_seen_at DESC, id DESC",
+		userID, now.UTC())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	sessions := []models.Session{}
+	for rows.Next() {
+		s, err := scanSession(rows)
+		if err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, *s)
+	}
+	return sessions, rows.Err()
+}
+
+func (p *SQL) TouchSession(ctx context.Context, id int, ip string, at, since time.Time) error {
+	ctx, cancel := p.withTimeout(ctx)
+	defer cancel()
+
+	_, err := p.db.ExecContext(ctx, `
+		UPDATE sessions SET last_seen_at=$1, last_seen_ip=$2
+		WHERE id=$3 AND (last_seen_at < $4 OR last_seen_ip <> $2)
+	`, at.UTC(), ip, id, since.UTC())
+	return err
+}
+
+func (p *SQL) ExtendSession(ctx context.Context, id int, expiresAt time.Time) error {
+	ctx, cancel := p.withTimeout(ctx)
+	defer cancel()
+
+	_, err := p.db.ExecContext(ctx, "UPDATE sessions SET expires_at=$1 WHERE id=$2", expiresAt.UTC(), id)
+	return err
+}
+
+func (p *SQL) DeleteSession(ctx context.Context, userID, id int) (bool, error) {
+	ctx, cancel := p.withTimeout(ctx)
+	defer cancel()
+
+	res, err := p.db.ExecContext(ctx, "DELETE FROM sessions WHERE id=$1 AND user_id=$2", id, userID)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+func (p *SQL) DeleteSessions(ctx context.Context, userID, exceptID int) (int, error) {
+	ctx, cancel := p.withTimeout(ctx)
+	defer cancel()
+
+	res, err := p.db.ExecContext(ctx, "DELETE FROM sessions WHERE user_id=$1 AND id <> $2", userID, exceptID)
+	if err != nil {
+		return 0, err
+	}
+	n, err := res.RowsAffected()
+	return int(n), err
+}
+
+func (p *SQL) PruneSessions(ctx context.Context, before time.Time) error {
+	ctx, cancel := p.withTimeout(ctx)
+	defer cancel()
+
+	_, err := p.db.ExecContext(ctx, "DELETE FROM sessions WHERE expires_at < $1", before.UTC())
+	return err
+}
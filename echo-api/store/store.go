@@ -0,0 +1,176 @@
+// Package store holds the repositories behind the HTTP handlers, with a
+// SQL implementation for Postgres or SQLite and an in-memory one for tests.
+package store
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"echo-api/models"
+)
+
+// ErrNotFound is returned when the requested row does not exist
+var ErrNotFound = errors.New("not found")
+
+// UserStore reads and writes user accounts
+type UserStore interface {
+	// CreateUser creates the user together with their personal organization and sets u.ID
+	CreateUser(ctx context.Context, u *models.User) error
+	GetUser(ctx context.Context, id int) (*models.User, error)
+	GetUserByUsername(ctx context.Context, username string) (*models.User, error)
+	GetUserByEmail(ctx context.Context, email string) (*models.User, error)
+	SetPassword(ctx context.Context, userID int, passwordHash string) error
+	// VerifyEmail marks the user's email verified if it is still email,
+	// reporting whether it was
+	VerifyEmail(ctx context.Context, userID int, email string) (bool, error)
+	// UpdateProfile saves u.Username and u.DisplayName
+	UpdateProfile(ctx context.Context, u *models.User) error
+	// SetEmail changes the user's email, which is not verified yet, or removes it if empty
+	SetEmail(ctx context.Context, userID int, email string) error
+	// DeleteUser deletes the user together with the organizations in orgIDs.
+	// Their files must be gone first.
+	DeleteUser(ctx context.Context, userID int, orgIDs []int) error
+	// ListUsers returns the users matching the filter, ordered by ID
+	ListUsers(ctx context.Context, f models.UserFilter) ([]models.User, error)
+	// SetDisabled disables or enables the user, reporting whether that changed anything
+	SetDisabled(ctx context.Context, userID int, disabled bool, now time.Time) (bool, error)
+	// MarkDeleting records that the user started deleting their account, so
+	// it cannot log in until DeleteUser finishes
+	MarkDeleting(ctx context.Context, userID int, now time.Time) error
+	SetRole(ctx context.Context, userID int, role string) error
+	// StorageUsage sums the files the user uploaded, or returns ErrNotFound
+	StorageUsage(ctx context.Context, userID int) (*models.StorageUsage, error)
+	// ListStorageUsage returns the storage usage of up to limit users, largest first
+	ListStorageUsage(ctx context.Context, limit int) ([]models.StorageUsage, error)
+}
+
+// OrgStore reads and writes organizations and their members
+type OrgStore interface {
+	// CreateOrganization creates an organization owned by ownerID and sets org.ID
+	CreateOrganization(ctx context.Context, ownerID int, org *models.Organization) error
+	// DefaultOrganization returns the organization a user acts in after logging in:
+	// their personal one, created if they registered before organizations existed
+	DefaultOrganization(ctx context.Context, userID int, username string) (int, error)
+	GetOrganization(ctx context.Context, orgID int) (*models.Organization, error)
+	// ListOrganizations returns the user's organizations with their role in each
+	ListOrganizations(ctx context.Context, userID int) ([]models.Organization, error)
+	// MemberRole returns the user's role in the organization, or "" if they are not a member
+	MemberRole(ctx context.Context, orgID, userID int) (string, error)
+	ListMembers(ctx context.Context, orgID int) ([]models.Member, error)
+	// AddMember adds a user to the organization, reporting false if they already belong to it
+	AddMember(ctx context.Context, orgID, userID int, role string) (bool, error)
+	// SetMemberRole changes the role of a member unless that would leave the
+	// organization without an owner, reporting whether it was changed
+	SetMemberRole(ctx context.Context, orgID, userID int, role string) (bool, error)
+	// RemoveMember removes a user unless they are its last owner, reporting whether they were removed
+	RemoveMember(ctx context.Context, orgID, userID int) (bool, error)
+	// SetQuota sets the organization's storage limit; nil removes it
+	SetQuota(ctx context.Context, orgID int, maxStorageBytes *int64) error
+}
+
+// LoginFailureStore counts failed logins by key, an account or a client IP
+type LoginFailureStore interface {
+	// AddLoginFailure counts a failure at now, starting over if the last one
+	// was before since, and returns the failures counted
+	AddLoginFailure(ctx context.Context, key string, now, since time.Time) (int, error)
+	// LoginFailures returns the failures counted for key, zero if there are none
+	LoginFailures(ctx context.Context, key string) (models.LoginFailures, error)
+	// ClearLoginFailures forgets the failures of key, reporting whether it had any
+	ClearLoginFailures(ctx context.Context, key string) (bool, error)
+	// PruneLoginFailures forgets the failures of every key whose last one was before
+	PruneLoginFailures(ctx context.Context, before time.Time) error
+}
+
+// AuditStore records security-relevant events
+type AuditStore interface {
+	// RecordEvent stores the event and sets e.ID and e.CreatedAt
+	RecordEvent(ctx context.Context, e *models.AuditEvent) error
+	// ListUserEvents returns the events concerning the user, oldest first
+	ListUserEvents(ctx context.Context, userID int) ([]models.AuditEvent, error)
+}
+
+// MFAStore keeps the TOTP enrollments and recovery codes of users
+type MFAStore interface {
+	// GetTOTP returns the user's enrollment, or ErrNotFound
+	GetTOTP(ctx context.Context, userID int) (*models.TOTP, error)
+	// StartTOTP stores a secret awaiting its first code, replacing one that
+	// was never verified; it reports false if TOTP is already enabled
+	StartTOTP(ctx context.Context, userID int, secret string) (bool, error)
+	// EnableTOTP marks the enrollment verified by a code for step and replaces
+	// the recovery codes; it reports false if it was already enabled
+	EnableTOTP(ctx context.Context, userID int, step int64, codeHashes []string) (bool, error)
+	// UseTOTPStep records that a code for step was accepted, reporting false
+	// if one for that step or a later one already was
+	UseTOTPStep(ctx context.Context, userID int, step int64) (bool, error)
+	// UseRecoveryCode marks an unused recovery code used, reporting whether there was one
+	UseRecoveryCode(ctx context.Context, userID int, codeHash string) (bool, error)
+	ReplaceRecoveryCodes(ctx context.Context, userID int, codeHashes []string) error
+	// DisableTOTP deletes the enrollment and the recovery codes
+	DisableTOTP(ctx context.Context, userID int) error
+}
+
+// TokenStore keeps the single-use tokens mailed to users
+type TokenStore interface {
+	CreateToken(ctx context.Context, t *models.UserToken) error
+	// UseToken marks the token with the hash and purpose used and returns it,
+	// or ErrNotFound if there is none, or it expired or was used before
+	UseToken(ctx context.Context, tokenHash, purpose string) (*models.UserToken, error)
+	// DeleteTokens deletes the user's tokens for a purpose
+	DeleteTokens(ctx context.Context, userID int, purpose string) error
+}
+
+// IdentityStore keeps the provider accounts users log in with
+type IdentityStore interface {
+	// CreateIdentity links an identity to its user and sets i.ID and i.CreatedAt
+	CreateIdentity(ctx context.Context, i *models.Identity) error
+	// GetIdentity returns the identity with the provider's subject, or ErrNotFound
+	GetIdentity(ctx context.Context, provider, subject string) (*models.Identity, error)
+	ListIdentities(ctx context.Context, userID int) ([]models.Identity, error)
+	// TouchIdentity records a login with the identity and the email it came with
+	TouchIdentity(ctx context.Context, id int, email string, at time.Time) error
+	// DeleteIdentity unlinks one of the user's identities, reporting whether it was theirs
+	DeleteIdentity(ctx context.Context, userID, id int) (bool, error)
+}
+
+// APIKeyStore keeps the personal API keys of users
+type APIKeyStore interface {
+	// CreateAPIKey stores the key and sets k.ID and k.CreatedAt
+	CreateAPIKey(ctx context.Context, k *models.APIKey) error
+	// GetAPIKeyByHash returns the key with the hash, revoked or not, or ErrNotFound
+	GetAPIKeyByHash(ctx context.Context, keyHash string) (*models.APIKey, error)
+	// GetAPIKey returns the key with the ID, revoked or not, or ErrNotFound
+	GetAPIKey(ctx context.Context, id int) (*models.APIKey, error)
+	ListAPIKeys(ctx context.Context, userID int) ([]models.APIKey, error)
+	// CountActiveAPIKeys counts the user's keys that are neither revoked nor expired at now
+	CountActiveAPIKeys(ctx context.Context, userID int, now time.Time) (int, error)
+	// TouchAPIKey records a use of the key from ip at at, unless one was
+	// recorded after since
+	TouchAPIKey(ctx context.Context, id int, ip string, at, since time.Time) error
+	// RevokeAPIKey revokes one of the user's keys, reporting false if it was
+	// not theirs or was already revoked
+	RevokeAPIKey(ctx context.Context, userID, id int, at time.Time) (bool, error)
+}
+
+// SessionStore keeps the login sessions of users. Logging a session out
+// deletes it.
+type SessionStore interface {
+	// CreateSession stores the session and sets s.ID and s.CreatedAt
+	CreateSession(ctx context.Context, s *models.Session) error
+	// GetSession returns the session, or ErrNotFound if it was logged out
+	GetSession(ctx context.Context, id int) (*models.Session, error)
+	// ListSessions lists the user's sessions that have not expired at now, most recently seen first
+	ListSessions(ctx context.Context, userID int, now time.Time) ([]models.Session, error)
+	// TouchSession records a request of the session from ip at at, unless one
+	// was recorded after since
+	TouchSession(ctx context.Context, id int, ip string, at, since time.Time) error
+	// ExtendSession moves the expiry of the session to that of a newly issued token
+	ExtendSession(ctx context.Context, id int, expiresAt time.Time) error
+	// DeleteSession logs out one of the user's sessions, reporting whether it was theirs
+	DeleteSession(ctx context.Context, userID, id int) (bool, error)
+	// DeleteSessions logs out all of the user's sessions but exceptID, which
+	// may be 0, and returns how many there were
+	DeleteSessions(ctx context.Context, userID, exceptID int) (int, error)
+	// PruneSessions deletes the sessions that expired before before
+	PruneSessions(ctx context.Context, before time.Time) error
+}
@@ -0,0 +1,233 @@
+package store_test
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"echo-api/db"
+	"echo-api/migrations"
+	"echo-api/models"
+	"echo-api/store"
+)
+
+// all is every repository, which both implementations are
+type all interface {
+	store.UserStore
+	store.OrgStore
+	store.LoginFailureStore
+	store.APIKeyStore
+	store.SessionStore
+}
+
+// eachStore runs test against the in-memory store and the SQL store on a
+// migrated SQLite database, so that the memory store behaves like the real one
+func eachStore(t *testing.T, test func(t *testing.T, s all)) {
+	t.Run("memory", func(t *testing.T) {
+		test(t, store.NewMemory())
+	})
+	t.Run("sqlite", func(t *testing.T) {
+		conn, err := sql.Open("sqlite", db.SQLiteDSN(filepath.Join(t.TempDir(), "test.db")))
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { conn.Close() })
+		if _, err := migrations.Up(context.Background(), conn, db.SQLite); err != nil {
+			t.Fatal(err)
+		}
+		test(t, store.NewSQL(conn, 5*time.Second))
+	})
+}
+
+func createUser(t *testing.T, s all, username string) *models.User {
+	t.Helper()
+	u := &models.User{Username: username, PasswordHash: "hash", Role: models.RoleUser}
+	if err := s.CreateUser(context.Background(), u); err != nil {
+		t.Fatal(err)
+	}
+	return u
+}
+
+func TestUsers(t *testing.T) {
+	eachStore(t, func(t *testing.T, s all) {
+		ctx := context.Background()
+		alice := createUser(t, s, "alice")
+
+		got, err := s.GetUserByUsername(ctx, "alice")
+		if err != nil || got.ID != alice.ID {
+			t.Fatalf("GetUserByUsername() = %+v, %v, want user %d", got, err, alice.ID)
+		}
+		if _, err := s.GetUser(ctx, alice.ID+1000); !errors.Is(err, store.ErrNotFound) {
+			t.Errorf("GetUser(unknown) error = %v, want ErrNotFound", err)
+		}
+		if err := s.CreateUser(ctx, &models.User{Username: "alice", PasswordHash: "hash", Role: models.RoleUser}); err == nil {
+			t.Error("CreateUser() with a taken username succeeded")
+		}
+
+		changed, err := s.SetDisabled(ctx, alice.ID, true, time.Now())
+		if err != nil || !changed {
+			t.Fatalf("SetDisabled() = %v, %v, want true", changed, err)
+		}
+		if changed, _ := s.SetDisabled(ctx, alice.ID, true, time.Now()); changed {
+			t.Error("SetDisabled() of a disabled user reported a change")
+		}
+		if err := s.MarkDeleting(ctx, alice.ID, time.Now()); err != nil {
+			t.Fatal(err)
+		}
+		got, err = s.GetUser(ctx, alice.ID)
+		if err != nil || !got.Disabled || !got.Deleting {
+			t.Errorf("GetUser() = %+v, %v, want disabled and deleting", got, err)
+		}
+	})
+}
+
+func TestLoginFailures(t *testing.T) {
+	eachStore(t, func(t *testing.T, s all) {
+		ctx := context.Background()
+		start := time.Now().Truncate(time.Second)
+
+		tests := []struct {
+			name  string
+			at    time.Duration // After start
+			since time.Duration // Window start, after start
+			want  int
+		}{
+			{name: "first", at: 0, since: -time.Hour, want: 1},
+			{name: "within the window", at: time.Minute, since: -time.Hour, want: 2},
+			{name: "another", at: 2 * time.Minute, since: -time.Hour, want: 3},
+			{name: "after the window", at: 3 * time.Hour, since: 2 * time.Hour, want: 1},
+		}
+		for _, tt := range tests {
+			n, err := s.AddLoginFailure(ctx, "user:alice", start.Add(tt.at), start.Add(tt.since))
+			if err != nil || n != tt.want {
+				t.Fatalf("%s: AddLoginFailure() = %d, %v, want %d", tt.name, n, err, tt.want)
+			}
+		}
+
+		f, err := s.LoginFailures(ctx, "user:alice")
+		if err != nil || f.Failures != 1 || !f.LastFailure.Equal(start.Add(3*time.Hour)) {
+			t.Errorf("LoginFailures() = %+v, %v, want 1 at %v", f, err, start.Add(3*time.Hour))
+		}
+		if cleared, err := s.ClearLoginFailures(ctx, "user:alice"); err != nil || !cleared {
+			t.Errorf("ClearLoginFailures() = %v, %v, want true", cleared, err)
+		}
+		if f, _ := s.LoginFailures(ctx, "user:alice"); f.Failures != 0 {
+			t.Errorf("failures after clearing = %d, want 0", f.Failures)
+		}
+	})
+}
+
+func TestSessions(t *testing.T) {
+	eachStore(t, func(t *testing.T, s all) {
+		ctx := context.Background()
+		alice, bob := createUser(t, s, "alice"), createUser(t, s, "bob")
+		newSession := func(userID int) int {
+			session := &models.Session{UserID: userID, LastSeenAt: time.Now(), ExpiresAt: time.Now().Add(time.Hour)}
+			if err := s.CreateSession(ctx, session); err != nil {
+				t.Fatal(err)
+			}
+			return session.ID
+		}
+		first, second, third := newSession(alice.ID), newSession(alice.ID), newSession(alice.ID)
+		other := newSession(bob.ID)
+
+		if deleted, err := s.DeleteSession(ctx, bob.ID, first); err != nil || deleted {
+			t.Errorf("DeleteSession() of another user's session = %v, %v, want false", deleted, err)
+		}
+		if deleted, err := s.DeleteSession(ctx, alice.ID, first); err != nil || !deleted {
+			t.Errorf("DeleteSession() = %v, %v, want true", deleted, err)
+		}
+		if _, err := s.GetSession(ctx, first); !errors.Is(err, store.ErrNotFound) {
+			t.Errorf("GetSession() of a deleted session error = %v, want ErrNotFound", err)
+		}
+
+		if n, err := s.DeleteSessions(ctx, alice.ID, third); err != nil || n != 1 {
+			t.Errorf("DeleteSessions() = %d, %v, want 1", n, err)
+		}
+		for id, want := range map[int]bool{second: false, third: true, other: true} {
+			_, err := s.GetSession(ctx, id)
+			if found := err == nil; found != want {
+				t.Errorf("session %d found = %v, want %v", id, found, want)
+			}
+		}
+	})
+}
+
+func TestAPIKeys(t *testing.T) {
+	eachStore(t, func(t *testing.T, s all) {
+		ctx := context.Background()
+		alice, bob := createUser(t, s, "alice"), createUser(t, s, "bob")
+		orgID, err := s.DefaultOrganization(ctx, alice.ID, alice.Username)
+		if err != nil {
+			t.Fatal(err)
+		}
+		k := &models.APIKey{UserID: alice.ID, OrgID: orgID, Name: "ci", Prefix: "eak_", KeyHash: "hash", Scopes: []string{"files:read"}}
+		if err := s.CreateAPIKey(ctx, k); err != nil {
+			t.Fatal(err)
+		}
+
+		got, err := s.GetAPIKeyByHash(ctx, "hash")
+		if err != nil || got.ID != k.ID || got.UserID != alice.ID {
+			t.Fatalf("GetAPIKeyByHash() = %+v, %v, want key %d", got, err, k.ID)
+		}
+		if revoked, err := s.RevokeAPIKey(ctx, bob.ID, k.ID, time.Now()); err != nil || revoked {
+			t.Errorf("RevokeAPIKey() of another user's key = %v, %v, want false", revoked, err)
+		}
+		if revoked, err := s.RevokeAPIKey(ctx, alice.ID, k.ID, time.Now()); err != nil || !revoked {
+			t.Errorf("RevokeAPIKey() = %v, %v, want true", revoked, err)
+		}
+		got, err = s.GetAPIKey(ctx, k.ID)
+		if err != nil || got.Active(time.Now()) {
+			t.Errorf("GetAPIKey() = %+v, %v, want a revoked key", got, err)
+		}
+	})
+}
+
+func TestMembers(t *testing.T) {
+	eachStore(t, func(t *testing.T, s all) {
+		ctx := context.Background()
+		alice, bob := createUser(t, s, "alice"), createUser(t, s, "bob")
+		org := &models.Organization{Name: "team"}
+		if err := s.CreateOrganization(ctx, alice.ID, org); err != nil {
+			t.Fatal(err)
+		}
+
+		if added, err := s.AddMember(ctx, org.ID, bob.ID, models.OrgRoleAdmin); err != nil || !added {
+			t.Fatalf("AddMember() = %v, %v, want true", added, err)
+		}
+		if added, err := s.AddMember(ctx, org.ID, alice.ID, models.OrgRoleMember); err != nil || added {
+			t.Errorf("AddMember() of the owner = %v, %v, want false", added, err)
+		}
+		if role, _ := s.MemberRole(ctx, org.ID, alice.ID); role != models.OrgRoleOwner {
+			t.Errorf("role of the owner after AddMember() = %q, want owner", role)
+		}
+
+		steps := []struct {
+			name   string
+			userID int
+			role   string
+			want   bool
+		}{
+			{name: "demote the last owner", userID: alice.ID, role: models.OrgRoleAdmin},
+			{name: "keep the last owner", userID: alice.ID, role: models.OrgRoleOwner, want: true},
+			{name: "promote", userID: bob.ID, role: models.OrgRoleOwner, want: true},
+			{name: "demote another owner", userID: alice.ID, role: models.OrgRoleMember, want: true},
+			{name: "demote the new last owner", userID: bob.ID, role: models.OrgRoleMember},
+			{name: "not a member", userID: bob.ID + 1000, role: models.OrgRoleMember},
+		}
+		for _, step := range steps {
+			if changed, err := s.SetMemberRole(ctx, org.ID, step.userID, step.role); err != nil || changed != step.want {
+				t.Fatalf("%s: SetMemberRole() = %v, %v, want %v", step.name, changed, err, step.want)
+			}
+		}
+		if removed, err := s.RemoveMember(ctx, org.ID, bob.ID); err != nil || removed {
+			t.Errorf("RemoveMember() of the last owner = %v, %v, want false", removed, err)
+		}
+		if removed, err := s.RemoveMember(ctx, org.ID, alice.ID); err != nil || !removed {
+			t.Errorf("RemoveMember() = %v, %v, want true", removed, err)
+		}
+	})
+}
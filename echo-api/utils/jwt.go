@@ -0,0 +1,203 @@
+package utils
+
+import (
+	"errors"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/labstack/echo/v4"
+)
+
+// TokenTTL is how long the token of a login is valid
+const TokenTTL = 72 * time.Hour
+
+// GenerateToken signs a JWT for the user acting in an organization that expires
+// after TokenTTL; sessionID names the login session the token belongs to and
+// mfa records that the login passed a second factor
+func GenerateToken(userID int, role string, orgID int, sessionID int, mfa bool) (string, error) {
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"user_id": userID,
+		"role":    role,
+		"org_id":  orgID,
+		"sid":     sessionID,
+		"mfa":     mfa,
+		"exp":     time.Now().Add(TokenTTL).Unix(),
+	})
+
+	return token.SignedString(JWTSecret)
+}
+
+// GenerateImpersonationToken signs a JWT that lets an admin act as the user in
+// the session for support. It names the admin, so that what is done with it
+// is audited as theirs, and expires after ttl.
+func GenerateImpersonationToken(userID int, role string, orgID int, sessionID int, mfa bool, adminID int, ttl time.Duration) (string, error) {
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"user_id":         userID,
+		"role":            role,
+		"org_id":          orgID,
+		"sid":             sessionID,
+		"mfa":             mfa,
+		"impersonator_id": adminID,
+		"exp":             time.Now().Add(ttl).Unix(),
+	})
+
+	return token.SignedString(JWTSecret)
+}
+
+// GenerateAPIKeyToken signs the JWT an API key is exchanged for on each
+// request. It lives only as long as the request, but file streams may take a
+// while, so it expires after an hour. Its scopes limit what the key may do.
+func GenerateAPIKeyToken(userID int, role string, orgID int, mfa bool, keyID int, scopes []string) (string, error) {
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"user_id":    userID,
+		"role":       role,
+		"org_id":     orgID,
+		"mfa":        mfa,
+		"api_key_id": keyID,
+		"scopes":     scopes,
+		"exp":        time.Now().Add(time.Hour).Unix(),
+	})
+
+	return token.SignedString(JWTSecret)
+}
+
+// UserID returns the user ID claim of the JWT validated by the echo-jwt middleware
+func UserID(c echo.Context) int {
+	user := c.Get("user").(*jwt.Token)
+	claims := user.Claims.(jwt.MapClaims)
+	return int(claims["user_id"].(float64))
+}
+
+// Role returns the role claim of the validated JWT
+func Role(c echo.Context) string {
+	user := c.Get("user").(*jwt.Token)
+	claims := user.Claims.(jwt.MapClaims)
+	role, _ := claims["role"].(string)
+	return role
+}
+
+// OrgID returns the organization claim of the validated JWT, or 0 for tokens issued without one
+func OrgID(c echo.Context) int {
+	user := c.Get("user").(*jwt.Token)
+	claims := user.Claims.(jwt.MapClaims)
+	orgID, _ := claims["org_id"].(float64)
+	return int(orgID)
+}
+
+// MFA reports whether the validated JWT was issued after a second factor
+func MFA(c echo.Context) bool {
+	user := c.Get("user").(*jwt.Token)
+	claims := user.Claims.(jwt.MapClaims)
+	mfa, _ := claims["mfa"].(bool)
+	return mfa
+}
+
+// SessionID returns the login session of the validated JWT, or 0 for a JWT an API key was exchanged for
+func SessionID(c echo.Context) int {
+	user := c.Get("user").(*jwt.Token)
+	claims := user.Claims.(jwt.MapClaims)
+	sessionID, _ := claims["sid"].(float64)
+	return int(sessionID)
+}
+
+// APIKeyID returns the API key the validated JWT was exchanged for, or 0 for a login's JWT
+func APIKeyID(c echo.Context) int {
+	user := c.Get("user").(*jwt.Token)
+	claims := user.Claims.(jwt.MapClaims)
+	keyID, _ := claims["api_key_id"].(float64)
+	return int(keyID)
+}
+
+// ImpersonatorID returns the admin acting as the user with the validated JWT, or 0
+func ImpersonatorID(c echo.Context) int {
+	user := c.Get("user").(*jwt.Token)
+	claims := user.Claims.(jwt.MapClaims)
+	adminID, _ := claims["impersonator_id"].(float64)
+	return int(adminID)
+}
+
+// Scopes returns the scopes of the API key the validated JWT was exchanged for
+func Scopes(c echo.Context) []string {
+	user := c.Get("user").(*jwt.Token)
+	claims := user.Claims.(jwt.MapClaims)
+	raw, _ := claims["scopes"].([]interface{})
+	scopes := make([]string, 0, len(raw))
+	for _, s := range raw {
+		if s, ok := s.(string); ok {
+			scopes = append(scopes, s)
+		}
+	}
+	return scopes
+}
+
+// GenerateMFAChallenge signs the token a login trades in, together with a
+// second factor, for an access token. It carries no user_id claim, so that it
+// is never accepted as an access token.
+func GenerateMFAChallenge(userID int, ttl time.Duration) (string, error) {
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"mfa_user_id": userID,
+		"exp":         time.Now().Add(ttl).Unix(),
+	})
+
+	return token.SignedString(JWTSecret)
+}
+
+// ParseMFAChallenge returns the user of a valid, unexpired challenge token
+func ParseMFAChallenge(challenge string) (int, error) {
+	claims := jwt.MapClaims{}
+	token, err := jwt.ParseWithClaims(challenge, claims, func(*jwt.Token) (interface{}, error) {
+		return JWTSecret, nil
+	}, jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}), jwt.WithExpirationRequired())
+	if err != nil || !token.Valid {
+		return 0, errors.New("invalid challenge token")
+	}
+	userID, ok := claims["mfa_user_id"].(float64)
+	if !ok {
+		return 0, errors.New("invalid challenge token")
+	}
+	return int(userID), nil
+}
+
+// OIDCFlow is what the gateway keeps, in a cookie, about a login in progress
+// at an OpenID Connect provider
+type OIDCFlow struct {
+	Provider string
+	State    string
+	Nonce    string
+	Verifier string // PKCE code verifier
+}
+
+// GenerateOIDCFlow signs a flow to keep until the provider sends the user back.
+// Like the MFA challenge it carries no user_id claim.
+func GenerateOIDCFlow(f OIDCFlow, ttl time.Duration) (string, error) {
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"oidc_provider": f.Provider,
+		"oidc_state":    f.State,
+		"oidc_nonce":    f.Nonce,
+		"oidc_verifier": f.Verifier,
+		"exp":           time.Now().Add(ttl).Unix(),
+	})
+
+	return token.SignedString(JWTSecret)
+}
+
+// ParseOIDCFlow returns the flow of a valid, unexpired flow token
+func ParseOIDCFlow(flow string) (OIDCFlow, error) {
+	claims := jwt.MapClaims{}
+	token, err := jwt.ParseWithClaims(flow, claims, func(*jwt.Token) (interface{}, error) {
+		return JWTSecret, nil
+	}, jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}), jwt.WithExpirationRequired())
+	if err != nil || !token.Valid {
+		return OIDCFlow{}, errors.New("invalid flow token")
+	}
+	var f OIDCFlow
+	var ok [4]bool
+	f.Provider, ok[0] = claims["oidc_provider"].(string)
+	f.State, ok[1] = claims["oidc_state"].(string)
+	f.Nonce, ok[2] = claims["oidc_nonce"].(string)
+	f.Verifier, ok[3] = claims["oidc_verifier"].(string)
+	if ok != [4]bool{true, true, true, true} {
+		return OIDCFlow{}, errors.New("invalid flow token")
+	}
+	return f, nil
+}
@@ -0,0 +1,7 @@
+package utils
+
+// Keys signing access tokens and download URLs, set from the configuration at startup
+var (
+	JWTSecret        []byte
+	URLSigningSecret []byte
+)
@@ -0,0 +1,38 @@
+package utils
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Passwords are hashed with bcrypt, which only reads the first 72 bytes
+const (
+	MinPasswordLength = 8
+	MaxPasswordLength = 72
+)
+
+// HashPassword returns the bcrypt hash a password is stored as
+func HashPassword(password string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	return string(hash), err
+}
+
+// IsPasswordHash reports whether a stored password is a bcrypt hash rather
+// than one stored in plain text before passwords were hashed
+func IsPasswordHash(stored string) bool {
+	_, err := bcrypt.Cost([]byte(stored))
+	return err == nil
+}
+
+// CheckPassword reports whether the password matches the stored hash, or the
+// stored plain text password, comparing those in constant time. Nothing
+// matches an empty stored password.
+func CheckPassword(stored, password string) bool {
+	if IsPasswordHash(stored) {
+		return bcrypt.CompareHashAndPassword([]byte(stored), []byte(password)) == nil
+	}
+	s, p := sha256.Sum256([]byte(stored)), sha256.Sum256([]byte(password))
+	return subtle.ConstantTimeCompare(s[:], p[:]) == 1 && stored != ""
+}
@@ -0,0 +1,38 @@
+package utils
+
+import (
+	"testing"
+	"time"
+)
+
+func TestVerifyTOTP(t *testing.T) {
+	// The SHA-1 secret of RFC 6238, whose test vectors have 8 digits; these
+	// are their last 6
+	secret := secretEncoding.EncodeToString([]byte("12345678901234567890"))
+
+	tests := []struct {
+		name string
+		at   int64
+		code string
+		step int64
+		ok   bool
+	}{
+		{name: "59", at: 59, code: "287082", step: 1, ok: true},
+		{name: "1111111109", at: 1111111109, code: "081804", step: 37037036, ok: true},
+		{name: "1234567890", at: 1234567890, code: "005924", step: 41152263, ok: true},
+		{name: "spaces ignored", at: 1234567890, code: "005 924", step: 41152263, ok: true},
+		{name: "previous step", at: 1111111109 + 30, code: "081804", step: 37037036, ok: true},
+		{name: "next step", at: 1111111109 - 30, code: "081804", step: 37037036, ok: true},
+		{name: "two steps late", at: 1111111109 + 60, code: "081804"},
+		{name: "wrong code", at: 1234567890, code: "005925"},
+		{name: "too short", at: 1234567890, code: "05924"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			step, ok := VerifyTOTP(secret, tt.code, time.Unix(tt.at, 0))
+			if ok != tt.ok || (ok && step != tt.step) {
+				t.Errorf("VerifyTOTP() = %d, %v, want %d, %v", step, ok, tt.step, tt.ok)
+			}
+		})
+	}
+}
@@ -0,0 +1,249 @@
+// Package apperr defines the errors echo-api and the file services return to
+// clients. Each carries a machine-readable code that stays stable across
+// releases, a message safe to show, and optional details such as the limits
+// behind a quota error. The file services send them as gRPC statuses with the
+// code and details attached, and echo-api turns them back into errors with
+// FromGRPC and into HTTP responses with HTTPStatus.
+package apperr
+
+import (
+	"errors"
+	"net/http"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/protoadapt"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+// Code is a machine-readable error code
+type Code string
+
+// Codes that stand for a whole class of gRPC status, used when nothing more
+// specific applies
+const (
+	InvalidRequest     Code = "invalid_request"
+	Unauthenticated    Code = "unauthenticated"
+	PermissionDenied   Code = "permission_denied"
+	NotFound           Code = "not_found"
+	AlreadyExists      Code = "already_exists"
+	ResourceExhausted  Code = "resource_exhausted"
+	FailedPrecondition Code = "failed_precondition"
+	Aborted            Code = "aborted"
+	Unimplemented      Code = "unimplemented"
+	Unavailable        Code = "unavailable"
+	DeadlineExceeded   Code = "deadline_exceeded"
+	Canceled           Code = "canceled"
+	Internal           Code = "internal"
+)
+
+// Specific codes
+const (
+	InvalidCredentials   Code = "invalid_credentials"
+	MissingToken         Code = "missing_token"
+	InvalidToken         Code = "invalid_token"
+	NotOrgMember         Code = "not_org_member"
+	NoWriteAccess        Code = "no_write_access"
+	OwnerOnly            Code = "owner_only"
+	InsufficientRole     Code = "insufficient_role"
+	UserNotFound         Code = "user_not_found"
+	OrgNotFound          Code = "organization_not_found"
+	AlreadyMember        Code = "already_member"
+	NotMember            Code = "not_member"
+	LastOwner            Code = "last_owner"
+	FileNotFound         Code = "file_not_found"
+	FolderNotFound       Code = "folder_not_found"
+	ShareLinkNotFound    Code = "share_link_not_found"
+	GrantNotFound        Code = "grant_not_found"
+	FileTooLarge         Code = "file_too_large"
+	QuotaExceeded        Code = "quota_exceeded"
+	SizeMismatch         Code = "size_mismatch"
+	RequestTooLarge      Code = "request_too_large"
+	MethodNotAllowed     Code = "method_not_allowed"
+	DownloadLimitReached Code = "download_limit_reached"
+	RateLimited          Code = "rate_limited"
+	LoginThrottled       Code = "login_throttled"
+	PasswordRequired     Code = "password_required"
+	InvalidPassword      Code = "invalid_password"
+	InvalidSignedURL     Code = "invalid_signed_url"
+	MFARequired          Code = "mfa_required"
+	MFANotEnrolled       Code = "mfa_not_enrolled"
+	MFAAlreadyEnabled    Code = "mfa_already_enabled"
+	InvalidMFACode       Code = "invalid_mfa_code"
+	InvalidMFAToken      Code = "invalid_mfa_token"
+	EmailMissing         Code = "email_missing"
+	EmailAlreadyVerified Code = "email_already_verified"
+	InvalidVerifyToken   Code = "invalid_verification_token"
+	InvalidResetToken    Code = "invalid_reset_token"
+	OIDCProviderNotFound Code = "oidc_provider_not_found"
+	InvalidOIDCState     Code = "invalid_oidc_state"
+	OIDCLoginFailed      Code = "oidc_login_failed"
+	IdentityNotLinked    Code = "identity_not_linked"
+	IdentityNotFound     Code = "identity_not_found"
+	LastLoginMethod      Code = "last_login_method"
+	InvalidAPIKey        Code = "invalid_api_key"
+	APIKeyNotFound       Code = "api_key_not_found"
+	APIKeyLimitReached   Code = "api_key_limit_reached"
+	InsufficientScope    Code = "insufficient_scope"
+	LoginRequired        Code = "login_required"
+	SessionRevoked       Code = "session_revoked"
+	SessionNotFound      Code = "session_not_found"
+	UsernameTaken        Code = "username_taken"
+	EmailTaken           Code = "email_taken"
+	SoleOrgOwner         Code = "sole_org_owner"
+	AccountDisabled      Code = "account_disabled"
+	OwnAccount           Code = "own_account"
+	ImpersonationDenied  Code = "impersonation_denied"
+	RecentLoginRequired  Code = "recent_login_required"
+)
+
+// domain names the services in the ErrorInfo detail of a status
+const domain = "file-service"
+
+// Error is an error with a code, a gRPC status code and a message for clients
+type Error struct {
+	Status  codes.Code
+	Code    Code
+	Message string
+	// Details are extra facts about the error, such as a limit that was hit;
+	// values are strings, numbers or booleans
+	Details map[string]interface{}
+}
+
+// New returns an error with the given status, code and message
+func New(status codes.Code, code Code, message string) *Error {
+	return &Error{Status: status, Code: code, Message: message}
+}
+
+// With returns a copy of e with a detail added
+func (e *Error) With(key string, value interface{}) *Error {
+	next := *e
+	next.Details = make(map[string]interface{}, len(e.Details)+1)
+	for k, v := range e.Details {
+		next.Details[k] = v
+	}
+	next.Details[key] = value
+	return &next
+}
+
+func (e *Error) Error() string {
+	return string(e.Code) + ": " + e.Message
+}
+
+// GRPCStatus converts e to a status carrying its code in an ErrorInfo detail and
+// its details in a Struct detail; gRPC servers send errors this way
+func (e *Error) GRPCStatus() *status.Status {
+	st := status.New(e.Status, e.Message)
+	details := []protoadapt.MessageV1{&errdetails.ErrorInfo{Reason: string(e.Code), Domain: domain}}
+	if len(e.Details) > 0 {
+		if s, err := structpb.NewStruct(e.Details); err == nil {
+			details = append(details, s)
+		}
+	}
+	if withDetails, err := st.WithDetails(details...); err == nil {
+		return withDetails
+	}
+	return st
+}
+
+// FromGRPC returns the error a file service sent, or err itself if it is an
+// Error. Errors without a code get the one of their status class. Server-side
+// failures without a code carry messages that are not meant for clients, such
+// as SQL or connection errors, so those messages are replaced.
+func FromGRPC(err error) *Error {
+	var e *Error
+	if errors.As(err, &e) {
+		return e
+	}
+
+	st := status.Convert(err)
+	e = &Error{Status: st.Code(), Code: classCodes[st.Code()], Message: st.Message()}
+	coded := false
+	for _, d := range st.Details() {
+		switch d := d.(type) {
+		case *errdetails.ErrorInfo:
+			if d.Domain == domain {
+				e.Code, coded = Code(d.Reason), true
+			}
+		case *structpb.Struct:
+			e.Details = d.AsMap()
+		}
+	}
+	if e.Code == "" {
+		e.Code = Internal
+	}
+	if !coded && e.HTTPStatus() >= http.StatusInternalServerError {
+		e.Message = genericMessages[e.Code]
+	}
+	return e
+}
+
+// genericMessages replace the messages of server-side failures
+var genericMessages = map[Code]string{
+	Internal:         "internal error",
+	Unimplemented:    "not implemented",
+	Unavailable:      "service unavailable, try again later",
+	DeadlineExceeded: "the request timed out",
+}
+
+// classCodes are the codes of errors that only have a status
+var classCodes = map[codes.Code]Code{
+	codes.InvalidArgument:    InvalidRequest,
+	codes.OutOfRange:         InvalidRequest,
+	codes.Unauthenticated:    Unauthenticated,
+	codes.PermissionDenied:   PermissionDenied,
+	codes.NotFound:           NotFound,
+	codes.AlreadyExists:      AlreadyExists,
+	codes.ResourceExhausted:  ResourceExhausted,
+	codes.FailedPrecondition: FailedPrecondition,
+	codes.Aborted:            Aborted,
+	codes.Unimplemented:      Unimplemented,
+	codes.Unavailable:        Unavailable,
+	codes.DeadlineExceeded:   DeadlineExceeded,
+	codes.Canceled:           Canceled,
+	codes.Internal:           Internal,
+	codes.Unknown:            Internal,
+	codes.DataLoss:           Internal,
+}
+
+// httpStatuses maps each gRPC status code to an HTTP status, following the
+// mapping of google.rpc.Code
+var httpStatuses = map[codes.Code]int{
+	codes.OK:                 http.StatusOK,
+	codes.Canceled:           499, // Client Closed Request
+	codes.Unknown:            http.StatusInternalServerError,
+	codes.InvalidArgument:    http.StatusBadRequest,
+	codes.DeadlineExceeded:   http.StatusGatewayTimeout,
+	codes.NotFound:           http.StatusNotFound,
+	codes.AlreadyExists:      http.StatusConflict,
+	codes.PermissionDenied:   http.StatusForbidden,
+	codes.ResourceExhausted:  http.StatusTooManyRequests,
+	codes.FailedPrecondition: http.StatusBadRequest,
+	codes.Aborted:            http.StatusConflict,
+	codes.OutOfRange:         http.StatusBadRequest,
+	codes.Unimplemented:      http.StatusNotImplemented,
+	codes.Internal:           http.StatusInternalServerError,
+	codes.Unavailable:        http.StatusServiceUnavailable,
+	codes.DataLoss:           http.StatusInternalServerError,
+	codes.Unauthenticated:    http.StatusUnauthorized,
+}
+
+// httpOverrides are the codes answered with a more precise status than their gRPC status maps to
+var httpOverrides = map[Code]int{
+	FileTooLarge:         http.StatusRequestEntityTooLarge,
+	QuotaExceeded:        http.StatusRequestEntityTooLarge,
+	RequestTooLarge:      http.StatusRequestEntityTooLarge,
+	DownloadLimitReached: http.StatusGone,
+}
+
+// HTTPStatus returns the HTTP status an error is answered with
+func (e *Error) HTTPStatus() int {
+	if s, ok := httpOverrides[e.Code]; ok {
+		return s
+	}
+	if s, ok := httpStatuses[e.Status]; ok {
+		return s
+	}
+	return http.StatusInternalServerError
+}
@@ -0,0 +1,68 @@
+package apperr
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestFromGRPC(t *testing.T) {
+	tests := []struct {
+		name    string
+		err     error
+		code    Code
+		message string
+	}{
+		{name: "sent by a file service", err: New(codes.NotFound, FileNotFound, "file not found").GRPCStatus().Err(),
+			code: FileNotFound, message: "file not found"},
+		{name: "client error without a code", err: status.Error(codes.InvalidArgument, "name is required"),
+			code: InvalidRequest, message: "name is required"},
+		{name: "server error without a code", err: status.Error(codes.Internal, "pq: connection refused"),
+			code: Internal, message: "internal error"},
+		{name: "server error with a code", err: New(codes.Unavailable, Unavailable, "storage is full").GRPCStatus().Err(),
+			code: Unavailable, message: "storage is full"},
+		{name: "not a status", err: errors.New("dial tcp: connection refused"), code: Internal, message: "internal error"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := FromGRPC(tt.err)
+			if e.Code != tt.code || e.Message != tt.message {
+				t.Errorf("FromGRPC() = %q, %q, want %q, %q", e.Code, e.Message, tt.code, tt.message)
+			}
+		})
+	}
+
+	// Details survive the trip through gRPC
+	sent := New(codes.ResourceExhausted, RateLimited, "too many requests").With("retry_after_seconds", 3)
+	e := FromGRPC(sent.GRPCStatus().Err())
+	if e.Details["retry_after_seconds"] != float64(3) {
+		t.Errorf("FromGRPC() details = %v, want retry_after_seconds 3", e.Details)
+	}
+}
+
+func TestHTTPStatus(t *testing.T) {
+	tests := []struct {
+		err  *Error
+		want int
+	}{
+		{err: New(codes.InvalidArgument, InvalidRequest, ""), want: http.StatusBadRequest},
+		{err: New(codes.FailedPrecondition, LastOwner, ""), want: http.StatusBadRequest},
+		{err: New(codes.Unauthenticated, InvalidToken, ""), want: http.StatusUnauthorized},
+		{err: New(codes.PermissionDenied, OwnerOnly, ""), want: http.StatusForbidden},
+		{err: New(codes.AlreadyExists, AlreadyMember, ""), want: http.StatusConflict},
+		{err: New(codes.ResourceExhausted, RateLimited, ""), want: http.StatusTooManyRequests},
+		{err: New(codes.ResourceExhausted, QuotaExceeded, ""), want: http.StatusRequestEntityTooLarge},
+		{err: New(codes.ResourceExhausted, DownloadLimitReached, ""), want: http.StatusGone},
+		{err: New(codes.Canceled, Canceled, ""), want: 499},
+		{err: New(codes.DeadlineExceeded, DeadlineExceeded, ""), want: http.StatusGatewayTimeout},
+		{err: New(codes.Code(99), Internal, ""), want: http.StatusInternalServerError},
+	}
+	for _, tt := range tests {
+		if got := tt.err.HTTPStatus(); got != tt.want {
+			t.Errorf("HTTPStatus() of %s (%s) = %d, want %d", tt.err.Code, tt.err.Status, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,56 @@
+// Package auth holds what echo-api and the file services must agree on to
+// authenticate requests: the access tokens echo-api issues and the file
+// services verify, and the signatures of download URLs.
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Reasons CheckDownload rejects a signed download URL
+var (
+	ErrBadSignature = errors.New("invalid signature")
+	ErrExpired      = errors.New("signed URL has expired")
+	ErrWrongAddress = errors.New("signed URL is not valid from this address")
+)
+
+// SignedDownload is what a signed download URL grants: a download of FileID by
+// UserID, acting in OrgID, until Expires (Unix time). BoundIP restricts the URL
+// to one client address; "" is no restriction. The URL names the login session
+// or the API key it was issued with, and stops working with them.
+type SignedDownload struct {
+	FileID    string
+	UserID    string
+	OrgID     string
+	Expires   int64
+	BoundIP   string
+	SessionID string
+	APIKeyID  string
+}
+
+// SignDownload returns the signature of a download URL under key
+func SignDownload(key []byte, d SignedDownload) string {
+	mac := hmac.New(sha256.New, key)
+	fmt.Fprintf(mac, "%s\n%s\n%s\n%d\n%s\n%s\n%s", d.FileID, d.UserID, d.OrgID, d.Expires, d.BoundIP, d.SessionID, d.APIKeyID)
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// CheckDownload returns nil if signature signs d under key and the URL is
+// still valid at now for a client at clientIP
+func CheckDownload(key []byte, d SignedDownload, signature, clientIP string, now time.Time) error {
+	if !hmac.Equal([]byte(SignDownload(key, d)), []byte(signature)) {
+		return ErrBadSignature
+	}
+	if now.Unix() > d.Expires {
+		return ErrExpired
+	}
+	if d.BoundIP != "" && d.BoundIP != clientIP {
+		return ErrWrongAddress
+	}
+	return nil
+}
@@ -0,0 +1,58 @@
+package auth
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestCheckDownload(t *testing.T) {
+	key := []byte("secret")
+	now := time.Unix(1700000000, 0)
+	signed := SignedDownload{
+		FileID:    "file",
+		UserID:    "1",
+		OrgID:     "2",
+		Expires:   now.Add(time.Minute).Unix(),
+		SessionID: "3",
+	}
+	bound := signed
+	bound.BoundIP = "10.0.0.1"
+
+	tests := []struct {
+		name     string
+		d        SignedDownload
+		sign     SignedDownload
+		key      []byte
+		clientIP string
+		now      time.Time
+		want     error
+	}{
+		{name: "valid", d: signed, sign: signed, key: key, now: now},
+		{name: "last second", d: signed, sign: signed, key: key, now: time.Unix(signed.Expires, 0)},
+		{name: "expired", d: signed, sign: signed, key: key, now: now.Add(2 * time.Minute), want: ErrExpired},
+		{name: "other key", d: signed, sign: signed, key: []byte("other"), now: now, want: ErrBadSignature},
+		{name: "other file", d: with(signed, func(d *SignedDownload) { d.FileID = "other" }), sign: signed, key: key, now: now, want: ErrBadSignature},
+		{name: "other user", d: with(signed, func(d *SignedDownload) { d.UserID = "9" }), sign: signed, key: key, now: now, want: ErrBadSignature},
+		{name: "later expiry", d: with(signed, func(d *SignedDownload) { d.Expires += 3600 }), sign: signed, key: key, now: now, want: ErrBadSignature},
+		{name: "other session", d: with(signed, func(d *SignedDownload) { d.SessionID = "4" }), sign: signed, key: key, now: now, want: ErrBadSignature},
+		{name: "session swapped for key", d: with(signed, func(d *SignedDownload) { d.SessionID, d.APIKeyID = "", "3" }), sign: signed, key: key, now: now, want: ErrBadSignature},
+		{name: "bound address", d: bound, sign: bound, key: key, clientIP: "10.0.0.1", now: now},
+		{name: "other address", d: bound, sign: bound, key: key, clientIP: "10.0.0.2", now: now, want: ErrWrongAddress},
+		{name: "binding removed", d: signed, sign: bound, key: key, clientIP: "10.0.0.2", now: now, want: ErrBadSignature},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := CheckDownload(key, tt.d, SignDownload(tt.key, tt.sign), tt.clientIP, tt.now)
+			if !errors.Is(err, tt.want) {
+				t.Errorf("CheckDownload() = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+// with returns a copy of d changed by change
+func with(d SignedDownload, change func(*SignedDownload)) SignedDownload {
+	change(&d)
+	return d
+}
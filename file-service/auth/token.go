@@ -0,0 +1,220 @@
+package auth
+
+import (
+	"context"
+	"log/slog"
+	"strconv"
+	"strings"
+
+	"github.com/golang-jwt/jwt/v5"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"file-service/apperr"
+	"file-service/logging"
+	"file-service/metrics"
+	"file-service/tracing"
+)
+
+// Identity is the authenticated caller of an RPC and the organization it acts in
+type Identity struct {
+	UserID string
+	OrgID  string
+	// APIKeyID and ImpersonatorID are set for the tokens of an API key and of
+	// an admin acting as the user
+	APIKeyID       string
+	ImpersonatorID string
+}
+
+// RequireLogin rejects callers using an API key or an admin impersonating the
+// user, for RPCs only the user's own login may make
+func (i *Identity) RequireLogin() error {
+	if i.APIKeyID != "" {
+		return apperr.New(codes.PermissionDenied, apperr.LoginRequired, "API keys cannot be used here; log in instead")
+	}
+	if i.ImpersonatorID != "" {
+		return apperr.New(codes.PermissionDenied, apperr.LoginRequired, "not available while impersonating a user")
+	}
+	return nil
+}
+
+// Store is what verifying a caller looks up in the database
+type Store interface {
+	// IsMember reports whether the user belongs to the organization
+	IsMember(ctx context.Context, orgID, userID string) (bool, error)
+	// SessionActive reports whether the user's login session has neither been
+	// logged out nor expired, and the user is neither disabled nor deleting
+	// their account
+	SessionActive(ctx context.Context, sessionID, userID string) (bool, error)
+	// APIKeyActive reports whether the user's API key is neither revoked nor
+	// expired, and the user is neither disabled nor deleting their account
+	APIKeyActive(ctx context.Context, keyID, userID string) (bool, error)
+}
+
+// DeletionStore is also implemented by the store of the service that releases
+// the files of deleted accounts
+type DeletionStore interface {
+	// DeletingSessionActive reports whether the user's login session has
+	// neither been logged out nor expired, and the user is deleting their account
+	DeletingSessionActive(ctx context.Context, sessionID, userID string) (bool, error)
+}
+
+// Verifier authenticates the callers of a file service by the access tokens
+// echo-api issues, which are HS256 JWTs signed with the shared JWT secret
+type Verifier struct {
+	service string
+	key     []byte
+	store   Store
+	logger  *slog.Logger
+}
+
+// NewVerifier returns a Verifier for the named service, which labels its logs
+// and auth failure metrics
+func NewVerifier(service string, key []byte, store Store) *Verifier {
+	return &Verifier{service: service, key: key, store: store, logger: logging.For(service)}
+}
+
+// Authenticate identifies the caller of an RPC in its own span, counting
+// rejected credentials
+func (v *Verifier) Authenticate(ctx context.Context) (*Identity, error) {
+	ctx, span := tracing.Start(ctx, "authenticate")
+	caller, err := v.verifyToken(ctx, v.CheckCredential)
+	tracing.End(span, err)
+	metrics.CountAuthFailure(v.service, err)
+	return caller, err
+}
+
+// AuthenticateDeletion identifies a user deleting their account by the login
+// session they do it with, which Authenticate no longer accepts, for releasing
+// their files. The service's store must implement DeletionStore.
+func (v *Verifier) AuthenticateDeletion(ctx context.Context) (*Identity, error) {
+	ctx, span := tracing.Start(ctx, "authenticate")
+	caller, err := v.verifyToken(ctx, v.checkDeletingSession)
+	tracing.End(span, err)
+	metrics.CountAuthFailure(v.service, err)
+	return caller, err
+}
+
+// verifyToken validates the JWT in the request metadata, checks the session or
+// API key it was issued for with check, and checks that the user still belongs
+// to the organization named by its org_id claim
+func (v *Verifier) verifyToken(ctx context.Context, check func(ctx context.Context, userID, sessionID, keyID string) error) (*Identity, error) {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return nil, apperr.New(codes.Unauthenticated, apperr.MissingToken, "metadata is not provided")
+	}
+
+	tokens := md.Get("authorization")
+	if len(tokens) == 0 {
+		return nil, apperr.New(codes.Unauthenticated, apperr.MissingToken, "authorization token is not provided")
+	}
+
+	// Only HS256 is accepted, so a token cannot pick a weaker algorithm
+	claims := jwt.MapClaims{}
+	parsedToken, err := jwt.ParseWithClaims(strings.TrimPrefix(tokens[0], "Bearer "), claims, func(token *jwt.Token) (interface{}, error) {
+		return v.key, nil
+	}, jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}))
+	if err != nil || !parsedToken.Valid {
+		return nil, apperr.New(codes.Unauthenticated, apperr.InvalidToken, "invalid token")
+	}
+
+	userID, ok := claims["user_id"].(float64)
+	if !ok {
+		return nil, apperr.New(codes.Unauthenticated, apperr.InvalidToken, "token has no user")
+	}
+
+	orgID, ok := claims["org_id"].(float64)
+	if !ok {
+		return nil, apperr.New(codes.Unauthenticated, apperr.InvalidToken, "token has no organization, log in again")
+	}
+
+	// Tokens belong to the session of a login or to an API key
+	var sessionID, keyID string
+	if id, ok := claims["sid"].(float64); ok {
+		sessionID = claimID(id)
+	}
+	if id, ok := claims["api_key_id"].(float64); ok {
+		keyID = claimID(id)
+	}
+	if err := check(ctx, claimID(userID), sessionID, keyID); err != nil {
+		return nil, err
+	}
+
+	caller, err := v.CheckMembership(ctx, claimID(userID), claimID(orgID))
+	if err != nil {
+		return nil, err
+	}
+	caller.APIKeyID = keyID
+	if id, ok := claims["impersonator_id"].(float64); ok {
+		caller.ImpersonatorID = claimID(id)
+	}
+	return caller, nil
+}
+
+// CheckCredential returns nil if the login session or, without one, the API
+// key the user authenticated with is still valid. Logging out, revoking the
+// key, disabling the user or them deleting their account thus stops its tokens
+// and signed URLs at once.
+func (v *Verifier) CheckCredential(ctx context.Context, userID, sessionID, keyID string) error {
+	switch {
+	case sessionID != "":
+		active, err := v.store.SessionActive(ctx, sessionID, userID)
+		if err != nil {
+			v.logger.ErrorContext(ctx, "Session query error", "error", err)
+			return status.Error(codes.Internal, "failed to check session")
+		}
+		if !active {
+			return apperr.New(codes.Unauthenticated, apperr.SessionRevoked, "the session was logged out, log in again")
+		}
+	case keyID != "":
+		active, err := v.store.APIKeyActive(ctx, keyID, userID)
+		if err != nil {
+			v.logger.ErrorContext(ctx, "API key query error", "error", err)
+			return status.Error(codes.Internal, "failed to check API key")
+		}
+		if !active {
+			return apperr.New(codes.Unauthenticated, apperr.InvalidAPIKey, "invalid, expired or revoked API key")
+		}
+	default:
+		return apperr.New(codes.Unauthenticated, apperr.InvalidToken, "token has no session, log in again")
+	}
+	return nil
+}
+
+// checkDeletingSession is CheckCredential for AuthenticateDeletion: only the
+// login session of a user deleting their account is accepted
+func (v *Verifier) checkDeletingSession(ctx context.Context, userID, sessionID, keyID string) error {
+	store, ok := v.store.(DeletionStore)
+	if !ok || sessionID == "" {
+		return apperr.New(codes.PermissionDenied, apperr.LoginRequired, "only the user's login can release their files")
+	}
+	active, err := store.DeletingSessionActive(ctx, sessionID, userID)
+	if err != nil {
+		v.logger.ErrorContext(ctx, "Session query error", "error", err)
+		return status.Error(codes.Internal, "failed to check session")
+	}
+	if !active {
+		return apperr.New(codes.Unauthenticated, apperr.SessionRevoked, "the session was logged out, log in again")
+	}
+	return nil
+}
+
+// claimID formats a numeric ID claim, which JSON decodes as a float
+func claimID(id float64) string {
+	return strconv.Itoa(int(id))
+}
+
+// CheckMembership returns the caller's identity if the user is a member of the organization
+func (v *Verifier) CheckMembership(ctx context.Context, userID string, orgID string) (*Identity, error) {
+	member, err := v.store.IsMember(ctx, orgID, userID)
+	if err != nil {
+		v.logger.ErrorContext(ctx, "Membership query error", "error", err)
+		return nil, status.Error(codes.Internal, "failed to check organization membership")
+	}
+	if !member {
+		return nil, apperr.New(codes.PermissionDenied, apperr.NotOrgMember, "not a member of this organization")
+	}
+
+	return &Identity{UserID: userID, OrgID: orgID}, nil
+}
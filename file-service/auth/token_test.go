@@ -0,0 +1,230 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"google.golang.org/grpc/metadata"
+
+	"file-service/apperr"
+)
+
+// fakeStore holds the active sessions and API keys, as "userID/id", and the
+// memberships, as "orgID/userID"
+type fakeStore struct {
+	sessions map[string]bool
+	keys     map[string]bool
+	members  map[string]bool
+}
+
+// deletionStore also holds the sessions of users deleting their account
+type deletionStore struct {
+	fakeStore
+	deleting map[string]bool
+}
+
+func (d *deletionStore) DeletingSessionActive(ctx context.Context, sessionID, userID string) (bool, error) {
+	return d.deleting[userID+"/"+sessionID], nil
+}
+
+func (f *fakeStore) IsMember(ctx context.Context, orgID, userID string) (bool, error) {
+	return f.members[orgID+"/"+userID], nil
+}
+
+func (f *fakeStore) SessionActive(ctx context.Context, sessionID, userID string) (bool, error) {
+	return f.sessions[userID+"/"+sessionID], nil
+}
+
+func (f *fakeStore) APIKeyActive(ctx context.Context, keyID, userID string) (bool, error) {
+	return f.keys[userID+"/"+keyID], nil
+}
+
+func TestAuthenticate(t *testing.T) {
+	key := []byte("secret")
+	v := NewVerifier("test", key, &fakeStore{
+		sessions: map[string]bool{"1/10": true},
+		keys:     map[string]bool{"1/20": true},
+		members:  map[string]bool{"5/1": true},
+	})
+	exp := time.Now().Add(time.Hour).Unix()
+
+	tests := []struct {
+		name   string
+		method jwt.SigningMethod
+		key    interface{}
+		claims jwt.MapClaims
+		want   *Identity
+		code   apperr.Code
+	}{
+		{
+			name:   "session",
+			claims: jwt.MapClaims{"user_id": 1, "org_id": 5, "sid": 10, "exp": exp},
+			want:   &Identity{UserID: "1", OrgID: "5"},
+		},
+		{
+			name:   "API key",
+			claims: jwt.MapClaims{"user_id": 1, "org_id": 5, "api_key_id": 20, "exp": exp},
+			want:   &Identity{UserID: "1", OrgID: "5", APIKeyID: "20"},
+		},
+		{
+			name:   "impersonation",
+			claims: jwt.MapClaims{"user_id": 1, "org_id": 5, "sid": 10, "impersonator_id": 7, "exp": exp},
+			want:   &Identity{UserID: "1", OrgID: "5", ImpersonatorID: "7"},
+		},
+		{
+			name:   "logged out session",
+			claims: jwt.MapClaims{"user_id": 1, "org_id": 5, "sid": 11, "exp": exp},
+			code:   apperr.SessionRevoked,
+		},
+		{
+			name:   "another user's session",
+			claims: jwt.MapClaims{"user_id": 2, "org_id": 5, "sid": 10, "exp": exp},
+			code:   apperr.SessionRevoked,
+		},
+		{
+			name:   "revoked API key",
+			claims: jwt.MapClaims{"user_id": 1, "org_id": 5, "api_key_id": 21, "exp": exp},
+			code:   apperr.InvalidAPIKey,
+		},
+		{
+			name:   "no session",
+			claims: jwt.MapClaims{"user_id": 1, "org_id": 5, "exp": exp},
+			code:   apperr.InvalidToken,
+		},
+		{
+			name:   "no user",
+			claims: jwt.MapClaims{"org_id": 5, "sid": 10, "exp": exp},
+			code:   apperr.InvalidToken,
+		},
+		{
+			name:   "no organization",
+			claims: jwt.MapClaims{"user_id": 1, "sid": 10, "exp": exp},
+			code:   apperr.InvalidToken,
+		},
+		{
+			name:   "not a member",
+			claims: jwt.MapClaims{"user_id": 1, "org_id": 6, "sid": 10, "exp": exp},
+			code:   apperr.NotOrgMember,
+		},
+		{
+			name:   "expired",
+			claims: jwt.MapClaims{"user_id": 1, "org_id": 5, "sid": 10, "exp": time.Now().Add(-time.Minute).Unix()},
+			code:   apperr.InvalidToken,
+		},
+		{
+			name:   "other key",
+			key:    []byte("other"),
+			claims: jwt.MapClaims{"user_id": 1, "org_id": 5, "sid": 10, "exp": exp},
+			code:   apperr.InvalidToken,
+		},
+		{
+			name:   "HS512",
+			method: jwt.SigningMethodHS512,
+			claims: jwt.MapClaims{"user_id": 1, "org_id": 5, "sid": 10, "exp": exp},
+			code:   apperr.InvalidToken,
+		},
+		{
+			name:   "unsigned",
+			method: jwt.SigningMethodNone,
+			key:    jwt.UnsafeAllowNoneSignatureType,
+			claims: jwt.MapClaims{"user_id": 1, "org_id": 5, "sid": 10, "exp": exp},
+			code:   apperr.InvalidToken,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			method, signingKey := tt.method, tt.key
+			if method == nil {
+				method = jwt.SigningMethodHS256
+			}
+			if signingKey == nil {
+				signingKey = key
+			}
+			token, err := jwt.NewWithClaims(method, tt.claims).SignedString(signingKey)
+			if err != nil {
+				t.Fatal(err)
+			}
+			ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs("authorization", "Bearer "+token))
+
+			got, err := v.Authenticate(ctx)
+			if code := codeOf(err); code != tt.code {
+				t.Fatalf("Authenticate() error = %v, want code %q", err, tt.code)
+			}
+			if tt.want != nil && *got != *tt.want {
+				t.Errorf("Authenticate() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAuthenticateDeletion(t *testing.T) {
+	key := []byte("secret")
+	store := &deletionStore{
+		fakeStore: fakeStore{sessions: map[string]bool{"1/10": true}, keys: map[string]bool{"2/20": true}, members: map[string]bool{"5/1": true, "5/2": true}},
+		deleting:  map[string]bool{"2/11": true},
+	}
+	exp := time.Now().Add(time.Hour).Unix()
+
+	tests := []struct {
+		name   string
+		store  Store
+		claims jwt.MapClaims
+		code   apperr.Code
+	}{
+		{name: "deleting", store: store, claims: jwt.MapClaims{"user_id": 2, "org_id": 5, "sid": 11, "exp": exp}},
+		{name: "not deleting", store: store, claims: jwt.MapClaims{"user_id": 1, "org_id": 5, "sid": 10, "exp": exp}, code: apperr.SessionRevoked},
+		{name: "API key", store: store, claims: jwt.MapClaims{"user_id": 2, "org_id": 5, "api_key_id": 20, "exp": exp}, code: apperr.LoginRequired},
+		{name: "store without deletions", store: &store.fakeStore, claims: jwt.MapClaims{"user_id": 2, "org_id": 5, "sid": 11, "exp": exp}, code: apperr.LoginRequired},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, tt.claims).SignedString(key)
+			if err != nil {
+				t.Fatal(err)
+			}
+			ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs("authorization", "Bearer "+token))
+			if _, err := NewVerifier("test", key, tt.store).AuthenticateDeletion(ctx); codeOf(err) != tt.code {
+				t.Errorf("AuthenticateDeletion() error = %v, want code %q", err, tt.code)
+			}
+		})
+	}
+}
+
+func TestAuthenticateWithoutToken(t *testing.T) {
+	v := NewVerifier("test", []byte("secret"), &fakeStore{})
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.MD{})
+	if _, err := v.Authenticate(ctx); codeOf(err) != apperr.MissingToken {
+		t.Errorf("Authenticate() error = %v, want code %q", err, apperr.MissingToken)
+	}
+}
+
+func TestRequireLogin(t *testing.T) {
+	tests := []struct {
+		name   string
+		caller Identity
+		code   apperr.Code
+	}{
+		{name: "login", caller: Identity{UserID: "1", OrgID: "5"}},
+		{name: "API key", caller: Identity{UserID: "1", OrgID: "5", APIKeyID: "20"}, code: apperr.LoginRequired},
+		{name: "impersonation", caller: Identity{UserID: "1", OrgID: "5", ImpersonatorID: "7"}, code: apperr.LoginRequired},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.caller.RequireLogin(); codeOf(err) != tt.code {
+				t.Errorf("RequireLogin() = %v, want code %q", err, tt.code)
+			}
+		})
+	}
+}
+
+// codeOf returns the code of an *apperr.Error, or "" for nil
+func codeOf(err error) apperr.Code {
+	var e *apperr.Error
+	if errors.As(err, &e) {
+		return e.Code
+	}
+	return ""
+}
@@ -0,0 +1,139 @@
+package config
+
+import (
+	"encoding"
+	"fmt"
+	"net/url"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// setting is one leaf of Config along with the tags describing it
+type setting struct {
+	path   string // YAML path, also the flag name
+	env    string
+	usage  string
+	secret string
+	reload bool
+	value  reflect.Value
+}
+
+// settings lists every setting of c in declaration order
+func settings(c *Config) []setting {
+	var out []setting
+	v := reflect.ValueOf(c).Elem()
+	for i := 0; i < v.NumField(); i++ {
+		section := v.Type().Field(i)
+		if !section.IsExported() {
+			continue
+		}
+		prefix := section.Tag.Get("yaml")
+		sv := v.Field(i)
+		for j := 0; j < sv.NumField(); j++ {
+			f := sv.Type().Field(j)
+			out = append(out, setting{
+				path:   prefix + "." + f.Tag.Get("yaml"),
+				env:    f.Tag.Get("env"),
+				usage:  f.Tag.Get("usage"),
+				secret: f.Tag.Get("secret"),
+				reload: f.Tag.Get("reload") == "true",
+				value:  sv.Field(j),
+			})
+		}
+	}
+	return out
+}
+
+// settingAt returns the setting of c at a YAML path
+func settingAt(c *Config, path string) setting {
+	for _, s := range settings(c) {
+		if s.path == path {
+			return s
+		}
+	}
+	panic("config: unknown setting " + path)
+}
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+// set parses a value given in the environment or on the command line
+func (s setting) set(raw string) error {
+	raw = strings.TrimSpace(raw)
+	if u, ok := s.value.Addr().Interface().(encoding.TextUnmarshaler); ok {
+		return u.UnmarshalText([]byte(raw))
+	}
+
+	switch {
+	case s.value.Type() == durationType:
+		d, err := time.ParseDuration(raw)
+		if err != nil {
+			return fmt.Errorf("invalid duration %q", raw)
+		}
+		s.value.SetInt(int64(d))
+	case s.value.Kind() == reflect.String:
+		s.value.SetString(raw)
+	case s.value.Kind() == reflect.Bool:
+		b, err := strconv.ParseBool(raw)
+		if err != nil {
+			return fmt.Errorf("invalid boolean %q", raw)
+		}
+		s.value.SetBool(b)
+	case s.value.Kind() == reflect.Float64:
+		f, err := strconv.ParseFloat(raw, 64)
+		if err != nil {
+			return fmt.Errorf("invalid number %q", raw)
+		}
+		s.value.SetFloat(f)
+	case s.value.Kind() == reflect.Int || s.value.Kind() == reflect.Int64:
+		n, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil {
+			return fmt.Errorf("invalid number %q", raw)
+		}
+		s.value.SetInt(n)
+	case s.value.Kind() == reflect.Slice:
+		var items []string
+		for _, item := range strings.Split(raw, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				items = append(items, item)
+			}
+		}
+		s.value.Set(reflect.ValueOf(items))
+	default:
+		panic("config: unsupported setting type " + s.value.Type().String())
+	}
+	return nil
+}
+
+// redact hides a secret setting; URLs keep everything but their password, and
+// so do the URLs in name=URL lists
+func (s setting) redact() {
+	if s.secret == "" {
+		return
+	}
+	if s.value.Kind() == reflect.Slice {
+		items := make([]string, s.value.Len())
+		for i := range items {
+			name, raw, _ := strings.Cut(s.value.Index(i).String(), "=")
+			items[i] = name + "=" + redacted(s.secret, raw)
+		}
+		s.value.Set(reflect.ValueOf(items))
+		return
+	}
+	s.value.SetString(redacted(s.secret, s.value.String()))
+}
+
+// redacted returns a secret value as it is printed
+func redacted(secret, raw string) string {
+	switch {
+	case raw == "":
+	case secret == "url":
+		if u, err := url.Parse(raw); err == nil && u.User != nil {
+			return u.Redacted()
+		}
+	default:
+		return "[redacted]"
+	}
+	return raw
+}
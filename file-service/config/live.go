@@ -0,0 +1,77 @@
+package config
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"os/signal"
+	"reflect"
+	"sync/atomic"
+	"syscall"
+)
+
+// Live is a configuration that reloads on SIGHUP. Settings tagged reload take
+// effect immediately; changes to the others are logged and wait for a restart.
+type Live struct {
+	program string
+	current atomic.Pointer[Config]
+}
+
+// Watch returns cfg as a Live configuration, reloading it on SIGHUP until ctx is done
+func Watch(ctx context.Context, program string, cfg *Config) *Live {
+	l := &Live{program: program}
+	l.current.Store(cfg)
+
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	go func() {
+		defer signal.Stop(hup)
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-hup:
+				if err := l.Reload(); err != nil {
+					logger().Warn("Configuration not reloaded", "error", err)
+				}
+			}
+		}
+	}()
+	return l
+}
+
+// Get returns the configuration in effect
+func (l *Live) Get() *Config {
+	return l.current.Load()
+}
+
+// Reload reads the configuration again from the sources it was loaded from
+func (l *Live) Reload() error {
+	old := l.Get()
+	fresh, _, err := LoadWith(l.program, old.defaults, old.args)
+	if err != nil {
+		return err
+	}
+
+	next := *old
+	newSettings := settings(fresh)
+	for i, s := range settings(&next) {
+		if reflect.DeepEqual(s.value.Interface(), newSettings[i].value.Interface()) {
+			continue
+		}
+		if !s.reload {
+			logger().Info("Setting changed; restart to apply it", "setting", s.path)
+			continue
+		}
+		s.value.Set(newSettings[i].value)
+		logger().Info("Setting reloaded", "setting", s.path)
+	}
+	l.current.Store(&next)
+	return nil
+}
+
+// logger returns the default logger, which the binaries set up after loading
+// the configuration, for the config component
+func logger() *slog.Logger {
+	return slog.With("component", "config")
+}
@@ -0,0 +1,33 @@
+package main
+
+import (
+	"database/sql"
+	"strings"
+
+	_ "github.com/jackc/pgx/v5/stdlib"
+	_ "modernc.org/sqlite"
+
+	"file-service/config"
+	"file-service/tracing"
+)
+
+// openDB opens the configured database: Postgres, or with the sqlite driver
+// the SQLite file echo-api migrates, tracing the statements it runs
+func openDB(cfg config.Database) (*sql.DB, error) {
+	if cfg.Driver == config.SQLite {
+		return tracing.OpenDB("sqlite", sqliteDSN(cfg.URL), "sqlite")
+	}
+	return tracing.OpenDB("pgx", cfg.URL, "postgresql")
+}
+
+// sqliteDSN adds the settings echo-api uses for the same file: foreign keys,
+// waiting on a busy database, WAL, write locks taken when a transaction begins,
+// and timestamps stored in a sortable text format
+func sqliteDSN(path string) string {
+	sep := "?"
+	if strings.Contains(path, "?") {
+		sep = "&"
+	}
+	return path + sep + "_pragma=foreign_keys(1)&_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)" +
+		"&_txlock=immediate&_time_format=sqlite"
+}
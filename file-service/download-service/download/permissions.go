@@ -0,0 +1,141 @@
+package download
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"file-service/apperr"
+	"file-service/auth"
+	"file-service/download-service/store"
+	pb "file-service/proto/download"
+)
+
+// requireOwner checks that the user owns the file or folder named by exactly one of the IDs
+func (s *server) requireOwner(ctx context.Context, fileID string, folderID string, caller *auth.Identity) error {
+	if (fileID == "") == (folderID == "") {
+		return status.Error(codes.InvalidArgument, "exactly one of file_id and folder_id is required")
+	}
+
+	var access string
+	var err error
+	if fileID != "" {
+		access, err = s.getFileAccess(ctx, fileID, caller)
+	} else {
+		access, err = s.getFolderAccess(ctx, folderID, caller)
+	}
+	if err != nil {
+		return err
+	}
+	if access != accessOwner {
+		return apperr.New(codes.PermissionDenied, apperr.OwnerOnly, "only the owner can manage access")
+	}
+	return nil
+}
+
+// grant converts a stored grant to its protobuf form
+func grant(g *store.Grant) *pb.Grant {
+	return &pb.Grant{
+		FileId:    g.FileID,
+		FolderId:  g.FolderID,
+		UserId:    g.UserID,
+		Username:  g.Username,
+		Access:    g.Access,
+		CreatedAt: g.CreatedAt.Format(time.RFC3339),
+	}
+}
+
+func (s *server) GrantAccess(ctx context.Context, req *pb.GrantAccessRequest) (*pb.Grant, error) {
+	// Get the caller from the JWT token
+	caller, err := s.auth.Authenticate(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if req.Access != accessRead && req.Access != accessReadWrite {
+		return nil, status.Error(codes.InvalidArgument, "access must be read or read_write")
+	}
+
+	if err := s.requireOwner(ctx, req.FileId, req.FolderId, caller); err != nil {
+		return nil, err
+	}
+
+	granteeID, err := s.store.UserIDByUsername(ctx, req.Username)
+	if errors.Is(err, store.ErrNotFound) {
+		return nil, apperr.New(codes.NotFound, apperr.UserNotFound, "user not found")
+	}
+	if err != nil {
+		return nil, status.Error(codes.Internal, "failed to look up user")
+	}
+	if granteeID == caller.UserID {
+		return nil, status.Error(codes.InvalidArgument, "cannot share with yourself")
+	}
+
+	// Granting again replaces the previous access level
+	g := &store.Grant{
+		FileID:    req.FileId,
+		FolderID:  req.FolderId,
+		UserID:    granteeID,
+		Username:  req.Username,
+		Access:    req.Access,
+		GrantedBy: caller.UserID,
+	}
+	if err := s.store.SaveGrant(ctx, g); err != nil {
+		logger.ErrorContext(ctx, "Failed to save grant", "error", err)
+		return nil, status.Error(codes.Internal, "failed to grant access")
+	}
+
+	return grant(g), nil
+}
+
+func (s *server) RevokeAccess(ctx context.Context, req *pb.RevokeAccessRequest) (*pb.RevokeAccessResponse, error) {
+	// Get the caller from the JWT token
+	caller, err := s.auth.Authenticate(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.requireOwner(ctx, req.FileId, req.FolderId, caller); err != nil {
+		return nil, err
+	}
+
+	err = s.store.DeleteGrant(ctx, req.FileId, req.FolderId, req.UserId)
+	if errors.Is(err, store.ErrNotFound) {
+		return nil, apperr.New(codes.NotFound, apperr.GrantNotFound, "grant not found")
+	}
+	if err != nil {
+		return nil, status.Error(codes.Internal, "failed to revoke access")
+	}
+
+	return &pb.RevokeAccessResponse{}, nil
+}
+
+func (s *server) ListGrants(ctx context.Context, req *pb.ListGrantsRequest) (*pb.ListGrantsResponse, error) {
+	// Get the caller from the JWT token
+	caller, err := s.auth.Authenticate(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.requireOwner(ctx, req.FileId, req.FolderId, caller); err != nil {
+		return nil, err
+	}
+
+	stored, err := s.store.ListGrants(ctx, req.FileId, req.FolderId)
+	if err != nil {
+		logger.ErrorContext(ctx, "Database query error", "error", err)
+		return nil, status.Error(codes.Internal, "failed to query grants")
+	}
+
+	var grants []*pb.Grant
+	for i := range stored {
+		grants = append(grants, grant(&stored[i]))
+	}
+
+	return &pb.ListGrantsResponse{
+		Grants: grants,
+	}, nil
+}
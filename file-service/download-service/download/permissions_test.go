@@ -0,0 +1,91 @@
+package download
+
+import (
+	"context"
+	"testing"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"file-service/apperr"
+	"file-service/download-service/store"
+	pb "file-service/proto/download"
+)
+
+func TestGrants(t *testing.T) {
+	s, m := newTestServer(t)
+	for id, name := range map[string]string{"1": "alice", "2": "bob", "3": "carol"} {
+		m.AddUser(id, name)
+	}
+	m.AddMember("1", "1", "owner")
+	m.AddMember("1", "2", "member")
+	m.AddMember("2", "3", "owner")
+	m.AddFolder("docs", "", "1", "1")
+	m.AddFolder("sub", "docs", "1", "1")
+	addFile(t, s, m, store.File{ID: "nested", Filename: "nested.txt", UserID: "1", OrgID: "1", FolderID: "sub"}, "nested")
+	addFile(t, s, m, store.File{ID: "top", Filename: "top.txt", UserID: "1", OrgID: "1"}, "top")
+	alice, bob, carol := callerContext(t, 1, 1), callerContext(t, 2, 1), callerContext(t, 3, 2)
+
+	download := func(ctx context.Context, fileID string) error {
+		return s.DownloadFile(&pb.DownloadFileRequest{FileId: fileID}, &fileRecorder{ctx: ctx})
+	}
+	if err := download(bob, "nested"); err != nil {
+		t.Errorf("DownloadFile() by a member of the organization = %v", err)
+	}
+	if err := download(carol, "nested"); codeOf(err) != apperr.FileNotFound {
+		t.Errorf("DownloadFile() by another organization = %v, want code %q", err, apperr.FileNotFound)
+	}
+
+	// Only owners manage access, and only read or read_write to others
+	folder := &pb.GrantAccessRequest{FolderId: "docs", Username: "carol", Access: "read"}
+	if _, err := s.GrantAccess(bob, folder); codeOf(err) != apperr.OwnerOnly {
+		t.Errorf("GrantAccess() by a member = %v, want code %q", err, apperr.OwnerOnly)
+	}
+	invalid := []*pb.GrantAccessRequest{
+		{FolderId: "docs", Username: "carol", Access: "owner"},
+		{FolderId: "docs", FileId: "top", Username: "carol", Access: "read"},
+		{FolderId: "docs", Username: "alice", Access: "read"},
+	}
+	for _, req := range invalid {
+		if _, err := s.GrantAccess(alice, req); status.Code(err) != codes.InvalidArgument {
+			t.Errorf("GrantAccess(%v) = %v, want InvalidArgument", req, err)
+		}
+	}
+	if _, err := s.GrantAccess(alice, &pb.GrantAccessRequest{FolderId: "docs", Username: "dave", Access: "read"}); codeOf(err) != apperr.UserNotFound {
+		t.Errorf("GrantAccess() to an unknown user = %v, want code %q", err, apperr.UserNotFound)
+	}
+
+	// A folder grant covers its subfolders, and nothing outside it
+	if _, err := s.GrantAccess(alice, folder); err != nil {
+		t.Fatal(err)
+	}
+	if err := download(carol, "nested"); err != nil {
+		t.Errorf("DownloadFile() in a granted folder = %v", err)
+	}
+	if err := download(carol, "top"); codeOf(err) != apperr.FileNotFound {
+		t.Errorf("DownloadFile() outside the granted folder = %v, want code %q", err, apperr.FileNotFound)
+	}
+	shared, err := s.ListFiles(carol, &pb.ListFilesRequest{SharedWithMe: true})
+	if err != nil || len(shared.Files) != 1 || shared.Files[0].FileId != "nested" {
+		t.Errorf("ListFiles(shared_with_me) = %v, %v, want the nested file", shared, err)
+	}
+	if _, err := s.ListGrants(carol, &pb.ListGrantsRequest{FolderId: "docs"}); codeOf(err) != apperr.OwnerOnly {
+		t.Errorf("ListGrants() by a grantee = %v, want code %q", err, apperr.OwnerOnly)
+	}
+	grants, err := s.ListGrants(alice, &pb.ListGrantsRequest{FolderId: "docs"})
+	if err != nil || len(grants.Grants) != 1 || grants.Grants[0].UserId != "3" || grants.Grants[0].Access != "read" {
+		t.Errorf("ListGrants() = %v, %v, want carol's read grant", grants, err)
+	}
+
+	// Revoked grants give no access
+	revoke := &pb.RevokeAccessRequest{FolderId: "docs", UserId: "3"}
+	if _, err := s.RevokeAccess(alice, revoke); err != nil {
+		t.Fatal(err)
+	}
+	if err := download(carol, "nested"); codeOf(err) != apperr.FileNotFound {
+		t.Errorf("DownloadFile() after revoking = %v, want code %q", err, apperr.FileNotFound)
+	}
+	if _, err := s.RevokeAccess(alice, revoke); codeOf(err) != apperr.GrantNotFound {
+		t.Errorf("RevokeAccess() again = %v, want code %q", err, apperr.GrantNotFound)
+	}
+}
@@ -0,0 +1,196 @@
+// Package download implements the FileDownload gRPC service.
+package download
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"file-service/apperr"
+	"file-service/auth"
+	"file-service/config"
+	"file-service/download-service/store"
+	"file-service/logging"
+	"file-service/metrics"
+	pb "file-service/proto/download"
+	"file-service/tracing"
+)
+
+// logger logs the failures behind Internal errors, whose details callers do not see
+var logger = logging.For("download")
+
+type server struct {
+	pb.UnimplementedFileDownloadServer
+	uploadDir        string
+	store            store.FileStore
+	auth             *auth.Verifier
+	urlSigningSecret []byte // Shared with echo-api for signed download URLs
+}
+
+// NewServer returns the download service, serving files from the configured
+// directory with their metadata in fileStore
+func NewServer(cfg *config.Config, fileStore store.FileStore) pb.FileDownloadServer {
+	return &server{
+		uploadDir:        cfg.Storage.Dir,
+		store:            fileStore,
+		auth:             auth.NewVerifier("download", []byte(cfg.Auth.JWTSecret), fileStore),
+		urlSigningSecret: []byte(cfg.Auth.URLSigningSecret),
+	}
+}
+
+func (s *server) DownloadFile(req *pb.DownloadFileRequest, stream pb.FileDownload_DownloadFileServer) error {
+	// Get the caller from the signed URL or the JWT token
+	var caller *auth.Identity
+	var err error
+	if req.Signed != nil {
+		ctx, span := tracing.Start(stream.Context(), "authenticate")
+		caller, err = s.verifySignedAccess(ctx, req.FileId, req.Signed)
+		tracing.End(span, err)
+		metrics.CountAuthFailure("download", err)
+	} else {
+		caller, err = s.auth.Authenticate(stream.Context())
+	}
+	if err != nil {
+		return err
+	}
+
+	metadata, err := s.getAccessibleFile(stream.Context(), req.FileId, caller)
+	if err != nil {
+		return err
+	}
+
+	return s.sendFile(stream, metadata, filepath.Join(s.uploadDir, req.FileId))
+}
+
+// getAccessibleFile returns the file's metadata if the user may read it
+func (s *server) getAccessibleFile(ctx context.Context, fileID string, caller *auth.Identity) (*pb.FileMetadata, error) {
+	if _, err := s.getFileAccess(ctx, fileID, caller); err != nil {
+		return nil, err
+	}
+
+	file, err := s.store.GetFile(ctx, fileID)
+	if errors.Is(err, store.ErrNotFound) {
+		return nil, apperr.New(codes.NotFound, apperr.FileNotFound, "file not found")
+	}
+	if err != nil {
+		logger.ErrorContext(ctx, "Database query error", "error", err)
+		return nil, status.Error(codes.Internal, "failed to look up file")
+	}
+	return fileMetadata(file), nil
+}
+
+// fileMetadata converts stored file metadata to its protobuf form
+func fileMetadata(f *store.File) *pb.FileMetadata {
+	return &pb.FileMetadata{
+		FileId:      f.ID,
+		Filename:    f.Filename,
+		ContentType: f.ContentType,
+		Size:        f.Size,
+		CreatedAt:   f.CreatedAt.Format(time.RFC3339),
+		UserId:      f.UserID,
+		FolderId:    f.FolderID,
+		OrgId:       f.OrgID,
+	}
+}
+
+// fileSender is implemented by the server streams of DownloadFile and DownloadSharedFile
+type fileSender interface {
+	Context() context.Context
+	Send(*pb.DownloadFileResponse) error
+}
+
+// sendFile streams the metadata followed by the file contents in chunks, in a
+// span covering the read from storage
+func (s *server) sendFile(stream fileSender, metadata *pb.FileMetadata, filePath string) error {
+	_, span := tracing.Start(stream.Context(), "storage.read")
+	span.SetAttributes(attribute.Int64("file.size", metadata.Size))
+	err := s.streamFile(stream, metadata, filePath)
+	tracing.End(span, err)
+	return err
+}
+
+// streamFile sends the metadata and then the file at filePath
+func (s *server) streamFile(stream fileSender, metadata *pb.FileMetadata, filePath string) error {
+	// Open file
+	file, err := os.Open(filePath)
+	if err != nil {
+		return apperr.New(codes.NotFound, apperr.FileNotFound, "file not found")
+	}
+	defer file.Close()
+
+	// Send metadata first
+	err = stream.Send(&pb.DownloadFileResponse{
+		Data: &pb.DownloadFileResponse_Metadata{
+			Metadata: metadata,
+		},
+	})
+	if err != nil {
+		return status.Error(codes.Internal, "failed to send metadata")
+	}
+
+	// Send file in chunks
+	buffer := make([]byte, 1024*1024) // 1MB chunks
+	for {
+		n, err := file.Read(buffer)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return status.Error(codes.Internal, "failed to read file")
+		}
+
+		err = stream.Send(&pb.DownloadFileResponse{
+			Data: &pb.DownloadFileResponse_Chunk{
+				Chunk: buffer[:n],
+			},
+		})
+		if err != nil {
+			return status.Error(codes.Internal, "failed to send chunk")
+		}
+		metrics.ChunkSize.WithLabelValues(metrics.Download).Observe(float64(n))
+		metrics.TransferredBytes.WithLabelValues(metrics.Download).Add(float64(n))
+	}
+
+	return nil
+}
+
+func (s *server) ListFiles(ctx context.Context, req *pb.ListFilesRequest) (*pb.ListFilesResponse, error) {
+	// Get the caller from the JWT token
+	caller, err := s.auth.Authenticate(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	// Query files from database; shared_with_me lists files outside the current
+	// organization granted directly, or inside a granted folder or its subfolders
+	var stored []store.File
+	switch {
+	case req.SharedWithMe:
+		stored, err = s.store.ListSharedFiles(ctx, caller.UserID, caller.OrgID)
+	case req.Owned:
+		stored, err = s.store.ListUserFiles(ctx, caller.UserID)
+	default:
+		stored, err = s.store.ListOrgFiles(ctx, caller.OrgID)
+	}
+	if err != nil {
+		logger.ErrorContext(ctx, "Database query error", "error", err)
+		return nil, status.Error(codes.Internal, "failed to query files")
+	}
+
+	var files []*pb.FileMetadata
+	for i := range stored {
+		files = append(files, fileMetadata(&stored[i]))
+	}
+
+	logger.DebugContext(ctx, "Listed files", "count", len(files), "shared_with_me", req.SharedWithMe, "owned", req.Owned)
+	return &pb.ListFilesResponse{
+		Files: files,
+	}, nil
+}
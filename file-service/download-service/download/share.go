@@ -0,0 +1,181 @@
+package download
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"path/filepath"
+	"time"
+
+	"github.com/google/uuid"
+	"golang.org/x/crypto/bcrypt"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"file-service/apperr"
+	"file-service/download-service/store"
+	pb "file-service/proto/download"
+)
+
+// hashShareToken returns the form of a share token stored in the database
+func hashShareToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+func (s *server) CreateShareLink(ctx context.Context, req *pb.CreateShareLinkRequest) (*pb.ShareLink, error) {
+	// Get the caller from the JWT token
+	caller, err := s.auth.Authenticate(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if req.ExpiresInSeconds < 0 || req.MaxDownloads < 0 {
+		return nil, status.Error(codes.InvalidArgument, "expiry and download limit must not be negative")
+	}
+
+	// Only owners may share a file publicly
+	access, err := s.getFileAccess(ctx, req.FileId, caller)
+	if err != nil {
+		return nil, err
+	}
+	if access != accessOwner {
+		return nil, apperr.New(codes.PermissionDenied, apperr.OwnerOnly, "only the owner can share a file")
+	}
+
+	file, err := s.store.GetFile(ctx, req.FileId)
+	if err != nil {
+		return nil, status.Error(codes.Internal, "failed to look up file")
+	}
+
+	// Generate the token handed out in the link; only its hash is stored
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		return nil, status.Error(codes.Internal, "failed to generate share token")
+	}
+	token := base64.RawURLEncoding.EncodeToString(raw)
+
+	link := &store.ShareLink{
+		ID:           uuid.New().String(),
+		TokenHash:    hashShareToken(token),
+		FileID:       req.FileId,
+		Filename:     file.Filename,
+		UserID:       caller.UserID,
+		MaxDownloads: req.MaxDownloads,
+		CreatedAt:    time.Now(),
+	}
+	if req.Password != "" {
+		hash, err := bcrypt.GenerateFromPassword([]byte(req.Password), bcrypt.DefaultCost)
+		if err != nil {
+			return nil, status.Error(codes.Internal, "failed to hash password")
+		}
+		link.PasswordHash = string(hash)
+	}
+	if req.ExpiresInSeconds > 0 {
+		expiresAt := time.Now().Add(time.Duration(req.ExpiresInSeconds) * time.Second)
+		link.ExpiresAt = &expiresAt
+	}
+
+	if err := s.store.CreateShareLink(ctx, link); err != nil {
+		logger.ErrorContext(ctx, "Failed to save share link", "error", err)
+		return nil, status.Error(codes.Internal, "failed to create share link")
+	}
+
+	result := shareLink(link)
+	result.Token = token
+	return result, nil
+}
+
+// shareLink converts a stored share link to its protobuf form, without the token
+func shareLink(l *store.ShareLink) *pb.ShareLink {
+	link := &pb.ShareLink{
+		Id:                l.ID,
+		FileId:            l.FileID,
+		Filename:          l.Filename,
+		PasswordProtected: l.PasswordHash != "",
+		MaxDownloads:      l.MaxDownloads,
+		DownloadCount:     l.DownloadCount,
+		CreatedAt:         l.CreatedAt.Format(time.RFC3339),
+	}
+	if l.ExpiresAt != nil {
+		link.ExpiresAt = l.ExpiresAt.Format(time.RFC3339)
+	}
+	return link
+}
+
+func (s *server) ListShareLinks(ctx context.Context, req *pb.ListShareLinksRequest) (*pb.ListShareLinksResponse, error) {
+	// Get the caller from the JWT token
+	caller, err := s.auth.Authenticate(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	stored, err := s.store.ListShareLinks(ctx, caller.UserID, caller.OrgID)
+	if err != nil {
+		logger.ErrorContext(ctx, "Database query error", "error", err)
+		return nil, status.Error(codes.Internal, "failed to query share links")
+	}
+
+	var links []*pb.ShareLink
+	for i := range stored {
+		links = append(links, shareLink(&stored[i]))
+	}
+
+	return &pb.ListShareLinksResponse{
+		Links: links,
+	}, nil
+}
+
+func (s *server) RevokeShareLink(ctx context.Context, req *pb.RevokeShareLinkRequest) (*pb.RevokeShareLinkResponse, error) {
+	// Get the caller from the JWT token
+	caller, err := s.auth.Authenticate(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.store.RevokeShareLink(ctx, req.Id, caller.UserID)
+	if errors.Is(err, store.ErrNotFound) {
+		return nil, apperr.New(codes.NotFound, apperr.ShareLinkNotFound, "share link not found")
+	}
+	if err != nil {
+		return nil, status.Error(codes.Internal, "failed to revoke share link")
+	}
+
+	return &pb.RevokeShareLinkResponse{}, nil
+}
+
+func (s *server) DownloadSharedFile(req *pb.DownloadSharedFileRequest, stream pb.FileDownload_DownloadSharedFileServer) error {
+	ctx := stream.Context()
+
+	// Look up the link; revoked and expired links are indistinguishable from unknown ones
+	link, file, err := s.store.GetShareLink(ctx, hashShareToken(req.Token))
+	if errors.Is(err, store.ErrNotFound) {
+		return apperr.New(codes.NotFound, apperr.ShareLinkNotFound, "share link not found")
+	}
+	if err != nil {
+		return status.Error(codes.Internal, "failed to look up share link")
+	}
+
+	if link.PasswordHash != "" {
+		if req.Password == "" {
+			return apperr.New(codes.Unauthenticated, apperr.PasswordRequired, "password required")
+		}
+		if bcrypt.CompareHashAndPassword([]byte(link.PasswordHash), []byte(req.Password)) != nil {
+			return apperr.New(codes.PermissionDenied, apperr.InvalidPassword, "invalid password")
+		}
+	}
+
+	// Count the download, refusing it once the limit is reached
+	counted, err := s.store.RecordShareDownload(ctx, link.ID)
+	if err != nil {
+		return status.Error(codes.Internal, "failed to record download")
+	}
+	if !counted {
+		return apperr.New(codes.ResourceExhausted, apperr.DownloadLimitReached, "download limit reached")
+	}
+
+	return s.sendFile(stream, fileMetadata(file), filepath.Join(s.uploadDir, file.ID))
+}
@@ -0,0 +1,137 @@
+package download
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"google.golang.org/grpc/metadata"
+
+	"file-service/apperr"
+	"file-service/auth"
+	"file-service/download-service/store"
+	pb "file-service/proto/download"
+)
+
+// jwtSecret signs the tokens of test callers
+var jwtSecret = []byte("jwt secret")
+
+// newTestServer returns a server with the memory store, whose files are kept in
+// a temporary directory
+func newTestServer(t *testing.T) (*server, *store.Memory) {
+	m := store.NewMemory()
+	return &server{uploadDir: t.TempDir(), store: m, auth: auth.NewVerifier("download", jwtSecret, m)}, m
+}
+
+// addFile stores a file with its contents
+func addFile(t *testing.T, s *server, m *store.Memory, f store.File, contents string) {
+	t.Helper()
+	f.Size = int64(len(contents))
+	m.AddFile(f)
+	if err := os.WriteFile(filepath.Join(s.uploadDir, f.ID), []byte(contents), 0o600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// callerContext returns the context of an RPC made with the token of a login
+// of the user acting in the organization
+func callerContext(t *testing.T, userID, orgID int) context.Context {
+	t.Helper()
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"user_id": userID,
+		"org_id":  orgID,
+		"sid":     userID * 10,
+		"exp":     time.Now().Add(time.Hour).Unix(),
+	}).SignedString(jwtSecret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return metadata.NewIncomingContext(context.Background(), metadata.Pairs("authorization", "Bearer "+token))
+}
+
+// fileRecorder is a server stream of a file download that keeps what is sent
+type fileRecorder struct {
+	pb.FileDownload_DownloadSharedFileServer
+	ctx      context.Context
+	metadata *pb.FileMetadata
+	data     []byte
+}
+
+func (r *fileRecorder) Context() context.Context {
+	return r.ctx
+}
+
+func (r *fileRecorder) Send(resp *pb.DownloadFileResponse) error {
+	if m := resp.GetMetadata(); m != nil {
+		r.metadata = m
+	}
+	r.data = append(r.data, resp.GetChunk()...)
+	return nil
+}
+
+func TestShareLinks(t *testing.T) {
+	s, m := newTestServer(t)
+	m.AddMember("1", "1", "owner")
+	m.AddMember("1", "2", "member")
+	addFile(t, s, m, store.File{ID: "file", Filename: "report.pdf", UserID: "1", OrgID: "1"}, "contents")
+	alice, bob := callerContext(t, 1, 1), callerContext(t, 2, 1)
+
+	if _, err := s.CreateShareLink(bob, &pb.CreateShareLinkRequest{FileId: "file"}); codeOf(err) != apperr.OwnerOnly {
+		t.Errorf("CreateShareLink() by a member = %v, want code %q", err, apperr.OwnerOnly)
+	}
+	link, err := s.CreateShareLink(alice, &pb.CreateShareLinkRequest{FileId: "file", Password: "secret", MaxDownloads: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !link.PasswordProtected || link.Token == "" {
+		t.Fatalf("CreateShareLink() = %+v, want a password protected link with a token", link)
+	}
+
+	download := func(token, password string) (*fileRecorder, error) {
+		r := &fileRecorder{ctx: context.Background()}
+		return r, s.DownloadSharedFile(&pb.DownloadSharedFileRequest{Token: token, Password: password}, r)
+	}
+	steps := []struct {
+		name     string
+		token    string
+		password string
+		code     apperr.Code
+	}{
+		{name: "unknown token", token: "unknown", password: "secret", code: apperr.ShareLinkNotFound},
+		{name: "no password", token: link.Token, code: apperr.PasswordRequired},
+		{name: "wrong password", token: link.Token, password: "wrong", code: apperr.InvalidPassword},
+		{name: "password", token: link.Token, password: "secret"},
+		{name: "after the last download", token: link.Token, password: "secret", code: apperr.DownloadLimitReached},
+	}
+	for _, step := range steps {
+		r, err := download(step.token, step.password)
+		if codeOf(err) != step.code {
+			t.Fatalf("%s: DownloadSharedFile() = %v, want code %q", step.name, err, step.code)
+		}
+		if err == nil && (string(r.data) != "contents" || r.metadata.GetFilename() != "report.pdf") {
+			t.Errorf("%s: downloaded %q as %q", step.name, r.data, r.metadata.GetFilename())
+		}
+	}
+
+	// Revoked links are gone from the list and cannot be used
+	open, err := s.CreateShareLink(alice, &pb.CreateShareLinkRequest{FileId: "file"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.RevokeShareLink(bob, &pb.RevokeShareLinkRequest{Id: open.Id}); codeOf(err) != apperr.ShareLinkNotFound {
+		t.Errorf("RevokeShareLink() by another user = %v, want code %q", err, apperr.ShareLinkNotFound)
+	}
+	if _, err := s.RevokeShareLink(alice, &pb.RevokeShareLinkRequest{Id: open.Id}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := download(open.Token, ""); codeOf(err) != apperr.ShareLinkNotFound {
+		t.Errorf("DownloadSharedFile() of a revoked link = %v, want code %q", err, apperr.ShareLinkNotFound)
+	}
+	links, err := s.ListShareLinks(alice, &pb.ListShareLinksRequest{})
+	if err != nil || len(links.Links) != 0 {
+		t.Errorf("ListShareLinks() = %v, %v, want none left", links, err)
+	}
+}
@@ -0,0 +1,34 @@
+package download
+
+import (
+	"context"
+	"time"
+
+	"google.golang.org/grpc/codes"
+
+	"file-service/apperr"
+	"file-service/auth"
+	pb "file-service/proto/download"
+)
+
+// verifySignedAccess checks a signed URL for the file and returns the identity it was
+// issued to, provided the session or API key it was issued with is still valid
+// and the user still belongs to the organization
+func (s *server) verifySignedAccess(ctx context.Context, fileID string, signed *pb.SignedAccess) (*auth.Identity, error) {
+	d := auth.SignedDownload{
+		FileID:    fileID,
+		UserID:    signed.UserId,
+		OrgID:     signed.OrgId,
+		Expires:   signed.Expires,
+		BoundIP:   signed.BoundIp,
+		SessionID: signed.SessionId,
+		APIKeyID:  signed.ApiKeyId,
+	}
+	if err := auth.CheckDownload(s.urlSigningSecret, d, signed.Signature, signed.ClientIp, time.Now()); err != nil {
+		return nil, apperr.New(codes.PermissionDenied, apperr.InvalidSignedURL, err.Error())
+	}
+	if err := s.auth.CheckCredential(ctx, signed.UserId, signed.SessionId, signed.ApiKeyId); err != nil {
+		return nil, err
+	}
+	return s.auth.CheckMembership(ctx, signed.UserId, signed.OrgId)
+}
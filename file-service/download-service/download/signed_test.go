@@ -0,0 +1,82 @@
+package download
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"file-service/apperr"
+	"file-service/auth"
+	"file-service/download-service/store"
+	pb "file-service/proto/download"
+)
+
+func TestVerifySignedAccess(t *testing.T) {
+	key := []byte("signing secret")
+	newServer := func() (*server, *store.Memory) {
+		m := store.NewMemory()
+		m.AddUser("1", "alice")
+		m.AddMember("1", "1", "member")
+		return &server{store: m, auth: auth.NewVerifier("download", []byte("jwt secret"), m), urlSigningSecret: key}, m
+	}
+	sign := func(d auth.SignedDownload) *pb.SignedAccess {
+		return &pb.SignedAccess{
+			UserId:    d.UserID,
+			OrgId:     d.OrgID,
+			Expires:   d.Expires,
+			BoundIp:   d.BoundIP,
+			SessionId: d.SessionID,
+			ApiKeyId:  d.APIKeyID,
+			Signature: auth.SignDownload(key, d),
+			ClientIp:  "192.0.2.1",
+		}
+	}
+	expires := time.Now().Add(time.Hour).Unix()
+	bySession := auth.SignedDownload{FileID: "file", UserID: "1", OrgID: "1", Expires: expires, SessionID: "10"}
+	byKey := auth.SignedDownload{FileID: "file", UserID: "1", OrgID: "1", Expires: expires, APIKeyID: "20"}
+
+	tests := []struct {
+		name   string
+		signed *pb.SignedAccess
+		change func(m *store.Memory)
+		code   apperr.Code
+	}{
+		{name: "session", signed: sign(bySession)},
+		{name: "API key", signed: sign(byKey)},
+		{name: "session logged out", signed: sign(bySession), change: func(m *store.Memory) { m.EndSession("10") }, code: apperr.SessionRevoked},
+		{name: "API key revoked", signed: sign(byKey), change: func(m *store.Memory) { m.RevokeAPIKey("20") }, code: apperr.InvalidAPIKey},
+		{name: "user disabled", signed: sign(bySession), change: func(m *store.Memory) { m.DisableUser("1") }, code: apperr.SessionRevoked},
+		{name: "user deleting their account", signed: sign(bySession), change: func(m *store.Memory) { m.MarkDeleting("1") }, code: apperr.SessionRevoked},
+		{name: "another file", signed: sign(with(bySession, func(d *auth.SignedDownload) { d.FileID = "other" })), code: apperr.InvalidSignedURL},
+		{name: "expired", signed: sign(with(bySession, func(d *auth.SignedDownload) { d.Expires = time.Now().Add(-time.Minute).Unix() })), code: apperr.InvalidSignedURL},
+		{name: "left the organization", signed: sign(with(bySession, func(d *auth.SignedDownload) { d.OrgID = "2" })), code: apperr.NotOrgMember},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, m := newServer()
+			if tt.change != nil {
+				tt.change(m)
+			}
+			_, err := s.verifySignedAccess(context.Background(), "file", tt.signed)
+			if code := codeOf(err); code != tt.code {
+				t.Errorf("verifySignedAccess() error = %v, want code %q", err, tt.code)
+			}
+		})
+	}
+}
+
+// with returns a copy of d changed by change
+func with(d auth.SignedDownload, change func(*auth.SignedDownload)) auth.SignedDownload {
+	change(&d)
+	return d
+}
+
+// codeOf returns the code of an *apperr.Error, or "" for nil
+func codeOf(err error) apperr.Code {
+	var e *apperr.Error
+	if errors.As(err, &e) {
+		return e.Code
+	}
+	return ""
+}
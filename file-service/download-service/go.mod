@@ -1,12 +1,25 @@
 module file-service/download-service
 
-go 1.21
+go 1.23.0
 
 require (
+	file-service/apperr v0.0.0
+	file-service/auth v0.0.0
+	file-service/config v0.0.0
+	file-service/healthcheck v0.0.0
+	file-service/logging v0.0.0
+	file-service/metrics v0.0.0
+	file-service/proto v0.0.0
+	file-service/ratelimit v0.0.0
+	file-service/tracing v0.0.0
 	github.com/golang-jwt/jwt/v5 v5.2.2
-	github.com/joho/godotenv v1.5.1
-	google.golang.org/grpc v1.62.1
+	github.com/google/uuid v1.6.0
+	github.com/jackc/pgx/v5 v5.7.5
+	golang.org/x/crypto v0.19.0
+	go.opentelemetry.io/otel v1.28.0
+	google.golang.org/grpc v1.65.0
 	google.golang.org/protobuf v1.33.0
+	modernc.org/sqlite v1.34.5
 )
 
 require (
@@ -15,4 +28,17 @@ require (
 	golang.org/x/sys v0.16.0 // indirect
 	golang.org/x/text v0.14.0 // indirect
 	google.golang.org/genproto/googleapis/rpc v0.0.0-20240123012728-ef4313101c80 // indirect
-) 
\ No newline at end of file
+)
+
+// The gRPC contract and the packages shared with echo-api
+replace (
+	file-service/apperr => ../apperr
+	file-service/auth => ../auth
+	file-service/config => ../config
+	file-service/healthcheck => ../healthcheck
+	file-service/logging => ../logging
+	file-service/metrics => ../metrics
+	file-service/proto => ../proto
+	file-service/ratelimit => ../ratelimit
+	file-service/tracing => ../tracing
+)
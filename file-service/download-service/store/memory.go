@@ -0,0 +1,375 @@
+package store
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Memory is a FileStore kept in maps, for tests and running without a database
+type Memory struct {
+	mu         sync.Mutex
+	users      map[string]string            // user ID to username
+	members    map[string]map[string]string // org ID to user ID to role
+	files      map[string]File
+	folders    map[string]memoryFolder
+	shareLinks map[string]*ShareLink
+	revoked    map[string]bool
+	ended      map[string]bool // logged out session IDs
+	keys       map[string]bool // revoked API key IDs
+	disabled   map[string]bool // disabled user IDs
+	deleting   map[string]bool // IDs of users deleting their account
+	grants     []Grant
+}
+
+type memoryFolder struct {
+	parentID string
+	userID   string
+	orgID    string
+}
+
+var _ FileStore = (*Memory)(nil)
+
+// NewMemory returns an empty in-memory store
+func NewMemory() *Memory {
+	return &Memory{
+		users:      map[string]string{},
+		members:    map[string]map[string]string{},
+		files:      map[string]File{},
+		folders:    map[string]memoryFolder{},
+		shareLinks: map[string]*ShareLink{},
+		revoked:    map[string]bool{},
+		ended:      map[string]bool{},
+		keys:       map[string]bool{},
+		disabled:   map[string]bool{},
+		deleting:   map[string]bool{},
+	}
+}
+
+// AddUser adds a user that files can be shared with
+func (m *Memory) AddUser(id, username string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.users[id] = username
+}
+
+// AddMember puts a user in an organization with the role owner, admin or member
+func (m *Memory) AddMember(orgID, userID, role string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.members[orgID] == nil {
+		m.members[orgID] = map[string]string{}
+	}
+	m.members[orgID][userID] = role
+}
+
+// AddFolder adds a folder; parentID is empty for top-level folders
+func (m *Memory) AddFolder(id, parentID, userID, orgID string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.folders[id] = memoryFolder{parentID: parentID, userID: userID, orgID: orgID}
+}
+
+// AddFile adds file metadata
+func (m *Memory) AddFile(f File) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.files[f.ID] = f
+}
+
+func (m *Memory) IsMember(ctx context.Context, orgID, userID string) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	_, ok := m.members[orgID][userID]
+	return ok, nil
+}
+
+// EndSession logs out a session, whose tokens SessionActive then rejects
+func (m *Memory) EndSession(sessionID string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.ended[sessionID] = true
+}
+
+func (m *Memory) SessionActive(ctx context.Context, sessionID, userID string) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return !m.ended[sessionID] && !m.disabled[userID] && !m.deleting[userID], nil
+}
+
+// RevokeAPIKey revokes an API key, whose tokens APIKeyActive then rejects
+func (m *Memory) RevokeAPIKey(keyID string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.keys[keyID] = true
+}
+
+// DisableUser disables a user, whose sessions and API keys are then inactive
+func (m *Memory) DisableUser(userID string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.disabled[userID] = true
+}
+
+// MarkDeleting marks a user as deleting their account, whose sessions and API
+// keys are then inactive
+func (m *Memory) MarkDeleting(userID string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.deleting[userID] = true
+}
+
+func (m *Memory) APIKeyActive(ctx context.Context, keyID, userID string) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return !m.keys[keyID] && !m.disabled[userID] && !m.deleting[userID], nil
+}
+
+// ancestors returns the folder and all of its parents
+func (m *Memory) ancestors(folderID string) []string {
+	var ids []string
+	for folderID != "" {
+		folder, ok := m.folders[folderID]
+		if !ok {
+			break
+		}
+		ids = append(ids, folderID)
+		folderID = folder.parentID
+	}
+	return ids
+}
+
+// resolveAccess mirrors fileAccessQuery for a resource in resourceOrg created by
+// creatorID (empty for folders) inside the given folders, granted as fileID
+func (m *Memory) resolveAccess(resourceOrg, creatorID, fileID string, folders []string, userID, orgID string) string {
+	inOrg := resourceOrg == orgID
+	owner := creatorID == userID
+	for _, id := range folders {
+		owner = owner || m.folders[id].userID == userID
+	}
+	role := m.members[resourceOrg][userID]
+	if inOrg && (owner || role == "owner" || role == "admin") {
+		return AccessOwner
+	}
+
+	granted := AccessNone
+	for _, g := range m.grants {
+		if g.UserID != userID || !(g.FileID != "" && g.FileID == fileID || contains(folders, g.FolderID)) {
+			continue
+		}
+		if g.Access == AccessReadWrite {
+			return AccessReadWrite
+		}
+		granted = AccessRead
+	}
+	if inOrg {
+		return AccessRead
+	}
+	return granted
+}
+
+func contains(ids []string, id string) bool {
+	for _, v := range ids {
+		if v == id {
+			return true
+		}
+	}
+	return false
+}
+
+func (m *Memory) FileAccess(ctx context.Context, fileID, userID, orgID string) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	f, ok := m.files[fileID]
+	if !ok {
+		return AccessNone, nil
+	}
+	return m.resolveAccess(f.OrgID, f.UserID, fileID, m.ancestors(f.FolderID), userID, orgID), nil
+}
+
+func (m *Memory) FolderAccess(ctx context.Context, folderID, userID, orgID string) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	folder, ok := m.folders[folderID]
+	if !ok {
+		return AccessNone, nil
+	}
+	return m.resolveAccess(folder.orgID, "", "", m.ancestors(folderID), userID, orgID), nil
+}
+
+func (m *Memory) GetFile(ctx context.Context, fileID string) (*File, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	f, ok := m.files[fileID]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return &f, nil
+}
+
+func (m *Memory) ListOrgFiles(ctx context.Context, orgID string) ([]File, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var files []File
+	for _, f := range m.files {
+		if f.OrgID == orgID {
+			files = append(files, f)
+		}
+	}
+	return files, nil
+}
+
+func (m *Memory) ListUserFiles(ctx context.Context, userID string) ([]File, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var files []File
+	for _, f := range m.files {
+		if f.UserID == userID {
+			files = append(files, f)
+		}
+	}
+	return files, nil
+}
+
+func (m *Memory) ListSharedFiles(ctx context.Context, userID, excludeOrgID string) ([]File, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var files []File
+	for _, f := range m.files {
+		if f.OrgID == excludeOrgID {
+			continue
+		}
+		folders := m.ancestors(f.FolderID)
+		for _, g := range m.grants {
+			if g.UserID == userID && (g.FileID == f.ID || contains(folders, g.FolderID)) {
+				files = append(files, f)
+				break
+			}
+		}
+	}
+	return files, nil
+}
+
+func (m *Memory) CreateShareLink(ctx context.Context, link *ShareLink) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	l := *link
+	m.shareLinks[l.ID] = &l
+	return nil
+}
+
+// usable reports whether a link has not been revoked or expired
+func (m *Memory) usable(l *ShareLink) bool {
+	return !m.revoked[l.ID] && (l.ExpiresAt == nil || l.ExpiresAt.After(time.Now()))
+}
+
+func (m *Memory) ListShareLinks(ctx context.Context, userID, orgID string) ([]ShareLink, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var links []ShareLink
+	for _, l := range m.shareLinks {
+		f := m.files[l.FileID]
+		if l.UserID != userID || f.OrgID != orgID || !m.usable(l) ||
+			(l.MaxDownloads > 0 && l.DownloadCount >= l.MaxDownloads) {
+			continue
+		}
+		link := *l
+		link.Filename = f.Filename
+		links = append(links, link)
+	}
+	sort.Slice(links, func(i, j int) bool { return links[i].CreatedAt.After(links[j].CreatedAt) })
+	return links, nil
+}
+
+func (m *Memory) RevokeShareLink(ctx context.Context, id, userID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	l, ok := m.shareLinks[id]
+	if !ok || l.UserID != userID || m.revoked[id] {
+		return ErrNotFound
+	}
+	m.revoked[id] = true
+	return nil
+}
+
+func (m *Memory) GetShareLink(ctx context.Context, tokenHash string) (*ShareLink, *File, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, l := range m.shareLinks {
+		if l.TokenHash != tokenHash || !m.usable(l) {
+			continue
+		}
+		f, ok := m.files[l.FileID]
+		if !ok {
+			break
+		}
+		link := *l
+		link.Filename = f.Filename
+		return &link, &f, nil
+	}
+	return nil, nil, ErrNotFound
+}
+
+func (m *Memory) RecordShareDownload(ctx context.Context, id string) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	l, ok := m.shareLinks[id]
+	if !ok || (l.MaxDownloads > 0 && l.DownloadCount >= l.MaxDownloads) {
+		return false, nil
+	}
+	l.DownloadCount++
+	return true, nil
+}
+
+func (m *Memory) UserIDByUsername(ctx context.Context, username string) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for id, name := range m.users {
+		if name == username {
+			return id, nil
+		}
+	}
+	return "", ErrNotFound
+}
+
+func (m *Memory) SaveGrant(ctx context.Context, grant *Grant) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for i, g := range m.grants {
+		if g.FileID == grant.FileID && g.FolderID == grant.FolderID && g.UserID == grant.UserID {
+			m.grants[i].Access, m.grants[i].GrantedBy = grant.Access, grant.GrantedBy
+			grant.CreatedAt = g.CreatedAt
+			return nil
+		}
+	}
+	grant.CreatedAt = time.Now()
+	m.grants = append(m.grants, *grant)
+	return nil
+}
+
+func (m *Memory) DeleteGrant(ctx context.Context, fileID, folderID, userID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for i, g := range m.grants {
+		if g.FileID == fileID && g.FolderID == folderID && g.UserID == userID {
+			m.grants = append(m.grants[:i], m.grants[i+1:]...)
+			return nil
+		}
+	}
+	return ErrNotFound
+}
+
+func (m *Memory) ListGrants(ctx context.Context, fileID, folderID string) ([]Grant, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var grants []Grant
+	for _, g := range m.grants {
+		if g.FileID == fileID && g.FolderID == folderID {
+			g.Username = m.users[g.UserID]
+			grants = append(grants, g)
+		}
+	}
+	sort.Slice(grants, func(i, j int) bool { return grants[i].Username < grants[j].Username })
+	return grants, nil
+}
@@ -0,0 +1,442 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// fileAccessQuery resolves user $2's access to file $1 while acting in organization $3.
+// Within the file's organization the uploader, owners of enclosing folders and
+// organization owners and admins are owners, and every other member can read.
+// Grants on the file or an enclosing folder apply in any organization.
+const fileAccessQuery = `
+	WITH RECURSIVE ancestors AS (
+		SELECT fo.id, fo.parent_id, fo.user_id
+		FROM folders fo
+		JOIN files f ON f.folder_id = fo.id
+		WHERE f.id = $1
+		UNION ALL
+		SELECT fo.id, fo.parent_id, fo.user_id
+		FROM folders fo
+		JOIN ancestors a ON fo.id = a.parent_id
+	), grants AS (
+		SELECT access FROM file_permissions
+		WHERE user_id = CAST($2 AS INTEGER)
+			AND (file_id = $1 OR folder_id IN (SELECT id FROM ancestors))
+	)
+	SELECT CASE
+		WHEN f.org_id = CAST($3 AS INTEGER) AND (
+			f.user_id = CAST($2 AS INTEGER)
+			OR EXISTS (SELECT 1 FROM ancestors WHERE user_id = CAST($2 AS INTEGER))
+			OR EXISTS (SELECT 1 FROM organization_members m
+				WHERE m.org_id = f.org_id AND m.user_id = CAST($2 AS INTEGER) AND m.role IN ('owner', 'admin'))
+		) THEN 'owner'
+		WHEN EXISTS (SELECT 1 FROM grants WHERE access = 'read_write') THEN 'read_write'
+		WHEN f.org_id = CAST($3 AS INTEGER) OR EXISTS (SELECT 1 FROM grants) THEN 'read'
+		ELSE ''
+	END
+	FROM files f
+	WHERE f.id = $1
+`
+
+// folderAccessQuery resolves user $2's access to folder $1 in organization $3 the same way
+const folderAccessQuery = `
+	WITH RECURSIVE ancestors AS (
+		SELECT id, parent_id, user_id
+		FROM folders
+		WHERE id = $1
+		UNION ALL
+		SELECT fo.id, fo.parent_id, fo.user_id
+		FROM folders fo
+		JOIN ancestors a ON fo.id = a.parent_id
+	), grants AS (
+		SELECT access FROM file_permissions
+		WHERE user_id = CAST($2 AS INTEGER) AND folder_id IN (SELECT id FROM ancestors)
+	)
+	SELECT CASE
+		WHEN fo.org_id = CAST($3 AS INTEGER) AND (
+			EXISTS (SELECT 1 FROM ancestors WHERE user_id = CAST($2 AS INTEGER))
+			OR EXISTS (SELECT 1 FROM organization_members m
+				WHERE m.org_id = fo.org_id AND m.user_id = CAST($2 AS INTEGER) AND m.role IN ('owner', 'admin'))
+		) THEN 'owner'
+		WHEN EXISTS (SELECT 1 FROM grants WHERE access = 'read_write') THEN 'read_write'
+		WHEN fo.org_id = CAST($3 AS INTEGER) OR EXISTS (SELECT 1 FROM grants) THEN 'read'
+		ELSE ''
+	END
+	FROM folders fo
+	WHERE fo.id = $1
+`
+
+// fileColumns are the columns scanned by scanFile
+const fileColumns = `id, filename, content_type, size, user_id, org_id, folder_id, created_at`
+
+// SQL is the FileStore backed by a Postgres or SQLite database. Queries stick
+// to the SQL both understand, so there is one implementation for either driver.
+type SQL struct {
+	db      *sql.DB
+	timeout time.Duration
+}
+
+var _ FileStore = (*SQL)(nil)
+
+// NewSQL returns a store on the database that bounds every query by timeout
+func NewSQL(db *sql.DB, timeout time.Duration) *SQL {
+	return &SQL{db: db, timeout: timeout}
+}
+
+func (p *SQL) withTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	return context.WithTimeout(ctx, p.timeout)
+}
+
+// resource returns the file_permissions column and value naming a file or folder
+func resource(fileID, folderID string) (string, string) {
+	if fileID != "" {
+		return "file_id", fileID
+	}
+	return "folder_id", folderID
+}
+
+// requireRow returns ErrNotFound if a statement changed no rows
+func requireRow(res sql.Result) error {
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// scanner is a *sql.Row or *sql.Rows
+type scanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanFile(row scanner) (*File, error) {
+	var f File
+	var folderID *string
+	err := row.Scan(&f.ID, &f.Filename, &f.ContentType, &f.Size, &f.UserID, &f.OrgID, &folderID, &f.CreatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	if folderID != nil {
+		f.FolderID = *folderID
+	}
+	return &f, nil
+}
+
+func (p *SQL) listFiles(ctx context.Context, query string, args ...interface{}) ([]File, error) {
+	ctx, cancel := p.withTimeout(ctx)
+	defer cancel()
+
+	rows, err := p.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var files []File
+	for rows.Next() {
+		f, err := scanFile(rows)
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, *f)
+	}
+	return files, rows.Err()
+}
+
+func (p *SQL) IsMember(ctx context.Context, orgID, userID string) (bool, error) {
+	ctx, cancel := p.withTimeout(ctx)
+	defer cancel()
+
+	var member bool
+	err := p.db.QueryRowContext(ctx, `
+		SELECT EXISTS (
+			SELECT 1 FROM organization_members
+			WHERE org_id = CAST($1 AS INTEGER) AND user_id = CAST($2 AS INTEGER)
+		)
+	`, orgID, userID).Scan(&member)
+	return member, err
+}
+
+func (p *SQL) SessionActive(ctx context.Context, sessionID, userID string) (bool, error) {
+	ctx, cancel := p.withTimeout(ctx)
+	defer cancel()
+
+	var active bool
+	err := p.db.QueryRowContext(ctx, `
+		SELECT EXISTS (
+			SELECT 1 FROM sessions s
+			JOIN users u ON u.id = s.user_id
+			WHERE s.id = CAST($1 AS INTEGER) AND s.user_id = CAST($2 AS INTEGER)
+				AND s.expires_at > $3 AND u.disabled_at IS NULL AND u.deleted_at IS NULL
+		)
+	`, sessionID, userID, time.Now().UTC()).Scan(&active)
+	return active, err
+}
+
+func (p *SQL) APIKeyActive(ctx context.Context, keyID, userID string) (bool, error) {
+	ctx, cancel := p.withTimeout(ctx)
+	defer cancel()
+
+	var active bool
+	err := p.db.QueryRowContext(ctx, `
+		SELECT EXISTS (
+			SELECT 1 FROM api_keys k
+			JOIN users u ON u.id = k.user_id
+			WHERE k.id = CAST($1 AS INTEGER) AND k.user_id = CAST($2 AS INTEGER)
+				AND k.revoked_at IS NULL AND (k.expires_at IS NULL OR k.expires_at > $3)
+				AND u.disabled_at IS NULL AND u.deleted_at IS NULL
+		)
+	`, keyID, userID, time.Now().UTC()).Scan(&active)
+	return active, err
+}
+
+func (p *SQL) access(ctx context.Context, query, id, userID, orgID string) (string, error) {
+	ctx, cancel := p.withTimeout(ctx)
+	defer cancel()
+
+	var access string
+	err := p.db.QueryRowContext(ctx, query, id, userID, orgID).Scan(&access)
+	if errors.Is(err, sql.ErrNoRows) {
+		return AccessNone, nil
+	}
+	return access, err
+}
+
+func (p *SQL) FileAccess(ctx context.Context, fileID, userID, orgID string) (string, error) {
+	return p.access(ctx, fileAccessQuery, fileID, userID, orgID)
+}
+
+func (p *SQL) FolderAccess(ctx context.Context, folderID, userID, orgID string) (string, error) {
+	return p.access(ctx, folderAccessQuery, folderID, userID, orgID)
+}
+
+func (p *SQL) GetFile(ctx context.Context, fileID string) (*File, error) {
+	ctx, cancel := p.withTimeout(ctx)
+	defer cancel()
+
+	return scanFile(p.db.QueryRowContext(ctx, `SELECT `+fileColumns+` FROM files WHERE id = $1`, fileID))
+}
+
+func (p *SQL) ListOrgFiles(ctx context.Context, orgID string) ([]File, error) {
+	return p.listFiles(ctx, `SELECT `+fileColumns+` FROM files WHERE org_id = CAST($1 AS INTEGER)`, orgID)
+}
+
+func (p *SQL) ListUserFiles(ctx context.Context, userID string) ([]File, error) {
+	return p.listFiles(ctx, `SELECT `+fileColumns+` FROM files WHERE user_id = CAST($1 AS INTEGER)`, userID)
+}
+
+func (p *SQL) ListSharedFiles(ctx context.Context, userID, excludeOrgID string) ([]File, error) {
+	return p.listFiles(ctx, `
+		WITH RECURSIVE shared_folders AS (
+			SELECT folder_id AS id FROM file_permissions
+			WHERE user_id = CAST($1 AS INTEGER) AND folder_id IS NOT NULL
+			UNION
+			SELECT fo.id FROM folders fo
+			JOIN shared_folders sf ON fo.parent_id = sf.id
+		)
+		SELECT `+fileColumns+`
+		FROM files
+		WHERE org_id <> CAST($2 AS INTEGER)
+			AND (folder_id IN (SELECT id FROM shared_folders)
+				OR id IN (SELECT file_id FROM file_permissions WHERE user_id = CAST($1 AS INTEGER)))
+	`, userID, excludeOrgID)
+}
+
+// nullable returns nil for the zero value so it is stored as NULL
+func nullable[T comparable](v T) interface{} {
+	var zero T
+	if v == zero {
+		return nil
+	}
+	return v
+}
+
+func (p *SQL) CreateShareLink(ctx context.Context, link *ShareLink) error {
+	ctx, cancel := p.withTimeout(ctx)
+	defer cancel()
+
+	// SQLite compares timestamps as text, which only orders correctly in one time zone
+	var expiresAt *time.Time
+	if link.ExpiresAt != nil {
+		t := link.ExpiresAt.UTC()
+		expiresAt = &t
+	}
+
+	_, err := p.db.ExecContext(ctx, `
+		INSERT INTO share_links (id, token_hash, file_id, user_id, password_hash, expires_at, max_downloads, created_at)
+		VALUES ($1, $2, $3, CAST($4 AS INTEGER), $5, $6, $7, $8)
+	`, link.ID, link.TokenHash, link.FileID, link.UserID, nullable(link.PasswordHash), expiresAt,
+		nullable(link.MaxDownloads), link.CreatedAt.UTC())
+	return err
+}
+
+func (p *SQL) ListShareLinks(ctx context.Context, userID, orgID string) ([]ShareLink, error) {
+	ctx, cancel := p.withTimeout(ctx)
+	defer cancel()
+
+	rows, err := p.db.QueryContext(ctx, `
+		SELECT s.id, s.file_id, f.filename, s.user_id, COALESCE(s.password_hash, ''),
+			s.expires_at, COALESCE(s.max_downloads, 0), s.download_count, s.created_at
+		FROM share_links s
+		JOIN files f ON f.id = s.file_id
+		WHERE s.user_id = CAST($1 AS INTEGER)
+			AND f.org_id = CAST($2 AS INTEGER)
+			AND s.revoked_at IS NULL
+			AND (s.expires_at IS NULL OR s.expires_at > CURRENT_TIMESTAMP)
+			AND (s.max_downloads IS NULL OR s.download_count < s.max_downloads)
+		ORDER BY s.created_at DESC
+	`, userID, orgID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var links []ShareLink
+	for rows.Next() {
+		var l ShareLink
+		err := rows.Scan(&l.ID, &l.FileID, &l.Filename, &l.UserID, &l.PasswordHash,
+			&l.ExpiresAt, &l.MaxDownloads, &l.DownloadCount, &l.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		links = append(links, l)
+	}
+	return links, rows.Err()
+}
+
+func (p *SQL) RevokeShareLink(ctx context.Context, id, userID string) error {
+	ctx, cancel := p.withTimeout(ctx)
+	defer cancel()
+
+	res, err := p.db.ExecContext(ctx, `
+		UPDATE share_links SET revoked_at = CURRENT_TIMESTAMP
+		WHERE id = $1 AND user_id = CAST($2 AS INTEGER) AND revoked_at IS NULL
+	`, id, userID)
+	if err != nil {
+		return err
+	}
+	return requireRow(res)
+}
+
+func (p *SQL) GetShareLink(ctx context.Context, tokenHash string) (*ShareLink, *File, error) {
+	ctx, cancel := p.withTimeout(ctx)
+	defer cancel()
+
+	var l ShareLink
+	var f File
+	var folderID *string
+	err := p.db.QueryRowContext(ctx, `
+		SELECT s.id, s.token_hash, s.user_id, COALESCE(s.password_hash, ''), s.expires_at,
+			COALESCE(s.max_downloads, 0), s.download_count, s.created_at,
+			f.id, f.filename, f.content_type, f.size, f.user_id, f.org_id, f.folder_id, f.created_at
+		FROM share_links s
+		JOIN files f ON f.id = s.file_id
+		WHERE s.token_hash = $1
+			AND s.revoked_at IS NULL
+			AND (s.expires_at IS NULL OR s.expires_at > CURRENT_TIMESTAMP)
+	`, tokenHash).Scan(&l.ID, &l.TokenHash, &l.UserID, &l.PasswordHash, &l.ExpiresAt,
+		&l.MaxDownloads, &l.DownloadCount, &l.CreatedAt,
+		&f.ID, &f.Filename, &f.ContentType, &f.Size, &f.UserID, &f.OrgID, &folderID, &f.CreatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	if folderID != nil {
+		f.FolderID = *folderID
+	}
+	l.FileID, l.Filename = f.ID, f.Filename
+	return &l, &f, nil
+}
+
+func (p *SQL) RecordShareDownload(ctx context.Context, id string) (bool, error) {
+	ctx, cancel := p.withTimeout(ctx)
+	defer cancel()
+
+	// Refuse the download atomically once the limit is reached
+	res, err := p.db.ExecContext(ctx, `
+		UPDATE share_links SET download_count = download_count + 1
+		WHERE id = $1 AND (max_downloads IS NULL OR download_count < max_downloads)
+	`, id)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+func (p *SQL) UserIDByUsername(ctx context.Context, username string) (string, error) {
+	ctx, cancel := p.withTimeout(ctx)
+	defer cancel()
+
+	var id string
+	err := p.db.QueryRowContext(ctx, "SELECT id FROM users WHERE username = $1", username).Scan(&id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", ErrNotFound
+	}
+	return id, err
+}
+
+func (p *SQL) SaveGrant(ctx context.Context, grant *Grant) error {
+	ctx, cancel := p.withTimeout(ctx)
+	defer cancel()
+
+	column, id := resource(grant.FileID, grant.FolderID)
+	return p.db.QueryRowContext(ctx, `
+		INSERT INTO file_permissions (`+column+`, user_id, access, granted_by)
+		VALUES ($1, CAST($2 AS INTEGER), $3, CAST($4 AS INTEGER))
+		ON CONFLICT (`+column+`, user_id) DO UPDATE SET access = EXCLUDED.access, granted_by = EXCLUDED.granted_by
+		RETURNING created_at
+	`, id, grant.UserID, grant.Access, grant.GrantedBy).Scan(&grant.CreatedAt)
+}
+
+func (p *SQL) DeleteGrant(ctx context.Context, fileID, folderID, userID string) error {
+	ctx, cancel := p.withTimeout(ctx)
+	defer cancel()
+
+	column, id := resource(fileID, folderID)
+	res, err := p.db.ExecContext(ctx,
+		"DELETE FROM file_permissions WHERE "+column+" = $1 AND user_id = CAST($2 AS INTEGER)", id, userID)
+	if err != nil {
+		return err
+	}
+	return requireRow(res)
+}
+
+func (p *SQL) ListGrants(ctx context.Context, fileID, folderID string) ([]Grant, error) {
+	ctx, cancel := p.withTimeout(ctx)
+	defer cancel()
+
+	column, id := resource(fileID, folderID)
+	rows, err := p.db.QueryContext(ctx, `
+		SELECT p.user_id, u.username, p.access, p.granted_by, p.created_at
+		FROM file_permissions p
+		JOIN users u ON u.id = p.user_id
+		WHERE p.`+column+` = $1
+		ORDER BY u.username
+	`, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var grants []Grant
+	for rows.Next() {
+		g := Grant{FileID: fileID, FolderID: folderID}
+		if err := rows.Scan(&g.UserID, &g.Username, &g.Access, &g.GrantedBy, &g.CreatedAt); err != nil {
+			return nil, err
+		}
+		grants = append(grants, g)
+	}
+	return grants, rows.Err()
+}
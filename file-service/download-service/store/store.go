@@ -0,0 +1,103 @@
+// Package store holds the file metadata repository used by the download service,
+// with a SQL implementation for Postgres or SQLite and an in-memory one for tests.
+package store
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// ErrNotFound is returned when the requested row does not exist
+var ErrNotFound = errors.New("not found")
+
+// Access levels a user can hold on a file or folder
+const (
+	AccessNone      = ""
+	AccessRead      = "read"
+	AccessReadWrite = "read_write"
+	AccessOwner     = "owner"
+)
+
+// File is the stored metadata of an uploaded file
+type File struct {
+	ID          string
+	Filename    string
+	ContentType string
+	Size        int64
+	UserID      string
+	OrgID       string
+	FolderID    string // Empty for files outside any folder
+	CreatedAt   time.Time
+}
+
+// ShareLink is a public link to a file. Zero values of PasswordHash, ExpiresAt
+// and MaxDownloads mean no such restriction.
+type ShareLink struct {
+	ID            string
+	TokenHash     string
+	FileID        string
+	Filename      string // Filled in when listing
+	UserID        string
+	PasswordHash  string
+	ExpiresAt     *time.Time
+	MaxDownloads  int32
+	DownloadCount int32
+	CreatedAt     time.Time
+}
+
+// Grant gives a user access to either a file or a folder
+type Grant struct {
+	FileID    string
+	FolderID  string
+	UserID    string
+	Username  string // Filled in when listing
+	Access    string
+	GrantedBy string
+	CreatedAt time.Time
+}
+
+// FileStore is the data the download service reads and manages. Methods taking
+// a fileID and a folderID act on whichever of the two is set.
+type FileStore interface {
+	// IsMember reports whether the user belongs to the organization
+	IsMember(ctx context.Context, orgID, userID string) (bool, error)
+	// SessionActive reports whether the user's login session has neither been
+	// logged out nor expired, and the user is neither disabled nor deleting
+	// their account
+	SessionActive(ctx context.Context, sessionID, userID string) (bool, error)
+	// APIKeyActive reports whether the user's API key is neither revoked nor
+	// expired, and the user is neither disabled nor deleting their account
+	APIKeyActive(ctx context.Context, keyID, userID string) (bool, error)
+	// FileAccess returns the user's access to a file while acting in orgID,
+	// AccessNone if the file does not exist or the user cannot see it
+	FileAccess(ctx context.Context, fileID, userID, orgID string) (string, error)
+	// FolderAccess is FileAccess for folders
+	FolderAccess(ctx context.Context, folderID, userID, orgID string) (string, error)
+
+	GetFile(ctx context.Context, fileID string) (*File, error)
+	// ListOrgFiles returns the files owned by an organization
+	ListOrgFiles(ctx context.Context, orgID string) ([]File, error)
+	// ListUserFiles returns the files the user uploaded, in every organization
+	ListUserFiles(ctx context.Context, userID string) ([]File, error)
+	// ListSharedFiles returns files outside excludeOrgID granted to the user,
+	// directly or through a folder or any of its parents
+	ListSharedFiles(ctx context.Context, userID, excludeOrgID string) ([]File, error)
+
+	CreateShareLink(ctx context.Context, link *ShareLink) error
+	// ListShareLinks returns the user's usable links to files in the organization
+	ListShareLinks(ctx context.Context, userID, orgID string) ([]ShareLink, error)
+	// RevokeShareLink disables one of the user's links
+	RevokeShareLink(ctx context.Context, id, userID string) error
+	// GetShareLink returns an unrevoked, unexpired link and its file by token hash
+	GetShareLink(ctx context.Context, tokenHash string) (*ShareLink, *File, error)
+	// RecordShareDownload counts a download, returning false once the limit is reached
+	RecordShareDownload(ctx context.Context, id string) (bool, error)
+
+	// UserIDByUsername looks up a user to share with
+	UserIDByUsername(ctx context.Context, username string) (string, error)
+	// SaveGrant creates a grant or replaces the access of an existing one, setting CreatedAt
+	SaveGrant(ctx context.Context, grant *Grant) error
+	DeleteGrant(ctx context.Context, fileID, folderID, userID string) error
+	ListGrants(ctx context.Context, fileID, folderID string) ([]Grant, error)
+}
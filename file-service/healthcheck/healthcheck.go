@@ -0,0 +1,140 @@
+// Package healthcheck reports whether the servers and their dependencies are
+// usable. Checks back echo-api's /readyz and the grpc.health.v1 status of the
+// file services, and probes back each binary's healthcheck subcommand.
+package healthcheck
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+// Timeout bounds one round of checks
+const Timeout = 5 * time.Second
+
+// interval is how often Watch re-runs its checks
+const interval = 10 * time.Second
+
+// Check reports whether a dependency is usable
+type Check func(ctx context.Context) error
+
+// Database checks that db answers a ping
+func Database(db *sql.DB) Check {
+	return db.PingContext
+}
+
+// Writable checks that files can be created in dir
+func Writable(dir string) Check {
+	return func(ctx context.Context) error {
+		f, err := os.CreateTemp(dir, ".healthcheck-*")
+		if err != nil {
+			return err
+		}
+		f.Close()
+		return os.Remove(f.Name())
+	}
+}
+
+// Readable checks that dir can be listed
+func Readable(dir string) Check {
+	return func(ctx context.Context) error {
+		f, err := os.Open(dir)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		if _, err := f.Readdirnames(1); err != nil && !errors.Is(err, io.EOF) {
+			return err
+		}
+		return nil
+	}
+}
+
+// GRPC checks that the server on conn reports service, "" for the server as a
+// whole, as SERVING over the standard health protocol
+func GRPC(conn grpc.ClientConnInterface, service string) Check {
+	return func(ctx context.Context) error {
+		resp, err := healthpb.NewHealthClient(conn).Check(ctx, &healthpb.HealthCheckRequest{Service: service})
+		if err != nil {
+			return err
+		}
+		if resp.Status != healthpb.HealthCheckResponse_SERVING {
+			return fmt.Errorf("status %s", resp.Status)
+		}
+		return nil
+	}
+}
+
+// Run runs checks concurrently and returns each one's error, nil when it passed
+func Run(ctx context.Context, checks map[string]Check) map[string]error {
+	ctx, cancel := context.WithTimeout(ctx, Timeout)
+	defer cancel()
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	results := make(map[string]error, len(checks))
+	for name, check := range checks {
+		wg.Add(1)
+		go func(name string, check Check) {
+			defer wg.Done()
+			err := check(ctx)
+			mu.Lock()
+			results[name] = err
+			mu.Unlock()
+		}(name, check)
+	}
+	wg.Wait()
+	return results
+}
+
+// Watch runs checks until ctx is done, publishing each one's status on hs under
+// its name and their combined status under "" and each of services. Once hs is
+// shut down for draining, its statuses no longer change.
+func Watch(ctx context.Context, hs *health.Server, checks map[string]Check, services ...string) {
+	failing := map[string]bool{}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		overall := healthpb.HealthCheckResponse_SERVING
+		for name, err := range Run(ctx, checks) {
+			status := healthpb.HealthCheckResponse_SERVING
+			if err != nil {
+				status = healthpb.HealthCheckResponse_NOT_SERVING
+				overall = status
+			}
+			if failed := err != nil; failed != failing[name] {
+				failing[name] = failed
+				if failed {
+					logger().Warn("Health check failing", "check", name, "error", err)
+				} else {
+					logger().Info("Health check recovered", "check", name)
+				}
+			}
+			hs.SetServingStatus(name, status)
+		}
+		for _, service := range append([]string{""}, services...) {
+			hs.SetServingStatus(service, overall)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// logger returns the default logger for the health component
+func logger() *slog.Logger {
+	return slog.With("component", "health")
+}
@@ -0,0 +1,154 @@
+// Package logging sets up the structured logs of echo-api and the file
+// services. Records are JSON or text, each component logs at its own level, the
+// request ID and trace ID of the request being handled are added from the
+// context, and credentials and personal data are redacted.
+package logging
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"regexp"
+	"strings"
+	"sync/atomic"
+
+	"go.opentelemetry.io/otel/trace"
+
+	"file-service/config"
+)
+
+// output is where records go and the levels they are filtered at
+type output struct {
+	handler slog.Handler
+	level   slog.Level
+	levels  map[string]slog.Level
+}
+
+// current is the output installed by Setup; until then records go to stderr as text
+var current atomic.Pointer[output]
+
+func init() {
+	current.Store(&output{handler: slog.NewTextHandler(os.Stderr, nil), level: slog.LevelInfo})
+}
+
+// Setup installs the configured output for the named service and makes it the
+// default slog logger. The standard log package writes through it too.
+func Setup(service string, cfg config.Log) error {
+	level, levels, err := cfg.ParseLevels()
+	if err != nil {
+		return err
+	}
+
+	// Filtering is done per component by handler, so the output takes every level
+	opts := &slog.HandlerOptions{Level: slog.LevelDebug, ReplaceAttr: redact}
+	var h slog.Handler = slog.NewJSONHandler(os.Stderr, opts)
+	if cfg.Format == config.LogText {
+		h = slog.NewTextHandler(os.Stderr, opts)
+	}
+	h = h.WithAttrs([]slog.Attr{slog.String("service", service)})
+
+	current.Store(&output{handler: h, level: level, levels: levels})
+	slog.SetDefault(slog.New(&handler{}))
+	return nil
+}
+
+// For returns the logger of a component, whose level can be set on its own
+// with log.levels. It may be called before Setup.
+func For(component string) *slog.Logger {
+	return slog.New(&handler{component: component})
+}
+
+// Fatal logs a failure to start and exits
+func Fatal(msg string, err error) {
+	slog.Error(msg, "error", err)
+	os.Exit(1)
+}
+
+// handler filters records by the level of their component and passes them to
+// the current output with the request and trace IDs of their context. A
+// "component" attribute added with With names the component, so loggers derived
+// from the default one have levels too.
+type handler struct {
+	component string
+	// derive replays the attributes and groups added to the logger onto the output
+	derive []func(slog.Handler) slog.Handler
+}
+
+func (h *handler) Enabled(_ context.Context, level slog.Level) bool {
+	out := current.Load()
+	min, ok := out.levels[h.component]
+	if !ok {
+		min = out.level
+	}
+	return level >= min
+}
+
+func (h *handler) Handle(ctx context.Context, r slog.Record) error {
+	if id := RequestID(ctx); id != "" {
+		r.AddAttrs(slog.String("request_id", id))
+	}
+	if span := trace.SpanContextFromContext(ctx); span.IsValid() {
+		r.AddAttrs(slog.String("trace_id", span.TraceID().String()))
+	}
+
+	out := current.Load().handler
+	if h.component != "" {
+		out = out.WithAttrs([]slog.Attr{slog.String("component", h.component)})
+	}
+	for _, derive := range h.derive {
+		out = derive(out)
+	}
+	return out.Handle(ctx, r)
+}
+
+func (h *handler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	next := &handler{component: h.component, derive: h.derive}
+	var rest []slog.Attr
+	for _, a := range attrs {
+		if a.Key == "component" && len(h.derive) == 0 {
+			next.component = a.Value.String()
+			continue
+		}
+		rest = append(rest, a)
+	}
+	if len(rest) > 0 {
+		next.derive = append(h.derive[:len(h.derive):len(h.derive)], func(out slog.Handler) slog.Handler {
+			return out.WithAttrs(rest)
+		})
+	}
+	return next
+}
+
+func (h *handler) WithGroup(name string) slog.Handler {
+	return &handler{component: h.component, derive: append(h.derive[:len(h.derive):len(h.derive)], func(out slog.Handler) slog.Handler {
+		return out.WithGroup(name)
+	})}
+}
+
+// redacted replaces the values of sensitive attributes
+const redacted = "[REDACTED]"
+
+// sensitiveKeys are the attribute names, or parts of them, whose values are never logged
+var sensitiveKeys = []string{"password", "token", "secret", "authorization", "cookie", "signature", "email", "username"}
+
+// credentials matches bearer tokens and JWTs that end up inside messages and errors
+var credentials = regexp.MustCompile(`(?i)bearer\s+[^\s"]+|eyJ[\w-]+\.[\w-]+\.[\w-]*`)
+
+// redact hides the values of sensitive attributes and credentials found in
+// strings and errors
+func redact(_ []string, a slog.Attr) slog.Attr {
+	key := strings.ToLower(a.Key)
+	for _, k := range sensitiveKeys {
+		if strings.Contains(key, k) {
+			return slog.String(a.Key, redacted)
+		}
+	}
+
+	switch v := a.Value.Any().(type) {
+	case string:
+		a.Value = slog.StringValue(credentials.ReplaceAllString(v, redacted))
+	case error:
+		a.Value = slog.StringValue(credentials.ReplaceAllString(v.Error(), redacted))
+	}
+	return a
+}
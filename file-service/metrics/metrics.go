@@ -0,0 +1,87 @@
+// Package metrics defines the Prometheus metrics shared by echo-api and the file
+// services and serves them for scraping. Labels only take values from fixed
+// sets, such as route templates, RPC methods and status codes, so that the
+// number of series stays bounded.
+package metrics
+
+import (
+	"database/sql"
+	"errors"
+	"log/slog"
+	"net/http"
+	"os"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Directions of a file transfer
+const (
+	Upload   = "upload"
+	Download = "download"
+)
+
+var (
+	// TransferredBytes counts file bytes received by the upload service and sent by the download service
+	TransferredBytes = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "file_transfer_bytes_total",
+		Help: "File bytes uploaded or downloaded.",
+	}, []string{"direction"})
+
+	// ChunkSize is the size of the chunks files are streamed in
+	ChunkSize = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "file_transfer_chunk_bytes",
+		Help:    "Size of the chunks files are streamed in.",
+		Buckets: prometheus.ExponentialBuckets(1024, 4, 8), // 1KiB to 16MiB
+	}, []string{"direction"})
+
+	// AuthFailures counts rejected credentials by the server that rejected them
+	AuthFailures = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "auth_failures_total",
+		Help: "Requests rejected for missing, invalid or insufficient credentials.",
+	}, []string{"server", "reason"})
+)
+
+// CountAuthFailure counts err if it rejects the caller's credentials
+func CountAuthFailure(server string, err error) {
+	switch status.Code(err) {
+	case codes.Unauthenticated:
+		AuthFailures.WithLabelValues(server, "unauthenticated").Inc()
+	case codes.PermissionDenied:
+		AuthFailures.WithLabelValues(server, "permission_denied").Inc()
+	}
+}
+
+// RegisterDB exports the connection pool statistics of db under the given name
+func RegisterDB(db *sql.DB, name string) {
+	prometheus.MustRegister(collectors.NewDBStatsCollector(db, name))
+}
+
+// Handler serves the metrics in the Prometheus text format
+func Handler() http.Handler {
+	return promhttp.Handler()
+}
+
+// Serve serves the metrics on addr until the returned server is closed
+func Serve(addr string) *http.Server {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", Handler())
+	srv := &http.Server{Addr: addr, Handler: mux}
+	go func() {
+		logger().Info("Metrics listening", "addr", addr)
+		if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			logger().Error("Failed to serve metrics", "error", err)
+			os.Exit(1)
+		}
+	}()
+	return srv
+}
+
+// logger returns the default logger for the metrics component
+func logger() *slog.Logger {
+	return slog.With("component", "metrics")
+}
@@ -0,0 +1,63 @@
+package metrics
+
+import (
+	"os"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// storageRefresh is how long a storage scan is reused, so scrapes stay cheap
+const storageRefresh = time.Minute
+
+// storageUsage scans the upload directory at most once per storageRefresh
+type storageUsage struct {
+	dir     string
+	mu      sync.Mutex
+	scanned time.Time
+	bytes   float64
+	files   float64
+}
+
+// RegisterStorage exports the bytes and number of files stored in dir
+func RegisterStorage(dir string) {
+	u := &storageUsage{dir: dir}
+	promauto.NewGaugeFunc(prometheus.GaugeOpts{
+		Name: "storage_used_bytes",
+		Help: "Bytes of stored files.",
+	}, func() float64 { bytes, _ := u.get(); return bytes })
+	promauto.NewGaugeFunc(prometheus.GaugeOpts{
+		Name: "storage_files",
+		Help: "Number of stored files.",
+	}, func() float64 { _, files := u.get(); return files })
+}
+
+// get returns the stored bytes and number of files
+func (u *storageUsage) get() (float64, float64) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	if time.Since(u.scanned) < storageRefresh {
+		return u.bytes, u.files
+	}
+
+	// Files are stored flat under the directory; staging files live in a subdirectory
+	entries, err := os.ReadDir(u.dir)
+	if err != nil {
+		logger().Warn("Failed to scan storage", "error", err)
+		return u.bytes, u.files
+	}
+	u.bytes, u.files = 0, 0
+	for _, entry := range entries {
+		if !entry.Type().IsRegular() {
+			continue
+		}
+		if info, err := entry.Info(); err == nil {
+			u.bytes += float64(info.Size())
+			u.files++
+		}
+	}
+	u.scanned = time.Now()
+	return u.bytes, u.files
+}
@@ -0,0 +1,466 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.2.0
+// - protoc             v5.29.3
+// source: download/file.proto
+
+package download
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.32.0 or later.
+const _ = grpc.SupportPackageIsVersion7
+
+// FileDownloadClient is the client API for FileDownload service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type FileDownloadClient interface {
+	// DownloadFile streams a file in chunks
+	DownloadFile(ctx context.Context, in *DownloadFileRequest, opts ...grpc.CallOption) (FileDownload_DownloadFileClient, error)
+	// ListFiles returns metadata for all files in the user's organization
+	ListFiles(ctx context.Context, in *ListFilesRequest, opts ...grpc.CallOption) (*ListFilesResponse, error)
+	// CreateShareLink creates a public link to a file owned by the user
+	CreateShareLink(ctx context.Context, in *CreateShareLinkRequest, opts ...grpc.CallOption) (*ShareLink, error)
+	// ListShareLinks returns the user's active share links
+	ListShareLinks(ctx context.Context, in *ListShareLinksRequest, opts ...grpc.CallOption) (*ListShareLinksResponse, error)
+	// RevokeShareLink disables a share link owned by the user
+	RevokeShareLink(ctx context.Context, in *RevokeShareLinkRequest, opts ...grpc.CallOption) (*RevokeShareLinkResponse, error)
+	// DownloadSharedFile streams a file through a share link, no JWT required
+	DownloadSharedFile(ctx context.Context, in *DownloadSharedFileRequest, opts ...grpc.CallOption) (FileDownload_DownloadSharedFileClient, error)
+	// GrantAccess gives another user read or read-write access to a file or folder
+	GrantAccess(ctx context.Context, in *GrantAccessRequest, opts ...grpc.CallOption) (*Grant, error)
+	// RevokeAccess removes a user's access to a file or folder
+	RevokeAccess(ctx context.Context, in *RevokeAccessRequest, opts ...grpc.CallOption) (*RevokeAccessResponse, error)
+	// ListGrants returns the users a file or folder is shared with
+	ListGrants(ctx context.Context, in *ListGrantsRequest, opts ...grpc.CallOption) (*ListGrantsResponse, error)
+}
+
+type fileDownloadClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewFileDownloadClient(cc grpc.ClientConnInterface) FileDownloadClient {
+	return &fileDownloadClient{cc}
+}
+
+func (c *fileDownloadClient) DownloadFile(ctx context.Context, in *DownloadFileRequest, opts ...grpc.CallOption) (FileDownload_DownloadFileClient, error) {
+	stream, err := c.cc.NewStream(ctx, &FileDownload_ServiceDesc.Streams[0], "/filedownload.FileDownload/DownloadFile", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &fileDownloadDownloadFileClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type FileDownload_DownloadFileClient interface {
+	Recv() (*DownloadFileResponse, error)
+	grpc.ClientStream
+}
+
+type fileDownloadDownloadFileClient struct {
+	grpc.ClientStream
+}
+
+func (x *fileDownloadDownloadFileClient) Recv() (*DownloadFileResponse, error) {
+	m := new(DownloadFileResponse)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *fileDownloadClient) ListFiles(ctx context.Context, in *ListFilesRequest, opts ...grpc.CallOption) (*ListFilesResponse, error) {
+	out := new(ListFilesResponse)
+	err := c.cc.Invoke(ctx, "/filedownload.FileDownload/ListFiles", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *fileDownloadClient) CreateShareLink(ctx context.Context, in *CreateShareLinkRequest, opts ...grpc.CallOption) (*ShareLink, error) {
+	out := new(ShareLink)
+	err := c.cc.Invoke(ctx, "/filedownload.FileDownload/CreateShareLink", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *fileDownloadClient) ListShareLinks(ctx context.Context, in *ListShareLinksRequest, opts ...grpc.CallOption) (*ListShareLinksResponse, error) {
+	out := new(ListShareLinksResponse)
+	err := c.cc.Invoke(ctx, "/filedownload.FileDownload/ListShareLinks", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *fileDownloadClient) RevokeShareLink(ctx context.Context, in *RevokeShareLinkRequest, opts ...grpc.CallOption) (*RevokeShareLinkResponse, error) {
+	out := new(RevokeShareLinkResponse)
+	err := c.cc.Invoke(ctx, "/filedownload.FileDownload/RevokeShareLink", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *fileDownloadClient) DownloadSharedFile(ctx context.Context, in *DownloadSharedFileRequest, opts ...grpc.CallOption) (FileDownload_DownloadSharedFileClient, error) {
+	stream, err := c.cc.NewStream(ctx, &FileDownload_ServiceDesc.Streams[1], "/filedownload.FileDownload/DownloadSharedFile", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &fileDownloadDownloadSharedFileClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type FileDownload_DownloadSharedFileClient interface {
+	Recv() (*DownloadFileResponse, error)
+	grpc.ClientStream
+}
+
+type fileDownloadDownloadSharedFileClient struct {
+	grpc.ClientStream
+}
+
+func (x *fileDownloadDownloadSharedFileClient) Recv() (*DownloadFileResponse, error) {
+	m := new(DownloadFileResponse)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *fileDownloadClient) GrantAccess(ctx context.Context, in *GrantAccessRequest, opts ...grpc.CallOption) (*Grant, error) {
+	out := new(Grant)
+	err := c.cc.Invoke(ctx, "/filedownload.FileDownload/GrantAccess", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *fileDownloadClient) RevokeAccess(ctx context.Context, in *RevokeAccessRequest, opts ...grpc.CallOption) (*RevokeAccessResponse, error) {
+	out := new(RevokeAccessResponse)
+	err := c.cc.Invoke(ctx, "/filedownload.FileDownload/RevokeAccess", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *fileDownloadClient) ListGrants(ctx context.Context, in *ListGrantsRequest, opts ...grpc.CallOption) (*ListGrantsResponse, error) {
+	out := new(ListGrantsResponse)
+	err := c.cc.Invoke(ctx, "/filedownload.FileDownload/ListGrants", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// FileDownloadServer is the server API for FileDownload service.
+// All implementations must embed UnimplementedFileDownloadServer
+// for forward compatibility
+type FileDownloadServer interface {
+	// DownloadFile streams a file in chunks
+	DownloadFile(*DownloadFileRequest, FileDownload_DownloadFileServer) error
+	// ListFiles returns metadata for all files in the user's organization
+	ListFiles(context.Context, *ListFilesRequest) (*ListFilesResponse, error)
+	// CreateShareLink creates a public link to a file owned by the user
+	CreateShareLink(context.Context, *CreateShareLinkRequest) (*ShareLink, error)
+	// ListShareLinks returns the user's active share links
+	ListShareLinks(context.Context, *ListShareLinksRequest) (*ListShareLinksResponse, error)
+	// RevokeShareLink disables a share link owned by the user
+	RevokeShareLink(context.Context, *RevokeShareLinkRequest) (*RevokeShareLinkResponse, error)
+	// DownloadSharedFile streams a file through a share link, no JWT required
+	DownloadSharedFile(*DownloadSharedFileRequest, FileDownload_DownloadSharedFileServer) error
+	// GrantAccess gives another user read or read-write access to a file or folder
+	GrantAccess(context.Context, *GrantAccessRequest) (*Grant, error)
+	// RevokeAccess removes a user's access to a file or folder
+	RevokeAccess(context.Context, *RevokeAccessRequest) (*RevokeAccessResponse, error)
+	// ListGrants returns the users a file or folder is shared with
+	ListGrants(context.Context, *ListGrantsRequest) (*ListGrantsResponse, error)
+	mustEmbedUnimplementedFileDownloadServer()
+}
+
+// UnimplementedFileDownloadServer must be embedded to have forward compatible implementations.
+type UnimplementedFileDownloadServer struct {
+}
+
+func (UnimplementedFileDownloadServer) DownloadFile(*DownloadFileRequest, FileDownload_DownloadFileServer) error {
+	return status.Errorf(codes.Unimplemented, "method DownloadFile not implemented")
+}
+func (UnimplementedFileDownloadServer) ListFiles(context.Context, *ListFilesRequest) (*ListFilesResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListFiles not implemented")
+}
+func (UnimplementedFileDownloadServer) CreateShareLink(context.Context, *CreateShareLinkRequest) (*ShareLink, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method CreateShareLink not implemented")
+}
+func (UnimplementedFileDownloadServer) ListShareLinks(context.Context, *ListShareLinksRequest) (*ListShareLinksResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListShareLinks not implemented")
+}
+func (UnimplementedFileDownloadServer) RevokeShareLink(context.Context, *RevokeShareLinkRequest) (*RevokeShareLinkResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method RevokeShareLink not implemented")
+}
+func (UnimplementedFileDownloadServer) DownloadSharedFile(*DownloadSharedFileRequest, FileDownload_DownloadSharedFileServer) error {
+	return status.Errorf(codes.Unimplemented, "method DownloadSharedFile not implemented")
+}
+func (UnimplementedFileDownloadServer) GrantAccess(context.Context, *GrantAccessRequest) (*Grant, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GrantAccess not implemented")
+}
+func (UnimplementedFileDownloadServer) RevokeAccess(context.Context, *RevokeAccessRequest) (*RevokeAccessResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method RevokeAccess not implemented")
+}
+func (UnimplementedFileDownloadServer) ListGrants(context.Context, *ListGrantsRequest) (*ListGrantsResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListGrants not implemented")
+}
+func (UnimplementedFileDownloadServer) mustEmbedUnimplementedFileDownloadServer() {}
+
+// UnsafeFileDownloadServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to FileDownloadServer will
+// result in compilation errors.
+type UnsafeFileDownloadServer interface {
+	mustEmbedUnimplementedFileDownloadServer()
+}
+
+func RegisterFileDownloadServer(s grpc.ServiceRegistrar, srv FileDownloadServer) {
+	s.RegisterService(&FileDownload_ServiceDesc, srv)
+}
+
+func _FileDownload_DownloadFile_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(DownloadFileRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(FileDownloadServer).DownloadFile(m, &fileDownloadDownloadFileServer{stream})
+}
+
+type FileDownload_DownloadFileServer interface {
+	Send(*DownloadFileResponse) error
+	grpc.ServerStream
+}
+
+type fileDownloadDownloadFileServer struct {
+	grpc.ServerStream
+}
+
+func (x *fileDownloadDownloadFileServer) Send(m *DownloadFileResponse) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func _FileDownload_ListFiles_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListFilesRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(FileDownloadServer).ListFiles(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/filedownload.FileDownload/ListFiles",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(FileDownloadServer).ListFiles(ctx, req.(*ListFilesRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _FileDownload_CreateShareLink_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(CreateShareLinkRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(FileDownloadServer).CreateShareLink(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/filedownload.FileDownload/CreateShareLink",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(FileDownloadServer).CreateShareLink(ctx, req.(*CreateShareLinkRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _FileDownload_ListShareLinks_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListShareLinksRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(FileDownloadServer).ListShareLinks(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/filedownload.FileDownload/ListShareLinks",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(FileDownloadServer).ListShareLinks(ctx, req.(*ListShareLinksRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _FileDownload_RevokeShareLink_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(RevokeShareLinkRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(FileDownloadServer).RevokeShareLink(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/filedownload.FileDownload/RevokeShareLink",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(FileDownloadServer).RevokeShareLink(ctx, req.(*RevokeShareLinkRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _FileDownload_DownloadSharedFile_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(DownloadSharedFileRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(FileDownloadServer).DownloadSharedFile(m, &fileDownloadDownloadSharedFileServer{stream})
+}
+
+type FileDownload_DownloadSharedFileServer interface {
+	Send(*DownloadFileResponse) error
+	grpc.ServerStream
+}
+
+type fileDownloadDownloadSharedFileServer struct {
+	grpc.ServerStream
+}
+
+func (x *fileDownloadDownloadSharedFileServer) Send(m *DownloadFileResponse) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func _FileDownload_GrantAccess_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GrantAccessRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(FileDownloadServer).GrantAccess(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/filedownload.FileDownload/GrantAccess",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(FileDownloadServer).GrantAccess(ctx, req.(*GrantAccessRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _FileDownload_RevokeAccess_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(RevokeAccessRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(FileDownloadServer).RevokeAccess(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/filedownload.FileDownload/RevokeAccess",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(FileDownloadServer).RevokeAccess(ctx, req.(*RevokeAccessRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _FileDownload_ListGrants_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListGrantsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(FileDownloadServer).ListGrants(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/filedownload.FileDownload/ListGrants",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(FileDownloadServer).ListGrants(ctx, req.(*ListGrantsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+// FileDownload_ServiceDesc is the grpc.ServiceDesc for FileDownload service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var FileDownload_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "filedownload.FileDownload",
+	HandlerType: (*FileDownloadServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "ListFiles",
+			Handler:    _FileDownload_ListFiles_Handler,
+		},
+		{
+			MethodName: "CreateShareLink",
+			Handler:    _FileDownload_CreateShareLink_Handler,
+		},
+		{
+			MethodName: "ListShareLinks",
+			Handler:    _FileDownload_ListShareLinks_Handler,
+		},
+		{
+			MethodName: "RevokeShareLink",
+			Handler:    _FileDownload_RevokeShareLink_Handler,
+		},
+		{
+			MethodName: "GrantAccess",
+			Handler:    _FileDownload_GrantAccess_Handler,
+		},
+		{
+			MethodName: "RevokeAccess",
+			Handler:    _FileDownload_RevokeAccess_Handler,
+		},
+		{
+			MethodName: "ListGrants",
+			Handler:    _FileDownload_ListGrants_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "DownloadFile",
+			Handler:       _FileDownload_DownloadFile_Handler,
+			ServerStreams: true,
+		},
+		{
+			StreamName:    "DownloadSharedFile",
+			Handler:       _FileDownload_DownloadSharedFile_Handler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "download/file.proto",
+}
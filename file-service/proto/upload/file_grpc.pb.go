@@ -2,7 +2,7 @@
 // versions:
 // - protoc-gen-go-grpc v1.2.0
 // - protoc             v5.29.3
-// source: proto/upload/file.proto
+// source: upload/file.proto
 
 package upload
 
@@ -26,6 +26,12 @@ type FileUploadClient interface {
 	UploadFile(ctx context.Context, opts ...grpc.CallOption) (FileUpload_UploadFileClient, error)
 	// GetFileMetadata returns metadata for a specific file
 	GetFileMetadata(ctx context.Context, in *GetFileMetadataRequest, opts ...grpc.CallOption) (*FileMetadata, error)
+	// GetStorageUsage returns the caller's used and remaining storage
+	GetStorageUsage(ctx context.Context, in *GetStorageUsageRequest, opts ...grpc.CallOption) (*StorageUsage, error)
+	// CreateFolder creates a folder, optionally inside one the user can write to
+	CreateFolder(ctx context.Context, in *CreateFolderRequest, opts ...grpc.CallOption) (*Folder, error)
+	// ReleaseUserFiles transfers or deletes the caller's files before their account is deleted
+	ReleaseUserFiles(ctx context.Context, in *ReleaseUserFilesRequest, opts ...grpc.CallOption) (*ReleaseUserFilesResponse, error)
 }
 
 type fileUploadClient struct {
@@ -79,6 +85,33 @@ func (c *fileUploadClient) GetFileMetadata(ctx context.Context, in *GetFileMetad
 	return out, nil
 }
 
+func (c *fileUploadClient) GetStorageUsage(ctx context.Context, in *GetStorageUsageRequest, opts ...grpc.CallOption) (*StorageUsage, error) {
+	out := new(StorageUsage)
+	err := c.cc.Invoke(ctx, "/fileupload.FileUpload/GetStorageUsage", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *fileUploadClient) CreateFolder(ctx context.Context, in *CreateFolderRequest, opts ...grpc.CallOption) (*Folder, error) {
+	out := new(Folder)
+	err := c.cc.Invoke(ctx, "/fileupload.FileUpload/CreateFolder", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *fileUploadClient) ReleaseUserFiles(ctx context.Context, in *ReleaseUserFilesRequest, opts ...grpc.CallOption) (*ReleaseUserFilesResponse, error) {
+	out := new(ReleaseUserFilesResponse)
+	err := c.cc.Invoke(ctx, "/fileupload.FileUpload/ReleaseUserFiles", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
 // FileUploadServer is the server API for FileUpload service.
 // All implementations must embed UnimplementedFileUploadServer
 // for forward compatibility
@@ -87,6 +120,12 @@ type FileUploadServer interface {
 	UploadFile(FileUpload_UploadFileServer) error
 	// GetFileMetadata returns metadata for a specific file
 	GetFileMetadata(context.Context, *GetFileMetadataRequest) (*FileMetadata, error)
+	// GetStorageUsage returns the caller's used and remaining storage
+	GetStorageUsage(context.Context, *GetStorageUsageRequest) (*StorageUsage, error)
+	// CreateFolder creates a folder, optionally inside one the user can write to
+	CreateFolder(context.Context, *CreateFolderRequest) (*Folder, error)
+	// ReleaseUserFiles transfers or deletes the caller's files before their account is deleted
+	ReleaseUserFiles(context.Context, *ReleaseUserFilesRequest) (*ReleaseUserFilesResponse, error)
 	mustEmbedUnimplementedFileUploadServer()
 }
 
@@ -100,6 +139,15 @@ func (UnimplementedFileUploadServer) UploadFile(FileUpload_UploadFileServer) err
 func (UnimplementedFileUploadServer) GetFileMetadata(context.Context, *GetFileMetadataRequest) (*FileMetadata, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method GetFileMetadata not implemented")
 }
+func (UnimplementedFileUploadServer) GetStorageUsage(context.Context, *GetStorageUsageRequest) (*StorageUsage, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetStorageUsage not implemented")
+}
+func (UnimplementedFileUploadServer) CreateFolder(context.Context, *CreateFolderRequest) (*Folder, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method CreateFolder not implemented")
+}
+func (UnimplementedFileUploadServer) ReleaseUserFiles(context.Context, *ReleaseUserFilesRequest) (*ReleaseUserFilesResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ReleaseUserFiles not implemented")
+}
 func (UnimplementedFileUploadServer) mustEmbedUnimplementedFileUploadServer() {}
 
 // UnsafeFileUploadServer may be embedded to opt out of forward compatibility for this service.
@@ -157,6 +205,60 @@ func _FileUpload_GetFileMetadata_Handler(srv interface{}, ctx context.Context, d
 	return interceptor(ctx, in, info, handler)
 }
 
+func _FileUpload_GetStorageUsage_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetStorageUsageRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(FileUploadServer).GetStorageUsage(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/fileupload.FileUpload/GetStorageUsage",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(FileUploadServer).GetStorageUsage(ctx, req.(*GetStorageUsageRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _FileUpload_CreateFolder_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(CreateFolderRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(FileUploadServer).CreateFolder(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/fileupload.FileUpload/CreateFolder",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(FileUploadServer).CreateFolder(ctx, req.(*CreateFolderRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _FileUpload_ReleaseUserFiles_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ReleaseUserFilesRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(FileUploadServer).ReleaseUserFiles(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/fileupload.FileUpload/ReleaseUserFiles",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(FileUploadServer).ReleaseUserFiles(ctx, req.(*ReleaseUserFilesRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
 // FileUpload_ServiceDesc is the grpc.ServiceDesc for FileUpload service.
 // It's only intended for direct use with grpc.RegisterService,
 // and not to be introspected or modified (even as a copy)
@@ -168,6 +270,18 @@ var FileUpload_ServiceDesc = grpc.ServiceDesc{
 			MethodName: "GetFileMetadata",
 			Handler:    _FileUpload_GetFileMetadata_Handler,
 		},
+		{
+			MethodName: "GetStorageUsage",
+			Handler:    _FileUpload_GetStorageUsage_Handler,
+		},
+		{
+			MethodName: "CreateFolder",
+			Handler:    _FileUpload_CreateFolder_Handler,
+		},
+		{
+			MethodName: "ReleaseUserFiles",
+			Handler:    _FileUpload_ReleaseUserFiles_Handler,
+		},
 	},
 	Streams: []grpc.StreamDesc{
 		{
@@ -176,5 +290,5 @@ var FileUpload_ServiceDesc = grpc.ServiceDesc{
 			ClientStreams: true,
 		},
 	},
-	Metadata: "proto/upload/file.proto",
+	Metadata: "upload/file.proto",
 }
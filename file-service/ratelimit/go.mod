@@ -0,0 +1,31 @@
+module file-service/ratelimit
+
+go 1.23.0
+
+require (
+	file-service/apperr v0.0.0
+	file-service/config v0.0.0
+	file-service/logging v0.0.0
+	github.com/golang-jwt/jwt/v5 v5.2.2
+	google.golang.org/grpc v1.62.1
+)
+
+require (
+	github.com/golang/protobuf v1.5.3 // indirect
+	github.com/joho/godotenv v1.5.1 // indirect
+	go.opentelemetry.io/otel v1.28.0 // indirect
+	go.opentelemetry.io/otel/trace v1.28.0 // indirect
+	golang.org/x/net v0.20.0 // indirect
+	golang.org/x/sys v0.16.0 // indirect
+	golang.org/x/text v0.14.0 // indirect
+	google.golang.org/genproto/googleapis/rpc v0.0.0-20240123012728-ef4313101c80 // indirect
+	google.golang.org/protobuf v1.32.0 // indirect
+	gopkg.in/yaml.v3 v3.0.1 // indirect
+)
+
+// The error codes, configuration and logging shared with the services
+replace (
+	file-service/apperr => ../apperr
+	file-service/config => ../config
+	file-service/logging => ../logging
+)
@@ -0,0 +1,46 @@
+package ratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"google.golang.org/grpc/metadata"
+)
+
+func TestTokenSubject(t *testing.T) {
+	secret := []byte("jwt secret")
+	claims := jwt.MapClaims{"user_id": 7, "exp": time.Now().Add(time.Hour).Unix()}
+	sign := func(method jwt.SigningMethod, key interface{}) string {
+		token, err := jwt.NewWithClaims(method, claims).SignedString(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return token
+	}
+
+	tests := []struct {
+		name  string
+		token string
+		want  string
+	}{
+		{name: "no token"},
+		{name: "HS256", token: sign(jwt.SigningMethodHS256, secret), want: "user:7"},
+		{name: "other secret", token: sign(jwt.SigningMethodHS256, []byte("other"))},
+		{name: "other HMAC", token: sign(jwt.SigningMethodHS512, secret)},
+		{name: "unsigned", token: sign(jwt.SigningMethodNone, jwt.UnsafeAllowNoneSignatureType)},
+	}
+	key := TokenSubject(secret)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			if tt.token != "" {
+				ctx = metadata.NewIncomingContext(ctx, metadata.Pairs("authorization", "Bearer "+tt.token))
+			}
+			if got := key(ctx); got != tt.want {
+				t.Errorf("TokenSubject() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
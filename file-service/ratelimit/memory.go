@@ -0,0 +1,69 @@
+package ratelimit
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"file-service/config"
+)
+
+// Memory is the Store keeping buckets in the process, for a single instance
+type Memory struct {
+	mu      sync.Mutex
+	buckets map[string]*bucket
+}
+
+var _ Store = (*Memory)(nil)
+
+// bucket holds the tokens left at the time it was last used
+type bucket struct {
+	tokens  float64
+	updated time.Time
+}
+
+// NewMemory returns an empty in-memory store
+func NewMemory() *Memory {
+	return &Memory{buckets: map[string]*bucket{}}
+}
+
+func (m *Memory) Take(_ context.Context, key string, p config.RatePolicy) (Result, error) {
+	now := time.Now()
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	b, ok := m.buckets[key]
+	if !ok {
+		b = &bucket{tokens: float64(p.Burst), updated: now}
+		m.buckets[key] = b
+	}
+	b.tokens = refill(b.tokens, now.Sub(b.updated), p)
+	b.updated = now
+
+	if b.tokens < 1 {
+		return result(p, b.tokens, false), nil
+	}
+	b.tokens--
+	return result(p, b.tokens, true), nil
+}
+
+func (m *Memory) Prune(_ context.Context, idle time.Duration) error {
+	cutoff := time.Now().Add(-idle)
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for key, b := range m.buckets {
+		if b.updated.Before(cutoff) {
+			delete(m.buckets, key)
+		}
+	}
+	return nil
+}
+
+// refill adds the tokens earned over elapsed to a bucket, up to its size
+func refill(tokens float64, elapsed time.Duration, p config.RatePolicy) float64 {
+	if elapsed > 0 {
+		tokens += elapsed.Seconds() * float64(p.Requests) / p.Period.Seconds()
+	}
+	return min(tokens, float64(p.Burst))
+}
@@ -0,0 +1,190 @@
+// Package ratelimit throttles clients of echo-api and the file services with
+// token buckets. Each configured policy names a bucket size and refill rate;
+// callers take a token from the bucket of a policy and a key, such as a client
+// IP or a user ID. Buckets live in memory, or in the shared database so that
+// every instance draws from the same ones.
+package ratelimit
+
+import (
+	"context"
+	"database/sql"
+	"math"
+	"slices"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"google.golang.org/grpc/codes"
+
+	"file-service/apperr"
+	"file-service/config"
+	"file-service/logging"
+)
+
+// logger logs store failures, which let requests through rather than fail them
+var logger = logging.For("ratelimit")
+
+// pruneInterval is how often buckets left idle long enough to be full again are removed
+const pruneInterval = time.Minute
+
+// Store keeps the buckets
+type Store interface {
+	// Take refills the bucket at key for the time since it was last used and
+	// takes a token from it if one is left
+	Take(ctx context.Context, key string, p config.RatePolicy) (Result, error)
+	// Prune removes the buckets not used for longer than idle
+	Prune(ctx context.Context, idle time.Duration) error
+}
+
+// NewStore returns the configured store; the database store keeps its buckets in db
+func NewStore(cfg config.RateLimit, db *sql.DB, timeout time.Duration) Store {
+	if cfg.Store == config.RateLimitDatabase {
+		return NewSQL(db, timeout)
+	}
+	return NewMemory()
+}
+
+// Result is the state of a bucket after a token was asked for
+type Result struct {
+	Allowed bool
+	Policy  config.RatePolicy
+	// Remaining is the number of whole tokens left
+	Remaining int
+	// Reset is the time until the bucket is full again
+	Reset time.Duration
+	// RetryAfter is the time until a token is available, when none was
+	RetryAfter time.Duration
+}
+
+// result describes a bucket holding tokens after a request
+func result(p config.RatePolicy, tokens float64, allowed bool) Result {
+	perToken := p.Period / time.Duration(p.Requests)
+	r := Result{
+		Allowed:   allowed,
+		Policy:    p,
+		Remaining: int(math.Max(tokens, 0)),
+		Reset:     time.Duration((float64(p.Burst) - tokens) * float64(perToken)),
+	}
+	if !allowed {
+		r.RetryAfter = time.Duration((1 - tokens) * float64(perToken))
+	}
+	return r
+}
+
+// Err returns the error for a request the bucket had no token for, or nil
+func (r Result) Err() error {
+	if r.Allowed {
+		return nil
+	}
+	return apperr.New(codes.ResourceExhausted, apperr.RateLimited, "too many requests, try again later").
+		With("retry_after_seconds", RetryAfterSeconds(r.RetryAfter))
+}
+
+// RetryAfterSeconds rounds a wait up to whole seconds, as Retry-After counts them
+func RetryAfterSeconds(d time.Duration) int64 {
+	return int64(math.Ceil(d.Seconds()))
+}
+
+// PolicyHeader describes a policy in the RateLimit-Policy header format,
+// e.g. 10;w=60;burst=20
+func PolicyHeader(p config.RatePolicy) string {
+	s := strconv.Itoa(p.Requests) + ";w=" + strconv.FormatInt(RetryAfterSeconds(p.Period), 10)
+	if p.Burst != p.Requests {
+		s += ";burst=" + strconv.Itoa(p.Burst)
+	}
+	return s
+}
+
+// Limiter takes tokens from the buckets of the policies in effect
+type Limiter struct {
+	store Store
+	// source returns the configured policies, which can change on reload
+	source    func() []string
+	parsed    atomic.Pointer[parsedPolicies]
+	nextPrune atomic.Int64
+	// undefined holds the names of policies asked for but not configured,
+	// which are warned about once
+	undefined sync.Map
+}
+
+// parsedPolicies caches the policies parsed from a configuration
+type parsedPolicies struct {
+	raw      []string
+	policies map[string]config.RatePolicy
+	// idle is how long the slowest bucket takes to refill from empty
+	idle time.Duration
+}
+
+// New returns a limiter keeping its buckets in store, applying the policies
+// source returns at the time of each request
+func New(store Store, source func() []string) *Limiter {
+	return &Limiter{store: store, source: source}
+}
+
+// Allow takes a token from the bucket of the named policy for key. It returns
+// false if the policy is turned off or not configured, in which case nothing
+// is limited; requests are let through, too, if the store fails.
+func (l *Limiter) Allow(ctx context.Context, policy, key string) (Result, bool) {
+	policies := l.policies()
+	p, ok := policies.policies[policy]
+	if !ok {
+		// Every default policy is configured unless turned off, so this is a
+		// policy name without a default
+		if _, warned := l.undefined.LoadOrStore(policy, true); !warned {
+			logger.WarnContext(ctx, "Rate limit policy is not configured; requests are not limited", "policy", policy)
+		}
+		return Result{}, false
+	}
+	if p == (config.RatePolicy{}) {
+		return Result{}, false
+	}
+
+	l.prune(policies.idle)
+	r, err := l.store.Take(ctx, policy+":"+key, p)
+	if err != nil {
+		logger.WarnContext(ctx, "Rate limit store failed; request let through", "policy", policy, "error", err)
+		return Result{}, false
+	}
+	return r, true
+}
+
+// policies returns the policies in effect, parsing them again if they changed
+func (l *Limiter) policies() *parsedPolicies {
+	raw := l.source()
+	cached := l.parsed.Load()
+	if cached != nil && slices.Equal(cached.raw, raw) {
+		return cached
+	}
+
+	policies, err := config.RateLimit{Policies: raw}.ParsePolicies()
+	if err != nil {
+		// The configuration was validated when loaded, so this is not expected
+		if cached != nil {
+			return cached
+		}
+		policies = nil
+	}
+	next := &parsedPolicies{raw: raw, policies: policies}
+	for _, p := range policies {
+		if p.Requests > 0 {
+			next.idle = max(next.idle, p.Period*time.Duration(p.Burst)/time.Duration(p.Requests))
+		}
+	}
+	l.parsed.Store(next)
+	return next
+}
+
+// prune removes idle buckets in the background, at most once per pruneInterval
+func (l *Limiter) prune(idle time.Duration) {
+	now := time.Now().UnixNano()
+	next := l.nextPrune.Load()
+	if now < next || !l.nextPrune.CompareAndSwap(next, now+int64(pruneInterval)) {
+		return
+	}
+	go func() {
+		if err := l.store.Prune(context.Background(), idle); err != nil {
+			logger.Warn("Pruning rate limit buckets failed", "error", err)
+		}
+	}()
+}
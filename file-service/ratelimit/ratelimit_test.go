@@ -0,0 +1,43 @@
+package ratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"file-service/apperr"
+)
+
+// codeOf returns the code of an *apperr.Error, or "" for nil
+func codeOf(err error) apperr.Code {
+	if e, ok := err.(*apperr.Error); ok {
+		return e.Code
+	}
+	return ""
+}
+
+func TestLimiter(t *testing.T) {
+	ctx := context.Background()
+	l := New(NewMemory(), func() []string { return []string{"login=2/1h", "register=off"} })
+
+	for i, want := range []bool{true, true, false} {
+		r, ok := l.Allow(ctx, "login", "ip:192.0.2.1")
+		if !ok || r.Allowed != want {
+			t.Fatalf("request %d: Allow() = %+v, %v, want allowed %v", i+1, r, ok, want)
+		}
+	}
+	r, _ := l.Allow(ctx, "login", "ip:192.0.2.1")
+	if codeOf(r.Err()) != apperr.RateLimited || r.RetryAfter <= 0 || r.RetryAfter > 30*time.Minute {
+		t.Errorf("Err() = %v after %v, want code %q within half an hour", r.Err(), r.RetryAfter, apperr.RateLimited)
+	}
+
+	// Buckets are per key, and policies turned off or not configured limit nothing
+	if r, ok := l.Allow(ctx, "login", "ip:192.0.2.2"); !ok || !r.Allowed || r.Remaining != 1 {
+		t.Errorf("Allow() for another key = %+v, %v, want allowed with 1 left", r, ok)
+	}
+	for _, policy := range []string{"register", "unknown"} {
+		if _, ok := l.Allow(ctx, policy, "ip:192.0.2.1"); ok {
+			t.Errorf("Allow(%q) limited the request", policy)
+		}
+	}
+}
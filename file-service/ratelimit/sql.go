@@ -0,0 +1,81 @@
+package ratelimit
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"file-service/config"
+)
+
+// SQL is the Store keeping buckets in the rate_limit_buckets table of the
+// shared database, so that every instance draws from the same ones. Bucket
+// times are microseconds since the epoch as seen by the instance using them.
+type SQL struct {
+	db      *sql.DB
+	timeout time.Duration
+}
+
+var _ Store = (*SQL)(nil)
+
+// NewSQL returns a store on the database that bounds every query by timeout
+func NewSQL(db *sql.DB, timeout time.Duration) *SQL {
+	return &SQL{db: db, timeout: timeout}
+}
+
+func (s *SQL) withTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	return context.WithTimeout(ctx, s.timeout)
+}
+
+// Take refills the bucket in one statement and takes the token in another that
+// only succeeds while one is left, so concurrent requests never overdraw it
+func (s *SQL) Take(ctx context.Context, key string, p config.RatePolicy) (Result, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	perMicrosecond := float64(p.Requests) / float64(p.Period.Microseconds())
+	var tokens float64
+	err := s.db.QueryRowContext(ctx, `
+		INSERT INTO rate_limit_buckets (key, tokens, updated_at)
+		VALUES ($1, CAST($2 AS DOUBLE PRECISION), $3)
+		ON CONFLICT (key) DO UPDATE SET
+			tokens = CASE
+				WHEN EXCLUDED.updated_at <= rate_limit_buckets.updated_at THEN
+					CASE WHEN rate_limit_buckets.tokens > EXCLUDED.tokens THEN EXCLUDED.tokens ELSE rate_limit_buckets.tokens END
+				WHEN rate_limit_buckets.tokens + (EXCLUDED.updated_at - rate_limit_buckets.updated_at) * CAST($4 AS DOUBLE PRECISION) > EXCLUDED.tokens
+					THEN EXCLUDED.tokens
+				ELSE rate_limit_buckets.tokens + (EXCLUDED.updated_at - rate_limit_buckets.updated_at) * CAST($4 AS DOUBLE PRECISION)
+			END,
+			updated_at = CASE
+				WHEN EXCLUDED.updated_at > rate_limit_buckets.updated_at THEN EXCLUDED.updated_at
+				ELSE rate_limit_buckets.updated_at
+			END
+		RETURNING tokens
+	`, key, float64(p.Burst), time.Now().UnixMicro(), perMicrosecond).Scan(&tokens)
+	if err != nil {
+		return Result{}, err
+	}
+
+	err = s.db.QueryRowContext(ctx, `
+		UPDATE rate_limit_buckets SET tokens = tokens - 1
+		WHERE key = $1 AND tokens >= 1
+		RETURNING tokens
+	`, key).Scan(&tokens)
+	if errors.Is(err, sql.ErrNoRows) {
+		return result(p, tokens, false), nil
+	}
+	if err != nil {
+		return Result{}, err
+	}
+	return result(p, tokens, true), nil
+}
+
+func (s *SQL) Prune(ctx context.Context, idle time.Duration) error {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	_, err := s.db.ExecContext(ctx, "DELETE FROM rate_limit_buckets WHERE updated_at < $1",
+		time.Now().Add(-idle).UnixMicro())
+	return err
+}
@@ -2,198 +2,143 @@ package main
 
 import (
 	"context"
-	"database/sql"
-	"fmt"
-	"io"
 	"log"
+	"log/slog"
 	"net"
 	"os"
-	"path/filepath"
+	"os/signal"
+	"syscall"
 	"time"
 
-	"github.com/golang-jwt/jwt/v5"
-	"github.com/google/uuid"
-	"github.com/joho/godotenv"
-	_ "github.com/lib/pq"
 	"google.golang.org/grpc"
-	"google.golang.org/grpc/codes"
-	"google.golang.org/grpc/metadata"
-	"google.golang.org/grpc/status"
-
-	pb "file-service/upload-service/proto"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+
+	"file-service/config"
+	"file-service/healthcheck"
+	"file-service/logging"
+	"file-service/metrics"
+	pb "file-service/proto/upload"
+	"file-service/ratelimit"
+	"file-service/tracing"
+	"file-service/upload-service/store"
+	"file-service/upload-service/upload"
 )
 
-type server struct {
-	pb.UnimplementedFileUploadServer
-	uploadDir string
-	db        *sql.DB
-}
-
-func (s *server) UploadFile(stream pb.FileUpload_UploadFileServer) error {
-	// Get user ID from JWT token
-	userID, err := getUserIDFromContext(stream.Context())
-	if err != nil {
-		return err
-	}
-
-	// First message should contain metadata
-	req, err := stream.Recv()
-	if err != nil {
-		return status.Error(codes.InvalidArgument, "failed to receive metadata")
-	}
-
-	metadata := req.GetMetadata()
-	if metadata == nil {
-		return status.Error(codes.InvalidArgument, "first message must contain metadata")
-	}
-
-	// Generate unique file ID
-	fileID := uuid.New().String()
-	filePath := filepath.Join(s.uploadDir, fileID)
-
-	// Create file
-	file, err := os.Create(filePath)
+func main() {
+	// Load and validate the configuration
+	cfg, args, err := config.Load("upload-service", os.Args[1:])
 	if err != nil {
-		return status.Error(codes.Internal, "failed to create file")
+		log.Fatal(err)
 	}
-	defer file.Close()
-
-	// Process file chunks
-	var totalSize int64
-	for {
-		req, err := stream.Recv()
-		if err == io.EOF {
-			break
-		}
-		if err != nil {
-			return status.Error(codes.Internal, "failed to receive chunk")
-		}
 
-		chunk := req.GetChunk()
-		if chunk == nil {
-			continue
+	// Probe a running service, for container health checks
+	if len(args) > 0 && args[0] == "healthcheck" {
+		if err := healthcheck.ProbeGRPC(cfg.Services.UploadAddr); err != nil {
+			log.Fatalf("Unhealthy: %v", err)
 		}
-
-		_, err = file.Write(chunk)
-		if err != nil {
-			return status.Error(codes.Internal, "failed to write chunk")
-		}
-		totalSize += int64(len(chunk))
-	}
-
-	// Save file metadata to database
-	_, err = s.db.Exec(`
-		INSERT INTO files (id, filename, content_type, size, user_id, created_at)
-		VALUES ($1, $2, $3, $4, $5, $6)
-	`, fileID, metadata.Filename, metadata.ContentType, totalSize, userID, time.Now())
-	if err != nil {
-		log.Printf("Failed to save file metadata to database: %v", err)
-		return status.Error(codes.Internal, "failed to save file metadata")
-	}
-
-	// Send response
-	return stream.SendAndClose(&pb.UploadFileResponse{
-		FileId:    fileID,
-		Filename:  metadata.Filename,
-		Size:      totalSize,
-		CreatedAt: time.Now().Format(time.RFC3339),
-		UserId:    userID,
-	})
-}
-
-func (s *server) GetFileMetadata(ctx context.Context, req *pb.GetFileMetadataRequest) (*pb.FileMetadata, error) {
-	// Get user ID from JWT token
-	userID, err := getUserIDFromContext(ctx)
-	if err != nil {
-		return nil, err
-	}
-
-	// TODO: Implement file metadata retrieval from database
-	// For now, return dummy data with the actual user ID
-	return &pb.FileMetadata{
-		Filename:    "example.txt",
-		ContentType: "text/plain",
-		Size:        1024,
-		UserId:      userID, // Use the actual user ID from the token
-	}, nil
-}
-
-func getUserIDFromContext(ctx context.Context) (string, error) {
-	md, ok := metadata.FromIncomingContext(ctx)
-	if !ok {
-		return "", status.Error(codes.Unauthenticated, "metadata is not provided")
+		return
 	}
 
-	tokens := md.Get("authorization")
-	if len(tokens) == 0 {
-		return "", status.Error(codes.Unauthenticated, "authorization token is not provided")
+	// Log structured records from here on
+	if err := logging.Setup("upload-service", cfg.Log); err != nil {
+		log.Fatal(err)
 	}
 
-	token := tokens[0]
-	// Remove "Bearer " prefix if present
-	if len(token) > 7 && token[:7] == "Bearer " {
-		token = token[7:]
-	}
-	claims := jwt.MapClaims{}
-	parsedToken, err := jwt.ParseWithClaims(token, claims, func(token *jwt.Token) (interface{}, error) {
-		return []byte(os.Getenv("JWT_SECRET")), nil
-	})
-
-	if err != nil || !parsedToken.Valid {
-		return "", status.Error(codes.Unauthenticated, "invalid token")
-	}
-
-	userID, ok := claims["user_id"].(float64)
-	if !ok {
-		return "", status.Error(codes.Internal, "invalid user ID in token")
+	// Create upload directory
+	if err := os.MkdirAll(cfg.Storage.Dir, 0755); err != nil {
+		logging.Fatal("Failed to create upload directory", err)
 	}
 
-	return fmt.Sprintf("%d", int(userID)), nil
-}
-
-func main() {
-	// Load environment variables
-	if err := godotenv.Load(); err != nil {
-		log.Printf("Warning: .env file not found")
+	// Uploads are staged until complete; clear out ones abandoned by a crash
+	if err := upload.PrepareStaging(cfg.Storage.Dir); err != nil {
+		logging.Fatal("Failed to prepare staging directory", err)
 	}
 
-	// Create upload directory
-	uploadDir := "uploads"
-	if err := os.MkdirAll(uploadDir, 0755); err != nil {
-		log.Fatalf("Failed to create upload directory: %v", err)
+	// Export traces; buffered spans are flushed on exit
+	shutdownTracing, err := tracing.Setup(context.Background(), "upload-service", cfg.Tracing)
+	if err != nil {
+		logging.Fatal("Failed to set up tracing", err)
 	}
+	defer shutdownTracing(context.Background())
 
 	// Initialize database connection
-	dbURL := os.Getenv("DB_URL")
-	if dbURL == "" {
-		log.Fatal("DB_URL environment variable is not set")
-	}
-
-	db, err := sql.Open("postgres", dbURL)
+	db, err := openDB(cfg.Database)
 	if err != nil {
-		log.Fatalf("Failed to connect to database: %v", err)
+		logging.Fatal("Failed to connect to database", err)
 	}
 	defer db.Close()
 
 	// Test database connection
 	if err := db.Ping(); err != nil {
-		log.Fatalf("Failed to ping database: %v", err)
+		logging.Fatal("Failed to ping database", err)
 	}
 
 	// Start gRPC server
-	lis, err := net.Listen("tcp", ":50051")
+	lis, err := net.Listen("tcp", cfg.Services.UploadAddr)
 	if err != nil {
-		log.Fatalf("Failed to listen: %v", err)
+		logging.Fatal("Failed to listen", err)
 	}
 
-	s := grpc.NewServer()
-	pb.RegisterFileUploadServer(s, &server{
-		uploadDir: uploadDir,
-		db:        db,
+	// Each user's RPCs draw from one bucket of the grpc rate limit policy
+	limiter := ratelimit.New(ratelimit.NewStore(cfg.RateLimit, db, cfg.Database.QueryTimeout), func() []string {
+		return cfg.RateLimit.Policies
 	})
+	opts := append(metrics.ServerOptions(), logging.ServerOptions()...)
+	opts = append(opts, ratelimit.ServerOptions(limiter, "grpc", ratelimit.TokenSubject([]byte(cfg.Auth.JWTSecret)))...)
+	s := grpc.NewServer(append(opts, tracing.ServerOption())...)
+	pb.RegisterFileUploadServer(s, upload.NewServer(cfg, store.NewSQL(db, cfg.Database.QueryTimeout)))
+
+	// Export metrics on their own port
+	metrics.RegisterDB(db, "echo_api")
+	metrics.RegisterStorage(cfg.Storage.Dir)
+	if cfg.Services.UploadMetricsAddr != "" {
+		defer metrics.Serve(cfg.Services.UploadMetricsAddr).Close()
+	}
+
+	// Run until SIGINT or SIGTERM
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	// Report the status of the service and each dependency over the standard health protocol
+	healthServer := health.NewServer()
+	healthpb.RegisterHealthServer(s, healthServer)
+	go healthcheck.Watch(ctx, healthServer, map[string]healthcheck.Check{
+		"database": healthcheck.Database(db),
+		"storage":  healthcheck.Writable(cfg.Storage.Dir),
+	}, pb.FileUpload_ServiceDesc.ServiceName)
+
+	go func() {
+		slog.Info("Upload service listening", "addr", cfg.Services.UploadAddr)
+		if err := s.Serve(lis); err != nil {
+			logging.Fatal("Failed to serve", err)
+		}
+	}()
+
+	<-ctx.Done()
+	slog.Info("Draining upload service")
+	healthServer.Shutdown()
+	time.Sleep(cfg.Shutdown.DrainDelay)
+	stopGRPC(s, cfg.Shutdown.Timeout)
 
-	log.Printf("Upload service listening on :50051")
-	if err := s.Serve(lis); err != nil {
-		log.Fatalf("Failed to serve: %v", err)
+	// Uploads cut off by the timeout leave partial files behind
+	upload.RemoveStaged()
+}
+
+// stopGRPC stops accepting RPCs and lets active ones finish for up to timeout,
+// then cancels the rest
+func stopGRPC(s *grpc.Server, timeout time.Duration) {
+	stopped := make(chan struct{})
+	go func() {
+		s.GracefulStop()
+		close(stopped)
+	}()
+
+	select {
+	case <-stopped:
+	case <-time.After(timeout):
+		slog.Warn("Shutdown timeout reached; cancelling remaining RPCs")
+		s.Stop()
+		<-stopped
 	}
-} 
\ No newline at end of file
+}
@@ -0,0 +1,382 @@
+package store
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Memory is a FileStore kept in maps, for tests and running without a database
+type Memory struct {
+	mu         sync.Mutex
+	roles      map[string]string            // user ID to role
+	members    map[string]map[string]string // org ID to user ID to role
+	orgLimits  map[string]*int64            // org ID to storage limit
+	roleQuotas map[string]Quota
+	userQuotas map[string]Quota
+	files      map[string]File
+	folders    map[string]Folder
+	grants     map[string]string // "file:ID:user" or "folder:ID:user" to access
+	ended      map[string]bool   // logged out session IDs
+	keys       map[string]bool   // revoked API key IDs
+	disabled   map[string]bool   // disabled user IDs
+	deleting   map[string]bool   // IDs of users deleting their account
+	reserved   map[string]reservation
+}
+
+// reservation is storage held by an upload in progress
+type reservation struct {
+	userID, orgID string
+	bytes         int64
+	expires       time.Time
+}
+
+var _ FileStore = (*Memory)(nil)
+
+// NewMemory returns an empty in-memory store with no storage limits
+func NewMemory() *Memory {
+	return &Memory{
+		roles:      map[string]string{},
+		members:    map[string]map[string]string{},
+		orgLimits:  map[string]*int64{},
+		roleQuotas: map[string]Quota{},
+		userQuotas: map[string]Quota{},
+		files:      map[string]File{},
+		folders:    map[string]Folder{},
+		grants:     map[string]string{},
+		ended:      map[string]bool{},
+		keys:       map[string]bool{},
+		disabled:   map[string]bool{},
+		deleting:   map[string]bool{},
+		reserved:   map[string]reservation{},
+	}
+}
+
+// AddUser adds a user with a role such as user or admin
+func (m *Memory) AddUser(id, role string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.roles[id] = role
+}
+
+// AddOrganization adds an organization; a nil maxStorageBytes is unlimited
+func (m *Memory) AddOrganization(id string, maxStorageBytes *int64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.orgLimits[id] = maxStorageBytes
+}
+
+// AddMember puts a user in an organization with the role owner, admin or member
+func (m *Memory) AddMember(orgID, userID, role string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.members[orgID] == nil {
+		m.members[orgID] = map[string]string{}
+	}
+	m.members[orgID][userID] = role
+}
+
+// SetRoleQuota sets the default limits for a role; nil is unlimited
+func (m *Memory) SetRoleQuota(role string, maxStorageBytes, maxFileSize *int64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.roleQuotas[role] = Quota{MaxStorageBytes: maxStorageBytes, MaxFileSize: maxFileSize}
+}
+
+// SetUserQuota overrides a user's role limits; nil falls back to the role
+func (m *Memory) SetUserQuota(userID string, maxStorageBytes, maxFileSize *int64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.userQuotas[userID] = Quota{MaxStorageBytes: maxStorageBytes, MaxFileSize: maxFileSize}
+}
+
+// Grant gives a user read or read_write access to a file or folder
+func (m *Memory) Grant(fileID, folderID, userID, access string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if fileID != "" {
+		m.grants["file:"+fileID+":"+userID] = access
+	} else {
+		m.grants["folder:"+folderID+":"+userID] = access
+	}
+}
+
+func (m *Memory) IsMember(ctx context.Context, orgID, userID string) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	_, ok := m.members[orgID][userID]
+	return ok, nil
+}
+
+// EndSession logs out a session, whose tokens SessionActive then rejects
+func (m *Memory) EndSession(sessionID string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.ended[sessionID] = true
+}
+
+func (m *Memory) SessionActive(ctx context.Context, sessionID, userID string) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return !m.ended[sessionID] && !m.disabled[userID] && !m.deleting[userID], nil
+}
+
+func (m *Memory) DeletingSessionActive(ctx context.Context, sessionID, userID string) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return !m.ended[sessionID] && m.deleting[userID], nil
+}
+
+// RevokeAPIKey revokes an API key, whose tokens APIKeyActive then rejects
+func (m *Memory) RevokeAPIKey(keyID string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.keys[keyID] = true
+}
+
+// DisableUser disables a user, whose sessions and API keys are then inactive
+func (m *Memory) DisableUser(userID string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.disabled[userID] = true
+}
+
+// MarkDeleting marks a user as deleting their account, whose sessions and API
+// keys are then inactive
+func (m *Memory) MarkDeleting(userID string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.deleting[userID] = true
+}
+
+func (m *Memory) APIKeyActive(ctx context.Context, keyID, userID string) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return !m.keys[keyID] && !m.disabled[userID] && !m.deleting[userID], nil
+}
+
+// ancestors returns the folder and all of its parents
+func (m *Memory) ancestors(folderID string) []Folder {
+	var folders []Folder
+	for folderID != "" {
+		folder, ok := m.folders[folderID]
+		if !ok {
+			break
+		}
+		folders = append(folders, folder)
+		folderID = folder.ParentID
+	}
+	return folders
+}
+
+// resolveAccess mirrors fileAccessQuery for a resource in resourceOrg created by
+// creatorID (empty for folders) inside the given folders, granted as fileID
+func (m *Memory) resolveAccess(resourceOrg, creatorID, fileID string, folders []Folder, userID, orgID string) string {
+	inOrg := resourceOrg == orgID
+	owner := creatorID == userID
+	grants := []string{m.grants["file:"+fileID+":"+userID]}
+	for _, f := range folders {
+		owner = owner || f.UserID == userID
+		grants = append(grants, m.grants["folder:"+f.ID+":"+userID])
+	}
+	role := m.members[resourceOrg][userID]
+	if inOrg && (owner || role == "owner" || role == "admin") {
+		return AccessOwner
+	}
+
+	granted := AccessNone
+	for _, access := range grants {
+		if access == AccessReadWrite {
+			return AccessReadWrite
+		}
+		if access != AccessNone {
+			granted = AccessRead
+		}
+	}
+	if inOrg {
+		return AccessRead
+	}
+	return granted
+}
+
+func (m *Memory) FileAccess(ctx context.Context, fileID, userID, orgID string) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	f, ok := m.files[fileID]
+	if !ok {
+		return AccessNone, nil
+	}
+	return m.resolveAccess(f.OrgID, f.UserID, fileID, m.ancestors(f.FolderID), userID, orgID), nil
+}
+
+func (m *Memory) FolderAccess(ctx context.Context, folderID, userID, orgID string) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	folder, ok := m.folders[folderID]
+	if !ok {
+		return AccessNone, nil
+	}
+	return m.resolveAccess(folder.OrgID, "", "", m.ancestors(folderID), userID, orgID), nil
+}
+
+func (m *Memory) GetFile(ctx context.Context, fileID string) (*File, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	f, ok := m.files[fileID]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return &f, nil
+}
+
+func (m *Memory) CreateFile(ctx context.Context, file *File) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.files[file.ID] = *file
+	delete(m.reserved, file.ID)
+	return nil
+}
+
+func (m *Memory) GetFolder(ctx context.Context, folderID string) (*Folder, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	f, ok := m.folders[folderID]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return &f, nil
+}
+
+func (m *Memory) CreateFolder(ctx context.Context, folder *Folder) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.folders[folder.ID] = *folder
+	return nil
+}
+
+func (m *Memory) GetQuota(ctx context.Context, userID, orgID string) (*Quota, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.quota(userID, orgID, "", time.Now())
+}
+
+// quota mirrors quotaQuery, leaving out the reservation with ID excludeID
+func (m *Memory) quota(userID, orgID, excludeID string, now time.Time) (*Quota, error) {
+	role, ok := m.roles[userID]
+	orgLimit, orgOK := m.orgLimits[orgID]
+	if !ok || !orgOK {
+		return nil, ErrNotFound
+	}
+
+	roleQuota, userQuota := m.roleQuotas[role], m.userQuotas[userID]
+	q := &Quota{
+		MaxStorageBytes:    roleQuota.MaxStorageBytes,
+		MaxFileSize:        roleQuota.MaxFileSize,
+		OrgMaxStorageBytes: orgLimit,
+	}
+	if userQuota.MaxStorageBytes != nil {
+		q.MaxStorageBytes = userQuota.MaxStorageBytes
+	}
+	if userQuota.MaxFileSize != nil {
+		q.MaxFileSize = userQuota.MaxFileSize
+	}
+	for _, f := range m.files {
+		if f.UserID == userID {
+			q.UsedBytes += f.Size
+			q.FileCount++
+		}
+		if f.OrgID == orgID {
+			q.OrgUsedBytes += f.Size
+		}
+	}
+	for id, r := range m.reserved {
+		if id == excludeID || !r.expires.After(now) {
+			continue
+		}
+		if r.userID == userID {
+			q.UsedBytes += r.bytes
+		}
+		if r.orgID == orgID {
+			q.OrgUsedBytes += r.bytes
+		}
+	}
+	return q, nil
+}
+
+func (m *Memory) ReserveStorage(ctx context.Context, id, userID, orgID string, bytes int64, expires time.Time) (*Quota, bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	q, err := m.quota(userID, orgID, id, time.Now())
+	if err != nil || !q.Fits(bytes) {
+		return q, false, err
+	}
+	m.reserved[id] = reservation{userID: userID, orgID: orgID, bytes: bytes, expires: expires}
+	return q, true, nil
+}
+
+func (m *Memory) ReleaseStorage(ctx context.Context, id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.reserved, id)
+	return nil
+}
+
+func (m *Memory) MemberRole(ctx context.Context, orgID, userID string) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.members[orgID][userID], nil
+}
+
+// listFiles returns the files that match
+func (m *Memory) listFiles(match func(File) bool) []File {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var files []File
+	for _, f := range m.files {
+		if match(f) {
+			files = append(files, f)
+		}
+	}
+	return files
+}
+
+func (m *Memory) ListUserFiles(ctx context.Context, userID string) ([]File, error) {
+	return m.listFiles(func(f File) bool { return f.UserID == userID }), nil
+}
+
+func (m *Memory) ListOrgFiles(ctx context.Context, orgID string) ([]File, error) {
+	return m.listFiles(func(f File) bool { return f.OrgID == orgID }), nil
+}
+
+func (m *Memory) TransferFiles(ctx context.Context, userID, orgID, toUserID string) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var n int64
+	for id, f := range m.files {
+		if f.UserID == userID && f.OrgID == orgID {
+			f.UserID = toUserID
+			m.files[id] = f
+			n++
+		}
+	}
+	for id, f := range m.folders {
+		if f.UserID == userID && f.OrgID == orgID {
+			f.UserID = toUserID
+			m.folders[id] = f
+		}
+	}
+	return n, nil
+}
+
+func (m *Memory) DeleteFile(ctx context.Context, fileID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.files, fileID)
+	for key := range m.grants {
+		if strings.HasPrefix(key, "file:"+fileID+":") {
+			delete(m.grants, key)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,441 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// fileAccessQuery resolves user $2's access to file $1 while acting in organization $3.
+// Within the file's organization the uploader, owners of enclosing folders and
+// organization owners and admins are owners, and every other member can read.
+// Grants on the file or an enclosing folder apply in any organization.
+const fileAccessQuery = `
+	WITH RECURSIVE ancestors AS (
+		SELECT fo.id, fo.parent_id, fo.user_id
+		FROM folders fo
+		JOIN files f ON f.folder_id = fo.id
+		WHERE f.id = $1
+		UNION ALL
+		SELECT fo.id, fo.parent_id, fo.user_id
+		FROM folders fo
+		JOIN ancestors a ON fo.id = a.parent_id
+	), grants AS (
+		SELECT access FROM file_permissions
+		WHERE user_id = CAST($2 AS INTEGER)
+			AND (file_id = $1 OR folder_id IN (SELECT id FROM ancestors))
+	)
+	SELECT CASE
+		WHEN f.org_id = CAST($3 AS INTEGER) AND (
+			f.user_id = CAST($2 AS INTEGER)
+			OR EXISTS (SELECT 1 FROM ancestors WHERE user_id = CAST($2 AS INTEGER))
+			OR EXISTS (SELECT 1 FROM organization_members m
+				WHERE m.org_id = f.org_id AND m.user_id = CAST($2 AS INTEGER) AND m.role IN ('owner', 'admin'))
+		) THEN 'owner'
+		WHEN EXISTS (SELECT 1 FROM grants WHERE access = 'read_write') THEN 'read_write'
+		WHEN f.org_id = CAST($3 AS INTEGER) OR EXISTS (SELECT 1 FROM grants) THEN 'read'
+		ELSE ''
+	END
+	FROM files f
+	WHERE f.id = $1
+`
+
+// folderAccessQuery resolves user $2's access to folder $1 in organization $3 the same way
+const folderAccessQuery = `
+	WITH RECURSIVE ancestors AS (
+		SELECT id, parent_id, user_id
+		FROM folders
+		WHERE id = $1
+		UNION ALL
+		SELECT fo.id, fo.parent_id, fo.user_id
+		FROM folders fo
+		JOIN ancestors a ON fo.id = a.parent_id
+	), grants AS (
+		SELECT access FROM file_permissions
+		WHERE user_id = CAST($2 AS INTEGER) AND folder_id IN (SELECT id FROM ancestors)
+	)
+	SELECT CASE
+		WHEN fo.org_id = CAST($3 AS INTEGER) AND (
+			EXISTS (SELECT 1 FROM ancestors WHERE user_id = CAST($2 AS INTEGER))
+			OR EXISTS (SELECT 1 FROM organization_members m
+				WHERE m.org_id = fo.org_id AND m.user_id = CAST($2 AS INTEGER) AND m.role IN ('owner', 'admin'))
+		) THEN 'owner'
+		WHEN EXISTS (SELECT 1 FROM grants WHERE access = 'read_write') THEN 'read_write'
+		WHEN fo.org_id = CAST($3 AS INTEGER) OR EXISTS (SELECT 1 FROM grants) THEN 'read'
+		ELSE ''
+	END
+	FROM folders fo
+	WHERE fo.id = $1
+`
+
+// quotaQuery loads the limits of user $1 and organization $2 with their usage:
+// the size of their files and of the unexpired upload reservations other than
+// $3 at time $4
+const quotaQuery = `
+	SELECT
+		COALESCE(uq.max_storage_bytes, rq.max_storage_bytes),
+		COALESCE(uq.max_file_size, rq.max_file_size),
+		(SELECT COALESCE(SUM(size), 0) FROM files WHERE user_id = u.id)
+			+ (SELECT COALESCE(SUM(bytes), 0) FROM upload_reservations
+				WHERE user_id = u.id AND id <> $3 AND expires_at > $4),
+		(SELECT COUNT(*) FROM files WHERE user_id = u.id),
+		o.max_storage_bytes,
+		(SELECT COALESCE(SUM(size), 0) FROM files WHERE org_id = o.id)
+			+ (SELECT COALESCE(SUM(bytes), 0) FROM upload_reservations
+				WHERE org_id = o.id AND id <> $3 AND expires_at > $4)
+	FROM users u
+	JOIN organizations o ON o.id = CAST($2 AS INTEGER)
+	LEFT JOIN role_quotas rq ON rq.role = u.role
+	LEFT JOIN user_quotas uq ON uq.user_id = u.id
+	WHERE u.id = CAST($1 AS INTEGER)
+`
+
+// fileColumns are the columns scanned by scanFile
+const fileColumns = `id, filename, content_type, size, user_id, org_id, folder_id, created_at`
+
+// SQL is the FileStore backed by a Postgres or SQLite database. Queries stick
+// to the SQL both understand, so there is one implementation for either driver.
+type SQL struct {
+	db      *sql.DB
+	timeout time.Duration
+}
+
+var _ FileStore = (*SQL)(nil)
+
+// NewSQL returns a store on the database that bounds every query by timeout
+func NewSQL(db *sql.DB, timeout time.Duration) *SQL {
+	return &SQL{db: db, timeout: timeout}
+}
+
+func (p *SQL) withTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	return context.WithTimeout(ctx, p.timeout)
+}
+
+func scanFile(row interface{ Scan(...interface{}) error }) (*File, error) {
+	var f File
+	var folderID *string
+	err := row.Scan(&f.ID, &f.Filename, &f.ContentType, &f.Size, &f.UserID, &f.OrgID, &folderID, &f.CreatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	if folderID != nil {
+		f.FolderID = *folderID
+	}
+	return &f, nil
+}
+
+func (p *SQL) IsMember(ctx context.Context, orgID, userID string) (bool, error) {
+	ctx, cancel := p.withTimeout(ctx)
+	defer cancel()
+
+	var member bool
+	err := p.db.QueryRowContext(ctx, `
+		SELECT EXISTS (
+			SELECT 1 FROM organization_members
+			WHERE org_id = CAST($1 AS INTEGER) AND user_id = CAST($2 AS INTEGER)
+		)
+	`, orgID, userID).Scan(&member)
+	return member, err
+}
+
+func (p *SQL) SessionActive(ctx context.Context, sessionID, userID string) (bool, error) {
+	ctx, cancel := p.withTimeout(ctx)
+	defer cancel()
+
+	var active bool
+	err := p.db.QueryRowContext(ctx, `
+		SELECT EXISTS (
+			SELECT 1 FROM sessions s
+			JOIN users u ON u.id = s.user_id
+			WHERE s.id = CAST($1 AS INTEGER) AND s.user_id = CAST($2 AS INTEGER)
+				AND s.expires_at > $3 AND u.disabled_at IS NULL AND u.deleted_at IS NULL
+		)
+	`, sessionID, userID, time.Now().UTC()).Scan(&active)
+	return active, err
+}
+
+func (p *SQL) DeletingSessionActive(ctx context.Context, sessionID, userID string) (bool, error) {
+	ctx, cancel := p.withTimeout(ctx)
+	defer cancel()
+
+	var active bool
+	err := p.db.QueryRowContext(ctx, `
+		SELECT EXISTS (
+			SELECT 1 FROM sessions s
+			JOIN users u ON u.id = s.user_id
+			WHERE s.id = CAST($1 AS INTEGER) AND s.user_id = CAST($2 AS INTEGER)
+				AND s.expires_at > $3 AND u.deleted_at IS NOT NULL
+		)
+	`, sessionID, userID, time.Now().UTC()).Scan(&active)
+	return active, err
+}
+
+func (p *SQL) APIKeyActive(ctx context.Context, keyID, userID string) (bool, error) {
+	ctx, cancel := p.withTimeout(ctx)
+	defer cancel()
+
+	var active bool
+	err := p.db.QueryRowContext(ctx, `
+		SELECT EXISTS (
+			SELECT 1 FROM api_keys k
+			JOIN users u ON u.id = k.user_id
+			WHERE k.id = CAST($1 AS INTEGER) AND k.user_id = CAST($2 AS INTEGER)
+				AND k.revoked_at IS NULL AND (k.expires_at IS NULL OR k.expires_at > $3)
+				AND u.disabled_at IS NULL AND u.deleted_at IS NULL
+		)
+	`, keyID, userID, time.Now().UTC()).Scan(&active)
+	return active, err
+}
+
+func (p *SQL) access(ctx context.Context, query, id, userID, orgID string) (string, error) {
+	ctx, cancel := p.withTimeout(ctx)
+	defer cancel()
+
+	var access string
+	err := p.db.QueryRowContext(ctx, query, id, userID, orgID).Scan(&access)
+	if errors.Is(err, sql.ErrNoRows) {
+		return AccessNone, nil
+	}
+	return access, err
+}
+
+func (p *SQL) FileAccess(ctx context.Context, fileID, userID, orgID string) (string, error) {
+	return p.access(ctx, fileAccessQuery, fileID, userID, orgID)
+}
+
+func (p *SQL) FolderAccess(ctx context.Context, folderID, userID, orgID string) (string, error) {
+	return p.access(ctx, folderAccessQuery, folderID, userID, orgID)
+}
+
+func (p *SQL) GetFile(ctx context.Context, fileID string) (*File, error) {
+	ctx, cancel := p.withTimeout(ctx)
+	defer cancel()
+
+	return scanFile(p.db.QueryRowContext(ctx, `SELECT `+fileColumns+` FROM files WHERE id = $1`, fileID))
+}
+
+// nullable returns nil for the zero value so it is stored as NULL
+func nullable[T comparable](v T) interface{} {
+	var zero T
+	if v == zero {
+		return nil
+	}
+	return v
+}
+
+func (p *SQL) CreateFile(ctx context.Context, file *File) error {
+	ctx, cancel := p.withTimeout(ctx)
+	defer cancel()
+
+	tx, err := p.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, `
+		INSERT INTO files (id, filename, content_type, size, user_id, org_id, folder_id, created_at)
+		VALUES ($1, $2, $3, $4, CAST($5 AS INTEGER), CAST($6 AS INTEGER), $7, $8)
+	`, file.ID, file.Filename, file.ContentType, file.Size, file.UserID, file.OrgID, nullable(file.FolderID), file.CreatedAt.UTC())
+	if err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, `DELETE FROM upload_reservations WHERE id = $1`, file.ID); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (p *SQL) GetFolder(ctx context.Context, folderID string) (*Folder, error) {
+	ctx, cancel := p.withTimeout(ctx)
+	defer cancel()
+
+	var f Folder
+	var parentID *string
+	err := p.db.QueryRowContext(ctx, `
+		SELECT id, name, parent_id, user_id, org_id, created_at
+		FROM folders
+		WHERE id = $1
+	`, folderID).Scan(&f.ID, &f.Name, &parentID, &f.UserID, &f.OrgID, &f.CreatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	if parentID != nil {
+		f.ParentID = *parentID
+	}
+	return &f, nil
+}
+
+func (p *SQL) CreateFolder(ctx context.Context, folder *Folder) error {
+	ctx, cancel := p.withTimeout(ctx)
+	defer cancel()
+
+	_, err := p.db.ExecContext(ctx, `
+		INSERT INTO folders (id, name, parent_id, user_id, org_id, created_at)
+		VALUES ($1, $2, $3, CAST($4 AS INTEGER), CAST($5 AS INTEGER), $6)
+	`, folder.ID, folder.Name, nullable(folder.ParentID), folder.UserID, folder.OrgID, folder.CreatedAt.UTC())
+	return err
+}
+
+func (p *SQL) GetQuota(ctx context.Context, userID, orgID string) (*Quota, error) {
+	ctx, cancel := p.withTimeout(ctx)
+	defer cancel()
+
+	return getQuota(ctx, p.db, userID, orgID, "", time.Now())
+}
+
+// getQuota runs quotaQuery, leaving out the reservation with ID excludeID
+func getQuota(ctx context.Context, db interface {
+	QueryRowContext(context.Context, string, ...interface{}) *sql.Row
+}, userID, orgID, excludeID string, now time.Time) (*Quota, error) {
+	q := &Quota{}
+	err := db.QueryRowContext(ctx, quotaQuery, userID, orgID, excludeID, now.UTC()).
+		Scan(&q.MaxStorageBytes, &q.MaxFileSize, &q.UsedBytes, &q.FileCount, &q.OrgMaxStorageBytes, &q.OrgUsedBytes)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return q, nil
+}
+
+func (p *SQL) ReserveStorage(ctx context.Context, id, userID, orgID string, bytes int64, expires time.Time) (*Quota, bool, error) {
+	ctx, cancel := p.withTimeout(ctx)
+	defer cancel()
+
+	tx, err := p.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, false, err
+	}
+	defer tx.Rollback()
+
+	// Lock the user's and the organization's rows so that reservations against
+	// either are checked one at a time; SQLite has a single writer anyway
+	for _, lock := range []struct{ table, id string }{{"users", userID}, {"organizations", orgID}} {
+		if _, err := tx.ExecContext(ctx, `UPDATE `+lock.table+` SET id = id WHERE id = CAST($1 AS INTEGER)`, lock.id); err != nil {
+			return nil, false, err
+		}
+	}
+
+	now := time.Now()
+	q, err := getQuota(ctx, tx, userID, orgID, id, now)
+	if err != nil {
+		return nil, false, err
+	}
+	if !q.Fits(bytes) {
+		return q, false, nil
+	}
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM upload_reservations WHERE expires_at <= $1`, now.UTC()); err != nil {
+		return nil, false, err
+	}
+	_, err = tx.ExecContext(ctx, `
+		INSERT INTO upload_reservations (id, user_id, org_id, bytes, expires_at)
+		VALUES ($1, CAST($2 AS INTEGER), CAST($3 AS INTEGER), $4, $5)
+		ON CONFLICT (id) DO UPDATE SET bytes = EXCLUDED.bytes, expires_at = EXCLUDED.expires_at
+	`, id, userID, orgID, bytes, expires.UTC())
+	if err != nil {
+		return nil, false, err
+	}
+	return q, true, tx.Commit()
+}
+
+func (p *SQL) ReleaseStorage(ctx context.Context, id string) error {
+	ctx, cancel := p.withTimeout(ctx)
+	defer cancel()
+
+	_, err := p.db.ExecContext(ctx, `DELETE FROM upload_reservations WHERE id = $1`, id)
+	return err
+}
+
+func (p *SQL) MemberRole(ctx context.Context, orgID, userID string) (string, error) {
+	ctx, cancel := p.withTimeout(ctx)
+	defer cancel()
+
+	var role string
+	err := p.db.QueryRowContext(ctx, `
+		SELECT role FROM organization_members
+		WHERE org_id = CAST($1 AS INTEGER) AND user_id = CAST($2 AS INTEGER)
+	`, orgID, userID).Scan(&role)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", nil
+	}
+	return role, err
+}
+
+// listFiles runs a query selecting fileColumns
+func (p *SQL) listFiles(ctx context.Context, query string, args ...interface{}) ([]File, error) {
+	ctx, cancel := p.withTimeout(ctx)
+	defer cancel()
+
+	rows, err := p.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var files []File
+	for rows.Next() {
+		f, err := scanFile(rows)
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, *f)
+	}
+	return files, rows.Err()
+}
+
+func (p *SQL) ListUserFiles(ctx context.Context, userID string) ([]File, error) {
+	return p.listFiles(ctx, `SELECT `+fileColumns+` FROM files WHERE user_id = CAST($1 AS INTEGER)`, userID)
+}
+
+func (p *SQL) ListOrgFiles(ctx context.Context, orgID string) ([]File, error) {
+	return p.listFiles(ctx, `SELECT `+fileColumns+` FROM files WHERE org_id = CAST($1 AS INTEGER)`, orgID)
+}
+
+func (p *SQL) TransferFiles(ctx context.Context, userID, orgID, toUserID string) (int64, error) {
+	ctx, cancel := p.withTimeout(ctx)
+	defer cancel()
+
+	tx, err := p.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	res, err := tx.ExecContext(ctx, `
+		UPDATE files SET user_id = CAST($3 AS INTEGER)
+		WHERE user_id = CAST($1 AS INTEGER) AND org_id = CAST($2 AS INTEGER)
+	`, userID, orgID, toUserID)
+	if err != nil {
+		return 0, err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+	_, err = tx.ExecContext(ctx, `
+		UPDATE folders SET user_id = CAST($3 AS INTEGER)
+		WHERE user_id = CAST($1 AS INTEGER) AND org_id = CAST($2 AS INTEGER)
+	`, userID, orgID, toUserID)
+	if err != nil {
+		return 0, err
+	}
+	return n, tx.Commit()
+}
+
+func (p *SQL) DeleteFile(ctx context.Context, fileID string) error {
+	ctx, cancel := p.withTimeout(ctx)
+	defer cancel()
+
+	_, err := p.db.ExecContext(ctx, `DELETE FROM files WHERE id = $1`, fileID)
+	return err
+}
@@ -0,0 +1,115 @@
+// Package store holds the file metadata repository used by the upload service,
+// with a SQL implementation for Postgres or SQLite and an in-memory one for tests.
+package store
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// ErrNotFound is returned when the requested row does not exist
+var ErrNotFound = errors.New("not found")
+
+// Access levels a user can hold on a file or folder
+const (
+	AccessNone      = ""
+	AccessRead      = "read"
+	AccessReadWrite = "read_write"
+	AccessOwner     = "owner"
+)
+
+// File is the stored metadata of an uploaded file
+type File struct {
+	ID          string
+	Filename    string
+	ContentType string
+	Size        int64
+	UserID      string
+	OrgID       string
+	FolderID    string // Empty for files outside any folder
+	CreatedAt   time.Time
+}
+
+// Folder groups files; ParentID is empty for top-level folders
+type Folder struct {
+	ID        string
+	Name      string
+	ParentID  string
+	UserID    string
+	OrgID     string
+	CreatedAt time.Time
+}
+
+// Quota holds a user's storage limits and usage together with those of an
+// organization. Nil limits are unlimited. Used bytes count stored files and
+// the storage reserved by uploads in progress.
+type Quota struct {
+	MaxStorageBytes    *int64
+	MaxFileSize        *int64
+	UsedBytes          int64
+	FileCount          int64
+	OrgMaxStorageBytes *int64
+	OrgUsedBytes       int64
+}
+
+// Fits reports whether bytes more fit in both the user's and the
+// organization's storage limit
+func (q *Quota) Fits(bytes int64) bool {
+	fits := func(limit *int64, used int64) bool {
+		return limit == nil || used+bytes <= *limit
+	}
+	return fits(q.MaxStorageBytes, q.UsedBytes) && fits(q.OrgMaxStorageBytes, q.OrgUsedBytes)
+}
+
+// FileStore is the data the upload service reads and writes
+type FileStore interface {
+	// IsMember reports whether the user belongs to the organization
+	IsMember(ctx context.Context, orgID, userID string) (bool, error)
+	// SessionActive reports whether the user's login session has neither been
+	// logged out nor expired, and the user is neither disabled nor deleting
+	// their account
+	SessionActive(ctx context.Context, sessionID, userID string) (bool, error)
+	// APIKeyActive reports whether the user's API key is neither revoked nor
+	// expired, and the user is neither disabled nor deleting their account
+	APIKeyActive(ctx context.Context, keyID, userID string) (bool, error)
+	// DeletingSessionActive reports whether the user's login session has
+	// neither been logged out nor expired, and the user is deleting their account
+	DeletingSessionActive(ctx context.Context, sessionID, userID string) (bool, error)
+	// FileAccess returns the user's access to a file while acting in orgID,
+	// AccessNone if the file does not exist or the user cannot see it
+	FileAccess(ctx context.Context, fileID, userID, orgID string) (string, error)
+	// FolderAccess is FileAccess for folders
+	FolderAccess(ctx context.Context, folderID, userID, orgID string) (string, error)
+
+	GetFile(ctx context.Context, fileID string) (*File, error)
+	// CreateFile stores a file's metadata and drops the reservation with the file's ID
+	CreateFile(ctx context.Context, file *File) error
+	GetFolder(ctx context.Context, folderID string) (*Folder, error)
+	CreateFolder(ctx context.Context, folder *Folder) error
+
+	// GetQuota loads the user's limits, falling back from user overrides to role
+	// defaults, and the limits of the organization an upload goes to
+	GetQuota(ctx context.Context, userID, orgID string) (*Quota, error)
+	// ReserveStorage sets the bytes reservation id holds for an upload by the
+	// user into the organization until expires, if they fit in both storage
+	// limits next to the stored files and other reservations. Reservations
+	// are made one at a time, so parallel uploads cannot together exceed a
+	// limit. It returns the quota checked, whose usage leaves out reservation
+	// id, and whether the bytes were reserved.
+	ReserveStorage(ctx context.Context, id, userID, orgID string, bytes int64, expires time.Time) (*Quota, bool, error)
+	// ReleaseStorage drops a reservation of an upload that did not complete
+	ReleaseStorage(ctx context.Context, id string) error
+
+	// MemberRole returns the user's role in the organization, or "" if they are not a member
+	MemberRole(ctx context.Context, orgID, userID string) (string, error)
+	// ListUserFiles returns the files the user uploaded, in every organization
+	ListUserFiles(ctx context.Context, userID string) ([]File, error)
+	// ListOrgFiles returns the files owned by an organization
+	ListOrgFiles(ctx context.Context, orgID string) ([]File, error)
+	// TransferFiles gives the user's files and folders in the organization to
+	// another user and returns how many files there were
+	TransferFiles(ctx context.Context, userID, orgID, toUserID string) (int64, error)
+	// DeleteFile deletes the metadata of a file, with its share links and grants
+	DeleteFile(ctx context.Context, fileID string) error
+}
@@ -0,0 +1,50 @@
+package upload
+
+import (
+	"context"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"file-service/apperr"
+	"file-service/auth"
+	"file-service/upload-service/store"
+)
+
+// Access levels a user can hold on a file or folder
+const (
+	accessNone      = store.AccessNone
+	accessRead      = store.AccessRead
+	accessReadWrite = store.AccessReadWrite
+	accessOwner     = store.AccessOwner
+)
+
+// getFileAccess returns the user's access level on a file.
+// Missing files and files the user cannot see both return NotFound.
+func (s *server) getFileAccess(ctx context.Context, fileID string, caller *auth.Identity) (string, error) {
+	access, err := s.store.FileAccess(ctx, fileID, caller.UserID, caller.OrgID)
+	return checkAccess(ctx, access, err, apperr.New(codes.NotFound, apperr.FileNotFound, "file not found"))
+}
+
+// getFolderAccess returns the user's access level on a folder.
+// Missing folders and folders the user cannot see both return NotFound.
+func (s *server) getFolderAccess(ctx context.Context, folderID string, caller *auth.Identity) (string, error) {
+	access, err := s.store.FolderAccess(ctx, folderID, caller.UserID, caller.OrgID)
+	return checkAccess(ctx, access, err, apperr.New(codes.NotFound, apperr.FolderNotFound, "folder not found"))
+}
+
+func checkAccess(ctx context.Context, access string, err error, notFound *apperr.Error) (string, error) {
+	if err != nil {
+		logger.ErrorContext(ctx, "Access query error", "error", err)
+		return accessNone, status.Error(codes.Internal, "failed to check access")
+	}
+	if access == accessNone {
+		return accessNone, notFound
+	}
+	return access, nil
+}
+
+// canWrite reports whether an access level allows adding to or managing a resource
+func canWrite(access string) bool {
+	return access == accessReadWrite || access == accessOwner
+}
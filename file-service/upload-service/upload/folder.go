@@ -0,0 +1,67 @@
+package upload
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"file-service/apperr"
+	pb "file-service/proto/upload"
+	"file-service/upload-service/store"
+)
+
+func (s *server) CreateFolder(ctx context.Context, req *pb.CreateFolderRequest) (*pb.Folder, error) {
+	// Get the caller from the JWT token
+	caller, err := s.auth.Authenticate(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	name := strings.TrimSpace(req.Name)
+	if name == "" {
+		return nil, status.Error(codes.InvalidArgument, "folder name is required")
+	}
+
+	// Creating a subfolder requires write access to the parent, and the
+	// subfolder belongs to the parent's organization
+	folder := &store.Folder{
+		ID:        uuid.New().String(),
+		Name:      name,
+		ParentID:  req.ParentId,
+		UserID:    caller.UserID,
+		OrgID:     caller.OrgID,
+		CreatedAt: time.Now(),
+	}
+	if req.ParentId != "" {
+		access, err := s.getFolderAccess(ctx, req.ParentId, caller)
+		if err != nil {
+			return nil, err
+		}
+		if !canWrite(access) {
+			return nil, apperr.New(codes.PermissionDenied, apperr.NoWriteAccess, "no write access to parent folder")
+		}
+		parent, err := s.store.GetFolder(ctx, req.ParentId)
+		if err != nil {
+			return nil, status.Error(codes.Internal, "failed to look up parent folder")
+		}
+		folder.OrgID = parent.OrgID
+	}
+
+	if err := s.store.CreateFolder(ctx, folder); err != nil {
+		logger.ErrorContext(ctx, "Failed to save folder", "error", err)
+		return nil, status.Error(codes.Internal, "failed to create folder")
+	}
+
+	return &pb.Folder{
+		Id:        folder.ID,
+		Name:      folder.Name,
+		ParentId:  folder.ParentID,
+		UserId:    folder.UserID,
+		CreatedAt: folder.CreatedAt.Format(time.RFC3339),
+		OrgId:     folder.OrgID,
+	}, nil
+}
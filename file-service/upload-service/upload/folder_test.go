@@ -0,0 +1,62 @@
+package upload
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"google.golang.org/grpc/metadata"
+
+	"file-service/apperr"
+	"file-service/auth"
+	pb "file-service/proto/upload"
+	"file-service/upload-service/store"
+)
+
+func TestCreateFolderAccess(t *testing.T) {
+	secret := []byte("jwt secret")
+	ctx := context.Background()
+	m := store.NewMemory()
+	m.AddUser("1", "user")
+	m.AddUser("2", "user")
+	m.AddMember("1", "1", "owner")
+	m.AddMember("2", "2", "owner")
+	if err := m.CreateFolder(ctx, &store.Folder{ID: "docs", Name: "docs", UserID: "1", OrgID: "1"}); err != nil {
+		t.Fatal(err)
+	}
+	s := &server{store: m, auth: auth.NewVerifier("upload", secret, m)}
+
+	// Bob acts in his own organization, with whatever access Alice grants him
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"user_id": 2, "org_id": 2, "sid": 20, "exp": time.Now().Add(time.Hour).Unix(),
+	}).SignedString(secret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bob := metadata.NewIncomingContext(ctx, metadata.Pairs("authorization", "Bearer "+token))
+
+	tests := []struct {
+		access string
+		code   apperr.Code
+	}{
+		{access: store.AccessNone, code: apperr.FolderNotFound},
+		{access: store.AccessRead, code: apperr.NoWriteAccess},
+		{access: store.AccessReadWrite},
+	}
+	for _, tt := range tests {
+		t.Run(tt.access, func(t *testing.T) {
+			if tt.access != store.AccessNone {
+				m.Grant("", "docs", "2", tt.access)
+			}
+			folder, err := s.CreateFolder(bob, &pb.CreateFolderRequest{Name: "sub", ParentId: "docs"})
+			if codeOf(err) != tt.code {
+				t.Fatalf("CreateFolder() = %v, want code %q", err, tt.code)
+			}
+			// Subfolders belong to the organization of their parent
+			if err == nil && folder.OrgId != "1" {
+				t.Errorf("CreateFolder() in organization %s, want 1", folder.OrgId)
+			}
+		})
+	}
+}
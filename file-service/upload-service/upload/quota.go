@@ -0,0 +1,214 @@
+package upload
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"file-service/apperr"
+	pb "file-service/proto/upload"
+	"file-service/upload-service/store"
+)
+
+// unlimited marks a storage or file size limit that is not enforced
+const unlimited int64 = -1
+
+// storageQuota holds the effective limits and current usage for a user
+// uploading into an organization
+type storageQuota struct {
+	maxStorageBytes    int64
+	maxFileSize        int64
+	usedBytes          int64
+	fileCount          int64
+	orgMaxStorageBytes int64
+	orgUsedBytes       int64
+}
+
+// getStorageQuota loads the user's quota, falling back from user overrides to role
+// defaults, together with the quota of the organization the upload goes to
+func (s *server) getStorageQuota(ctx context.Context, userID string, orgID string) (*storageQuota, error) {
+	stored, err := s.store.GetQuota(ctx, userID, orgID)
+	if err != nil {
+		return nil, quotaError(ctx, err)
+	}
+	return s.newStorageQuota(stored), nil
+}
+
+// quotaError converts a failure to load a quota to the error callers see
+func quotaError(ctx context.Context, err error) error {
+	if errors.Is(err, store.ErrNotFound) {
+		return apperr.New(codes.NotFound, apperr.UserNotFound, "user or organization not found")
+	}
+	logger.ErrorContext(ctx, "Quota query error", "error", err)
+	return status.Error(codes.Internal, "failed to load storage quota")
+}
+
+// newStorageQuota returns the effective limits of a stored quota
+func (s *server) newStorageQuota(stored *store.Quota) *storageQuota {
+	q := &storageQuota{
+		maxStorageBytes:    limit(stored.MaxStorageBytes),
+		maxFileSize:        limit(stored.MaxFileSize),
+		usedBytes:          stored.UsedBytes,
+		fileCount:          stored.FileCount,
+		orgMaxStorageBytes: limit(stored.OrgMaxStorageBytes),
+		orgUsedBytes:       stored.OrgUsedBytes,
+	}
+
+	// The server-wide file size limit applies on top of the user's own
+	if s.maxFileSize > 0 && (q.maxFileSize == unlimited || s.maxFileSize < q.maxFileSize) {
+		q.maxFileSize = s.maxFileSize
+	}
+	return q
+}
+
+// limit converts a stored limit to its value, or unlimited if it is not set
+func limit(v *int64) int64 {
+	if v == nil {
+		return unlimited
+	}
+	return *v
+}
+
+// remainingBytes returns how much of a storage limit is left
+func remainingBytes(limit int64, used int64) int64 {
+	if limit == unlimited {
+		return unlimited
+	}
+	if used >= limit {
+		return 0
+	}
+	return limit - used
+}
+
+// remaining returns the bytes the user may still store
+func (q *storageQuota) remaining() int64 {
+	return remainingBytes(q.maxStorageBytes, q.usedBytes)
+}
+
+// orgRemaining returns the bytes the organization may still store
+func (q *storageQuota) orgRemaining() int64 {
+	return remainingBytes(q.orgMaxStorageBytes, q.orgUsedBytes)
+}
+
+// checkSize returns ResourceExhausted if a file of the given size would break a
+// limit, with the limit and what is left of it in the details
+func (q *storageQuota) checkSize(size int64) error {
+	if q.maxFileSize != unlimited && size > q.maxFileSize {
+		return apperr.New(codes.ResourceExhausted, apperr.FileTooLarge,
+			fmt.Sprintf("file exceeds maximum size of %d bytes", q.maxFileSize)).
+			With("max_file_size", q.maxFileSize)
+	}
+	if remaining := q.remaining(); remaining != unlimited && size > remaining {
+		return apperr.New(codes.ResourceExhausted, apperr.QuotaExceeded,
+			fmt.Sprintf("storage quota exceeded: %d bytes remaining", remaining)).
+			With("scope", "user").With("quota_bytes", q.maxStorageBytes).With("remaining_bytes", remaining)
+	}
+	if remaining := q.orgRemaining(); remaining != unlimited && size > remaining {
+		return apperr.New(codes.ResourceExhausted, apperr.QuotaExceeded,
+			fmt.Sprintf("organization storage quota exceeded: %d bytes remaining", remaining)).
+			With("scope", "organization").With("quota_bytes", q.orgMaxStorageBytes).With("remaining_bytes", remaining)
+	}
+	return nil
+}
+
+// reservationTTL is how long a reservation counts if the upload never
+// settles it, say because the service crashed
+const reservationTTL = 24 * time.Hour
+
+// reservationStep is how much more than received is reserved at a time for
+// an upload of undeclared size, so that not every chunk costs a query
+const reservationStep int64 = 8 << 20
+
+// reservation is the storage held in the store for an upload in progress,
+// which counts as used for every other upload until CreateFile replaces it
+// with the file or it is released
+type reservation struct {
+	s                 *server
+	id, userID, orgID string
+	stepped           bool          // The size is not declared, reserve ahead
+	bytes             int64         // Bytes held
+	quota             *storageQuota // Limits, and usage without this reservation
+}
+
+// reserveStorage reserves the declared size of the upload of file id into the
+// organization, or a first step if the size is not declared. It returns
+// ResourceExhausted if the size breaks a limit; the reservation must be
+// released either way.
+func (s *server) reserveStorage(ctx context.Context, id, userID, orgID string, declared int64) (*reservation, error) {
+	r := &reservation{s: s, id: id, userID: userID, orgID: orgID, stepped: declared == 0}
+	return r, r.grow(ctx, declared)
+}
+
+// grow makes sure size bytes are reserved, returning ResourceExhausted if a
+// file of that size breaks a limit
+func (r *reservation) grow(ctx context.Context, size int64) error {
+	if r.quota != nil {
+		if err := r.quota.checkSize(size); err != nil {
+			return err
+		}
+		if size <= r.bytes {
+			return nil
+		}
+	}
+
+	// Reserve ahead if the size is not declared, or just what is needed if
+	// there is no room for more
+	want := size
+	if r.stepped {
+		want += reservationStep
+	}
+	expires := time.Now().Add(reservationTTL)
+	stored, ok, err := r.s.store.ReserveStorage(ctx, r.id, r.userID, r.orgID, want, expires)
+	if err == nil && !ok && want > size {
+		want = size
+		stored, ok, err = r.s.store.ReserveStorage(ctx, r.id, r.userID, r.orgID, want, expires)
+	}
+	if err != nil {
+		return quotaError(ctx, err)
+	}
+
+	r.quota = r.s.newStorageQuota(stored)
+	if ok {
+		r.bytes = want
+	}
+	if err := r.quota.checkSize(size); err != nil || ok {
+		return err
+	}
+	return apperr.New(codes.ResourceExhausted, apperr.QuotaExceeded, "storage quota exceeded")
+}
+
+// release drops the reservation, a no-op once CreateFile has replaced it with the file
+func (r *reservation) release(ctx context.Context) {
+	// Release even if the client went away, which cancels ctx
+	if err := r.s.store.ReleaseStorage(context.WithoutCancel(ctx), r.id); err != nil {
+		logger.ErrorContext(ctx, "Failed to release storage reservation", "error", err)
+	}
+}
+
+func (s *server) GetStorageUsage(ctx context.Context, req *pb.GetStorageUsageRequest) (*pb.StorageUsage, error) {
+	// Get the caller from the JWT token
+	caller, err := s.auth.Authenticate(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	q, err := s.getStorageQuota(ctx, caller.UserID, caller.OrgID)
+	if err != nil {
+		return nil, err
+	}
+
+	return &pb.StorageUsage{
+		UsedBytes:         q.usedBytes,
+		QuotaBytes:        q.maxStorageBytes,
+		RemainingBytes:    q.remaining(),
+		MaxFileSize:       q.maxFileSize,
+		FileCount:         q.fileCount,
+		OrgUsedBytes:      q.orgUsedBytes,
+		OrgQuotaBytes:     q.orgMaxStorageBytes,
+		OrgRemainingBytes: q.orgRemaining(),
+	}, nil
+}
@@ -0,0 +1,210 @@
+package upload
+
+import (
+	"context"
+	"errors"
+	"io"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"file-service/apperr"
+	pb "file-service/proto/upload"
+	"file-service/upload-service/store"
+)
+
+// newQuotaServer returns a server over a memory store where user 1 of role
+// "user" belongs to organization 1, with the given limits; nil is unlimited
+func newQuotaServer(userLimit, orgLimit, fileLimit *int64) (*server, *store.Memory) {
+	m := store.NewMemory()
+	m.AddUser("1", "user")
+	m.AddOrganization("1", orgLimit)
+	m.AddMember("1", "1", "owner")
+	m.SetRoleQuota("user", userLimit, fileLimit)
+	return &server{store: m}, m
+}
+
+func bytes(n int64) *int64 {
+	return &n
+}
+
+func TestReserveStorage(t *testing.T) {
+	tests := []struct {
+		name      string
+		userLimit *int64
+		orgLimit  *int64
+		fileLimit *int64
+		serverMax int64
+		stored    int64 // Size of a file the user already has
+		size      int64
+		code      apperr.Code
+	}{
+		{name: "unlimited", size: 1 << 30},
+		{name: "fits", userLimit: bytes(100), size: 100},
+		{name: "over user quota", userLimit: bytes(100), size: 101, code: apperr.QuotaExceeded},
+		{name: "counts stored files", userLimit: bytes(100), stored: 60, size: 50, code: apperr.QuotaExceeded},
+		{name: "fits beside stored files", userLimit: bytes(100), stored: 60, size: 40},
+		{name: "over organization quota", userLimit: bytes(1000), orgLimit: bytes(100), size: 101, code: apperr.QuotaExceeded},
+		{name: "over file size limit", fileLimit: bytes(10), size: 11, code: apperr.FileTooLarge},
+		{name: "over server file size limit", serverMax: 10, size: 11, code: apperr.FileTooLarge},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, m := newQuotaServer(tt.userLimit, tt.orgLimit, tt.fileLimit)
+			s.maxFileSize = tt.serverMax
+			if tt.stored > 0 {
+				m.CreateFile(context.Background(), &store.File{ID: "stored", Size: tt.stored, UserID: "1", OrgID: "1"})
+			}
+
+			r, err := s.reserveStorage(context.Background(), "new", "1", "1", tt.size)
+			defer r.release(context.Background())
+			if code := codeOf(err); code != tt.code {
+				t.Errorf("reserveStorage() error = %v, want code %q", err, tt.code)
+			}
+		})
+	}
+}
+
+func TestReservationsCountAgainstOtherUploads(t *testing.T) {
+	ctx := context.Background()
+	s, m := newQuotaServer(bytes(100), nil, nil)
+
+	first, err := s.reserveStorage(ctx, "first", "1", "1", 60)
+	if err != nil {
+		t.Fatalf("first reserveStorage() error = %v", err)
+	}
+	second, err := s.reserveStorage(ctx, "second", "1", "1", 60)
+	if codeOf(err) != apperr.QuotaExceeded {
+		t.Fatalf("second reserveStorage() error = %v, want code %q", err, apperr.QuotaExceeded)
+	}
+	second.release(ctx)
+
+	// Storing the first file replaces its reservation, and releasing it
+	// afterwards changes nothing
+	m.CreateFile(ctx, &store.File{ID: "first", Size: 60, UserID: "1", OrgID: "1"})
+	first.release(ctx)
+	q, err := m.GetQuota(ctx, "1", "1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if q.UsedBytes != 60 {
+		t.Errorf("used bytes = %d, want 60", q.UsedBytes)
+	}
+
+	third, err := s.reserveStorage(ctx, "third", "1", "1", 40)
+	if err != nil {
+		t.Errorf("third reserveStorage() error = %v", err)
+	}
+	third.release(ctx)
+}
+
+func TestParallelReservations(t *testing.T) {
+	ctx := context.Background()
+	s, _ := newQuotaServer(bytes(100), nil, nil)
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	reserved := 0
+	for _, id := range []string{"a", "b", "c", "d", "e", "f"} {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := s.reserveStorage(ctx, id, "1", "1", 60); err == nil {
+				mu.Lock()
+				reserved++
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	if reserved != 1 {
+		t.Errorf("%d uploads reserved storage, want 1", reserved)
+	}
+}
+
+func TestGrowUndeclaredSize(t *testing.T) {
+	ctx := context.Background()
+	limit := reservationStep + 100
+	s, m := newQuotaServer(&limit, nil, nil)
+
+	tests := []struct {
+		name     string
+		size     int64
+		reserved int64 // What the store holds afterwards
+		code     apperr.Code
+	}{
+		{name: "reserves a step ahead", size: 0, reserved: reservationStep},
+		{name: "within the step", size: reservationStep - 1, reserved: reservationStep},
+		{name: "no room for another step", size: reservationStep + 50, reserved: reservationStep + 50},
+		{name: "over quota", size: limit + 1, reserved: reservationStep + 50, code: apperr.QuotaExceeded},
+	}
+	r := &reservation{s: s, id: "upload", userID: "1", orgID: "1", stepped: true}
+	defer r.release(ctx)
+	for _, tt := range tests {
+		err := r.grow(ctx, tt.size)
+		if code := codeOf(err); code != tt.code {
+			t.Fatalf("%s: grow(%d) error = %v, want code %q", tt.name, tt.size, err, tt.code)
+		}
+		q, err := m.GetQuota(ctx, "1", "1")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if q.UsedBytes != tt.reserved {
+			t.Errorf("%s: reserved %d bytes, want %d", tt.name, q.UsedBytes, tt.reserved)
+		}
+	}
+}
+
+// chunkStream is an upload stream of file chunks
+type chunkStream struct {
+	pb.FileUpload_UploadFileServer
+	chunks [][]byte
+}
+
+func (c *chunkStream) Context() context.Context {
+	return context.Background()
+}
+
+func (c *chunkStream) Recv() (*pb.UploadFileRequest, error) {
+	if len(c.chunks) == 0 {
+		return nil, io.EOF
+	}
+	chunk := c.chunks[0]
+	c.chunks = c.chunks[1:]
+	return &pb.UploadFileRequest{Data: &pb.UploadFileRequest_Chunk{Chunk: chunk}}, nil
+}
+
+func TestReceiveFileOverDeclaredSize(t *testing.T) {
+	ctx := context.Background()
+	s, m := newQuotaServer(bytes(30), nil, nil)
+	r, err := s.reserveStorage(ctx, "upload", "1", "1", 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.release(ctx)
+
+	// Sending more than declared is a size mismatch, whatever the quota, and
+	// reserves nothing more
+	dir := t.TempDir()
+	stream := &chunkStream{chunks: [][]byte{make([]byte, 8), make([]byte, 42)}}
+	_, err = receiveFile(stream, filepath.Join(dir, "staging"), filepath.Join(dir, "file"), 10, r)
+	if codeOf(err) != apperr.SizeMismatch {
+		t.Errorf("receiveFile() error = %v, want code %q", err, apperr.SizeMismatch)
+	}
+	q, err := m.GetQuota(ctx, "1", "1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if q.UsedBytes != 10 {
+		t.Errorf("reserved %d bytes, want 10", q.UsedBytes)
+	}
+}
+
+// codeOf returns the code of an *apperr.Error, or "" for nil
+func codeOf(err error) apperr.Code {
+	var e *apperr.Error
+	if errors.As(err, &e) {
+		return e.Code
+	}
+	return ""
+}
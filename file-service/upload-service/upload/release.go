@@ -0,0 +1,100 @@
+package upload
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"file-service/apperr"
+	pb "file-service/proto/upload"
+	"file-service/upload-service/store"
+)
+
+func (s *server) ReleaseUserFiles(ctx context.Context, req *pb.ReleaseUserFilesRequest) (*pb.ReleaseUserFilesResponse, error) {
+	// Get the caller from the JWT token of the session deleting the account,
+	// which no other RPC accepts any more
+	caller, err := s.auth.AuthenticateDeletion(ctx)
+	if err != nil {
+		return nil, err
+	}
+	// Only the user's own login can give away or delete all of their files
+	if err := caller.RequireLogin(); err != nil {
+		return nil, err
+	}
+
+	// Organizations are only emptied by their owner, and files only go to
+	// members of their organization
+	deleteOrgs := map[string]bool{}
+	for _, orgID := range req.DeleteOrgIds {
+		role, err := s.store.MemberRole(ctx, orgID, caller.UserID)
+		if err != nil {
+			logger.ErrorContext(ctx, "Membership query error", "error", err)
+			return nil, status.Error(codes.Internal, "failed to check membership")
+		}
+		if role != "owner" {
+			return nil, apperr.New(codes.PermissionDenied, apperr.OwnerOnly, "only owners can delete an organization's files").
+				With("org_id", orgID)
+		}
+		deleteOrgs[orgID] = true
+	}
+	for orgID, userID := range req.TransferTo {
+		member, err := s.store.IsMember(ctx, orgID, userID)
+		if err != nil {
+			logger.ErrorContext(ctx, "Membership query error", "error", err)
+			return nil, status.Error(codes.Internal, "failed to check membership")
+		}
+		if !member || deleteOrgs[orgID] {
+			return nil, apperr.New(codes.FailedPrecondition, apperr.NotOrgMember, "files can only go to a member of their organization").
+				With("org_id", orgID)
+		}
+	}
+
+	res := &pb.ReleaseUserFilesResponse{}
+	for orgID, userID := range req.TransferTo {
+		n, err := s.store.TransferFiles(ctx, caller.UserID, orgID, userID)
+		if err != nil {
+			logger.ErrorContext(ctx, "Failed to transfer files", "error", err)
+			return nil, status.Error(codes.Internal, "failed to transfer files")
+		}
+		res.TransferredFiles += n
+	}
+
+	// What was not transferred is deleted, each file's metadata before its
+	// contents, so that no file is listed without them
+	files, err := s.store.ListUserFiles(ctx, caller.UserID)
+	for orgID := range deleteOrgs {
+		if err != nil {
+			break
+		}
+		var orgFiles []store.File
+		orgFiles, err = s.store.ListOrgFiles(ctx, orgID)
+		files = append(files, orgFiles...)
+	}
+	if err != nil {
+		logger.ErrorContext(ctx, "Database query error", "error", err)
+		return nil, status.Error(codes.Internal, "failed to query files")
+	}
+	deleted := map[string]bool{}
+	for _, f := range files {
+		if deleted[f.ID] {
+			continue
+		}
+		if err := s.store.DeleteFile(ctx, f.ID); err != nil {
+			logger.ErrorContext(ctx, "Failed to delete file metadata", "error", err)
+			return nil, status.Error(codes.Internal, "failed to delete files")
+		}
+		if err := os.Remove(filepath.Join(s.uploadDir, f.ID)); err != nil && !errors.Is(err, os.ErrNotExist) {
+			logger.WarnContext(ctx, "Failed to delete file contents", "file_id", f.ID, "error", err)
+		}
+		deleted[f.ID] = true
+		res.DeletedFiles++
+		res.DeletedBytes += f.Size
+	}
+
+	logger.InfoContext(ctx, "Released user files", "transferred", res.TransferredFiles, "deleted", res.DeletedFiles)
+	return res, nil
+}
@@ -0,0 +1,82 @@
+package upload
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"google.golang.org/grpc/metadata"
+
+	"file-service/apperr"
+	"file-service/auth"
+	pb "file-service/proto/upload"
+	"file-service/upload-service/store"
+)
+
+func TestReleaseUserFiles(t *testing.T) {
+	secret := []byte("jwt secret")
+	newServer := func() (*server, *store.Memory) {
+		m := store.NewMemory()
+		m.AddUser("1", "user")
+		m.AddUser("2", "user")
+		m.AddMember("1", "1", "owner")
+		m.AddMember("2", "1", "owner")
+		m.AddMember("2", "2", "owner")
+		return &server{uploadDir: t.TempDir(), store: m, auth: auth.NewVerifier("upload", secret, m)}, m
+	}
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"user_id": 1, "org_id": 1, "sid": 10, "exp": time.Now().Add(time.Hour).Unix(),
+	}).SignedString(secret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req := &pb.ReleaseUserFilesRequest{DeleteOrgIds: []string{"1"}, TransferTo: map[string]string{"2": "2"}}
+
+	tests := []struct {
+		name   string
+		change func(m *store.Memory)
+		code   apperr.Code
+	}{
+		{name: "deleting the account", change: func(m *store.Memory) { m.MarkDeleting("1") }},
+		{name: "not deleting the account", change: func(m *store.Memory) {}, code: apperr.SessionRevoked},
+		{name: "session logged out", change: func(m *store.Memory) { m.MarkDeleting("1"); m.EndSession("10") }, code: apperr.SessionRevoked},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, m := newServer()
+			ctx := context.Background()
+			for _, f := range []store.File{
+				{ID: "personal", UserID: "1", OrgID: "1", Size: 3},
+				{ID: "shared", UserID: "1", OrgID: "2", Size: 5},
+			} {
+				if err := m.CreateFile(ctx, &f); err != nil {
+					t.Fatal(err)
+				}
+				if err := os.WriteFile(filepath.Join(s.uploadDir, f.ID), []byte("data"), 0o600); err != nil {
+					t.Fatal(err)
+				}
+			}
+			tt.change(m)
+
+			res, err := s.ReleaseUserFiles(metadata.NewIncomingContext(ctx, metadata.Pairs("authorization", "Bearer "+token)), req)
+			if codeOf(err) != tt.code {
+				t.Fatalf("ReleaseUserFiles() error = %v, want code %q", err, tt.code)
+			}
+			if err != nil {
+				return
+			}
+			if res.DeletedFiles != 1 || res.DeletedBytes != 3 || res.TransferredFiles != 1 {
+				t.Errorf("ReleaseUserFiles() = %+v, want 1 file of 3 bytes deleted and 1 transferred", res)
+			}
+			if _, err := os.Stat(filepath.Join(s.uploadDir, "personal")); !os.IsNotExist(err) {
+				t.Errorf("contents of the deleted file: %v, want them gone", err)
+			}
+			if f, err := m.GetFile(ctx, "shared"); err != nil || f.UserID != "2" {
+				t.Errorf("GetFile(shared) = %+v, %v, want it owned by user 2", f, err)
+			}
+		})
+	}
+}
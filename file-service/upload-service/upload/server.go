@@ -0,0 +1,231 @@
+// Package upload implements the FileUpload gRPC service.
+package upload
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/google/uuid"
+	"go.opentelemetry.io/otel/attribute"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"file-service/apperr"
+	"file-service/auth"
+	"file-service/config"
+	"file-service/logging"
+	"file-service/metrics"
+	pb "file-service/proto/upload"
+	"file-service/tracing"
+	"file-service/upload-service/store"
+)
+
+// logger logs the failures behind Internal errors, whose details callers do not see
+var logger = logging.For("upload")
+
+type server struct {
+	pb.UnimplementedFileUploadServer
+	uploadDir   string
+	store       store.FileStore
+	maxFileSize int64 // Server-wide upload limit in bytes, 0 for none
+	auth        *auth.Verifier
+}
+
+// NewServer returns the upload service, storing files in the configured
+// directory and their metadata in fileStore
+func NewServer(cfg *config.Config, fileStore store.FileStore) pb.FileUploadServer {
+	return &server{
+		uploadDir:   cfg.Storage.Dir,
+		store:       fileStore,
+		maxFileSize: int64(cfg.Storage.MaxFileSize),
+		auth:        auth.NewVerifier("upload", []byte(cfg.Auth.JWTSecret), fileStore),
+	}
+}
+
+func (s *server) UploadFile(stream pb.FileUpload_UploadFileServer) error {
+	// Get the caller from the JWT token
+	caller, err := s.auth.Authenticate(stream.Context())
+	if err != nil {
+		return err
+	}
+
+	// First message should contain metadata
+	req, err := stream.Recv()
+	if err != nil {
+		return status.Error(codes.InvalidArgument, "failed to receive metadata")
+	}
+
+	metadata := req.GetMetadata()
+	if metadata == nil {
+		return status.Error(codes.InvalidArgument, "first message must contain metadata")
+	}
+	if metadata.Size < 0 {
+		return status.Error(codes.InvalidArgument, "file size must not be negative")
+	}
+
+	// Files belong to the caller's organization, or to the folder's when
+	// uploading into a folder, which requires write access to it
+	orgID := caller.OrgID
+	if metadata.FolderId != "" {
+		access, err := s.getFolderAccess(stream.Context(), metadata.FolderId, caller)
+		if err != nil {
+			return err
+		}
+		if !canWrite(access) {
+			return apperr.New(codes.PermissionDenied, apperr.NoWriteAccess, "no write access to folder")
+		}
+		folder, err := s.store.GetFolder(stream.Context(), metadata.FolderId)
+		if err != nil {
+			return status.Error(codes.Internal, "failed to look up folder")
+		}
+		orgID = folder.OrgID
+	}
+
+	// Generate unique file ID
+	fileID := uuid.New().String()
+
+	// Reserve the declared size, rejecting it early if it breaks the user's
+	// or organization's limits; parallel uploads count each other's reservations
+	reservation, err := s.reserveStorage(stream.Context(), fileID, caller.UserID, orgID, metadata.Size)
+	defer reservation.release(stream.Context())
+	if err != nil {
+		return err
+	}
+	filePath := filepath.Join(s.uploadDir, fileID)
+
+	// Write to a staging file, removed unless the upload completes
+	stagingPath := filepath.Join(s.uploadDir, stagingDir, fileID)
+	defer stage(stagingPath)()
+	_, span := tracing.Start(stream.Context(), "storage.write")
+	totalSize, err := receiveFile(stream, stagingPath, filePath, metadata.Size, reservation)
+	span.SetAttributes(attribute.Int64("file.size", totalSize))
+	tracing.End(span, err)
+	if err != nil {
+		return err
+	}
+
+	// Save file metadata to database
+	err = s.store.CreateFile(stream.Context(), &store.File{
+		ID:          fileID,
+		Filename:    metadata.Filename,
+		ContentType: metadata.ContentType,
+		Size:        totalSize,
+		UserID:      caller.UserID,
+		OrgID:       orgID,
+		FolderID:    metadata.FolderId,
+		CreatedAt:   time.Now(),
+	})
+	if err != nil {
+		logger.ErrorContext(stream.Context(), "Failed to save file metadata to database", "error", err)
+		os.Remove(filePath)
+		return status.Error(codes.Internal, "failed to save file metadata")
+	}
+
+	// Send response
+	return stream.SendAndClose(&pb.UploadFileResponse{
+		FileId:    fileID,
+		Filename:  metadata.Filename,
+		Size:      totalSize,
+		CreatedAt: time.Now().Format(time.RFC3339),
+		UserId:    caller.UserID,
+		FolderId:  metadata.FolderId,
+		OrgId:     orgID,
+	})
+}
+
+// receiveFile writes the chunks on stream to stagingPath, growing the
+// reservation as needed and enforcing the declared size, and moves the
+// complete file to filePath. It returns the number of bytes received.
+func receiveFile(stream pb.FileUpload_UploadFileServer, stagingPath, filePath string, declared int64, reservation *reservation) (int64, error) {
+	file, err := os.Create(stagingPath)
+	if err != nil {
+		return 0, status.Error(codes.Internal, "failed to create file")
+	}
+	defer file.Close()
+
+	// Process file chunks
+	var totalSize int64
+	for {
+		req, err := stream.Recv()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return totalSize, status.Error(codes.Internal, "failed to receive chunk")
+		}
+
+		chunk := req.GetChunk()
+		if chunk == nil {
+			continue
+		}
+
+		metrics.ChunkSize.WithLabelValues(metrics.Upload).Observe(float64(len(chunk)))
+		metrics.TransferredBytes.WithLabelValues(metrics.Upload).Add(float64(len(chunk)))
+
+		// Enforce limits on the bytes actually received, not just the declared
+		// size, which is checked first so that excess never holds storage
+		totalSize += int64(len(chunk))
+		if declared > 0 && totalSize > declared {
+			return totalSize, apperr.New(codes.InvalidArgument, apperr.SizeMismatch, "received more bytes than declared")
+		}
+		if err := reservation.grow(stream.Context(), totalSize); err != nil {
+			return totalSize, err
+		}
+
+		_, err = file.Write(chunk)
+		if err != nil {
+			return totalSize, status.Error(codes.Internal, "failed to write chunk")
+		}
+	}
+
+	if declared > 0 && totalSize != declared {
+		return totalSize, apperr.New(codes.InvalidArgument, apperr.SizeMismatch, "received fewer bytes than declared")
+	}
+
+	// Move the complete file into place
+	if err := file.Close(); err != nil {
+		return totalSize, status.Error(codes.Internal, "failed to write file")
+	}
+	if err := os.Rename(stagingPath, filePath); err != nil {
+		logger.ErrorContext(stream.Context(), "Failed to move upload into place", "error", err)
+		return totalSize, status.Error(codes.Internal, "failed to store file")
+	}
+	return totalSize, nil
+}
+
+func (s *server) GetFileMetadata(ctx context.Context, req *pb.GetFileMetadataRequest) (*pb.FileMetadata, error) {
+	// Get the caller from the JWT token
+	caller, err := s.auth.Authenticate(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	// Members of the file's organization and grantees may read the metadata
+	if _, err := s.getFileAccess(ctx, req.FileId, caller); err != nil {
+		return nil, err
+	}
+
+	file, err := s.store.GetFile(ctx, req.FileId)
+	if errors.Is(err, store.ErrNotFound) {
+		return nil, apperr.New(codes.NotFound, apperr.FileNotFound, "file not found")
+	}
+	if err != nil {
+		logger.ErrorContext(ctx, "Failed to load file metadata", "error", err)
+		return nil, status.Error(codes.Internal, "failed to load file metadata")
+	}
+
+	return &pb.FileMetadata{
+		FileId:      file.ID,
+		Filename:    file.Filename,
+		ContentType: file.ContentType,
+		Size:        file.Size,
+		UserId:      file.UserID,
+		OrgId:       file.OrgID,
+		FolderId:    file.FolderID,
+		CreatedAt:   file.CreatedAt.Format(time.RFC3339),
+	}, nil
+}
@@ -0,0 +1,66 @@
+package upload
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// stagingDir holds uploads in progress under the upload directory; a file is
+// moved into place only once it is complete
+const stagingDir = ".staging"
+
+// staleAfter is how long a staging file may go unwritten before it is taken to
+// be left behind by a server that did not shut down cleanly
+const staleAfter = 24 * time.Hour
+
+// staged holds the staging files of uploads in progress, so that shutdown can
+// remove the ones it cuts off
+var staged sync.Map
+
+// stage records an upload's staging file and returns the func that removes it
+func stage(path string) func() {
+	staged.Store(path, struct{}{})
+	return func() {
+		os.Remove(path)
+		staged.Delete(path)
+	}
+}
+
+// RemoveStaged removes the staging files of uploads still in progress
+func RemoveStaged() {
+	staged.Range(func(path, _ interface{}) bool {
+		os.Remove(path.(string))
+		staged.Delete(path)
+		return true
+	})
+}
+
+// PrepareStaging creates the staging directory under uploadDir and removes stale
+// files from it. Fresh ones may belong to another server sharing the directory.
+func PrepareStaging(uploadDir string) error {
+	dir := filepath.Join(uploadDir, stagingDir)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		info, err := entry.Info()
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if time.Since(info.ModTime()) > staleAfter {
+			os.Remove(filepath.Join(dir, entry.Name()))
+		}
+	}
+	return nil
+}